@@ -0,0 +1,182 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+	"github.com/2beens/spotilizer/services"
+	"github.com/2beens/spotilizer/util"
+	"github.com/gorilla/mux"
+)
+
+// AudioFeaturesHandler serves average audio features of snapshot tracks over time, oldest snapshot first:
+//
+//	GET /api/audiofeatures/favtracks          - of favorite tracks snapshots
+//	GET /api/audiofeatures/playlists/{id}     - of the playlist, in playlists snapshots containing it
+type AudioFeaturesHandler struct {
+	srvUsers         *services.UserService
+	srvPlaylists     services.UserPlaylistService
+	srvAudioFeatures *services.AudioFeaturesService
+}
+
+func NewAudioFeaturesHandler(srvUsers *services.UserService, srvPlaylists services.UserPlaylistService, srvAudioFeatures *services.AudioFeaturesService) *AudioFeaturesHandler {
+	return &AudioFeaturesHandler{
+		srvUsers:         srvUsers,
+		srvPlaylists:     srvPlaylists,
+		srvAudioFeatures: srvAudioFeatures,
+	}
+}
+
+func (handler *AudioFeaturesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := handler.srvUsers.GetUserByRequestCookieID(r)
+	if err != nil {
+		log.Errorf(" >>> API audio features handler: user/cookie error: %s", err.Error())
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		util.SendAPIErrorResp(w, "unknown/unsupported request method", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Path == "/api/audiofeatures/favtracks" {
+		handler.getFavTracksAudioFeatures(user, w)
+	} else {
+		handler.getPlaylistAudioFeatures(user, w, r)
+	}
+}
+
+func (handler *AudioFeaturesHandler) getFavTracksAudioFeatures(user *models.User, w io.Writer) {
+	log.Debugf(" > get fav tracks audio features: username [%s]", user.Username)
+
+	snapshots := handler.srvPlaylists.GetAllFavTracksSnapshots(user.Username)
+	tracksBySnapshot := make([][]string, len(snapshots))
+	var allTrackIDs []string
+	for i, s := range snapshots {
+		for _, t := range s.Tracks {
+			tracksBySnapshot[i] = append(tracksBySnapshot[i], t.Track.ID)
+		}
+		allTrackIDs = append(allTrackIDs, tracksBySnapshot[i]...)
+	}
+
+	features, apiErr := handler.srvAudioFeatures.GetAudioFeatures(user.AccessToken(), allTrackIDs)
+	if apiErr != nil {
+		log.Infof(" >>> error while getting fav tracks audio features: %v", apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+
+	averages := []models.DTOAudioFeaturesAverage{}
+	for i, s := range snapshots {
+		averages = append(averages, averageAudioFeatures(s.Timestamp.Unix(), tracksBySnapshot[i], features))
+	}
+	sortAudioFeaturesAverages(averages)
+
+	util.SendAPIOKRespWithData(w, "success", averages)
+}
+
+func (handler *AudioFeaturesHandler) getPlaylistAudioFeatures(user *models.User, w io.Writer, r *http.Request) {
+	playlistID := mux.Vars(r)["id"]
+	log.Debugf(" > get playlist [%s] audio features: username [%s]", playlistID, user.Username)
+
+	var timestamps []int64
+	var tracksBySnapshot [][]string
+	var allTrackIDs []string
+	for _, s := range handler.srvPlaylists.GetAllPlaylistsSnapshots(user.Username) {
+		for _, pl := range s.Playlists {
+			if pl.Playlist.ID != playlistID {
+				continue
+			}
+			var trackIDs []string
+			for _, t := range pl.Tracks {
+				trackIDs = append(trackIDs, t.Track.ID)
+			}
+			timestamps = append(timestamps, s.Timestamp.Unix())
+			tracksBySnapshot = append(tracksBySnapshot, trackIDs)
+			allTrackIDs = append(allTrackIDs, trackIDs...)
+		}
+	}
+	if len(timestamps) == 0 {
+		util.SendAPIErrorResp(w, "Playlist not found in snapshots", http.StatusNotFound)
+		return
+	}
+
+	features, apiErr := handler.srvAudioFeatures.GetAudioFeatures(user.AccessToken(), allTrackIDs)
+	if apiErr != nil {
+		log.Infof(" >>> error while getting playlist audio features: %v", apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+
+	averages := []models.DTOAudioFeaturesAverage{}
+	for i, timestamp := range timestamps {
+		averages = append(averages, averageAudioFeatures(timestamp, tracksBySnapshot[i], features))
+	}
+	sortAudioFeaturesAverages(averages)
+
+	util.SendAPIOKRespWithData(w, "success", averages)
+}
+
+func averageAudioFeatures(timestamp int64, trackIDs []string, features map[string]models.SpAudioFeatures) models.DTOAudioFeaturesAverage {
+	average := models.DTOAudioFeaturesAverage{Timestamp: timestamp, TracksCount: len(trackIDs)}
+	for _, id := range trackIDs {
+		f, found := features[id]
+		if !found {
+			continue
+		}
+		average.AnalyzedCount++
+		average.Tempo += f.Tempo
+		average.Energy += f.Energy
+		average.Valence += f.Valence
+		average.Danceability += f.Danceability
+	}
+	if average.AnalyzedCount > 0 {
+		count := float64(average.AnalyzedCount)
+		average.Tempo /= count
+		average.Energy /= count
+		average.Valence /= count
+		average.Danceability /= count
+	}
+	return average
+}
+
+// snapshots are not stored in any particular order
+func sortAudioFeaturesAverages(averages []models.DTOAudioFeaturesAverage) {
+	sort.Slice(averages, func(i, j int) bool {
+		return averages[i].Timestamp < averages[j].Timestamp
+	})
+}
+
+// audioFeaturesRequested tells if audio features of tracks should be included in the response, requested by
+// audio_features=true query param
+func audioFeaturesRequested(r *http.Request) bool {
+	return r.URL.Query().Get("audio_features") == "true"
+}
+
+// addAudioFeatures sets audio features of given tracks, where known. Tracks of all the given lists (e.g. of all
+// playlists in a snapshot) are looked up at once, so they are downloaded in as few batches as possible.
+func addAudioFeatures(srvAudioFeatures *services.AudioFeaturesService, accessToken string, trackLists ...[]models.DTOTrack) *models.SpAPIError {
+	var trackIDs []string
+	for _, tracks := range trackLists {
+		for _, t := range tracks {
+			trackIDs = append(trackIDs, t.ID)
+		}
+	}
+	features, apiErr := srvAudioFeatures.GetAudioFeatures(accessToken, trackIDs)
+	if apiErr != nil {
+		return apiErr
+	}
+	for _, tracks := range trackLists {
+		for i := range tracks {
+			if f, found := features[tracks[i].ID]; found {
+				tracks[i].AudioFeatures = models.SpAudioFeatures2dtoAudioFeatures(f)
+			}
+		}
+	}
+	return nil
+}
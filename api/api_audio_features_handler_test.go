@@ -0,0 +1,31 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+func TestAverageAudioFeatures(t *testing.T) {
+	features := map[string]models.SpAudioFeatures{
+		"t1": {ID: "t1", Tempo: 100, Energy: 0.2, Valence: 0.1, Danceability: 0.5},
+		"t2": {ID: "t2", Tempo: 140, Energy: 0.6, Valence: 0.3, Danceability: 0.7},
+	}
+
+	// tracks without audio features are not taken into account
+	average := averageAudioFeatures(1500000000, []string{"t1", "t2", "local"}, features)
+	assert.Equal(t, int64(1500000000), average.Timestamp)
+	assert.Equal(t, 3, average.TracksCount)
+	assert.Equal(t, 2, average.AnalyzedCount)
+	assert.InDelta(t, 120, average.Tempo, 0.0001)
+	assert.InDelta(t, 0.4, average.Energy, 0.0001)
+	assert.InDelta(t, 0.2, average.Valence, 0.0001)
+	assert.InDelta(t, 0.6, average.Danceability, 0.0001)
+
+	average = averageAudioFeatures(1500000000, []string{"local"}, features)
+	assert.Equal(t, 1, average.TracksCount)
+	assert.Equal(t, 0, average.AnalyzedCount)
+	assert.Equal(t, float64(0), average.Energy)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+	"github.com/2beens/spotilizer/services"
+	"github.com/2beens/spotilizer/util"
+)
+
+type AuthStatusHandler struct {
+	srvUsers *services.UserService
+}
+
+func NewAuthStatusHandler(srvUsers *services.UserService) *AuthStatusHandler {
+	return &AuthStatusHandler{
+		srvUsers: srvUsers,
+	}
+}
+
+func (handler *AuthStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := handler.srvUsers.GetUserByRequestCookieID(r)
+	if err != nil {
+		log.Errorf(" >>> API auth status handler: user/cookie error: %s", err.Error())
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		util.SendAPIErrorResp(w, "unknown/unsupported request method", http.StatusBadRequest)
+		return
+	}
+
+	authStatus := models.DTOAuthStatus{
+		Username:        user.Username,
+		ReloginRequired: user.ReloginRequired(),
+	}
+	if auth := user.CurrentAuth(); auth != nil {
+		if !auth.ExpiresAt.IsZero() {
+			authStatus.ExpiresAt = auth.ExpiresAt.Unix()
+		}
+		authStatus.GrantedScopes = auth.GrantedScopes()
+	}
+
+	util.SendAPIOKRespWithData(w, "success", authStatus)
+}
@@ -14,14 +14,18 @@ import (
 )
 
 type FavTracksHandler struct {
-	srvUsers     *services.UserService
-	srvPlaylists services.UserPlaylistService
+	srvUsers         *services.UserService
+	srvPlaylists     services.UserPlaylistService
+	srvAudioFeatures *services.AudioFeaturesService
+	srvArtists       *services.ArtistsService
 }
 
-func NewFavTracksHandler(srvUsers *services.UserService, srvPlaylists services.UserPlaylistService) *FavTracksHandler {
+func NewFavTracksHandler(srvUsers *services.UserService, srvPlaylists services.UserPlaylistService, srvAudioFeatures *services.AudioFeaturesService, srvArtists *services.ArtistsService) *FavTracksHandler {
 	return &FavTracksHandler{
-		srvUsers:     srvUsers,
-		srvPlaylists: srvPlaylists,
+		srvUsers:         srvUsers,
+		srvPlaylists:     srvPlaylists,
+		srvAudioFeatures: srvAudioFeatures,
+		srvArtists:       srvArtists,
 	}
 }
 
@@ -35,15 +39,20 @@ func (handler *FavTracksHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 
 	switch r.Method {
 	case "GET":
+		fullTracks, err := fullTracksRequested(r)
+		if err != nil {
+			util.SendAPIErrorResp(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		switch {
 		case r.URL.Path == "/api/ssfavtracks":
-			handler.getFavTracksSnapshots(user.Username, false, w)
+			handler.getFavTracksSnapshots(user.Username, false, fullTracks, w)
 		case r.URL.Path == "/api/ssfavtracks/full":
-			handler.getFavTracksSnapshots(user.Username, true, w)
+			handler.getFavTracksSnapshots(user.Username, true, fullTracks, w)
 		case strings.HasPrefix(r.URL.Path, "/api/ssfavtracks/diff/"):
-			handler.getFavTracksDiff(user, w, r)
+			handler.getFavTracksDiff(user, fullTracks, w, r)
 		case strings.HasPrefix(r.URL.Path, "/api/ssfavtracks/"):
-			handler.getFavTracksSnapshot(user.Username, w, r)
+			handler.getFavTracksSnapshot(user, fullTracks, w, r)
 		default:
 			util.SendAPIErrorResp(w, "unknown path", http.StatusBadRequest)
 		}
@@ -54,7 +63,7 @@ func (handler *FavTracksHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-func (handler *FavTracksHandler) getFavTracksDiff(user *models.User, w io.Writer, r *http.Request) {
+func (handler *FavTracksHandler) getFavTracksDiff(user *models.User, fullTracks bool, w io.Writer, r *http.Request) {
 	vars := mux.Vars(r)
 	timestamp := vars["timestamp"]
 	log.Debugf(" > get fav tracks diff for snapshot [%s]: username [%s]", timestamp, user.Username)
@@ -72,7 +81,7 @@ func (handler *FavTracksHandler) getFavTracksDiff(user *models.User, w io.Writer
 	}
 
 	// now get the current fav tracks, and make a diff relative to "snapshot" object
-	currentTracks, apiErr := handler.srvPlaylists.DownloadSavedFavTracks(user.Auth.AccessToken)
+	currentTracks, apiErr := handler.srvPlaylists.DownloadSavedFavTracks(user.AccessToken())
 	if apiErr != nil {
 		log.Infof(" >>> error while getting current tracks diff: %v", apiErr)
 		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
@@ -82,17 +91,19 @@ func (handler *FavTracksHandler) getFavTracksDiff(user *models.User, w io.Writer
 	var newTracks []models.DTOTrack
 	var removedTracks []models.DTOTrack
 	for _, t := range currentTracks {
-		if !containsTrack(t, snapshot.Tracks) {
+		if !models.ContainsAddedTrack(t, snapshot.Tracks) {
 			newTracks = append(newTracks, models.SpAddedTrack2dtoTrack(t))
 		}
 	}
 	for _, t := range snapshot.Tracks {
-		if !containsTrack(t, currentTracks) {
+		if !models.ContainsAddedTrack(t, currentTracks) {
 			removedTracks = append(removedTracks, models.SpAddedTrack2dtoTrack(t))
 		}
 	}
 
 	log.Debugf(" > fav tracks [%s] diff. found [%d] new tracks and [%d] removed tracks", timestamp, len(newTracks), len(removedTracks))
+	projectTracks(newTracks, fullTracks)
+	projectTracks(removedTracks, fullTracks)
 
 	util.SendAPIOKRespWithData(w, "success", struct {
 		NewTracks     []models.DTOTrack `json:"newTracks"`
@@ -103,25 +114,12 @@ func (handler *FavTracksHandler) getFavTracksDiff(user *models.User, w io.Writer
 	})
 }
 
-func containsTrack(track models.SpAddedTrack, tracks []models.SpAddedTrack) bool {
-	for _, t := range tracks {
-		if track.Track.Album.ID != t.Track.Album.ID {
-			continue
-		}
-		if track.Track.ID != t.Track.ID {
-			continue
-		}
-		return true
-	}
-	return false
-}
-
-func (handler *FavTracksHandler) getFavTracksSnapshot(username string, w io.Writer, r *http.Request) {
+func (handler *FavTracksHandler) getFavTracksSnapshot(user *models.User, fullTracks bool, w io.Writer, r *http.Request) {
 	vars := mux.Vars(r)
 	timestamp := vars["timestamp"]
-	log.Debugf(" > get fav tracks snapshot [%s]: username [%s]", timestamp, username)
+	log.Debugf(" > get fav tracks snapshot [%s]: username [%s]", timestamp, user.Username)
 
-	snapshot, err := handler.srvPlaylists.GetFavTracksSnapshotByTimestamp(username, timestamp)
+	snapshot, err := handler.srvPlaylists.GetFavTracksSnapshotByTimestamp(user.Username, timestamp)
 	if err != nil {
 		log.Errorf(" >>> error while trying to get fav. tracks snapshot: %s", err.Error())
 		util.SendAPIErrorResp(w, "Error occurred: "+err.Error(), http.StatusNotFound)
@@ -142,11 +140,27 @@ func (handler *FavTracksHandler) getFavTracksSnapshot(username string, w io.Writ
 	for _, trRaw := range snapshot.Tracks {
 		snapshotDto.Tracks = append(snapshotDto.Tracks, models.SpAddedTrack2dtoTrack(trRaw))
 	}
+	projectTracks(snapshotDto.Tracks, fullTracks)
+
+	if audioFeaturesRequested(r) {
+		if apiErr := addAudioFeatures(handler.srvAudioFeatures, user.AccessToken(), snapshotDto.Tracks); apiErr != nil {
+			log.Infof(" >>> error while getting fav tracks audio features: %v", apiErr)
+			util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+			return
+		}
+	}
+	if genresRequested(r) {
+		if apiErr := addArtistGenres(handler.srvArtists, user.AccessToken(), snapshotDto.Tracks); apiErr != nil {
+			log.Infof(" >>> error while getting fav tracks artist genres: %v", apiErr)
+			util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+			return
+		}
+	}
 
 	util.SendAPIOKRespWithData(w, "success", snapshotDto)
 }
 
-func (handler *FavTracksHandler) getFavTracksSnapshots(username string, loadAllData bool, w io.Writer) {
+func (handler *FavTracksHandler) getFavTracksSnapshots(username string, loadAllData bool, fullTracks bool, w io.Writer) {
 	log.WithFields(log.Fields{
 		"loadAllData": loadAllData,
 	}).Debugf(" > get fav tracks snapshots: username [%s]", username)
@@ -163,6 +177,7 @@ func (handler *FavTracksHandler) getFavTracksSnapshots(username string, loadAllD
 			for _, trRaw := range tracksssRaw.Tracks {
 				tracksss.Tracks = append(tracksss.Tracks, models.SpAddedTrack2dtoTrack(trRaw))
 			}
+			projectTracks(tracksss.Tracks, fullTracks)
 		}
 		sstracks = append(sstracks, tracksss)
 	}
@@ -47,7 +47,7 @@ func (suite *FavTracksTestSuite) SetupSuite() {
 	testUserSrv.AddUserCookie("cookietu1", suite.testUser.Username)
 	userPlaylistSrv := services.NewUserPlaylistTestService(suite.allTracks, suite.snapshots)
 
-	suite.handler = NewFavTracksHandler(testUserSrv, userPlaylistSrv)
+	suite.handler = NewFavTracksHandler(testUserSrv, userPlaylistSrv, nil, nil)
 }
 
 func (suite *FavTracksTestSuite) TestGetAllFavTracksSnapshotsCounts() {
@@ -138,6 +138,38 @@ func (suite *FavTracksTestSuite) TestGetFavTracksSnapshotByTimestamp() {
 	suite.Equal(orgSnapshot.Tracks[1].Track.Artists[0].Name, recSnapshot.Tracks[1].Artists[0].Name)
 }
 
+func (suite *FavTracksTestSuite) TestGetFavTracksSnapshotProjections() {
+	orgSnapshot := suite.snapshots[0]
+	getSnapshot := func(path string) *httptest.ResponseRecorder {
+		req := suite.getRequest(path)
+		req = mux.SetURLVars(req, map[string]string{"timestamp": strconv.FormatInt(orgSnapshot.Timestamp.Unix(), 10)})
+		req.AddCookie(suite.cookie)
+		resp := httptest.NewRecorder()
+		suite.handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// compact projection is the default one
+	for _, path := range []string{"/api/ssfavtracks/{timestamp}", "/api/ssfavtracks/{timestamp}?projection=compact"} {
+		apiResp := suite.checkFavTracksSnapshotAPIResponse(getSnapshot(path).Body.Bytes())
+		suite.Nil(apiResp.Snapshot.Tracks[0].Details, path)
+	}
+
+	apiResp := suite.checkFavTracksSnapshotAPIResponse(getSnapshot("/api/ssfavtracks/{timestamp}?projection=full").Body.Bytes())
+	if suite.NotNil(apiResp.Snapshot.Tracks[0].Details) {
+		suite.True(apiResp.Snapshot.Tracks[0].Details.Explicit)
+		suite.Equal(orgSnapshot.Tracks[0].Track.Album.ID, apiResp.Snapshot.Tracks[0].Details.Album.ID)
+	}
+	if suite.NotNil(apiResp.Snapshot.Tracks[1].Details) {
+		suite.False(apiResp.Snapshot.Tracks[1].Details.Explicit)
+		suite.Equal(orgSnapshot.Tracks[1].Track.Album.ID, apiResp.Snapshot.Tracks[1].Details.Album.ID)
+	}
+
+	errResp := &models.SpAPIError{}
+	suite.Require().NoError(json.Unmarshal(getSnapshot("/api/ssfavtracks/{timestamp}?projection=huge").Body.Bytes(), errResp))
+	suite.Equal(http.StatusBadRequest, errResp.Error.Status)
+}
+
 func (suite *FavTracksTestSuite) TestFavTracksSnapshotDiff() {
 	relSnapshot := suite.snapshots[0]
 	req := suite.getRequest("/api/ssfavtracks/diff/{timestamp}")
@@ -345,10 +377,11 @@ type track struct {
 		Type string `json:"type"`
 		Href string `json:"href"`
 	} `json:"artists"`
-	Album       string `json:"album"`
-	URI         string `json:"uri"`
-	ID          string `json:"id"`
-	TrackNumber int    `json:"track_number"`
-	DurationMs  int    `json:"duration_ms"`
-	Name        string `json:"name"`
+	Album       string                  `json:"album"`
+	URI         string                  `json:"uri"`
+	ID          string                  `json:"id"`
+	TrackNumber int                     `json:"track_number"`
+	DurationMs  int                     `json:"duration_ms"`
+	Name        string                  `json:"name"`
+	Details     *models.DTOTrackDetails `json:"details"`
 }
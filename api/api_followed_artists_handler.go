@@ -0,0 +1,79 @@
+package api
+
+import (
+	"time"
+
+	"github.com/2beens/spotilizer/models"
+	"github.com/2beens/spotilizer/services"
+)
+
+// NewFollowedArtistsHandler creates the handler of followed artists snapshots API
+func NewFollowedArtistsHandler(srvUsers *services.UserService, srvPlaylists services.UserPlaylistService) *LibrarySnapshotsHandler {
+	return &LibrarySnapshotsHandler{
+		srvUsers: srvUsers,
+		prefix:   "/api/ssartists",
+		source:   followedArtistsSource{srvPlaylists: srvPlaylists},
+	}
+}
+
+type followedArtistsSource struct {
+	srvPlaylists services.UserPlaylistService
+}
+
+func (s followedArtistsSource) name() string {
+	return "followed artists"
+}
+
+func (s followedArtistsSource) getAll(username string) []librarySnapshot {
+	var snapshots []librarySnapshot
+	for _, snapshot := range s.srvPlaylists.GetAllFollowedArtistsSnapshots(username) {
+		snapshots = append(snapshots, librarySnapshot{timestamp: snapshot.Timestamp, items: artists2items(snapshot.Artists)})
+	}
+	return snapshots
+}
+
+func (s followedArtistsSource) get(username string, timestamp string) (*librarySnapshot, error) {
+	snapshot, err := s.srvPlaylists.GetFollowedArtistsSnapshotByTimestamp(username, timestamp)
+	if err != nil || snapshot == nil {
+		return nil, err
+	}
+	return &librarySnapshot{timestamp: snapshot.Timestamp, items: artists2items(snapshot.Artists)}, nil
+}
+
+func (s followedArtistsSource) remove(username string, timestamp string) (*librarySnapshot, error) {
+	snapshot, err := s.srvPlaylists.DeleteFollowedArtistsSnapshot(username, timestamp)
+	if err != nil || snapshot == nil {
+		return nil, err
+	}
+	return &librarySnapshot{timestamp: snapshot.Timestamp}, nil
+}
+
+func (s followedArtistsSource) downloadCurrent(accessToken string) ([]libraryItem, *models.SpAPIError) {
+	artists, apiErr := s.srvPlaylists.DownloadFollowedArtists(accessToken)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return artists2items(artists), nil
+}
+
+func (s followedArtistsSource) snapshotDTO(timestamp time.Time, items []libraryItem, withItems bool) interface{} {
+	snapshotDto := models.DTOFollowedArtistsSnapshot{
+		Timestamp:    timestamp.Unix(),
+		ArtistsCount: len(items),
+		Artists:      []models.DTOArtist{},
+	}
+	if withItems {
+		for _, item := range items {
+			snapshotDto.Artists = append(snapshotDto.Artists, item.dto.(models.DTOArtist))
+		}
+	}
+	return snapshotDto
+}
+
+func artists2items(artists []models.SpFullArtist) []libraryItem {
+	var items []libraryItem
+	for _, a := range artists {
+		items = append(items, libraryItem{id: a.ID, dto: models.SpFullArtist2dtoArtist(a)})
+	}
+	return items
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+	"github.com/2beens/spotilizer/services"
+	"github.com/2beens/spotilizer/util"
+	"github.com/gorilla/mux"
+)
+
+// GenresHandler serves genre breakdowns of snapshot tracks, genres being the genres of track's artists:
+//
+//	GET /api/genres/favtracks/{timestamp}           - of the favorite tracks snapshot
+//	GET /api/genres/playlists/{timestamp}/{id}      - of the playlist in the playlists snapshot
+type GenresHandler struct {
+	srvUsers     *services.UserService
+	srvPlaylists services.UserPlaylistService
+	srvArtists   *services.ArtistsService
+}
+
+func NewGenresHandler(srvUsers *services.UserService, srvPlaylists services.UserPlaylistService, srvArtists *services.ArtistsService) *GenresHandler {
+	return &GenresHandler{
+		srvUsers:     srvUsers,
+		srvPlaylists: srvPlaylists,
+		srvArtists:   srvArtists,
+	}
+}
+
+func (handler *GenresHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := handler.srvUsers.GetUserByRequestCookieID(r)
+	if err != nil {
+		log.Errorf(" >>> API genres handler: user/cookie error: %s", err.Error())
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		util.SendAPIErrorResp(w, "unknown/unsupported request method", http.StatusBadRequest)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/api/genres/favtracks/") {
+		handler.getFavTracksGenres(user, w, r)
+	} else {
+		handler.getPlaylistGenres(user, w, r)
+	}
+}
+
+func (handler *GenresHandler) getFavTracksGenres(user *models.User, w io.Writer, r *http.Request) {
+	timestamp := mux.Vars(r)["timestamp"]
+	log.Debugf(" > get fav tracks snapshot [%s] genres: username [%s]", timestamp, user.Username)
+
+	snapshot, err := handler.srvPlaylists.GetFavTracksSnapshotByTimestamp(user.Username, timestamp)
+	if err != nil || snapshot == nil {
+		util.SendAPIErrorResp(w, "Favorite tracks snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	var tracks []models.SpTrack
+	for _, t := range snapshot.Tracks {
+		tracks = append(tracks, t.Track)
+	}
+	handler.sendGenreBreakdown(user, snapshot.Timestamp.Unix(), tracks, w)
+}
+
+func (handler *GenresHandler) getPlaylistGenres(user *models.User, w io.Writer, r *http.Request) {
+	vars := mux.Vars(r)
+	timestamp, playlistID := vars["timestamp"], vars["id"]
+	log.Debugf(" > get playlist [%s] genres in snapshot [%s]: username [%s]", playlistID, timestamp, user.Username)
+
+	snapshot, err := handler.srvPlaylists.GetPlaylistsSnapshotByTimestamp(user.Username, timestamp)
+	if err != nil || snapshot == nil {
+		util.SendAPIErrorResp(w, "Playlists snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	for _, pl := range snapshot.Playlists {
+		if pl.Playlist.ID != playlistID {
+			continue
+		}
+		var tracks []models.SpTrack
+		for _, t := range pl.Tracks {
+			tracks = append(tracks, t.Track)
+		}
+		handler.sendGenreBreakdown(user, snapshot.Timestamp.Unix(), tracks, w)
+		return
+	}
+	util.SendAPIErrorResp(w, "Playlist not found in snapshot", http.StatusNotFound)
+}
+
+func (handler *GenresHandler) sendGenreBreakdown(user *models.User, timestamp int64, tracks []models.SpTrack, w io.Writer) {
+	var artistIDs []string
+	for _, t := range tracks {
+		for _, a := range t.Artists {
+			artistIDs = append(artistIDs, a.ID)
+		}
+	}
+
+	artists, apiErr := handler.srvArtists.GetArtists(user.AccessToken(), artistIDs)
+	if apiErr != nil {
+		log.Infof(" >>> error while getting artists for genre breakdown: %v", apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+
+	util.SendAPIOKRespWithData(w, "success", genreBreakdown(timestamp, tracks, artists))
+}
+
+func genreBreakdown(timestamp int64, tracks []models.SpTrack, artists map[string]models.SpFullArtist) models.DTOGenreBreakdown {
+	breakdown := models.DTOGenreBreakdown{
+		Timestamp:   timestamp,
+		TracksCount: len(tracks),
+		Genres:      []models.DTOGenreCount{},
+	}
+
+	genreTracks := make(map[string]int)
+	for _, t := range tracks {
+		// a track is counted once per genre, even when more of its artists share the genre
+		trackGenres := make(map[string]bool)
+		for _, a := range t.Artists {
+			for _, g := range artists[a.ID].Genres {
+				trackGenres[g] = true
+			}
+		}
+		if len(trackGenres) == 0 {
+			breakdown.UnknownGenreTracks++
+		}
+		for g := range trackGenres {
+			genreTracks[g]++
+		}
+	}
+
+	for g, count := range genreTracks {
+		breakdown.Genres = append(breakdown.Genres, models.DTOGenreCount{Genre: g, TracksCount: count})
+	}
+	sort.Slice(breakdown.Genres, func(i, j int) bool {
+		if breakdown.Genres[i].TracksCount != breakdown.Genres[j].TracksCount {
+			return breakdown.Genres[i].TracksCount > breakdown.Genres[j].TracksCount
+		}
+		return breakdown.Genres[i].Genre < breakdown.Genres[j].Genre
+	})
+	return breakdown
+}
+
+// genresRequested tells if genres of track artists should be included in the response, requested by genres=true
+// query param
+func genresRequested(r *http.Request) bool {
+	return r.URL.Query().Get("genres") == "true"
+}
+
+// addArtistGenres sets genres of the artists of given tracks, where known. Artists of all the given track lists are
+// looked up at once, so they are downloaded in as few batches as possible.
+func addArtistGenres(srvArtists *services.ArtistsService, accessToken string, trackLists ...[]models.DTOTrack) *models.SpAPIError {
+	var artistIDs []string
+	for _, tracks := range trackLists {
+		for _, t := range tracks {
+			for _, a := range t.Artists {
+				artistIDs = append(artistIDs, a.ID)
+			}
+		}
+	}
+	artists, apiErr := srvArtists.GetArtists(accessToken, artistIDs)
+	if apiErr != nil {
+		return apiErr
+	}
+	for _, tracks := range trackLists {
+		for i := range tracks {
+			for j := range tracks[i].Artists {
+				tracks[i].Artists[j].Genres = artists[tracks[i].Artists[j].ID].Genres
+			}
+		}
+	}
+	return nil
+}
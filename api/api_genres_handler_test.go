@@ -0,0 +1,37 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+func TestGenreBreakdown(t *testing.T) {
+	artist := func(id string) models.SpArtist {
+		return models.SpArtist{ID: id}
+	}
+	artists := map[string]models.SpFullArtist{
+		"a1": {SpArtist: artist("a1"), Genres: []string{"rock", "indie rock"}},
+		"a2": {SpArtist: artist("a2"), Genres: []string{"rock", "blues"}},
+		"a3": {SpArtist: artist("a3"), Genres: []string{}},
+	}
+	tracks := []models.SpTrack{
+		{ID: "t1", Artists: []models.SpArtist{artist("a1")}},
+		// rock counted once, though both artists play it
+		{ID: "t2", Artists: []models.SpArtist{artist("a1"), artist("a2")}},
+		{ID: "t3", Artists: []models.SpArtist{artist("a3")}},
+		{ID: "t4", Artists: []models.SpArtist{artist("not-found")}},
+	}
+
+	breakdown := genreBreakdown(1500000000, tracks, artists)
+	assert.Equal(t, int64(1500000000), breakdown.Timestamp)
+	assert.Equal(t, 4, breakdown.TracksCount)
+	assert.Equal(t, 2, breakdown.UnknownGenreTracks)
+	assert.Equal(t, []models.DTOGenreCount{
+		{Genre: "indie rock", TracksCount: 2},
+		{Genre: "rock", TracksCount: 2},
+		{Genre: "blues", TracksCount: 1},
+	}, breakdown.Genres)
+}
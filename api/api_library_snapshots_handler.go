@@ -0,0 +1,201 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/2beens/spotilizer/models"
+	"github.com/2beens/spotilizer/services"
+	"github.com/2beens/spotilizer/util"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// libraryItem is a single item of a library snapshot (an artist, an album, ...), with its DTO representation
+type libraryItem struct {
+	id  string
+	dto interface{}
+}
+
+type librarySnapshot struct {
+	timestamp time.Time
+	items     []libraryItem
+}
+
+// librarySnapshotsSource gives access to snapshots of a single part of user's library, e.g. followed artists
+type librarySnapshotsSource interface {
+	// name is used in logs and error messages
+	name() string
+	getAll(username string) []librarySnapshot
+	get(username string, timestamp string) (*librarySnapshot, error)
+	remove(username string, timestamp string) (*librarySnapshot, error)
+	downloadCurrent(accessToken string) ([]libraryItem, *models.SpAPIError)
+	snapshotDTO(timestamp time.Time, items []libraryItem, withItems bool) interface{}
+}
+
+// LibrarySnapshotsHandler serves snapshots of a part of user's library, with the same API shape as fav. tracks snapshots:
+//
+//	GET <prefix>                   - all snapshots, without items
+//	GET <prefix>/full              - all snapshots, with items
+//	GET <prefix>/{timestamp}       - single snapshot
+//	GET <prefix>/diff/{timestamp}  - diff of the snapshot against the current library
+//	GET <prefix>/diff/{timestamp}/{other} - diff of the snapshot against the other snapshot
+//	DELETE <prefix>/{timestamp}    - delete the snapshot
+type LibrarySnapshotsHandler struct {
+	srvUsers *services.UserService
+	prefix   string
+	source   librarySnapshotsSource
+}
+
+func (handler *LibrarySnapshotsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := handler.srvUsers.GetUserByRequestCookieID(r)
+	if err != nil {
+		log.Errorf(" >>> API %s handler: user/cookie error: %s", handler.source.name(), err.Error())
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		switch {
+		case r.URL.Path == handler.prefix:
+			handler.getSnapshots(user.Username, false, w)
+		case r.URL.Path == handler.prefix+"/full":
+			handler.getSnapshots(user.Username, true, w)
+		case strings.HasPrefix(r.URL.Path, handler.prefix+"/diff/"):
+			handler.getDiff(user, w, r)
+		case strings.HasPrefix(r.URL.Path, handler.prefix+"/"):
+			handler.getSnapshot(user.Username, w, r)
+		default:
+			util.SendAPIErrorResp(w, "unknown path", http.StatusBadRequest)
+		}
+	case "DELETE":
+		handler.deleteSnapshot(user.Username, w, r)
+	default:
+		util.SendAPIErrorResp(w, "unknown/unsupported request method", http.StatusBadRequest)
+	}
+}
+
+func (handler *LibrarySnapshotsHandler) getSnapshots(username string, loadAllData bool, w io.Writer) {
+	log.WithFields(log.Fields{
+		"loadAllData": loadAllData,
+	}).Debugf(" > get %s snapshots: username [%s]", handler.source.name(), username)
+
+	snapshots := []interface{}{}
+	for _, s := range handler.source.getAll(username) {
+		snapshots = append(snapshots, handler.source.snapshotDTO(s.timestamp, s.items, loadAllData))
+	}
+
+	util.SendAPIOKRespWithData(w, "success", snapshots)
+}
+
+func (handler *LibrarySnapshotsHandler) getSnapshot(username string, w io.Writer, r *http.Request) {
+	timestamp := mux.Vars(r)["timestamp"]
+	log.Debugf(" > get %s snapshot [%s]: username [%s]", handler.source.name(), timestamp, username)
+
+	snapshot, found := handler.findSnapshot(username, timestamp, w)
+	if !found {
+		return
+	}
+
+	util.SendAPIOKRespWithData(w, "success", handler.source.snapshotDTO(snapshot.timestamp, snapshot.items, true))
+}
+
+func (handler *LibrarySnapshotsHandler) getDiff(user *models.User, w io.Writer, r *http.Request) {
+	timestamp := mux.Vars(r)["timestamp"]
+	log.Debugf(" > get %s diff for snapshot [%s]: username [%s]", handler.source.name(), timestamp, user.Username)
+
+	snapshot, found := handler.findSnapshot(user.Username, timestamp, w)
+	if !found {
+		return
+	}
+
+	var currentItems []libraryItem
+	if otherTimestamp, ok := mux.Vars(r)["other"]; ok {
+		other, found := handler.findSnapshot(user.Username, otherTimestamp, w)
+		if !found {
+			return
+		}
+		currentItems = other.items
+	} else {
+		// now get the current library items, and make a diff relative to "snapshot" object
+		var apiErr *models.SpAPIError
+		currentItems, apiErr = handler.source.downloadCurrent(user.AccessToken())
+		if apiErr != nil {
+			log.Infof(" >>> error while getting current %s diff: %v", handler.source.name(), apiErr)
+			util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+			return
+		}
+	}
+
+	newItems, removedItems := diffLibraryItems(snapshot.items, currentItems)
+	log.Debugf(" > %s [%s] diff. found [%d] new and [%d] removed items", handler.source.name(), timestamp, len(newItems), len(removedItems))
+
+	util.SendAPIOKRespWithData(w, "success", struct {
+		NewItems     []interface{} `json:"newItems"`
+		RemovedItems []interface{} `json:"removedItems"`
+	}{
+		newItems,
+		removedItems,
+	})
+}
+
+func (handler *LibrarySnapshotsHandler) deleteSnapshot(username string, w io.Writer, r *http.Request) {
+	timestamp := mux.Vars(r)["timestamp"]
+	log.Debugf(" > delete %s snapshot [%s]: username [%s]", handler.source.name(), timestamp, username)
+
+	snapshot, err := handler.source.remove(username, timestamp)
+	if err != nil {
+		log.Errorf(" >>> error while trying to delete %s snapshot: %s", handler.source.name(), err.Error())
+		util.SendAPIErrorResp(w, "Error occurred: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if snapshot == nil {
+		log.Errorf(" >>> error while trying to delete %s snapshot: snapshot is nil", handler.source.name())
+		util.SendAPIErrorResp(w, fmt.Sprintf("Snapshot of %s not deleted: not found", handler.source.name()), http.StatusNotFound)
+		return
+	}
+
+	util.SendAPIOKResp(w, fmt.Sprintf("Snapshot of %s [%s] successfully deleted.", handler.source.name(), snapshot.timestamp))
+}
+
+func (handler *LibrarySnapshotsHandler) findSnapshot(username string, timestamp string, w io.Writer) (*librarySnapshot, bool) {
+	snapshot, err := handler.source.get(username, timestamp)
+	if err != nil {
+		log.Errorf(" >>> error while trying to get %s snapshot: %s", handler.source.name(), err.Error())
+		util.SendAPIErrorResp(w, "Error occurred: "+err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if snapshot == nil {
+		log.Errorf(" >>> error while trying to get %s snapshot: snapshot is nil", handler.source.name())
+		util.SendAPIErrorResp(w, fmt.Sprintf("Snapshot of %s not found", handler.source.name()), http.StatusNotFound)
+		return nil, false
+	}
+	return snapshot, true
+}
+
+// diffLibraryItems finds the items of current not found in previous (new ones), and the other way around (removed ones)
+func diffLibraryItems(previous []libraryItem, current []libraryItem) (newItems []interface{}, removedItems []interface{}) {
+	newItems = []interface{}{}
+	removedItems = []interface{}{}
+	previousIDs := make(map[string]bool)
+	for _, item := range previous {
+		previousIDs[item.id] = true
+	}
+	currentIDs := make(map[string]bool)
+	for _, item := range current {
+		currentIDs[item.id] = true
+		if !previousIDs[item.id] {
+			newItems = append(newItems, item.dto)
+		}
+	}
+	for _, item := range previous {
+		if !currentIDs[item.id] {
+			removedItems = append(removedItems, item.dto)
+		}
+	}
+	return newItems, removedItems
+}
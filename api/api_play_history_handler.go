@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+	"github.com/2beens/spotilizer/services"
+	"github.com/2beens/spotilizer/util"
+)
+
+// PlayHistoryHandler serves user's play history, filtered by query params (all optional):
+//
+//	from, to - time range, as unix timestamps
+//	track    - Spotify track ID
+//	artist   - Spotify artist ID
+type PlayHistoryHandler struct {
+	srvUsers       *services.UserService
+	srvPlayHistory *services.PlayHistoryService
+}
+
+func NewPlayHistoryHandler(srvUsers *services.UserService, srvPlayHistory *services.PlayHistoryService) *PlayHistoryHandler {
+	return &PlayHistoryHandler{
+		srvUsers:       srvUsers,
+		srvPlayHistory: srvPlayHistory,
+	}
+}
+
+func (handler *PlayHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := handler.srvUsers.GetUserByRequestCookieID(r)
+	if err != nil {
+		log.Errorf(" >>> API play history handler: user/cookie error: %s", err.Error())
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		util.SendAPIErrorResp(w, "unknown/unsupported request method", http.StatusBadRequest)
+		return
+	}
+
+	fullTracks, err := fullTracksRequested(r)
+	if err != nil {
+		util.SendAPIErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	query := services.PlayHistoryQuery{
+		From:     time.Unix(0, 0),
+		To:       time.Now(),
+		TrackID:  q.Get("track"),
+		ArtistID: q.Get("artist"),
+	}
+	if from := q.Get("from"); len(from) > 0 {
+		if query.From, err = parseUnixTimestamp(from); err != nil {
+			util.SendAPIErrorResp(w, "invalid from timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	if to := q.Get("to"); len(to) > 0 {
+		if query.To, err = parseUnixTimestamp(to); err != nil {
+			util.SendAPIErrorResp(w, "invalid to timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	log.Debugf(" > get play history: username [%s], query: %+v", user.Username, query)
+
+	plays := []models.DTOPlay{}
+	for _, play := range handler.srvPlayHistory.Query(user.Username, query) {
+		dtoPlay := models.SpPlayHistory2dtoPlay(play)
+		if !fullTracks {
+			dtoPlay.Track.Details = nil
+		}
+		plays = append(plays, dtoPlay)
+	}
+
+	util.SendAPIOKRespWithData(w, "success", struct {
+		Enabled bool             `json:"enabled"`
+		Plays   []models.DTOPlay `json:"plays"`
+	}{
+		handler.srvPlayHistory.Enabled(user.Username),
+		plays,
+	})
+}
+
+func parseUnixTimestamp(timestamp string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
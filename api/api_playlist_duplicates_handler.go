@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/services"
+	"github.com/2beens/spotilizer/util"
+)
+
+// PlaylistDuplicatesHandler finds duplicate tracks in a playlists snapshot, inside each playlist and across them:
+//
+//	GET /api/ssplaylists/duplicates/{timestamp}             - all playlists of the snapshot
+//	GET /api/ssplaylists/duplicates/{timestamp}?ids=id1,id2 - only the given playlists
+type PlaylistDuplicatesHandler struct {
+	srvUsers     *services.UserService
+	srvPlaylists services.UserPlaylistService
+}
+
+func NewPlaylistDuplicatesHandler(srvUsers *services.UserService, srvPlaylists services.UserPlaylistService) *PlaylistDuplicatesHandler {
+	return &PlaylistDuplicatesHandler{
+		srvUsers:     srvUsers,
+		srvPlaylists: srvPlaylists,
+	}
+}
+
+func (handler *PlaylistDuplicatesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := handler.srvUsers.GetUserByRequestCookieID(r)
+	if err != nil {
+		log.Errorf(" >>> API playlist duplicates handler: user/cookie error: %s", err.Error())
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		util.SendAPIErrorResp(w, "unknown/unsupported request method", http.StatusBadRequest)
+		return
+	}
+
+	timestamp := mux.Vars(r)["timestamp"]
+	log.Debugf(" > get playlists snapshot [%s] duplicates: username [%s]", timestamp, user.Username)
+	snapshot, err := handler.srvPlaylists.GetPlaylistsSnapshotByTimestamp(user.Username, timestamp)
+	if err != nil {
+		log.Errorf(" >>> error while trying to get playlists snapshot: %s", err.Error())
+		util.SendAPIErrorResp(w, "Error occurred: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if snapshot == nil {
+		util.SendAPIErrorResp(w, "Playlists snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	var ids []string
+	if idsParam := r.URL.Query().Get("ids"); len(idsParam) > 0 {
+		ids = strings.Split(idsParam, ",")
+	}
+	playlists, err := snapshot.PlaylistsByIDs(ids)
+	if err != nil {
+		util.SendAPIErrorResp(w, "Error occurred: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	util.SendAPIOKRespWithData(w, "success", services.FindPlaylistDuplicates(playlists))
+}
@@ -29,13 +29,18 @@ func (handler *PlaylistsHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 
 	switch r.Method {
 	case "GET":
+		fullTracks, err := fullTracksRequested(r)
+		if err != nil {
+			util.SendAPIErrorResp(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		switch r.URL.Path {
 		case "/api/ssplaylists":
-			handler.getPlaylistsSnapshots(user.Username, false, w)
+			handler.getPlaylistsSnapshots(user.Username, false, fullTracks, w)
 		case "/api/ssplaylists/full":
-			handler.getPlaylistsSnapshots(user.Username, true, w)
+			handler.getPlaylistsSnapshots(user.Username, true, fullTracks, w)
 		default:
-			handler.getPlaylistsSnapshot(user.Username, w, r)
+			handler.getPlaylistsSnapshot(user, fullTracks, w, r)
 		}
 	case "DELETE":
 		handler.deletePlaylistsSnapshot(user.Username, w, r)
@@ -44,12 +49,12 @@ func (handler *PlaylistsHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-func (handler *PlaylistsHandler) getPlaylistsSnapshot(username string, w io.Writer, r *http.Request) {
+func (handler *PlaylistsHandler) getPlaylistsSnapshot(user *models.User, fullTracks bool, w io.Writer, r *http.Request) {
 	vars := mux.Vars(r)
 	timestamp := vars["timestamp"]
-	log.Debugf(" > get playlists snapshot [%s]: username [%s]", timestamp, username)
+	log.Debugf(" > get playlists snapshot [%s]: username [%s]", timestamp, user.Username)
 
-	snapshotRaw, err := services.UserPlaylist.GetPlaylistsSnapshotByTimestamp(username, timestamp)
+	snapshotRaw, err := services.UserPlaylist.GetPlaylistsSnapshotByTimestamp(user.Username, timestamp)
 	if err != nil {
 		log.Errorf(" >>> error while trying to get playlists snapshot: %s", err.Error())
 		util.SendAPIErrorResp(w, "Error occurred: "+err.Error(), http.StatusNotFound)
@@ -61,13 +66,32 @@ func (handler *PlaylistsHandler) getPlaylistsSnapshot(username string, w io.Writ
 		return
 	}
 
-	snapshots := handler.preparePlaylistsSnapshots([]models.PlaylistsSnapshot{*snapshotRaw}, true)
+	snapshots := handler.preparePlaylistsSnapshots([]models.PlaylistsSnapshot{*snapshotRaw}, true, fullTracks)
 	if len(snapshots) == 0 {
 		log.Errorf(" >>> error while trying to get playlists snapshot: DTO transformation error")
 		util.SendAPIErrorResp(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	var trackLists [][]models.DTOTrack
+	for _, pl := range snapshots[0].Playlists {
+		trackLists = append(trackLists, pl.Tracks)
+	}
+	if audioFeaturesRequested(r) {
+		if apiErr := addAudioFeatures(services.AudioFeatures, user.AccessToken(), trackLists...); apiErr != nil {
+			log.Infof(" >>> error while getting playlists audio features: %v", apiErr)
+			util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+			return
+		}
+	}
+	if genresRequested(r) {
+		if apiErr := addArtistGenres(services.Artists, user.AccessToken(), trackLists...); apiErr != nil {
+			log.Infof(" >>> error while getting playlists artist genres: %v", apiErr)
+			util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+			return
+		}
+	}
+
 	util.SendAPIOKRespWithData(w, "success", snapshots[0])
 }
 
@@ -91,14 +115,14 @@ func (handler *PlaylistsHandler) deletePlaylistsSnapshot(username string, w io.W
 	util.SendAPIOKResp(w, fmt.Sprintf("Playlists snapshot [%s] successfully deleted.", snapshot.Timestamp))
 }
 
-func (handler *PlaylistsHandler) getPlaylistsSnapshots(username string, loadAllData bool, w io.Writer) {
+func (handler *PlaylistsHandler) getPlaylistsSnapshots(username string, loadAllData bool, fullTracks bool, w io.Writer) {
 	log.Debugf(" > get playlists snapshots: username [%s]", username)
 	ssplaylistsRaw := services.UserPlaylist.GetAllPlaylistsSnapshots(username)
-	ssplaylists := handler.preparePlaylistsSnapshots(ssplaylistsRaw, loadAllData)
+	ssplaylists := handler.preparePlaylistsSnapshots(ssplaylistsRaw, loadAllData, fullTracks)
 	util.SendAPIOKRespWithData(w, "success", ssplaylists)
 }
 
-func (handler *PlaylistsHandler) preparePlaylistsSnapshots(ssplaylistsRaw []models.PlaylistsSnapshot, loadTracks bool) []models.DTOPlaylistSnapshot {
+func (handler *PlaylistsHandler) preparePlaylistsSnapshots(ssplaylistsRaw []models.PlaylistsSnapshot, loadTracks bool, fullTracks bool) []models.DTOPlaylistSnapshot {
 	var ssplaylists []models.DTOPlaylistSnapshot
 	for _, plssRaw := range ssplaylistsRaw {
 		plss := models.DTOPlaylistSnapshot{
@@ -110,7 +134,9 @@ func (handler *PlaylistsHandler) preparePlaylistsSnapshots(ssplaylistsRaw []mode
 			if loadTracks {
 				rawTracks = plRaw.Tracks
 			}
-			plss.Playlists = append(plss.Playlists, models.SpPlaylist2dtoPlaylist(plRaw.Playlist, rawTracks))
+			dtoPlaylist := models.SpPlaylist2dtoPlaylist(plRaw.Playlist, rawTracks)
+			projectTracks(dtoPlaylist.Tracks, fullTracks)
+			plss.Playlists = append(plss.Playlists, dtoPlaylist)
 		}
 		ssplaylists = append(ssplaylists, plss)
 	}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"time"
+
+	"github.com/2beens/spotilizer/models"
+	"github.com/2beens/spotilizer/services"
+)
+
+// NewSavedAlbumsHandler creates the handler of saved albums snapshots API
+func NewSavedAlbumsHandler(srvUsers *services.UserService, srvPlaylists services.UserPlaylistService) *LibrarySnapshotsHandler {
+	return &LibrarySnapshotsHandler{
+		srvUsers: srvUsers,
+		prefix:   "/api/ssalbums",
+		source:   savedAlbumsSource{srvPlaylists: srvPlaylists},
+	}
+}
+
+type savedAlbumsSource struct {
+	srvPlaylists services.UserPlaylistService
+}
+
+func (s savedAlbumsSource) name() string {
+	return "saved albums"
+}
+
+func (s savedAlbumsSource) getAll(username string) []librarySnapshot {
+	var snapshots []librarySnapshot
+	for _, snapshot := range s.srvPlaylists.GetAllSavedAlbumsSnapshots(username) {
+		snapshots = append(snapshots, librarySnapshot{timestamp: snapshot.Timestamp, items: albums2items(snapshot.Albums)})
+	}
+	return snapshots
+}
+
+func (s savedAlbumsSource) get(username string, timestamp string) (*librarySnapshot, error) {
+	snapshot, err := s.srvPlaylists.GetSavedAlbumsSnapshotByTimestamp(username, timestamp)
+	if err != nil || snapshot == nil {
+		return nil, err
+	}
+	return &librarySnapshot{timestamp: snapshot.Timestamp, items: albums2items(snapshot.Albums)}, nil
+}
+
+func (s savedAlbumsSource) remove(username string, timestamp string) (*librarySnapshot, error) {
+	snapshot, err := s.srvPlaylists.DeleteSavedAlbumsSnapshot(username, timestamp)
+	if err != nil || snapshot == nil {
+		return nil, err
+	}
+	return &librarySnapshot{timestamp: snapshot.Timestamp}, nil
+}
+
+func (s savedAlbumsSource) downloadCurrent(accessToken string) ([]libraryItem, *models.SpAPIError) {
+	albums, apiErr := s.srvPlaylists.DownloadSavedAlbums(accessToken)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return albums2items(albums), nil
+}
+
+func (s savedAlbumsSource) snapshotDTO(timestamp time.Time, items []libraryItem, withItems bool) interface{} {
+	snapshotDto := models.DTOSavedAlbumsSnapshot{
+		Timestamp:   timestamp.Unix(),
+		AlbumsCount: len(items),
+		Albums:      []models.DTOAlbum{},
+	}
+	if withItems {
+		for _, item := range items {
+			snapshotDto.Albums = append(snapshotDto.Albums, item.dto.(models.DTOAlbum))
+		}
+	}
+	return snapshotDto
+}
+
+func albums2items(albums []models.SpSavedAlbum) []libraryItem {
+	var items []libraryItem
+	for _, a := range albums {
+		items = append(items, libraryItem{id: a.Album.ID, dto: models.SpSavedAlbum2dtoAlbum(a)})
+	}
+	return items
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"time"
+
+	"github.com/2beens/spotilizer/models"
+	"github.com/2beens/spotilizer/services"
+)
+
+// NewSavedEpisodesHandler creates the handler of saved episodes snapshots API
+func NewSavedEpisodesHandler(srvUsers *services.UserService, srvPlaylists services.UserPlaylistService) *LibrarySnapshotsHandler {
+	return &LibrarySnapshotsHandler{
+		srvUsers: srvUsers,
+		prefix:   "/api/ssepisodes",
+		source:   savedEpisodesSource{srvPlaylists: srvPlaylists},
+	}
+}
+
+type savedEpisodesSource struct {
+	srvPlaylists services.UserPlaylistService
+}
+
+func (s savedEpisodesSource) name() string {
+	return "saved episodes"
+}
+
+func (s savedEpisodesSource) getAll(username string) []librarySnapshot {
+	var snapshots []librarySnapshot
+	for _, snapshot := range s.srvPlaylists.GetAllSavedEpisodesSnapshots(username) {
+		snapshots = append(snapshots, librarySnapshot{timestamp: snapshot.Timestamp, items: episodes2items(snapshot.Episodes)})
+	}
+	return snapshots
+}
+
+func (s savedEpisodesSource) get(username string, timestamp string) (*librarySnapshot, error) {
+	snapshot, err := s.srvPlaylists.GetSavedEpisodesSnapshotByTimestamp(username, timestamp)
+	if err != nil || snapshot == nil {
+		return nil, err
+	}
+	return &librarySnapshot{timestamp: snapshot.Timestamp, items: episodes2items(snapshot.Episodes)}, nil
+}
+
+func (s savedEpisodesSource) remove(username string, timestamp string) (*librarySnapshot, error) {
+	snapshot, err := s.srvPlaylists.DeleteSavedEpisodesSnapshot(username, timestamp)
+	if err != nil || snapshot == nil {
+		return nil, err
+	}
+	return &librarySnapshot{timestamp: snapshot.Timestamp}, nil
+}
+
+func (s savedEpisodesSource) downloadCurrent(accessToken string) ([]libraryItem, *models.SpAPIError) {
+	episodes, apiErr := s.srvPlaylists.DownloadSavedEpisodes(accessToken)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return episodes2items(episodes), nil
+}
+
+func (s savedEpisodesSource) snapshotDTO(timestamp time.Time, items []libraryItem, withItems bool) interface{} {
+	snapshotDto := models.DTOSavedEpisodesSnapshot{
+		Timestamp:     timestamp.Unix(),
+		EpisodesCount: len(items),
+		Episodes:      []models.DTOEpisode{},
+	}
+	if withItems {
+		for _, item := range items {
+			snapshotDto.Episodes = append(snapshotDto.Episodes, item.dto.(models.DTOEpisode))
+		}
+	}
+	return snapshotDto
+}
+
+func episodes2items(episodes []models.SpSavedEpisode) []libraryItem {
+	var items []libraryItem
+	for _, e := range episodes {
+		items = append(items, libraryItem{id: e.Episode.ID, dto: models.SpSavedEpisode2dtoEpisode(e)})
+	}
+	return items
+}
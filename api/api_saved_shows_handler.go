@@ -0,0 +1,79 @@
+package api
+
+import (
+	"time"
+
+	"github.com/2beens/spotilizer/models"
+	"github.com/2beens/spotilizer/services"
+)
+
+// NewSavedShowsHandler creates the handler of saved shows snapshots API
+func NewSavedShowsHandler(srvUsers *services.UserService, srvPlaylists services.UserPlaylistService) *LibrarySnapshotsHandler {
+	return &LibrarySnapshotsHandler{
+		srvUsers: srvUsers,
+		prefix:   "/api/ssshows",
+		source:   savedShowsSource{srvPlaylists: srvPlaylists},
+	}
+}
+
+type savedShowsSource struct {
+	srvPlaylists services.UserPlaylistService
+}
+
+func (s savedShowsSource) name() string {
+	return "saved shows"
+}
+
+func (s savedShowsSource) getAll(username string) []librarySnapshot {
+	var snapshots []librarySnapshot
+	for _, snapshot := range s.srvPlaylists.GetAllSavedShowsSnapshots(username) {
+		snapshots = append(snapshots, librarySnapshot{timestamp: snapshot.Timestamp, items: shows2items(snapshot.Shows)})
+	}
+	return snapshots
+}
+
+func (s savedShowsSource) get(username string, timestamp string) (*librarySnapshot, error) {
+	snapshot, err := s.srvPlaylists.GetSavedShowsSnapshotByTimestamp(username, timestamp)
+	if err != nil || snapshot == nil {
+		return nil, err
+	}
+	return &librarySnapshot{timestamp: snapshot.Timestamp, items: shows2items(snapshot.Shows)}, nil
+}
+
+func (s savedShowsSource) remove(username string, timestamp string) (*librarySnapshot, error) {
+	snapshot, err := s.srvPlaylists.DeleteSavedShowsSnapshot(username, timestamp)
+	if err != nil || snapshot == nil {
+		return nil, err
+	}
+	return &librarySnapshot{timestamp: snapshot.Timestamp}, nil
+}
+
+func (s savedShowsSource) downloadCurrent(accessToken string) ([]libraryItem, *models.SpAPIError) {
+	shows, apiErr := s.srvPlaylists.DownloadSavedShows(accessToken)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return shows2items(shows), nil
+}
+
+func (s savedShowsSource) snapshotDTO(timestamp time.Time, items []libraryItem, withItems bool) interface{} {
+	snapshotDto := models.DTOSavedShowsSnapshot{
+		Timestamp:  timestamp.Unix(),
+		ShowsCount: len(items),
+		Shows:      []models.DTOShow{},
+	}
+	if withItems {
+		for _, item := range items {
+			snapshotDto.Shows = append(snapshotDto.Shows, item.dto.(models.DTOShow))
+		}
+	}
+	return snapshotDto
+}
+
+func shows2items(shows []models.SpSavedShow) []libraryItem {
+	var items []libraryItem
+	for _, a := range shows {
+		items = append(items, libraryItem{id: a.Show.ID, dto: models.SpSavedShow2dtoShow(a)})
+	}
+	return items
+}
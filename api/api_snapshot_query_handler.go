@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/services"
+	"github.com/2beens/spotilizer/util"
+)
+
+// SnapshotQueryHandler previews the tracks selected from the history of user's snapshots by the query given in request
+// params, see services.ParseSnapshotQuery, e.g. the tracks unliked in the last 90 days:
+//
+//	GET /api/query?source=fav_tracks&in=any&since=90d&not_in=latest
+type SnapshotQueryHandler struct {
+	srvUsers *services.UserService
+	srvQuery *services.SnapshotQueryService
+}
+
+func NewSnapshotQueryHandler(srvUsers *services.UserService, srvQuery *services.SnapshotQueryService) *SnapshotQueryHandler {
+	return &SnapshotQueryHandler{
+		srvUsers: srvUsers,
+		srvQuery: srvQuery,
+	}
+}
+
+func (handler *SnapshotQueryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := handler.srvUsers.GetUserByRequestCookieID(r)
+	if err != nil {
+		log.Errorf(" >>> API snapshot query handler: user/cookie error: %s", err.Error())
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		util.SendAPIErrorResp(w, "unknown/unsupported request method", http.StatusBadRequest)
+		return
+	}
+
+	query, err := services.ParseSnapshotQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		util.SendAPIErrorResp(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Debugf(" > snapshot query [%s]: username [%s]", r.URL.RawQuery, user.Username)
+
+	result, apiErr := handler.srvQuery.Run(user.Username, query)
+	if apiErr != nil {
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+	util.SendAPIOKRespWithData(w, "success", result)
+}
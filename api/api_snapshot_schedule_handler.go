@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/services"
+	"github.com/2beens/spotilizer/util"
+)
+
+// SnapshotScheduleHandler serves user's snapshot schedule, with its last run, next run and last error:
+//
+//	GET /api/schedule
+type SnapshotScheduleHandler struct {
+	srvUsers     *services.UserService
+	srvScheduler *services.SnapshotSchedulerService
+}
+
+func NewSnapshotScheduleHandler(srvUsers *services.UserService, srvScheduler *services.SnapshotSchedulerService) *SnapshotScheduleHandler {
+	return &SnapshotScheduleHandler{
+		srvUsers:     srvUsers,
+		srvScheduler: srvScheduler,
+	}
+}
+
+func (handler *SnapshotScheduleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := handler.srvUsers.GetUserByRequestCookieID(r)
+	if err != nil {
+		log.Errorf(" >>> API snapshot schedule handler: user/cookie error: %s", err.Error())
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		util.SendAPIErrorResp(w, "unknown/unsupported request method", http.StatusBadRequest)
+		return
+	}
+
+	schedule := handler.srvScheduler.GetSchedule(user.Username)
+	if schedule == nil {
+		util.SendAPIErrorResp(w, "No snapshots scheduled", http.StatusNotFound)
+		return
+	}
+	util.SendAPIOKRespWithData(w, "success", schedule)
+}
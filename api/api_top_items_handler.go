@@ -0,0 +1,236 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/2beens/spotilizer/models"
+	"github.com/2beens/spotilizer/services"
+	"github.com/2beens/spotilizer/util"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// moves of items in top tracks/artists rankings
+const (
+	rankMoveEntered = "entered"
+	rankMoveLeft    = "left"
+	rankMoveUp      = "up"
+	rankMoveDown    = "down"
+	rankMoveSame    = "same"
+)
+
+// TopItemsHandler serves snapshots of user's top tracks and artists:
+//
+//	GET /api/sstop                               - all snapshots, without items
+//	GET /api/sstop/full                          - all snapshots, with items
+//	GET /api/sstop/{timestamp}                   - single snapshot
+//	GET /api/sstop/moves/{timestamp}/{other}     - how rankings moved from the snapshot to the other one
+//	DELETE /api/sstop/{timestamp}                - delete the snapshot
+type TopItemsHandler struct {
+	srvUsers     *services.UserService
+	srvPlaylists services.UserPlaylistService
+}
+
+func NewTopItemsHandler(srvUsers *services.UserService, srvPlaylists services.UserPlaylistService) *TopItemsHandler {
+	return &TopItemsHandler{
+		srvUsers:     srvUsers,
+		srvPlaylists: srvPlaylists,
+	}
+}
+
+func (handler *TopItemsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := handler.srvUsers.GetUserByRequestCookieID(r)
+	if err != nil {
+		log.Errorf(" >>> API top items handler: user/cookie error: %s", err.Error())
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		fullTracks, err := fullTracksRequested(r)
+		if err != nil {
+			util.SendAPIErrorResp(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case r.URL.Path == "/api/sstop":
+			handler.getTopItemsSnapshots(user.Username, false, fullTracks, w)
+		case r.URL.Path == "/api/sstop/full":
+			handler.getTopItemsSnapshots(user.Username, true, fullTracks, w)
+		case strings.HasPrefix(r.URL.Path, "/api/sstop/moves/"):
+			handler.getTopItemsMoves(user.Username, w, r)
+		case strings.HasPrefix(r.URL.Path, "/api/sstop/"):
+			handler.getTopItemsSnapshot(user.Username, fullTracks, w, r)
+		default:
+			util.SendAPIErrorResp(w, "unknown path", http.StatusBadRequest)
+		}
+	case "DELETE":
+		handler.deleteTopItemsSnapshot(user.Username, w, r)
+	default:
+		util.SendAPIErrorResp(w, "unknown/unsupported request method", http.StatusBadRequest)
+	}
+}
+
+func (handler *TopItemsHandler) getTopItemsSnapshots(username string, loadAllData bool, fullTracks bool, w io.Writer) {
+	log.WithFields(log.Fields{
+		"loadAllData": loadAllData,
+	}).Debugf(" > get top items snapshots: username [%s]", username)
+
+	snapshots := []models.DTOTopItemsSnapshot{}
+	for _, s := range handler.srvPlaylists.GetAllTopItemsSnapshots(username) {
+		snapshots = append(snapshots, topItemsSnapshot2dto(s, loadAllData, fullTracks))
+	}
+
+	util.SendAPIOKRespWithData(w, "success", snapshots)
+}
+
+func (handler *TopItemsHandler) getTopItemsSnapshot(username string, fullTracks bool, w io.Writer, r *http.Request) {
+	timestamp := mux.Vars(r)["timestamp"]
+	log.Debugf(" > get top items snapshot [%s]: username [%s]", timestamp, username)
+
+	snapshot, found := handler.findTopItemsSnapshot(username, timestamp, w)
+	if !found {
+		return
+	}
+
+	util.SendAPIOKRespWithData(w, "success", topItemsSnapshot2dto(*snapshot, true, fullTracks))
+}
+
+func (handler *TopItemsHandler) getTopItemsMoves(username string, w io.Writer, r *http.Request) {
+	vars := mux.Vars(r)
+	timestamp, otherTimestamp := vars["timestamp"], vars["other"]
+	log.Debugf(" > get top items moves [%s] -> [%s]: username [%s]", timestamp, otherTimestamp, username)
+
+	snapshot, found := handler.findTopItemsSnapshot(username, timestamp, w)
+	if !found {
+		return
+	}
+	other, found := handler.findTopItemsSnapshot(username, otherTimestamp, w)
+	if !found {
+		return
+	}
+
+	moves := make(map[string]models.DTOTopRangeMoves)
+	for _, timeRange := range models.TopTimeRanges {
+		moves[timeRange] = models.DTOTopRangeMoves{
+			Tracks:  rankMoves(topTracks2ranked(snapshot.Tracks[timeRange]), topTracks2ranked(other.Tracks[timeRange])),
+			Artists: rankMoves(topArtists2ranked(snapshot.Artists[timeRange]), topArtists2ranked(other.Artists[timeRange])),
+		}
+	}
+
+	util.SendAPIOKRespWithData(w, "success", moves)
+}
+
+func (handler *TopItemsHandler) deleteTopItemsSnapshot(username string, w io.Writer, r *http.Request) {
+	timestamp := mux.Vars(r)["timestamp"]
+	log.Debugf(" > delete top items snapshot [%s]: username [%s]", timestamp, username)
+
+	snapshot, err := handler.srvPlaylists.DeleteTopItemsSnapshot(username, timestamp)
+	if err != nil {
+		log.Errorf(" >>> error while trying to delete top items snapshot: %s", err.Error())
+		util.SendAPIErrorResp(w, "Error occurred: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if snapshot == nil {
+		log.Errorf(" >>> error while trying to delete top items snapshot: snapshot is nil")
+		util.SendAPIErrorResp(w, "Top items snapshot not deleted: not found", http.StatusNotFound)
+		return
+	}
+
+	util.SendAPIOKResp(w, fmt.Sprintf("Top items snapshot [%s] successfully deleted.", snapshot.Timestamp))
+}
+
+func (handler *TopItemsHandler) findTopItemsSnapshot(username string, timestamp string, w io.Writer) (*models.TopItemsSnapshot, bool) {
+	snapshot, err := handler.srvPlaylists.GetTopItemsSnapshotByTimestamp(username, timestamp)
+	if err != nil {
+		log.Errorf(" >>> error while trying to get top items snapshot: %s", err.Error())
+		util.SendAPIErrorResp(w, "Error occurred: "+err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if snapshot == nil {
+		log.Errorf(" >>> error while trying to get top items snapshot: snapshot is nil")
+		util.SendAPIErrorResp(w, "Top items snapshot not found", http.StatusNotFound)
+		return nil, false
+	}
+	return snapshot, true
+}
+
+func topItemsSnapshot2dto(snapshot models.TopItemsSnapshot, withItems bool, fullTracks bool) models.DTOTopItemsSnapshot {
+	snapshotDto := models.DTOTopItemsSnapshot{Timestamp: snapshot.Timestamp.Unix()}
+	if !withItems {
+		return snapshotDto
+	}
+	snapshotDto.Ranges = make(map[string]models.DTOTopItemsRange)
+	for _, timeRange := range models.TopTimeRanges {
+		rangeDto := models.DTOTopItemsRange{Tracks: []models.DTOTrack{}, Artists: []models.DTOArtist{}}
+		for _, t := range snapshot.Tracks[timeRange] {
+			rangeDto.Tracks = append(rangeDto.Tracks, models.SpTrack2dtoTrack(t))
+		}
+		projectTracks(rangeDto.Tracks, fullTracks)
+		for _, a := range snapshot.Artists[timeRange] {
+			rangeDto.Artists = append(rangeDto.Artists, models.SpFullArtist2dtoArtist(a))
+		}
+		snapshotDto.Ranges[timeRange] = rangeDto
+	}
+	return snapshotDto
+}
+
+// rankedItem is an item of a ranking, ranked by its position in the ranking
+type rankedItem struct {
+	id   string
+	name string
+}
+
+func topTracks2ranked(tracks []models.SpTrack) []rankedItem {
+	var ranked []rankedItem
+	for _, t := range tracks {
+		ranked = append(ranked, rankedItem{id: t.ID, name: t.Name})
+	}
+	return ranked
+}
+
+func topArtists2ranked(artists []models.SpFullArtist) []rankedItem {
+	var ranked []rankedItem
+	for _, a := range artists {
+		ranked = append(ranked, rankedItem{id: a.ID, name: a.Name})
+	}
+	return ranked
+}
+
+// rankMoves tells how the items moved from previous to current ranking. Items of the current ranking come first,
+// in their order, followed by the items which left the ranking.
+func rankMoves(previous []rankedItem, current []rankedItem) []models.DTORankMove {
+	previousRanks := make(map[string]int)
+	for i, item := range previous {
+		previousRanks[item.id] = i + 1
+	}
+	currentRanks := make(map[string]int)
+
+	moves := []models.DTORankMove{}
+	for i, item := range current {
+		rank := i + 1
+		currentRanks[item.id] = rank
+		move := models.DTORankMove{ID: item.id, Name: item.name, Rank: rank, PreviousRank: previousRanks[item.id]}
+		switch {
+		case move.PreviousRank == 0:
+			move.Move = rankMoveEntered
+		case move.PreviousRank > rank:
+			move.Move = rankMoveUp
+		case move.PreviousRank < rank:
+			move.Move = rankMoveDown
+		default:
+			move.Move = rankMoveSame
+		}
+		moves = append(moves, move)
+	}
+	for _, item := range previous {
+		if _, stayed := currentRanks[item.id]; !stayed {
+			moves = append(moves, models.DTORankMove{ID: item.id, Name: item.name, PreviousRank: previousRanks[item.id], Move: rankMoveLeft})
+		}
+	}
+	return moves
+}
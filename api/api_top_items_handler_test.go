@@ -0,0 +1,34 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+func TestRankMoves(t *testing.T) {
+	previous := []rankedItem{{id: "a", name: "A"}, {id: "b", name: "B"}, {id: "c", name: "C"}, {id: "d", name: "D"}}
+	current := []rankedItem{{id: "c", name: "C"}, {id: "b", name: "B"}, {id: "e", name: "E"}, {id: "a", name: "A"}}
+
+	moves := rankMoves(previous, current)
+
+	assert.Equal(t, []models.DTORankMove{
+		{ID: "c", Name: "C", Rank: 1, PreviousRank: 3, Move: rankMoveUp},
+		{ID: "b", Name: "B", Rank: 2, PreviousRank: 2, Move: rankMoveSame},
+		{ID: "e", Name: "E", Rank: 3, PreviousRank: 0, Move: rankMoveEntered},
+		{ID: "a", Name: "A", Rank: 4, PreviousRank: 1, Move: rankMoveDown},
+		{ID: "d", Name: "D", Rank: 0, PreviousRank: 4, Move: rankMoveLeft},
+	}, moves)
+}
+
+func TestRankMovesEmpty(t *testing.T) {
+	assert.Empty(t, rankMoves(nil, nil))
+
+	moves := rankMoves(nil, []rankedItem{{id: "a", name: "A"}})
+	assert.Equal(t, []models.DTORankMove{{ID: "a", Name: "A", Rank: 1, Move: rankMoveEntered}}, moves)
+
+	moves = rankMoves([]rankedItem{{id: "a", name: "A"}}, nil)
+	assert.Equal(t, []models.DTORankMove{{ID: "a", Name: "A", PreviousRank: 1, Move: rankMoveLeft}}, moves)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/services"
+	"github.com/2beens/spotilizer/util"
+)
+
+// WriteBackPlansHandler serves user's write-back plans, along with the records of their executions:
+//
+//	GET /api/plans      - all plans, oldest first
+//	GET /api/plans/{id} - single plan
+type WriteBackPlansHandler struct {
+	srvUsers     *services.UserService
+	srvWriteBack *services.WriteBackService
+}
+
+func NewWriteBackPlansHandler(srvUsers *services.UserService, srvWriteBack *services.WriteBackService) *WriteBackPlansHandler {
+	return &WriteBackPlansHandler{
+		srvUsers:     srvUsers,
+		srvWriteBack: srvWriteBack,
+	}
+}
+
+func (handler *WriteBackPlansHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := handler.srvUsers.GetUserByRequestCookieID(r)
+	if err != nil {
+		log.Errorf(" >>> API write-back plans handler: user/cookie error: %s", err.Error())
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		util.SendAPIErrorResp(w, "unknown/unsupported request method", http.StatusBadRequest)
+		return
+	}
+
+	id, found := mux.Vars(r)["id"]
+	if !found {
+		util.SendAPIOKRespWithData(w, "success", handler.srvWriteBack.GetAllPlans(user.Username))
+		return
+	}
+	plan := handler.srvWriteBack.GetPlan(user.Username, id)
+	if plan == nil {
+		util.SendAPIErrorResp(w, "Plan not found", http.StatusNotFound)
+		return
+	}
+	util.SendAPIOKRespWithData(w, "success", plan)
+}
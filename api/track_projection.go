@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// projections of tracks in API responses, chosen by projection query param: compact by default, while full one
+// includes track details (album, ISRC, explicit flag, popularity, ...)
+const (
+	trackProjectionCompact = "compact"
+	trackProjectionFull    = "full"
+)
+
+var errInvalidProjection = errors.New("invalid projection, expected compact or full")
+
+// fullTracksRequested tells if the full tracks projection is requested, error for an unknown projection
+func fullTracksRequested(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("projection") {
+	case "", trackProjectionCompact:
+		return false, nil
+	case trackProjectionFull:
+		return true, nil
+	default:
+		return false, errInvalidProjection
+	}
+}
+
+// projectTracks leaves out track details, unless full tracks projection is requested
+func projectTracks(tracks []models.DTOTrack, full bool) {
+	if full {
+		return
+	}
+	for i := range tracks {
+		tracks[i].Details = nil
+	}
+}
@@ -1,20 +1,194 @@
 package config
 
+import (
+	"fmt"
+	"time"
+)
+
+var host = "localhost"
+var port = "8080"
+var protocol = "http"
+var redisHost = "localhost"
+var redisPort = "6379"
+
+// OAuth scopes requested from the user at login, features needing more scopes ask for them when used.
+// Playlists are read by most of the features, so reading them is asked for at login as well.
+var scopes = []string{
+	"user-read-private",
+	"user-read-email",
+	"user-library-read",
+	"playlist-read-private",
+	"playlist-read-collaborative",
+}
+
+// login flows: "authorization_code" needs the client secret, while "pkce" (Authorization Code with PKCE)
+// works with client ID only, and is meant for self-hosted servers
+const (
+	AuthFlowAuthorizationCode = "authorization_code"
+	AuthFlowPKCE              = "pkce"
+)
+
+var authFlow = AuthFlowAuthorizationCode
+
 var spotifyAPIURL = "https://api.spotify.com"
+var spotifyAccountsURL = "https://accounts.spotify.com"
+var urlAuthorize = "/authorize"
+var urlAccessToken = "/api/token"
 var urlCurrentUserPlaylists = "/v1/me/playlists"
 var urlCurrentUserSavedTracks = "/v1/me/tracks"
 var urlCurrentUser = "/v1/me"
+var urlFollowedArtists = "/v1/me/following"
+var urlSavedAlbums = "/v1/me/albums"
+var urlSavedShows = "/v1/me/shows"
+var urlSavedEpisodes = "/v1/me/episodes"
+var urlRecentlyPlayed = "/v1/me/player/recently-played"
+var urlTopTracks = "/v1/me/top/tracks"
+var urlTopArtists = "/v1/me/top/artists"
+var urlAudioFeatures = "/v1/audio-features"
+var urlArtists = "/v1/artists"
+var urlTracks = "/v1/tracks"
+var urlPlaylists = "/v1/playlists"
+var urlUsers = "/v1/users"
+
+// access tokens of logged in users are checked every tokenRefreshCheckInterval, and refreshed
+// when they expire in less than tokenRefreshMargin
+var tokenRefreshCheckInterval = 1 * time.Minute
+var tokenRefreshMargin = 5 * time.Minute
+
+// recently played tracks of users with play history enabled are collected every playHistoryCollectInterval,
+// Spotify keeps only the last 50 played tracks, so it should not be much longer than a couple of hours
+var playHistoryCollectInterval = 30 * time.Minute
+
+// snapshot schedules are checked every scheduleCheckInterval; scheduled snapshots are delayed by a random jitter
+// up to scheduleMaxJitter, so users with the same schedule are not all snapshotted at once
+var scheduleCheckInterval = 1 * time.Minute
+var scheduleMaxJitter = 15 * time.Minute
+
+// artists (genres, popularity, images) are cached for all the users, and refreshed from Spotify when cached
+// longer than artistCacheTTL
+var artistCacheTTL = 7 * 24 * time.Hour
 
+// requests towards Spotify API are shared between all the users and limited to spotifyAPIRequestsPerSecond,
+// while at most playlistDownloadWorkers playlists are downloaded concurrently for a single snapshot
+var spotifyAPIRequestsPerSecond = 10
+var playlistDownloadWorkers = 5
+
+// requests downloading all user's playlists or liked tracks, or executing write-back plans, may take minutes for users
+// with big libraries, so they are given longRequestWriteTimeout to respond, instead of the server write timeout (15s)
+var longRequestWriteTimeout = 10 * time.Minute
+
+// Spotify API responses cache: "memory" (LRU), "redis", "disk", or empty to disable caching
+var responseCacheType = "memory"
+var responseCacheMaxEntries = 5000
+var responseCacheDir = "cache/responses"
+
+// CachePolicy defines for how long responses from endpoints starting with PathPrefix are used
+// without revalidation, and if they can be shared between users (i.e. don't depend on the access token)
+type CachePolicy struct {
+	PathPrefix string        `json:"path_prefix"`
+	TTL        time.Duration `json:"-"`
+	Shared     bool          `json:"shared"`
+}
+
+// responses from endpoints without a policy are always revalidated using their ETag
+var responseCachePolicies = []CachePolicy{
+	{PathPrefix: "/v1/albums", TTL: 24 * time.Hour, Shared: true},
+	{PathPrefix: "/v1/artists", TTL: 24 * time.Hour, Shared: true},
+	{PathPrefix: "/v1/tracks", TTL: 24 * time.Hour, Shared: true},
+	{PathPrefix: "/v1/audio-features", TTL: 7 * 24 * time.Hour, Shared: true},
+}
+
+// personal data fields of Spotify responses, scrubbed from recorded fixtures (tokens are always scrubbed)
+var fixtureScrubbedFields = []string{"email", "display_name", "birthdate"}
+
+// Config holds server settings, loaded from a JSON config file and environment variables, see Load
 type Config struct {
-	SpotifyAPIURL             string
-	URLCurrentUserPlaylists   string
-	URLCurrentUserSavedTracks string
-	URLCurrentUser            string
+	Host                        string        `json:"host"`
+	Port                        string        `json:"port"`
+	Protocol                    string        `json:"protocol"`
+	RedisHost                   string        `json:"redis_host"`
+	RedisPort                   string        `json:"redis_port"`
+	Scopes                      []string      `json:"scopes"`
+	AuthFlow                    string        `json:"auth_flow"`
+	SpotifyAPIURL               string        `json:"spotify_api_url"`
+	SpotifyAccountsURL          string        `json:"spotify_accounts_url"`
+	URLAuthorize                string        `json:"url_authorize"`
+	URLAccessToken              string        `json:"url_access_token"`
+	URLCurrentUserPlaylists     string        `json:"url_current_user_playlists"`
+	URLCurrentUserSavedTracks   string        `json:"url_current_user_saved_tracks"`
+	URLCurrentUser              string        `json:"url_current_user"`
+	URLFollowedArtists          string        `json:"url_followed_artists"`
+	URLSavedAlbums              string        `json:"url_saved_albums"`
+	URLSavedShows               string        `json:"url_saved_shows"`
+	URLSavedEpisodes            string        `json:"url_saved_episodes"`
+	URLRecentlyPlayed           string        `json:"url_recently_played"`
+	URLTopTracks                string        `json:"url_top_tracks"`
+	URLTopArtists               string        `json:"url_top_artists"`
+	URLAudioFeatures            string        `json:"url_audio_features"`
+	URLArtists                  string        `json:"url_artists"`
+	URLTracks                   string        `json:"url_tracks"`
+	URLPlaylists                string        `json:"url_playlists"`
+	URLUsers                    string        `json:"url_users"`
+	TokenRefreshCheckInterval   time.Duration `json:"token_refresh_check_interval"`
+	TokenRefreshMargin          time.Duration `json:"token_refresh_margin"`
+	PlayHistoryCollectInterval  time.Duration `json:"play_history_collect_interval"`
+	ScheduleCheckInterval       time.Duration `json:"schedule_check_interval"`
+	ScheduleMaxJitter           time.Duration `json:"schedule_max_jitter"`
+	ArtistCacheTTL              time.Duration `json:"artist_cache_ttl"`
+	SpotifyAPIRequestsPerSecond int           `json:"spotify_api_requests_per_second"`
+	PlaylistDownloadWorkers     int           `json:"playlist_download_workers"`
+	LongRequestWriteTimeout     time.Duration `json:"long_request_write_timeout"`
+	ResponseCacheType           string        `json:"response_cache_type"`
+	ResponseCacheMaxEntries     int           `json:"response_cache_max_entries"`
+	ResponseCacheDir            string        `json:"response_cache_dir"`
+	ResponseCachePolicies       []CachePolicy `json:"response_cache_policies"`
+	FixtureScrubbedFields       []string      `json:"fixture_scrubbed_fields"`
+}
+
+// ServerURL is the address spotilizer is reachable at, e.g. http://localhost:8080
+func (c *Config) ServerURL() string {
+	return fmt.Sprintf("%s://%s:%s", c.Protocol, c.Host, c.Port)
 }
 
 var Conf = &Config{
-	SpotifyAPIURL:             spotifyAPIURL,
-	URLCurrentUserPlaylists:   urlCurrentUserPlaylists,
-	URLCurrentUserSavedTracks: urlCurrentUserSavedTracks,
-	URLCurrentUser:            urlCurrentUser,
+	Host:                        host,
+	Port:                        port,
+	Protocol:                    protocol,
+	RedisHost:                   redisHost,
+	RedisPort:                   redisPort,
+	Scopes:                      scopes,
+	AuthFlow:                    authFlow,
+	SpotifyAPIURL:               spotifyAPIURL,
+	SpotifyAccountsURL:          spotifyAccountsURL,
+	URLAuthorize:                urlAuthorize,
+	URLAccessToken:              urlAccessToken,
+	URLCurrentUserPlaylists:     urlCurrentUserPlaylists,
+	URLCurrentUserSavedTracks:   urlCurrentUserSavedTracks,
+	URLCurrentUser:              urlCurrentUser,
+	URLFollowedArtists:          urlFollowedArtists,
+	URLSavedAlbums:              urlSavedAlbums,
+	URLSavedShows:               urlSavedShows,
+	URLSavedEpisodes:            urlSavedEpisodes,
+	URLRecentlyPlayed:           urlRecentlyPlayed,
+	URLTopTracks:                urlTopTracks,
+	URLTopArtists:               urlTopArtists,
+	URLAudioFeatures:            urlAudioFeatures,
+	URLArtists:                  urlArtists,
+	URLTracks:                   urlTracks,
+	URLPlaylists:                urlPlaylists,
+	URLUsers:                    urlUsers,
+	TokenRefreshCheckInterval:   tokenRefreshCheckInterval,
+	TokenRefreshMargin:          tokenRefreshMargin,
+	PlayHistoryCollectInterval:  playHistoryCollectInterval,
+	ScheduleCheckInterval:       scheduleCheckInterval,
+	ScheduleMaxJitter:           scheduleMaxJitter,
+	ArtistCacheTTL:              artistCacheTTL,
+	SpotifyAPIRequestsPerSecond: spotifyAPIRequestsPerSecond,
+	PlaylistDownloadWorkers:     playlistDownloadWorkers,
+	LongRequestWriteTimeout:     longRequestWriteTimeout,
+	ResponseCacheType:           responseCacheType,
+	ResponseCacheMaxEntries:     responseCacheMaxEntries,
+	ResponseCacheDir:            responseCacheDir,
+	ResponseCachePolicies:       responseCachePolicies,
+	FixtureScrubbedFields:       fixtureScrubbedFields,
 }
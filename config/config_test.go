@@ -0,0 +1,76 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadExampleConfig(t *testing.T) {
+	defaults := *Conf
+	defer func() { *Conf = defaults }()
+
+	require.NoError(t, Load("../config.example.json"))
+	// example config file documents the defaults
+	assert.True(t, reflect.DeepEqual(defaults, *Conf), "example config differs from defaults: %+v", *Conf)
+}
+
+func TestEnvOverrides(t *testing.T) {
+	conf := *Conf
+	env := map[string]string{
+		"SPOTILIZER_PORT":                      "9090",
+		"SPOTILIZER_SPOTIFY_ACCOUNTS_URL":      "http://localhost:9000",
+		"SPOTILIZER_TOKEN_REFRESH_MARGIN":      "30s",
+		"SPOTILIZER_PLAYLIST_DOWNLOAD_WORKERS": "2",
+		"SPOTILIZER_SCOPES":                    "user-read-private, user-library-read",
+	}
+	lookupEnv := func(key string) (string, bool) {
+		v, found := env[key]
+		return v, found
+	}
+
+	require.NoError(t, conf.applyEnvOverrides(lookupEnv))
+	assert.NoError(t, conf.Validate())
+	assert.Equal(t, "9090", conf.Port)
+	assert.Equal(t, "http://localhost:9000", conf.SpotifyAccountsURL)
+	assert.Equal(t, 30*time.Second, conf.TokenRefreshMargin)
+	assert.Equal(t, 2, conf.PlaylistDownloadWorkers)
+	assert.Equal(t, []string{"user-read-private", "user-library-read"}, conf.Scopes)
+	assert.Equal(t, Conf.SpotifyAPIURL, conf.SpotifyAPIURL)
+
+	env["SPOTILIZER_PLAYLIST_DOWNLOAD_WORKERS"] = "many"
+	assert.Error(t, conf.applyEnvOverrides(lookupEnv))
+}
+
+func TestLoadInvalidConfig(t *testing.T) {
+	defaults := *Conf
+	defer func() { *Conf = defaults }()
+
+	f, err := ioutil.TempFile("", "spotilizer-config-*.json")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString(`{"port": "80800", "spotify_api_url": "api.spotify.com", "response_cache_policies": [{"path_prefix": "/v1/albums", "ttl": "1h"}], "fixture_scrubbed_fields": ["email", "user.name"], "schedule_max_jitter": "1h"}`)
+	f.Close()
+
+	err = Load(f.Name())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid port [80800]")
+		assert.Contains(t, err.Error(), "invalid Spotify URL [api.spotify.com]")
+		assert.Contains(t, err.Error(), "invalid fixture scrubbed field [user.name]")
+		assert.Contains(t, err.Error(), "schedule_max_jitter must be between 0 and an hour")
+	}
+	assert.Equal(t, []CachePolicy{{PathPrefix: "/v1/albums", TTL: time.Hour}}, Conf.ResponseCachePolicies)
+	assert.Equal(t, 4, len(responseCachePolicies), "defaults must not be changed")
+
+	*Conf = defaults
+	f, err = os.Create(f.Name())
+	require.NoError(t, err)
+	f.WriteString(`{"prot": "https"}`)
+	f.Close()
+	assert.Error(t, Load(f.Name()), "misspelled fields are not ignored")
+}
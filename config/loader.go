@@ -0,0 +1,280 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// EnvPrefix is the prefix of environment variables overriding config values, e.g. SPOTILIZER_PORT=9090
+const EnvPrefix = "SPOTILIZER_"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load reads the config file (if path is not empty) over the default config, then applies the
+// environment overrides and validates the result. Config values missing in the file keep their defaults.
+func Load(path string) error {
+	if len(path) > 0 {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := json.NewDecoder(f).Decode(Conf); err != nil {
+			return fmt.Errorf("invalid config file [%s]: %s", path, err.Error())
+		}
+		log.Debugf(" > config loaded from [%s]", path)
+	}
+
+	if err := Conf.applyEnvOverrides(os.LookupEnv); err != nil {
+		return err
+	}
+	return Conf.Validate()
+}
+
+// UnmarshalJSON reads durations as strings, e.g. "5m", and refuses unknown (e.g. misspelled) fields
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type configAlias Config
+	aux := struct {
+		*configAlias
+		TokenRefreshCheckInterval  *string `json:"token_refresh_check_interval"`
+		TokenRefreshMargin         *string `json:"token_refresh_margin"`
+		PlayHistoryCollectInterval *string `json:"play_history_collect_interval"`
+		ScheduleCheckInterval      *string `json:"schedule_check_interval"`
+		ScheduleMaxJitter          *string `json:"schedule_max_jitter"`
+		ArtistCacheTTL             *string `json:"artist_cache_ttl"`
+		LongRequestWriteTimeout    *string `json:"long_request_write_timeout"`
+		// lists are decoded separately, json would otherwise decode them into the default lists
+		Scopes                []string      `json:"scopes"`
+		ResponseCachePolicies []CachePolicy `json:"response_cache_policies"`
+		FixtureScrubbedFields []string      `json:"fixture_scrubbed_fields"`
+	}{configAlias: (*configAlias)(c)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	if aux.Scopes != nil {
+		c.Scopes = aux.Scopes
+	}
+	if aux.ResponseCachePolicies != nil {
+		c.ResponseCachePolicies = aux.ResponseCachePolicies
+	}
+	if aux.FixtureScrubbedFields != nil {
+		c.FixtureScrubbedFields = aux.FixtureScrubbedFields
+	}
+	if err := parseDurationInto(aux.TokenRefreshCheckInterval, &c.TokenRefreshCheckInterval); err != nil {
+		return fmt.Errorf("token_refresh_check_interval: %s", err.Error())
+	}
+	if err := parseDurationInto(aux.TokenRefreshMargin, &c.TokenRefreshMargin); err != nil {
+		return fmt.Errorf("token_refresh_margin: %s", err.Error())
+	}
+	if err := parseDurationInto(aux.PlayHistoryCollectInterval, &c.PlayHistoryCollectInterval); err != nil {
+		return fmt.Errorf("play_history_collect_interval: %s", err.Error())
+	}
+	if err := parseDurationInto(aux.ScheduleCheckInterval, &c.ScheduleCheckInterval); err != nil {
+		return fmt.Errorf("schedule_check_interval: %s", err.Error())
+	}
+	if err := parseDurationInto(aux.ScheduleMaxJitter, &c.ScheduleMaxJitter); err != nil {
+		return fmt.Errorf("schedule_max_jitter: %s", err.Error())
+	}
+	if err := parseDurationInto(aux.ArtistCacheTTL, &c.ArtistCacheTTL); err != nil {
+		return fmt.Errorf("artist_cache_ttl: %s", err.Error())
+	}
+	if err := parseDurationInto(aux.LongRequestWriteTimeout, &c.LongRequestWriteTimeout); err != nil {
+		return fmt.Errorf("long_request_write_timeout: %s", err.Error())
+	}
+	return nil
+}
+
+// UnmarshalJSON reads TTL as a string, e.g. "24h"
+func (p *CachePolicy) UnmarshalJSON(data []byte) error {
+	type cachePolicyAlias CachePolicy
+	aux := struct {
+		*cachePolicyAlias
+		TTL *string `json:"ttl"`
+	}{cachePolicyAlias: (*cachePolicyAlias)(p)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	if err := parseDurationInto(aux.TTL, &p.TTL); err != nil {
+		return fmt.Errorf("ttl: %s", err.Error())
+	}
+	return nil
+}
+
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func parseDurationInto(value *string, d *time.Duration) error {
+	if value == nil {
+		return nil
+	}
+	parsed, err := time.ParseDuration(*value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// applyEnvOverrides sets config values from SPOTILIZER_<JSON_NAME> environment variables,
+// lists (e.g. scopes) are comma separated
+func (c *Config) applyEnvOverrides(lookupEnv func(key string) (string, bool)) error {
+	confValue := reflect.ValueOf(c).Elem()
+	confType := confValue.Type()
+	for i := 0; i < confType.NumField(); i++ {
+		jsonName := strings.Split(confType.Field(i).Tag.Get("json"), ",")[0]
+		envName := EnvPrefix + strings.ToUpper(jsonName)
+		envValue, found := lookupEnv(envName)
+		if !found {
+			continue
+		}
+
+		field := confValue.Field(i)
+		switch {
+		case field.Type() == durationType:
+			d, err := time.ParseDuration(envValue)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %s", envName, err.Error())
+			}
+			field.SetInt(int64(d))
+		case field.Kind() == reflect.String:
+			field.SetString(envValue)
+		case field.Kind() == reflect.Int:
+			n, err := strconv.Atoi(envValue)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %s", envName, err.Error())
+			}
+			field.SetInt(int64(n))
+		case field.Type() == reflect.TypeOf([]string{}):
+			values := []string{}
+			for _, v := range strings.Split(envValue, ",") {
+				if v = strings.TrimSpace(v); len(v) > 0 {
+					values = append(values, v)
+				}
+			}
+			field.Set(reflect.ValueOf(values))
+		default:
+			return fmt.Errorf("%s cannot be set from environment, use the config file", envName)
+		}
+		log.Debugf(" > config value [%s] set from environment", jsonName)
+	}
+	return nil
+}
+
+// Validate checks the config makes sense, so the server fails at startup instead of on first use
+func (c *Config) Validate() error {
+	errs := []string{}
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if len(c.Host) == 0 {
+		addErr("host is empty")
+	}
+	if !isPort(c.Port) {
+		addErr("invalid port [%s]", c.Port)
+	}
+	if c.Protocol != "http" && c.Protocol != "https" {
+		addErr("invalid protocol [%s], http or https expected", c.Protocol)
+	}
+	if len(c.RedisHost) == 0 {
+		addErr("redis host is empty")
+	}
+	if !isPort(c.RedisPort) {
+		addErr("invalid redis port [%s]", c.RedisPort)
+	}
+	if len(c.Scopes) == 0 {
+		addErr("no OAuth scopes set")
+	}
+	if c.AuthFlow != AuthFlowAuthorizationCode && c.AuthFlow != AuthFlowPKCE {
+		addErr("invalid auth_flow [%s], %s or %s expected", c.AuthFlow, AuthFlowAuthorizationCode, AuthFlowPKCE)
+	}
+
+	for _, baseURL := range []string{c.SpotifyAPIURL, c.SpotifyAccountsURL} {
+		u, err := url.Parse(baseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			addErr("invalid Spotify URL [%s]", baseURL)
+		}
+	}
+	for _, path := range []string{c.URLAuthorize, c.URLAccessToken, c.URLCurrentUserPlaylists, c.URLCurrentUserSavedTracks, c.URLCurrentUser, c.URLFollowedArtists, c.URLSavedAlbums, c.URLSavedShows, c.URLSavedEpisodes, c.URLRecentlyPlayed, c.URLTopTracks, c.URLTopArtists, c.URLAudioFeatures, c.URLArtists, c.URLTracks, c.URLPlaylists, c.URLUsers} {
+		if !strings.HasPrefix(path, "/") {
+			addErr("invalid Spotify endpoint path [%s], path starting with / expected", path)
+		}
+	}
+
+	if c.TokenRefreshCheckInterval <= 0 {
+		addErr("token_refresh_check_interval must be positive")
+	}
+	if c.TokenRefreshMargin < 0 {
+		addErr("token_refresh_margin must not be negative")
+	}
+	if c.PlayHistoryCollectInterval <= 0 {
+		addErr("play_history_collect_interval must be positive")
+	}
+	if c.ScheduleCheckInterval <= 0 {
+		addErr("schedule_check_interval must be positive")
+	}
+	if c.ScheduleMaxJitter < 0 || c.ScheduleMaxJitter >= time.Hour {
+		addErr("schedule_max_jitter must be between 0 and an hour, the shortest schedule frequency")
+	}
+	if c.ArtistCacheTTL <= 0 {
+		addErr("artist_cache_ttl must be positive")
+	}
+	if c.SpotifyAPIRequestsPerSecond <= 0 {
+		addErr("spotify_api_requests_per_second must be positive")
+	}
+	if c.PlaylistDownloadWorkers <= 0 {
+		addErr("playlist_download_workers must be positive")
+	}
+	if c.LongRequestWriteTimeout <= 0 {
+		addErr("long_request_write_timeout must be positive")
+	}
+	switch c.ResponseCacheType {
+	case "", "redis":
+	case "memory":
+		if c.ResponseCacheMaxEntries <= 0 {
+			addErr("response_cache_max_entries must be positive")
+		}
+	case "disk":
+		if len(c.ResponseCacheDir) == 0 {
+			addErr("response_cache_dir is empty")
+		}
+	default:
+		addErr("unknown response_cache_type [%s]", c.ResponseCacheType)
+	}
+	for _, policy := range c.ResponseCachePolicies {
+		if !strings.HasPrefix(policy.PathPrefix, "/") || policy.TTL < 0 {
+			addErr("invalid response cache policy [%s]", policy.PathPrefix)
+		}
+	}
+	for _, field := range c.FixtureScrubbedFields {
+		if !fixtureFieldRegex.MatchString(field) {
+			addErr("invalid fixture scrubbed field [%s]", field)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// scrubbed fields are matched by name in JSON responses
+var fixtureFieldRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+func isPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
@@ -1,15 +1,8 @@
 package constants
 
 const (
-	IPAddress       = "localhost"
 	CookieStateKey  = "spotify_auth_state"
 	CookieUserIDKey = "spotilizer-user-id"
-	Protocol        = "http"
-	Port            = "8080"
-	RedisPort       = "6379"
-	Permissions     = `
-		user-read-private 
-		user-read-email 
-		user-library-read 
-		user-read-birthdate`
+	// where to return the user to after login, e.g. after granting additional scopes
+	CookieReturnToKey = "spotilizer-return-to"
 )
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// ArtistsDBClient is the artist cache shared by all the users; cached artists are never removed, but stale ones
+// are refreshed from Spotify API, see services.ArtistsService
+type ArtistsDBClient interface {
+	SaveArtists(artists []models.SpFullArtist, cachedAt time.Time)
+	// GetArtists returns the cached artists, by artist ID, artists not cached yet are left out
+	GetArtists(artistIDs []string) map[string]models.CachedArtist
+}
+
+// artists are kept in the same store as library snapshots, keys being:
+//
+//	artist::id::<artist ID>
+type artistsDB struct {
+	store snapshotStore
+}
+
+func artistKey(artistID string) string {
+	return "artist::id::" + artistID
+}
+
+func (a artistsDB) SaveArtists(artists []models.SpFullArtist, cachedAt time.Time) {
+	for _, artist := range artists {
+		artistJSON, err := json.Marshal(models.CachedArtist{Artist: artist, CachedAt: cachedAt})
+		if err != nil {
+			log.Printf(" >>> json marshaling error saving artist [%s]\n", artist.ID)
+			continue
+		}
+		if err := a.store.save(artistKey(artist.ID), artistJSON); err != nil {
+			log.Printf(" >>> failed to store artist [%s]: %s\n", artist.ID, err.Error())
+		}
+	}
+	log.Tracef(" > [%d] artists saved to DB\n", len(artists))
+}
+
+func (a artistsDB) GetArtists(artistIDs []string) map[string]models.CachedArtist {
+	artists := make(map[string]models.CachedArtist)
+	for _, id := range artistIDs {
+		artistJSON, found := a.store.load(artistKey(id))
+		if !found {
+			continue
+		}
+		var artist models.CachedArtist
+		if err := json.Unmarshal(artistJSON, &artist); err != nil {
+			log.Errorf(" >>> failed to unmarshal artist [%s]: %s\n", id, err.Error())
+			continue
+		}
+		artists[id] = artist
+	}
+	return artists
+}
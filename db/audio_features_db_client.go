@@ -0,0 +1,58 @@
+package db
+
+import (
+	"encoding/json"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// AudioFeaturesDBClient caches audio features of tracks, they never change so they are fetched only once per track
+type AudioFeaturesDBClient interface {
+	SaveAudioFeatures(features []models.SpAudioFeatures)
+	// GetAudioFeatures returns the cached audio features of given tracks, tracks not cached yet are left out
+	GetAudioFeatures(trackIDs []string) map[string]models.SpAudioFeatures
+}
+
+// audio features are kept in the same store as library snapshots, keys being:
+//
+//	audiofeatures::track::<track ID>
+type audioFeaturesDB struct {
+	store snapshotStore
+}
+
+func audioFeaturesKey(trackID string) string {
+	return "audiofeatures::track::" + trackID
+}
+
+func (a audioFeaturesDB) SaveAudioFeatures(features []models.SpAudioFeatures) {
+	for _, f := range features {
+		featuresJSON, err := json.Marshal(f)
+		if err != nil {
+			log.Printf(" >>> json marshaling error saving audio features of track [%s]\n", f.ID)
+			continue
+		}
+		if err := a.store.save(audioFeaturesKey(f.ID), featuresJSON); err != nil {
+			log.Printf(" >>> failed to store audio features of track [%s]: %s\n", f.ID, err.Error())
+		}
+	}
+	log.Tracef(" > audio features of [%d] tracks saved to DB\n", len(features))
+}
+
+func (a audioFeaturesDB) GetAudioFeatures(trackIDs []string) map[string]models.SpAudioFeatures {
+	features := make(map[string]models.SpAudioFeatures)
+	for _, id := range trackIDs {
+		featuresJSON, found := a.store.load(audioFeaturesKey(id))
+		if !found {
+			continue
+		}
+		var f models.SpAudioFeatures
+		if err := json.Unmarshal(featuresJSON, &f); err != nil {
+			log.Errorf(" >>> failed to unmarshal audio features of track [%s]: %s\n", id, err.Error())
+			continue
+		}
+		features[id] = f
+	}
+	return features
+}
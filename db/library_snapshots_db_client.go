@@ -0,0 +1,402 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/redis.v3"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// library snapshots kinds, used as key prefixes
+const (
+	followedArtistsSnapshotKind = "artistsshot"
+	savedAlbumsSnapshotKind     = "albumsshot"
+	savedShowsSnapshotKind      = "showsshot"
+	savedEpisodesSnapshotKind   = "episodesshot"
+	topItemsSnapshotKind        = "topshot"
+)
+
+// LibrarySnapshotsDBClient stores snapshots of user's library, other than saved tracks and playlists
+type LibrarySnapshotsDBClient interface {
+	SaveFollowedArtistsSnapshot(s *models.FollowedArtistsSnapshot) (saved bool)
+	GetFollowedArtistsSnapshotByTimestamp(username string, timestamp string) (*models.FollowedArtistsSnapshot, error)
+	GetAllFollowedArtistsSnapshots(username string) []models.FollowedArtistsSnapshot
+	DeleteFollowedArtistsSnapshot(username string, timestamp string) (*models.FollowedArtistsSnapshot, error)
+
+	SaveSavedAlbumsSnapshot(s *models.SavedAlbumsSnapshot) (saved bool)
+	GetSavedAlbumsSnapshotByTimestamp(username string, timestamp string) (*models.SavedAlbumsSnapshot, error)
+	GetAllSavedAlbumsSnapshots(username string) []models.SavedAlbumsSnapshot
+	DeleteSavedAlbumsSnapshot(username string, timestamp string) (*models.SavedAlbumsSnapshot, error)
+
+	SaveSavedShowsSnapshot(s *models.SavedShowsSnapshot) (saved bool)
+	GetSavedShowsSnapshotByTimestamp(username string, timestamp string) (*models.SavedShowsSnapshot, error)
+	GetAllSavedShowsSnapshots(username string) []models.SavedShowsSnapshot
+	DeleteSavedShowsSnapshot(username string, timestamp string) (*models.SavedShowsSnapshot, error)
+
+	SaveSavedEpisodesSnapshot(s *models.SavedEpisodesSnapshot) (saved bool)
+	GetSavedEpisodesSnapshotByTimestamp(username string, timestamp string) (*models.SavedEpisodesSnapshot, error)
+	GetAllSavedEpisodesSnapshots(username string) []models.SavedEpisodesSnapshot
+	DeleteSavedEpisodesSnapshot(username string, timestamp string) (*models.SavedEpisodesSnapshot, error)
+
+	SaveTopItemsSnapshot(s *models.TopItemsSnapshot) (saved bool)
+	GetTopItemsSnapshotByTimestamp(username string, timestamp string) (*models.TopItemsSnapshot, error)
+	GetAllTopItemsSnapshots(username string) []models.TopItemsSnapshot
+	DeleteTopItemsSnapshot(username string, timestamp string) (*models.TopItemsSnapshot, error)
+}
+
+// snapshotStore keeps snapshot items JSON encoded, under keys like: <kind>::user::<username>::timestamp::<unix timestamp>
+type snapshotStore interface {
+	save(key string, value []byte) error
+	load(key string) (value []byte, found bool)
+	keys(prefix string) []string
+	remove(key string) error
+}
+
+// librarySnapshotsDB implements LibrarySnapshotsDBClient on top of a snapshot store, so the same code is used
+// with redis, and with in-memory store in tests
+type librarySnapshotsDB struct {
+	store snapshotStore
+}
+
+func snapshotKey(kind string, username string, timestamp string) string {
+	return fmt.Sprintf("%s::user::%s::timestamp::%s", kind, username, timestamp)
+}
+
+func (l librarySnapshotsDB) saveSnapshot(kind string, username string, timestamp time.Time, items interface{}) (saved bool) {
+	itemsJSON, err := json.Marshal(items)
+	if err != nil {
+		log.Printf(" >>> json marshaling error saving [%s] snapshot to DB for user: %s\n", kind, username)
+		return false
+	}
+	key := snapshotKey(kind, username, strconv.FormatInt(timestamp.Unix(), 10))
+	log.Tracef(" > saving new snapshot: [%s]\n", key)
+	if err := l.store.save(key, itemsJSON); err != nil {
+		log.Printf(" >>> failed to store [%s] snapshot for user [%s]: %s\n", kind, username, err.Error())
+		return false
+	}
+	log.Debugf(" > user [%s] [%s] snapshot saved to DB\n", username, kind)
+	return true
+}
+
+// loadSnapshot unmarshals items of the snapshot stored under key into items, and returns the snapshot timestamp
+func (l librarySnapshotsDB) loadSnapshot(key string, items interface{}) (timestamp time.Time, found bool) {
+	itemsJSON, found := l.store.load(key)
+	if !found {
+		return time.Time{}, false
+	}
+	keyParts := strings.Split(key, "::")
+	timestampInt, err := strconv.ParseInt(keyParts[len(keyParts)-1], 10, 64)
+	if err != nil {
+		log.Debugf(" >>> error while parsing snapshot [%s] timestamp", key)
+		return time.Time{}, false
+	}
+	if err := json.Unmarshal(itemsJSON, items); err != nil {
+		log.Errorf(" >>> failed to unmarshal snapshot [%s]: %s\n", key, err.Error())
+		return time.Time{}, false
+	}
+	return time.Unix(timestampInt, 0), true
+}
+
+// snapshotKeys returns the keys of all user's snapshots of given kind, oldest first
+func (l librarySnapshotsDB) snapshotKeys(kind string, username string) []string {
+	keys := l.store.keys(fmt.Sprintf("%s::user::%s::timestamp::", kind, username))
+	sort.Strings(keys)
+	return keys
+}
+
+func (l librarySnapshotsDB) SaveFollowedArtistsSnapshot(s *models.FollowedArtistsSnapshot) (saved bool) {
+	return l.saveSnapshot(followedArtistsSnapshotKind, s.Username, s.Timestamp, s.Artists)
+}
+
+func (l librarySnapshotsDB) GetFollowedArtistsSnapshotByTimestamp(username string, timestamp string) (*models.FollowedArtistsSnapshot, error) {
+	snapshot := l.getFollowedArtistsSnapshot(username, snapshotKey(followedArtistsSnapshotKind, username, timestamp))
+	if snapshot == nil {
+		return nil, fmt.Errorf("snapshot [%s] not found", timestamp)
+	}
+	return snapshot, nil
+}
+
+func (l librarySnapshotsDB) GetAllFollowedArtistsSnapshots(username string) []models.FollowedArtistsSnapshot {
+	var snapshots []models.FollowedArtistsSnapshot
+	for _, key := range l.snapshotKeys(followedArtistsSnapshotKind, username) {
+		if snapshot := l.getFollowedArtistsSnapshot(username, key); snapshot != nil {
+			snapshots = append(snapshots, *snapshot)
+		}
+	}
+	return snapshots
+}
+
+func (l librarySnapshotsDB) DeleteFollowedArtistsSnapshot(username string, timestamp string) (*models.FollowedArtistsSnapshot, error) {
+	snapshot, err := l.GetFollowedArtistsSnapshotByTimestamp(username, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.store.remove(snapshotKey(followedArtistsSnapshotKind, username, timestamp)); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (l librarySnapshotsDB) getFollowedArtistsSnapshot(username string, key string) *models.FollowedArtistsSnapshot {
+	snapshot := &models.FollowedArtistsSnapshot{Username: username}
+	timestamp, found := l.loadSnapshot(key, &snapshot.Artists)
+	if !found {
+		return nil
+	}
+	snapshot.Timestamp = timestamp
+	return snapshot
+}
+
+func (l librarySnapshotsDB) SaveSavedAlbumsSnapshot(s *models.SavedAlbumsSnapshot) (saved bool) {
+	return l.saveSnapshot(savedAlbumsSnapshotKind, s.Username, s.Timestamp, s.Albums)
+}
+
+func (l librarySnapshotsDB) GetSavedAlbumsSnapshotByTimestamp(username string, timestamp string) (*models.SavedAlbumsSnapshot, error) {
+	snapshot := l.getSavedAlbumsSnapshot(username, snapshotKey(savedAlbumsSnapshotKind, username, timestamp))
+	if snapshot == nil {
+		return nil, fmt.Errorf("snapshot [%s] not found", timestamp)
+	}
+	return snapshot, nil
+}
+
+func (l librarySnapshotsDB) GetAllSavedAlbumsSnapshots(username string) []models.SavedAlbumsSnapshot {
+	var snapshots []models.SavedAlbumsSnapshot
+	for _, key := range l.snapshotKeys(savedAlbumsSnapshotKind, username) {
+		if snapshot := l.getSavedAlbumsSnapshot(username, key); snapshot != nil {
+			snapshots = append(snapshots, *snapshot)
+		}
+	}
+	return snapshots
+}
+
+func (l librarySnapshotsDB) DeleteSavedAlbumsSnapshot(username string, timestamp string) (*models.SavedAlbumsSnapshot, error) {
+	snapshot, err := l.GetSavedAlbumsSnapshotByTimestamp(username, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.store.remove(snapshotKey(savedAlbumsSnapshotKind, username, timestamp)); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (l librarySnapshotsDB) getSavedAlbumsSnapshot(username string, key string) *models.SavedAlbumsSnapshot {
+	snapshot := &models.SavedAlbumsSnapshot{Username: username}
+	timestamp, found := l.loadSnapshot(key, &snapshot.Albums)
+	if !found {
+		return nil
+	}
+	snapshot.Timestamp = timestamp
+	return snapshot
+}
+
+func (l librarySnapshotsDB) SaveSavedShowsSnapshot(s *models.SavedShowsSnapshot) (saved bool) {
+	return l.saveSnapshot(savedShowsSnapshotKind, s.Username, s.Timestamp, s.Shows)
+}
+
+func (l librarySnapshotsDB) GetSavedShowsSnapshotByTimestamp(username string, timestamp string) (*models.SavedShowsSnapshot, error) {
+	snapshot := l.getSavedShowsSnapshot(username, snapshotKey(savedShowsSnapshotKind, username, timestamp))
+	if snapshot == nil {
+		return nil, fmt.Errorf("snapshot [%s] not found", timestamp)
+	}
+	return snapshot, nil
+}
+
+func (l librarySnapshotsDB) GetAllSavedShowsSnapshots(username string) []models.SavedShowsSnapshot {
+	var snapshots []models.SavedShowsSnapshot
+	for _, key := range l.snapshotKeys(savedShowsSnapshotKind, username) {
+		if snapshot := l.getSavedShowsSnapshot(username, key); snapshot != nil {
+			snapshots = append(snapshots, *snapshot)
+		}
+	}
+	return snapshots
+}
+
+func (l librarySnapshotsDB) DeleteSavedShowsSnapshot(username string, timestamp string) (*models.SavedShowsSnapshot, error) {
+	snapshot, err := l.GetSavedShowsSnapshotByTimestamp(username, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.store.remove(snapshotKey(savedShowsSnapshotKind, username, timestamp)); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (l librarySnapshotsDB) getSavedShowsSnapshot(username string, key string) *models.SavedShowsSnapshot {
+	snapshot := &models.SavedShowsSnapshot{Username: username}
+	timestamp, found := l.loadSnapshot(key, &snapshot.Shows)
+	if !found {
+		return nil
+	}
+	snapshot.Timestamp = timestamp
+	return snapshot
+}
+
+func (l librarySnapshotsDB) SaveSavedEpisodesSnapshot(s *models.SavedEpisodesSnapshot) (saved bool) {
+	return l.saveSnapshot(savedEpisodesSnapshotKind, s.Username, s.Timestamp, s.Episodes)
+}
+
+func (l librarySnapshotsDB) GetSavedEpisodesSnapshotByTimestamp(username string, timestamp string) (*models.SavedEpisodesSnapshot, error) {
+	snapshot := l.getSavedEpisodesSnapshot(username, snapshotKey(savedEpisodesSnapshotKind, username, timestamp))
+	if snapshot == nil {
+		return nil, fmt.Errorf("snapshot [%s] not found", timestamp)
+	}
+	return snapshot, nil
+}
+
+func (l librarySnapshotsDB) GetAllSavedEpisodesSnapshots(username string) []models.SavedEpisodesSnapshot {
+	var snapshots []models.SavedEpisodesSnapshot
+	for _, key := range l.snapshotKeys(savedEpisodesSnapshotKind, username) {
+		if snapshot := l.getSavedEpisodesSnapshot(username, key); snapshot != nil {
+			snapshots = append(snapshots, *snapshot)
+		}
+	}
+	return snapshots
+}
+
+func (l librarySnapshotsDB) DeleteSavedEpisodesSnapshot(username string, timestamp string) (*models.SavedEpisodesSnapshot, error) {
+	snapshot, err := l.GetSavedEpisodesSnapshotByTimestamp(username, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.store.remove(snapshotKey(savedEpisodesSnapshotKind, username, timestamp)); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (l librarySnapshotsDB) getSavedEpisodesSnapshot(username string, key string) *models.SavedEpisodesSnapshot {
+	snapshot := &models.SavedEpisodesSnapshot{Username: username}
+	timestamp, found := l.loadSnapshot(key, &snapshot.Episodes)
+	if !found {
+		return nil
+	}
+	snapshot.Timestamp = timestamp
+	return snapshot
+}
+
+func (l librarySnapshotsDB) SaveTopItemsSnapshot(s *models.TopItemsSnapshot) (saved bool) {
+	return l.saveSnapshot(topItemsSnapshotKind, s.Username, s.Timestamp, s.TopItems)
+}
+
+func (l librarySnapshotsDB) GetTopItemsSnapshotByTimestamp(username string, timestamp string) (*models.TopItemsSnapshot, error) {
+	snapshot := l.getTopItemsSnapshot(username, snapshotKey(topItemsSnapshotKind, username, timestamp))
+	if snapshot == nil {
+		return nil, fmt.Errorf("snapshot [%s] not found", timestamp)
+	}
+	return snapshot, nil
+}
+
+func (l librarySnapshotsDB) GetAllTopItemsSnapshots(username string) []models.TopItemsSnapshot {
+	var snapshots []models.TopItemsSnapshot
+	for _, key := range l.snapshotKeys(topItemsSnapshotKind, username) {
+		if snapshot := l.getTopItemsSnapshot(username, key); snapshot != nil {
+			snapshots = append(snapshots, *snapshot)
+		}
+	}
+	return snapshots
+}
+
+func (l librarySnapshotsDB) DeleteTopItemsSnapshot(username string, timestamp string) (*models.TopItemsSnapshot, error) {
+	snapshot, err := l.GetTopItemsSnapshotByTimestamp(username, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.store.remove(snapshotKey(topItemsSnapshotKind, username, timestamp)); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (l librarySnapshotsDB) getTopItemsSnapshot(username string, key string) *models.TopItemsSnapshot {
+	snapshot := &models.TopItemsSnapshot{Username: username}
+	timestamp, found := l.loadSnapshot(key, &snapshot.TopItems)
+	if !found {
+		return nil
+	}
+	snapshot.Timestamp = timestamp
+	return snapshot
+}
+
+// redisSnapshotStore keeps snapshots in redis
+type redisSnapshotStore struct{}
+
+func (s redisSnapshotStore) save(key string, value []byte) error {
+	return rc.Set(key, string(value), 0).Err()
+}
+
+func (s redisSnapshotStore) load(key string) ([]byte, bool) {
+	cmd := rc.Get(key)
+	if err := cmd.Err(); err != nil {
+		if err != redis.Nil {
+			log.Printf(" >>> failed to get snapshot [%s]: %s\n", key, err.Error())
+		}
+		return nil, false
+	}
+	return []byte(cmd.Val()), true
+}
+
+func (s redisSnapshotStore) keys(prefix string) []string {
+	cmd := rc.Keys(prefix + "*")
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		log.Printf(" >>> failed to get snapshots keys [%s]: %s\n", prefix, err.Error())
+		return nil
+	}
+	return cmd.Val()
+}
+
+func (s redisSnapshotStore) remove(key string) error {
+	return rc.Del(key).Err()
+}
+
+// memorySnapshotStore keeps snapshots in memory, used for testing instead of redis
+type memorySnapshotStore struct {
+	mutex     sync.Mutex
+	snapshots map[string][]byte
+}
+
+func newMemorySnapshotStore() *memorySnapshotStore {
+	return &memorySnapshotStore{snapshots: make(map[string][]byte)}
+}
+
+func (s *memorySnapshotStore) save(key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.snapshots[key] = value
+	return nil
+}
+
+func (s *memorySnapshotStore) load(key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, found := s.snapshots[key]
+	return value, found
+}
+
+func (s *memorySnapshotStore) keys(prefix string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var keys []string
+	for key := range s.snapshots {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (s *memorySnapshotStore) remove(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.snapshots, key)
+	return nil
+}
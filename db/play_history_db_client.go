@@ -0,0 +1,219 @@
+package db
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+
+	"gopkg.in/redis.v3"
+)
+
+// PlayHistoryDBClient stores user's play history, collected from recently played tracks, and the list of users
+// who opted in for collecting it
+type PlayHistoryDBClient interface {
+	// AddPlays stores the plays not stored before, plays are identified by their played_at time
+	AddPlays(username string, plays []models.SpPlayHistory) (added int)
+	// GetPlays returns the plays in [from, to] time range, oldest first
+	GetPlays(username string, from time.Time, to time.Time) []models.SpPlayHistory
+	GetLatestPlayedAt(username string) (playedAt time.Time, found bool)
+	SetPlayHistoryEnabled(username string, enabled bool) error
+	PlayHistoryEnabled(username string) bool
+	GetPlayHistoryUsers() []string
+}
+
+// play history is kept in redis sorted sets, one per user, with plays JSON encoded and scored by their
+// played_at time (unix ms), so time range reads never go through all the user's plays. Users who enabled
+// it are kept in the same store as library snapshots. Keys being:
+//
+//	playhistory::user::<username>
+//	playhistoryuser::user::<username>
+type playHistoryDB struct {
+	store snapshotStore
+	plays sortedSetStore
+}
+
+func playsKey(username string) string {
+	return "playhistory::user::" + username
+}
+
+func playHistoryUserKey(username string) string {
+	return "playhistoryuser::user::" + username
+}
+
+func unixMs(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func (p playHistoryDB) AddPlays(username string, plays []models.SpPlayHistory) (added int) {
+	key := playsKey(username)
+	for _, play := range plays {
+		playJSON, err := json.Marshal(play)
+		if err != nil {
+			log.Printf(" >>> json marshaling error saving play [%v] for user: %s\n", play.PlayedAt, username)
+			continue
+		}
+		isNew, err := p.plays.addNew(key, unixMs(play.PlayedAt), playJSON)
+		if err != nil {
+			log.Printf(" >>> failed to store play [%v] for user [%s]: %s\n", play.PlayedAt, username, err.Error())
+			continue
+		}
+		if isNew {
+			added++
+		}
+	}
+	log.Debugf(" > user [%s] play history: [%d] of [%d] plays added\n", username, added, len(plays))
+	return added
+}
+
+func (p playHistoryDB) GetPlays(username string, from time.Time, to time.Time) []models.SpPlayHistory {
+	plays := []models.SpPlayHistory{}
+	for _, playJSON := range p.plays.rangeByScore(playsKey(username), unixMs(from), unixMs(to)) {
+		var play models.SpPlayHistory
+		if err := json.Unmarshal(playJSON, &play); err != nil {
+			log.Errorf(" >>> failed to unmarshal play of user [%s]: %s\n", username, err.Error())
+			continue
+		}
+		plays = append(plays, play)
+	}
+	return plays
+}
+
+func (p playHistoryDB) GetLatestPlayedAt(username string) (playedAt time.Time, found bool) {
+	latestMs, found := p.plays.maxScore(playsKey(username))
+	if !found {
+		return time.Time{}, false
+	}
+	return time.Unix(0, latestMs*int64(time.Millisecond)), true
+}
+
+func (p playHistoryDB) SetPlayHistoryEnabled(username string, enabled bool) error {
+	if enabled {
+		return p.store.save(playHistoryUserKey(username), []byte(strconv.FormatInt(time.Now().Unix(), 10)))
+	}
+	return p.store.remove(playHistoryUserKey(username))
+}
+
+func (p playHistoryDB) PlayHistoryEnabled(username string) bool {
+	_, found := p.store.load(playHistoryUserKey(username))
+	return found
+}
+
+func (p playHistoryDB) GetPlayHistoryUsers() []string {
+	var usernames []string
+	for _, key := range p.store.keys(playHistoryUserKey("")) {
+		usernames = append(usernames, strings.TrimPrefix(key, playHistoryUserKey("")))
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// sortedSetStore keeps members ordered by their score, with a single member per score
+type sortedSetStore interface {
+	// addNew adds the member, unless the set already has a member with the same score
+	addNew(key string, score int64, member []byte) (added bool, err error)
+	// rangeByScore returns members with score in [min, max], lowest score first
+	rangeByScore(key string, min int64, max int64) [][]byte
+	maxScore(key string) (score int64, found bool)
+}
+
+// redisSortedSetStore keeps sorted sets in redis
+type redisSortedSetStore struct{}
+
+func (s redisSortedSetStore) addNew(key string, score int64, member []byte) (bool, error) {
+	scoreStr := strconv.FormatInt(score, 10)
+	countCmd := rc.ZCount(key, scoreStr, scoreStr)
+	if err := countCmd.Err(); err != nil {
+		return false, err
+	}
+	if countCmd.Val() > 0 {
+		return false, nil
+	}
+	if err := rc.ZAdd(key, redis.Z{Score: float64(score), Member: string(member)}).Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s redisSortedSetStore) rangeByScore(key string, min int64, max int64) [][]byte {
+	cmd := rc.ZRangeByScore(key, redis.ZRangeByScore{Min: strconv.FormatInt(min, 10), Max: strconv.FormatInt(max, 10)})
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		log.Printf(" >>> failed to get [%s] range [%d, %d]: %s\n", key, min, max, err.Error())
+		return nil
+	}
+	var members [][]byte
+	for _, m := range cmd.Val() {
+		members = append(members, []byte(m))
+	}
+	return members
+}
+
+func (s redisSortedSetStore) maxScore(key string) (int64, bool) {
+	cmd := rc.ZRevRangeWithScores(key, 0, 0)
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		log.Printf(" >>> failed to get [%s] max score: %s\n", key, err.Error())
+		return 0, false
+	}
+	if len(cmd.Val()) == 0 {
+		return 0, false
+	}
+	return int64(cmd.Val()[0].Score), true
+}
+
+type sortedSetMember struct {
+	score  int64
+	member []byte
+}
+
+// memorySortedSetStore keeps sorted sets in memory, used for testing instead of redis
+type memorySortedSetStore struct {
+	mutex sync.Mutex
+	sets  map[string][]sortedSetMember
+}
+
+func newMemorySortedSetStore() *memorySortedSetStore {
+	return &memorySortedSetStore{sets: make(map[string][]sortedSetMember)}
+}
+
+func (s *memorySortedSetStore) addNew(key string, score int64, member []byte) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	set := s.sets[key]
+	i := sort.Search(len(set), func(i int) bool { return set[i].score >= score })
+	if i < len(set) && set[i].score == score {
+		return false, nil
+	}
+	set = append(set, sortedSetMember{})
+	copy(set[i+1:], set[i:])
+	set[i] = sortedSetMember{score: score, member: member}
+	s.sets[key] = set
+	return true, nil
+}
+
+func (s *memorySortedSetStore) rangeByScore(key string, min int64, max int64) [][]byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var members [][]byte
+	for _, m := range s.sets[key] {
+		if m.score >= min && m.score <= max {
+			members = append(members, m.member)
+		}
+	}
+	return members
+}
+
+func (s *memorySortedSetStore) maxScore(key string) (int64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	set := s.sets[key]
+	if len(set) == 0 {
+		return 0, false
+	}
+	return set[len(set)-1].score, true
+}
@@ -5,7 +5,7 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/2beens/spotilizer/constants"
+	"github.com/2beens/spotilizer/config"
 
 	"gopkg.in/redis.v3"
 )
@@ -23,7 +23,7 @@ func InitRedisClient(flashDB bool) {
 	log.Println(" > initializing redis ...")
 	options := &redis.Options{
 		Network: "tcp",
-		Addr:    fmt.Sprintf("%s:%s", constants.IPAddress, constants.RedisPort), // localhost:6379
+		Addr:    fmt.Sprintf("%s:%s", config.Conf.RedisHost, config.Conf.RedisPort), // localhost:6379
 		DB:      int64(6),
 	}
 
@@ -40,7 +40,14 @@ func InitRedisClient(flashDB bool) {
 
 	cookiesDBClient = &CookiesDB{}
 	usersDBClient = &UsersDBRedisClient{}
-	spotifyDBClient = &SpotifyDB{}
+	spotifyDBClient = &SpotifyDB{
+		librarySnapshotsDB: librarySnapshotsDB{store: redisSnapshotStore{}},
+		playHistoryDB:      playHistoryDB{store: redisSnapshotStore{}, plays: redisSortedSetStore{}},
+		audioFeaturesDB:    audioFeaturesDB{store: redisSnapshotStore{}},
+		artistsDB:          artistsDB{store: redisSnapshotStore{}},
+		writeBackDB:        writeBackDB{store: redisSnapshotStore{}},
+		snapshotScheduleDB: snapshotScheduleDB{store: redisSnapshotStore{}},
+	}
 
 	log.Printf(" > connected to redis %+v\n", options)
 }
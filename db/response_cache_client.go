@@ -0,0 +1,182 @@
+package db
+
+import (
+	"container/list"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+	"gopkg.in/redis.v3"
+)
+
+// ResponseCacheClient stores Spotify API responses, so they can be served without calling the API again.
+// Keys are expected to be safe to be used as file names.
+type ResponseCacheClient interface {
+	GetResponse(key string) *models.CachedResponse
+	SaveResponse(key string, resp *models.CachedResponse) (saved bool)
+}
+
+// responses are kept in redis and on disk a while after they expire, since they can still be revalidated using ETag
+var responseCacheRetention = 7 * 24 * time.Hour
+
+/****************** R E D I S **********************************************************************/
+
+type ResponseCacheRedisClient struct{}
+
+func NewResponseCacheRedisClient() *ResponseCacheRedisClient {
+	return &ResponseCacheRedisClient{}
+}
+
+func (c *ResponseCacheRedisClient) GetResponse(key string) *models.CachedResponse {
+	cmd := rc.Get("spresponse::" + key)
+	if err := cmd.Err(); err != nil {
+		if err != redis.Nil {
+			log.Printf(" >>> failed to get cached response [%s]: %s\n", key, err.Error())
+		}
+		return nil
+	}
+	resp := &models.CachedResponse{}
+	if err := json.Unmarshal([]byte(cmd.Val()), resp); err != nil {
+		log.Errorf(" >>> failed to unmarshal cached response [%s]: %s\n", key, err.Error())
+		return nil
+	}
+	return resp
+}
+
+func (c *ResponseCacheRedisClient) SaveResponse(key string, resp *models.CachedResponse) (saved bool) {
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		log.Println(" >>> json marshaling error saving cached response: " + resp.URL)
+		return false
+	}
+	cmd := rc.Set("spresponse::"+key, string(respJSON), time.Until(resp.ExpiresAt)+responseCacheRetention)
+	if err := cmd.Err(); err != nil {
+		log.Printf(" >>> failed to store cached response [%s]: %s\n", resp.URL, err.Error())
+		return false
+	}
+	return true
+}
+
+/****************** M E M O R Y   ( L R U ) ********************************************************/
+
+type memoryCacheEntry struct {
+	key  string
+	resp *models.CachedResponse
+}
+
+// ResponseCacheMemoryClient keeps at most maxEntries responses in memory, evicting the least recently used ones
+type ResponseCacheMemoryClient struct {
+	mutex      sync.Mutex
+	maxEntries int
+	entries    *list.List
+	key2entry  map[string]*list.Element
+}
+
+func NewResponseCacheMemoryClient(maxEntries int) *ResponseCacheMemoryClient {
+	return &ResponseCacheMemoryClient{
+		maxEntries: maxEntries,
+		entries:    list.New(),
+		key2entry:  make(map[string]*list.Element),
+	}
+}
+
+func (c *ResponseCacheMemoryClient) GetResponse(key string) *models.CachedResponse {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, found := c.key2entry[key]
+	if !found {
+		return nil
+	}
+	c.entries.MoveToFront(elem)
+	return elem.Value.(*memoryCacheEntry).resp
+}
+
+func (c *ResponseCacheMemoryClient) SaveResponse(key string, resp *models.CachedResponse) (saved bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, found := c.key2entry[key]; found {
+		elem.Value.(*memoryCacheEntry).resp = resp
+		c.entries.MoveToFront(elem)
+		return true
+	}
+
+	c.key2entry[key] = c.entries.PushFront(&memoryCacheEntry{key: key, resp: resp})
+	for c.maxEntries > 0 && c.entries.Len() > c.maxEntries {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.key2entry, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return true
+}
+
+/****************** D I S K ************************************************************************/
+
+// ResponseCacheDiskClient stores each response as a JSON file in the cache dir
+type ResponseCacheDiskClient struct {
+	dir string
+}
+
+func NewResponseCacheDiskClient(dir string) (*ResponseCacheDiskClient, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ResponseCacheDiskClient{dir: dir}, nil
+}
+
+func (c *ResponseCacheDiskClient) GetResponse(key string) *models.CachedResponse {
+	respJSON, err := ioutil.ReadFile(c.filePath(key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf(" >>> failed to read cached response [%s]: %s\n", key, err.Error())
+		}
+		return nil
+	}
+	resp := &models.CachedResponse{}
+	if err := json.Unmarshal(respJSON, resp); err != nil {
+		log.Errorf(" >>> failed to unmarshal cached response [%s]: %s\n", key, err.Error())
+		return nil
+	}
+	if time.Since(resp.ExpiresAt) > responseCacheRetention {
+		os.Remove(c.filePath(key))
+		return nil
+	}
+	return resp
+}
+
+func (c *ResponseCacheDiskClient) SaveResponse(key string, resp *models.CachedResponse) (saved bool) {
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		log.Println(" >>> json marshaling error saving cached response: " + resp.URL)
+		return false
+	}
+	// write to a temp file first, so readers never see a partially written response
+	tmpFile, err := ioutil.TempFile(c.dir, key+".*.tmp")
+	if err != nil {
+		log.Printf(" >>> failed to store cached response [%s]: %s\n", resp.URL, err.Error())
+		return false
+	}
+	_, err = tmpFile.Write(respJSON)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), c.filePath(key))
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		log.Printf(" >>> failed to store cached response [%s]: %s\n", resp.URL, err.Error())
+		return false
+	}
+	return true
+}
+
+func (c *ResponseCacheDiskClient) filePath(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// SnapshotScheduleDBClient stores users' snapshot schedules, a single one per user
+type SnapshotScheduleDBClient interface {
+	SaveSnapshotSchedule(schedule *models.SnapshotSchedule) (saved bool)
+	GetSnapshotSchedule(username string) *models.SnapshotSchedule
+	GetAllSnapshotSchedules() []models.SnapshotSchedule
+	DeleteSnapshotSchedule(username string) error
+}
+
+// snapshot schedules are kept in the same store as library snapshots, keys being:
+//
+//	schedule::user::<username>
+type snapshotScheduleDB struct {
+	store snapshotStore
+}
+
+const snapshotScheduleKeyPrefix = "schedule::user::"
+
+func snapshotScheduleKey(username string) string {
+	return fmt.Sprintf("%s%s", snapshotScheduleKeyPrefix, username)
+}
+
+func (s snapshotScheduleDB) SaveSnapshotSchedule(schedule *models.SnapshotSchedule) (saved bool) {
+	scheduleJSON, err := json.Marshal(schedule)
+	if err != nil {
+		log.Printf(" >>> json marshaling error saving snapshot schedule for user: %s\n", schedule.Username)
+		return false
+	}
+	if err := s.store.save(snapshotScheduleKey(schedule.Username), scheduleJSON); err != nil {
+		log.Printf(" >>> failed to store snapshot schedule for user [%s]: %s\n", schedule.Username, err.Error())
+		return false
+	}
+	log.Tracef(" > user [%s] snapshot schedule saved to DB\n", schedule.Username)
+	return true
+}
+
+func (s snapshotScheduleDB) GetSnapshotSchedule(username string) *models.SnapshotSchedule {
+	return s.loadSchedule(snapshotScheduleKey(username))
+}
+
+func (s snapshotScheduleDB) GetAllSnapshotSchedules() []models.SnapshotSchedule {
+	schedules := []models.SnapshotSchedule{}
+	for _, key := range s.store.keys(snapshotScheduleKeyPrefix) {
+		if schedule := s.loadSchedule(key); schedule != nil {
+			schedules = append(schedules, *schedule)
+		}
+	}
+	return schedules
+}
+
+func (s snapshotScheduleDB) DeleteSnapshotSchedule(username string) error {
+	return s.store.remove(snapshotScheduleKey(username))
+}
+
+func (s snapshotScheduleDB) loadSchedule(key string) *models.SnapshotSchedule {
+	scheduleJSON, found := s.store.load(key)
+	if !found {
+		return nil
+	}
+	var schedule models.SnapshotSchedule
+	if err := json.Unmarshal(scheduleJSON, &schedule); err != nil {
+		log.Errorf(" >>> failed to unmarshal snapshot schedule [%s]: %s\n", key, err.Error())
+		return nil
+	}
+	return &schedule
+}
@@ -14,6 +14,12 @@ import (
 )
 
 type SpotifyDBClient interface {
+	LibrarySnapshotsDBClient
+	PlayHistoryDBClient
+	AudioFeaturesDBClient
+	ArtistsDBClient
+	WriteBackDBClient
+	SnapshotScheduleDBClient
 	SaveFavTracksSnapshot(ft *models.FavTracksSnapshot) (saved bool)
 	SavePlaylistsSnapshot(ps *models.PlaylistsSnapshot) (saved bool)
 	DeletePlaylistsSnapshot(username string, timestamp string) (*models.PlaylistsSnapshot, error)
@@ -24,9 +30,17 @@ type SpotifyDBClient interface {
 	GetFavTracksSnapshot(key string) *models.FavTracksSnapshot
 	GetAllFavTracksSnapshots(username string) []models.FavTracksSnapshot
 	GetAllPlaylistsSnapshots(username string) []models.PlaylistsSnapshot
+	GetLatestPlaylistsSnapshot(username string) *models.PlaylistsSnapshot
 }
 
-type SpotifyDB struct{}
+type SpotifyDB struct {
+	librarySnapshotsDB
+	playHistoryDB
+	audioFeaturesDB
+	artistsDB
+	writeBackDB
+	snapshotScheduleDB
+}
 
 func (sDB SpotifyDB) SaveFavTracksSnapshot(ft *models.FavTracksSnapshot) (saved bool) {
 	log.Tracef(" > saving fav tracks [%d] for user [%s] ...\n", len(ft.Tracks), ft.Username)
@@ -221,3 +235,29 @@ func (sDB SpotifyDB) GetAllPlaylistsSnapshots(username string) []models.Playlist
 	}
 	return plsnapshots
 }
+
+func (sDB SpotifyDB) GetLatestPlaylistsSnapshot(username string) *models.PlaylistsSnapshot {
+	snapshotsKey := fmt.Sprintf("playlistsshot::user::%s::timestamp::*", username)
+	cmd := rc.Keys(snapshotsKey)
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		log.Printf(" >>> failed to get latest playlists snapshot for user [%s]: %s\n", username, err.Error())
+		return nil
+	}
+	latestKey := ""
+	var latestTimestamp int64
+	for _, skey := range cmd.Val() {
+		keyParts := strings.Split(skey, "::")
+		timestamp, err := strconv.ParseInt(keyParts[len(keyParts)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if timestamp > latestTimestamp {
+			latestTimestamp = timestamp
+			latestKey = skey
+		}
+	}
+	if latestKey == "" {
+		return nil
+	}
+	return sDB.GetPlaylistsSnapshot(latestKey)
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// SpotifyDBTestClient keeps snapshots in memory, used for testing instead of redis
+type SpotifyDBTestClient struct {
+	librarySnapshotsDB
+	playHistoryDB
+	audioFeaturesDB
+	artistsDB
+	writeBackDB
+	snapshotScheduleDB
+	mutex              sync.Mutex
+	favTracksSnapshots map[string]models.FavTracksSnapshot
+	playlistsSnapshots map[string]models.PlaylistsSnapshot
+}
+
+func NewSpotifyDBTest() *SpotifyDBTestClient {
+	return &SpotifyDBTestClient{
+		librarySnapshotsDB: librarySnapshotsDB{store: newMemorySnapshotStore()},
+		playHistoryDB:      playHistoryDB{store: newMemorySnapshotStore(), plays: newMemorySortedSetStore()},
+		audioFeaturesDB:    audioFeaturesDB{store: newMemorySnapshotStore()},
+		artistsDB:          artistsDB{store: newMemorySnapshotStore()},
+		writeBackDB:        writeBackDB{store: newMemorySnapshotStore()},
+		snapshotScheduleDB: snapshotScheduleDB{store: newMemorySnapshotStore()},
+		favTracksSnapshots: make(map[string]models.FavTracksSnapshot),
+		playlistsSnapshots: make(map[string]models.PlaylistsSnapshot),
+	}
+}
+
+func testSnapshotKey(username string, timestamp string) string {
+	return fmt.Sprintf("user::%s::timestamp::%s", username, timestamp)
+}
+
+func (c *SpotifyDBTestClient) SaveFavTracksSnapshot(ft *models.FavTracksSnapshot) (saved bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.favTracksSnapshots[testSnapshotKey(ft.Username, strconv.FormatInt(ft.Timestamp.Unix(), 10))] = *ft
+	return true
+}
+
+func (c *SpotifyDBTestClient) SavePlaylistsSnapshot(ps *models.PlaylistsSnapshot) (saved bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.playlistsSnapshots[testSnapshotKey(ps.Username, strconv.FormatInt(ps.Timestamp.Unix(), 10))] = *ps
+	return true
+}
+
+func (c *SpotifyDBTestClient) DeletePlaylistsSnapshot(username string, timestamp string) (*models.PlaylistsSnapshot, error) {
+	snapshot, err := c.GetPlaylistsSnapshotByTimestamp(username, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.playlistsSnapshots, testSnapshotKey(username, timestamp))
+	return snapshot, nil
+}
+
+func (c *SpotifyDBTestClient) DeleteFavTracksSnapshot(username string, timestamp string) (*models.FavTracksSnapshot, error) {
+	snapshot, err := c.GetFavTracksSnapshotByTimestamp(username, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.favTracksSnapshots, testSnapshotKey(username, timestamp))
+	return snapshot, nil
+}
+
+func (c *SpotifyDBTestClient) GetPlaylistsSnapshotByTimestamp(username string, timestamp string) (*models.PlaylistsSnapshot, error) {
+	snapshot := c.GetPlaylistsSnapshot(testSnapshotKey(username, timestamp))
+	if snapshot == nil {
+		return nil, fmt.Errorf("snapshot [%s] not found", timestamp)
+	}
+	return snapshot, nil
+}
+
+func (c *SpotifyDBTestClient) GetFavTracksSnapshotByTimestamp(username string, timestamp string) (*models.FavTracksSnapshot, error) {
+	snapshot := c.GetFavTracksSnapshot(testSnapshotKey(username, timestamp))
+	if snapshot == nil {
+		return nil, fmt.Errorf("snapshot [%s] not found", timestamp)
+	}
+	return snapshot, nil
+}
+
+func (c *SpotifyDBTestClient) GetPlaylistsSnapshot(key string) *models.PlaylistsSnapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	snapshot, found := c.playlistsSnapshots[key]
+	if !found {
+		return nil
+	}
+	return &snapshot
+}
+
+func (c *SpotifyDBTestClient) GetFavTracksSnapshot(key string) *models.FavTracksSnapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	snapshot, found := c.favTracksSnapshots[key]
+	if !found {
+		return nil
+	}
+	return &snapshot
+}
+
+func (c *SpotifyDBTestClient) GetAllFavTracksSnapshots(username string) []models.FavTracksSnapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var snapshots []models.FavTracksSnapshot
+	for _, s := range c.favTracksSnapshots {
+		if s.Username == username {
+			snapshots = append(snapshots, s)
+		}
+	}
+	return snapshots
+}
+
+func (c *SpotifyDBTestClient) GetAllPlaylistsSnapshots(username string) []models.PlaylistsSnapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var snapshots []models.PlaylistsSnapshot
+	for _, s := range c.playlistsSnapshots {
+		if s.Username == username {
+			snapshots = append(snapshots, s)
+		}
+	}
+	return snapshots
+}
+
+func (c *SpotifyDBTestClient) GetLatestPlaylistsSnapshot(username string) *models.PlaylistsSnapshot {
+	var latest *models.PlaylistsSnapshot
+	for _, s := range c.GetAllPlaylistsSnapshots(username) {
+		s := s
+		if latest == nil || s.Timestamp.After(latest.Timestamp) {
+			latest = &s
+		}
+	}
+	return latest
+}
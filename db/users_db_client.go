@@ -24,7 +24,7 @@ type UsersDBClient interface {
 type UsersDBRedisClient struct{}
 
 func (uDB *UsersDBRedisClient) SaveUser(user *models.User) (stored bool) {
-	auth, err := json.Marshal(user.Auth)
+	auth, err := json.Marshal(user.CurrentAuth())
 	if err != nil {
 		fmt.Println(" >>> error while storing user info: " + err.Error())
 		return false
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// WriteBackDBClient stores write-back plans, along with the records of their executions
+type WriteBackDBClient interface {
+	SaveWriteBackPlan(plan *models.WriteBackPlan) (saved bool)
+	GetWriteBackPlan(username string, id string) *models.WriteBackPlan
+	// GetAllWriteBackPlans returns all user's plans, oldest first
+	GetAllWriteBackPlans(username string) []models.WriteBackPlan
+}
+
+// write-back plans are kept in the same store as library snapshots, keys being:
+//
+//	writeback::user::<username>::id::<plan ID>
+type writeBackDB struct {
+	store snapshotStore
+}
+
+func writeBackPlanKey(username string, id string) string {
+	return fmt.Sprintf("writeback::user::%s::id::%s", username, id)
+}
+
+func (wb writeBackDB) SaveWriteBackPlan(plan *models.WriteBackPlan) (saved bool) {
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		log.Printf(" >>> json marshaling error saving write-back plan [%s] for user: %s\n", plan.ID, plan.Username)
+		return false
+	}
+	if err := wb.store.save(writeBackPlanKey(plan.Username, plan.ID), planJSON); err != nil {
+		log.Printf(" >>> failed to store write-back plan [%s] for user [%s]: %s\n", plan.ID, plan.Username, err.Error())
+		return false
+	}
+	log.Tracef(" > user [%s] write-back plan [%s] saved to DB\n", plan.Username, plan.ID)
+	return true
+}
+
+func (wb writeBackDB) GetWriteBackPlan(username string, id string) *models.WriteBackPlan {
+	return wb.loadPlan(writeBackPlanKey(username, id))
+}
+
+func (wb writeBackDB) GetAllWriteBackPlans(username string) []models.WriteBackPlan {
+	plans := []models.WriteBackPlan{}
+	for _, key := range wb.store.keys(fmt.Sprintf("writeback::user::%s::id::", username)) {
+		if plan := wb.loadPlan(key); plan != nil {
+			plans = append(plans, *plan)
+		}
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		return plans[i].CreatedAt.Before(plans[j].CreatedAt)
+	})
+	return plans
+}
+
+func (wb writeBackDB) loadPlan(key string) *models.WriteBackPlan {
+	planJSON, found := wb.store.load(key)
+	if !found {
+		return nil
+	}
+	var plan models.WriteBackPlan
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		log.Errorf(" >>> failed to unmarshal write-back plan [%s]: %s\n", key, err.Error())
+		return nil
+	}
+	return &plan
+}
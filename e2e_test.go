@@ -0,0 +1,893 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/2beens/spotilizer/config"
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/fakespotify"
+	"github.com/2beens/spotilizer/handlers"
+	"github.com/2beens/spotilizer/models"
+	"github.com/2beens/spotilizer/services"
+	"github.com/2beens/spotilizer/util"
+)
+
+// E2ETestSuite runs spotilizer against the fake Spotify server, with in-memory storage instead of redis
+type E2ETestSuite struct {
+	suite.Suite
+	fakeSpotify       *fakespotify.Server
+	fakeSpotifyServer *httptest.Server
+	spotilizerServer  *httptest.Server
+	client            *http.Client
+}
+
+type e2eAPIResponse struct {
+	Status  int             `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Error   *models.SpError `json:"error"`
+}
+
+func (suite *E2ETestSuite) SetupTest() {
+	fixtures, err := fakespotify.LoadFixtures("fakespotify/testdata/fixtures.json")
+	suite.Require().NoError(err)
+	suite.fakeSpotify = fakespotify.NewServer(fixtures, "e2e-client-id", "e2e-client-secret")
+	suite.fakeSpotifyServer = httptest.NewServer(suite.fakeSpotify)
+
+	config.Conf.SpotifyAPIURL = suite.fakeSpotifyServer.URL
+	config.Conf.SpotifyAccountsURL = suite.fakeSpotifyServer.URL
+	config.Conf.AuthFlow = config.AuthFlowAuthorizationCode
+	util.SetupTemplates()
+}
+
+// startSpotilizer is called by tests after adjusting the config
+func (suite *E2ETestSuite) startSpotilizer(clientSecret string) {
+	services.SetupServices(services.NewUserServiceTest(), db.NewSpotifyDBTest(), "e2e-client-id", clientSecret)
+
+	// router needs to know its own URL for the login callback, so it's created after the server is started
+	var router http.Handler
+	suite.spotilizerServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r)
+	}))
+	serverURL = suite.spotilizerServer.URL
+	router = routerSetup()
+	handlers.SetClientID("e2e-client-id")
+
+	jar, err := cookiejar.New(nil)
+	suite.Require().NoError(err)
+	suite.client = &http.Client{Jar: jar, Timeout: 30 * time.Second}
+}
+
+func (suite *E2ETestSuite) TearDownTest() {
+	if suite.spotilizerServer != nil {
+		suite.spotilizerServer.Close()
+		suite.spotilizerServer = nil
+	}
+	suite.fakeSpotifyServer.Close()
+	config.Conf.AuthFlow = config.AuthFlowAuthorizationCode
+}
+
+func (suite *E2ETestSuite) TestLoginSnapshotAndDiff() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	apiResp := suite.getAPI("/save_current_tracks")
+	suite.Equal("52 favorite tracks saved successfully", apiResp.Message)
+
+	// reading playlists is granted at login
+	apiResp = suite.getAPI("/save_current_playlists")
+	suite.Equal("4 playlists saved successfully (0 unchanged, 4 downloaded)", apiResp.Message)
+
+	var authStatus models.DTOAuthStatus
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/auth").Data, &authStatus))
+	suite.Equal([]string{"user-read-private", "user-read-email", "user-library-read", "playlist-read-private", "playlist-read-collaborative"}, authStatus.GrantedScopes)
+
+	// nothing changed on Spotify, so all playlists are reused on the next save
+	time.Sleep(time.Second)
+	apiResp = suite.getAPI("/save_current_playlists")
+	suite.Equal("4 playlists saved successfully (4 unchanged, 0 downloaded)", apiResp.Message)
+
+	var playlistsSnapshots []models.DTOPlaylistSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssplaylists").Data, &playlistsSnapshots))
+	suite.Equal(2, len(playlistsSnapshots))
+
+	// user removes a track from saved tracks, and saves another one
+	var removedTrack models.SpAddedTrack
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		removedTrack = f.SavedTracks[0]
+		f.SavedTracks = append(f.SavedTracks[1:], models.SpAddedTrack{
+			AddedAt: time.Now(),
+			Track:   models.SpTrack{ID: "track-new", Name: "New Track"},
+		})
+	})
+	// access token expires meanwhile, and spotify is busy
+	tokenRequests := suite.fakeSpotify.RequestsCount("/api/token")
+	suite.fakeSpotify.ExpireAccessTokens()
+	suite.fakeSpotify.InjectFault(fakespotify.Fault{PathPrefix: "/v1/me/tracks", Status: http.StatusTooManyRequests, RetryAfter: 1, Count: 1})
+
+	var favTracksSnapshots []models.DTOFavTracksSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssfavtracks").Data, &favTracksSnapshots))
+	suite.Require().Equal(1, len(favTracksSnapshots))
+
+	var diff struct {
+		NewTracks     []models.DTOTrack `json:"newTracks"`
+		RemovedTracks []models.DTOTrack `json:"removedTracks"`
+	}
+	apiResp = suite.getAPI(fmt.Sprintf("/api/ssfavtracks/diff/%d", favTracksSnapshots[0].Timestamp))
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &diff))
+	if suite.Equal(1, len(diff.RemovedTracks)) {
+		suite.Equal(removedTrack.Track.ID, diff.RemovedTracks[0].ID)
+	}
+	if suite.Equal(1, len(diff.NewTracks)) {
+		suite.Equal("track-new", diff.NewTracks[0].ID)
+	}
+	suite.Equal(tokenRequests+1, suite.fakeSpotify.RequestsCount("/api/token"), "access token should be refreshed once")
+}
+
+func (suite *E2ETestSuite) TestFollowedArtistsSnapshots() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	suite.grantMissingScopes("/save_followed_artists", "user-follow-read")
+	apiResp := suite.getAPI("/save_followed_artists")
+	suite.Equal("60 followed artists saved successfully", apiResp.Message)
+	suite.Equal(2, suite.fakeSpotify.RequestsCount("/v1/me/following"), "followed artists should be paged by cursor")
+
+	var snapshots []models.DTOFollowedArtistsSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssartists/full").Data, &snapshots))
+	suite.Require().Equal(1, len(snapshots))
+	suite.Equal(60, snapshots[0].ArtistsCount)
+	suite.Require().Equal(60, len(snapshots[0].Artists))
+	suite.Equal("followed-artist-59", snapshots[0].Artists[59].ID)
+
+	// user unfollows an artist, and follows a new one
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		f.FollowedArtists = append(f.FollowedArtists[1:], models.SpFullArtist{
+			SpArtist: models.SpArtist{ID: "artist-new", Name: "New Artist", Type: "artist"},
+		})
+	})
+
+	var diff struct {
+		NewItems     []models.DTOArtist `json:"newItems"`
+		RemovedItems []models.DTOArtist `json:"removedItems"`
+	}
+	apiResp = suite.getAPI(fmt.Sprintf("/api/ssartists/diff/%d", snapshots[0].Timestamp))
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &diff))
+	if suite.Equal(1, len(diff.RemovedItems)) {
+		suite.Equal("followed-artist-0", diff.RemovedItems[0].ID)
+	}
+	if suite.Equal(1, len(diff.NewItems)) {
+		suite.Equal("artist-new", diff.NewItems[0].ID)
+	}
+
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/ssartists/%d", suite.spotilizerServer.URL, snapshots[0].Timestamp), nil)
+	suite.Require().NoError(err)
+	resp, err := suite.client.Do(req)
+	suite.Require().NoError(err)
+	resp.Body.Close()
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssartists").Data, &snapshots))
+	suite.Empty(snapshots)
+}
+
+func (suite *E2ETestSuite) TestSavedAlbumsSnapshots() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	apiResp := suite.getAPI("/save_albums")
+	suite.Equal("55 saved albums saved successfully", apiResp.Message)
+
+	// user removes an album from the library, and saves another one
+	var removedAlbum models.SpSavedAlbum
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		removedAlbum = f.SavedAlbums[3]
+		f.SavedAlbums = append(append(f.SavedAlbums[:3:3], f.SavedAlbums[4:]...), models.SpSavedAlbum{
+			AddedAt: time.Now(),
+			Album:   models.SpAlbum{ID: "album-new", Name: "New Album"},
+		})
+	})
+	time.Sleep(time.Second)
+	apiResp = suite.getAPI("/save_albums")
+	suite.Equal("55 saved albums saved successfully", apiResp.Message)
+
+	var snapshots []models.DTOSavedAlbumsSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssalbums").Data, &snapshots))
+	suite.Require().Equal(2, len(snapshots))
+	suite.Equal(55, snapshots[0].AlbumsCount)
+	suite.Empty(snapshots[0].Albums)
+
+	var snapshot models.DTOSavedAlbumsSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI(fmt.Sprintf("/api/ssalbums/%d", snapshots[1].Timestamp)).Data, &snapshot))
+	suite.Require().Equal(55, len(snapshot.Albums))
+	suite.Equal("album-new", snapshot.Albums[54].ID)
+
+	var diff struct {
+		NewItems     []models.DTOAlbum `json:"newItems"`
+		RemovedItems []models.DTOAlbum `json:"removedItems"`
+	}
+	apiResp = suite.getAPI(fmt.Sprintf("/api/ssalbums/diff/%d/%d", snapshots[0].Timestamp, snapshots[1].Timestamp))
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &diff))
+	if suite.Equal(1, len(diff.RemovedItems)) {
+		suite.Equal(removedAlbum.Album.ID, diff.RemovedItems[0].ID)
+		suite.Equal(removedAlbum.AddedAt.Unix(), diff.RemovedItems[0].AddedAt)
+	}
+	if suite.Equal(1, len(diff.NewItems)) {
+		suite.Equal("album-new", diff.NewItems[0].ID)
+	}
+
+	// latest snapshot is the same as the library on Spotify
+	apiResp = suite.getAPI(fmt.Sprintf("/api/ssalbums/diff/%d", snapshots[1].Timestamp))
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &diff))
+	suite.Empty(diff.NewItems)
+	suite.Empty(diff.RemovedItems)
+}
+
+func (suite *E2ETestSuite) TestSavedShowsAndEpisodesSnapshots() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	apiResp := suite.getAPI("/save_shows")
+	suite.Equal("3 saved shows saved successfully", apiResp.Message)
+
+	// saved episodes need the playback position scope as well
+	suite.grantMissingScopes("/save_episodes", "user-read-playback-position")
+	apiResp = suite.getAPI("/save_episodes")
+	suite.Equal("53 saved episodes saved successfully", apiResp.Message)
+	suite.Equal(2, suite.fakeSpotify.RequestsCount("/v1/me/episodes"))
+
+	// user unsubscribes from a show by mistake
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		f.SavedShows = f.SavedShows[:2]
+	})
+
+	var showsSnapshots []models.DTOSavedShowsSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssshows").Data, &showsSnapshots))
+	suite.Require().Equal(1, len(showsSnapshots))
+	suite.Equal(3, showsSnapshots[0].ShowsCount)
+
+	var diff struct {
+		NewItems     []models.DTOShow `json:"newItems"`
+		RemovedItems []models.DTOShow `json:"removedItems"`
+	}
+	apiResp = suite.getAPI(fmt.Sprintf("/api/ssshows/diff/%d", showsSnapshots[0].Timestamp))
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &diff))
+	suite.Empty(diff.NewItems)
+	if suite.Equal(1, len(diff.RemovedItems)) {
+		suite.Equal("show-2", diff.RemovedItems[0].ID)
+		suite.Equal("Publisher 2", diff.RemovedItems[0].Publisher)
+	}
+
+	var episodesSnapshots []models.DTOSavedEpisodesSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssepisodes/full").Data, &episodesSnapshots))
+	suite.Require().Equal(1, len(episodesSnapshots))
+	suite.Require().Equal(53, len(episodesSnapshots[0].Episodes))
+	suite.Equal("Show 1", episodesSnapshots[0].Episodes[52].Show)
+}
+
+func (suite *E2ETestSuite) TestPlayHistory() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	suite.grantMissingScopes("/enable_play_history", "user-read-recently-played")
+	apiResp := suite.getAPI("/enable_play_history")
+	suite.Equal("Play history enabled, 6 plays collected", apiResp.Message)
+
+	// user listens to two more tracks, the collector picks up only those
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		latest := f.RecentlyPlayed[0].PlayedAt
+		f.RecentlyPlayed = append([]models.SpPlayHistory{
+			{Track: models.SpTrack{ID: "track-new", Artists: []models.SpArtist{{ID: "artist-0"}}}, PlayedAt: latest.Add(10 * time.Minute)},
+			{Track: f.RecentlyPlayed[2].Track, PlayedAt: latest.Add(5 * time.Minute)},
+		}, f.RecentlyPlayed...)
+	})
+	services.PlayHistory.CollectAll()
+	// nothing new played meanwhile, so nothing is added again
+	services.PlayHistory.CollectAll()
+
+	var history struct {
+		Enabled bool             `json:"enabled"`
+		Plays   []models.DTOPlay `json:"plays"`
+	}
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/playhistory").Data, &history))
+	suite.True(history.Enabled)
+	suite.Require().Equal(8, len(history.Plays))
+	suite.Equal("track-new", history.Plays[7].Track.ID, "plays should be sorted oldest first")
+
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/playhistory?track=track-2").Data, &history))
+	suite.Equal(3, len(history.Plays))
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/playhistory?artist=artist-0").Data, &history))
+	suite.Equal(3, len(history.Plays))
+	from, to := history.Plays[0].PlayedAt, history.Plays[1].PlayedAt
+	suite.Require().NoError(json.Unmarshal(suite.getAPI(fmt.Sprintf("/api/playhistory?from=%d&to=%d", from, to)).Data, &history))
+	suite.Equal(4, len(history.Plays))
+
+	suite.getAPI("/disable_play_history")
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/playhistory").Data, &history))
+	suite.False(history.Enabled)
+	suite.Equal(8, len(history.Plays), "collected plays should be kept")
+}
+
+func (suite *E2ETestSuite) TestTopItemsSnapshots() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	suite.grantMissingScopes("/save_top_items", "user-top-read")
+	apiResp := suite.getAPI("/save_top_items")
+	suite.Equal("27 top tracks and artists saved successfully", apiResp.Message)
+
+	// short term favourites change: track 1 drops out, track 3 comes in, track 0 goes to the top
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		tracks := f.TopTracks[models.TopTimeRangeLong]
+		f.TopTracks[models.TopTimeRangeShort] = []models.SpTrack{tracks[0], tracks[2], tracks[3]}
+	})
+	time.Sleep(time.Second)
+	apiResp = suite.getAPI("/save_top_items")
+	suite.Equal("27 top tracks and artists saved successfully", apiResp.Message)
+
+	var snapshots []models.DTOTopItemsSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/sstop").Data, &snapshots))
+	suite.Require().Equal(2, len(snapshots))
+	suite.Empty(snapshots[0].Ranges)
+
+	var snapshot models.DTOTopItemsSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI(fmt.Sprintf("/api/sstop/%d", snapshots[0].Timestamp)).Data, &snapshot))
+	suite.Equal(5, len(snapshot.Ranges[models.TopTimeRangeMedium].Tracks))
+	suite.Equal(4, len(snapshot.Ranges[models.TopTimeRangeLong].Artists))
+
+	var moves map[string]models.DTOTopRangeMoves
+	apiResp = suite.getAPI(fmt.Sprintf("/api/sstop/moves/%d/%d", snapshots[0].Timestamp, snapshots[1].Timestamp))
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &moves))
+	suite.Equal([]models.DTORankMove{
+		{ID: "track-0", Name: "Track 0", Rank: 1, PreviousRank: 3, Move: "up"},
+		{ID: "track-2", Name: "Track 2", Rank: 2, PreviousRank: 1, Move: "down"},
+		{ID: "track-3", Name: "Track 3", Rank: 3, PreviousRank: 0, Move: "entered"},
+		{ID: "track-1", Name: "Track 1", Rank: 0, PreviousRank: 2, Move: "left"},
+	}, moves[models.TopTimeRangeShort].Tracks)
+	for _, move := range moves[models.TopTimeRangeLong].Artists {
+		suite.Equal("same", move.Move)
+	}
+}
+
+func (suite *E2ETestSuite) TestAudioFeatures() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	apiResp := suite.getAPI("/save_current_tracks")
+	suite.Equal("52 favorite tracks saved successfully", apiResp.Message)
+
+	var favTracksSnapshots []models.DTOFavTracksSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssfavtracks").Data, &favTracksSnapshots))
+	suite.Require().Equal(1, len(favTracksSnapshots))
+
+	// audio features are included only when asked for
+	var snapshot models.DTOFavTracksSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI(fmt.Sprintf("/api/ssfavtracks/%d", favTracksSnapshots[0].Timestamp)).Data, &snapshot))
+	suite.Nil(snapshot.Tracks[0].AudioFeatures)
+	suite.Equal(0, suite.fakeSpotify.RequestsCount("/v1/audio-features"))
+
+	suite.Require().NoError(json.Unmarshal(suite.getAPI(fmt.Sprintf("/api/ssfavtracks/%d?audio_features=true", favTracksSnapshots[0].Timestamp)).Data, &snapshot))
+	suite.Require().Equal(52, len(snapshot.Tracks))
+	for _, t := range snapshot.Tracks {
+		suite.NotNil(t.AudioFeatures, "track [%s] has no audio features", t.ID)
+	}
+	suite.Equal(1, suite.fakeSpotify.RequestsCount("/v1/audio-features"))
+
+	// user's taste gets calmer, only 10 tracks stay saved
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		f.SavedTracks = f.SavedTracks[:10]
+	})
+	time.Sleep(time.Second)
+	apiResp = suite.getAPI("/save_current_tracks")
+	suite.Equal("10 favorite tracks saved successfully", apiResp.Message)
+
+	var averages []models.DTOAudioFeaturesAverage
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/audiofeatures/favtracks").Data, &averages))
+	suite.Require().Equal(2, len(averages))
+	suite.True(averages[0].Timestamp < averages[1].Timestamp)
+	suite.Equal(52, averages[0].TracksCount)
+	suite.Equal(52, averages[0].AnalyzedCount)
+	suite.Equal(10, averages[1].TracksCount)
+	suite.InDelta(0.45, averages[1].Energy, 0.0001)
+	suite.InDelta(104.5, averages[1].Tempo, 0.0001)
+	// all audio features were cached already
+	suite.Equal(1, suite.fakeSpotify.RequestsCount("/v1/audio-features"))
+
+	suite.getAPI("/save_current_playlists")
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/audiofeatures/playlists/playlist-1").Data, &averages))
+	if suite.Equal(1, len(averages)) {
+		suite.Equal(8, averages[0].TracksCount)
+		suite.Equal(8, averages[0].AnalyzedCount)
+	}
+}
+
+func (suite *E2ETestSuite) TestGenres() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	apiResp := suite.getAPI("/save_current_tracks")
+	suite.Equal("52 favorite tracks saved successfully", apiResp.Message)
+	suite.getAPI("/save_current_playlists")
+
+	var favTracksSnapshots []models.DTOFavTracksSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssfavtracks").Data, &favTracksSnapshots))
+	suite.Require().Equal(1, len(favTracksSnapshots))
+	timestamp := favTracksSnapshots[0].Timestamp
+
+	var breakdown models.DTOGenreBreakdown
+	suite.Require().NoError(json.Unmarshal(suite.getAPI(fmt.Sprintf("/api/genres/favtracks/%d", timestamp)).Data, &breakdown))
+	suite.Equal(52, breakdown.TracksCount)
+	suite.Equal(7, breakdown.UnknownGenreTracks)
+	suite.Require().Equal(6, len(breakdown.Genres))
+	suite.Equal(models.DTOGenreCount{Genre: "rock", TracksCount: 16}, breakdown.Genres[0])
+	// all 7 artists are downloaded in a single request, and cached
+	suite.Equal(1, suite.fakeSpotify.RequestsCount("/v1/artists"))
+
+	var playlistsSnapshots []models.DTOPlaylistSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssplaylists").Data, &playlistsSnapshots))
+	suite.Require().Equal(1, len(playlistsSnapshots))
+	suite.Require().NoError(json.Unmarshal(suite.getAPI(fmt.Sprintf("/api/genres/playlists/%d/playlist-1", playlistsSnapshots[0].Timestamp)).Data, &breakdown))
+	suite.Equal(8, breakdown.TracksCount)
+	suite.Equal(models.DTOGenreCount{Genre: "indie rock", TracksCount: 3}, breakdown.Genres[0])
+
+	var snapshot models.DTOFavTracksSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI(fmt.Sprintf("/api/ssfavtracks/%d?genres=true", timestamp)).Data, &snapshot))
+	suite.Equal("artist-0", snapshot.Tracks[0].Artists[0].ID)
+	suite.Equal([]string{"indie rock", "rock"}, snapshot.Tracks[0].Artists[0].Genres)
+	suite.Equal(1, suite.fakeSpotify.RequestsCount("/v1/artists"))
+}
+
+func (suite *E2ETestSuite) TestPlaylistsSnapshotEnrichment() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+	suite.getAPI("/save_current_playlists")
+
+	var playlistsSnapshots []models.DTOPlaylistSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssplaylists").Data, &playlistsSnapshots))
+	suite.Require().Equal(1, len(playlistsSnapshots))
+
+	var snapshot models.DTOPlaylistSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI(fmt.Sprintf("/api/ssplaylists/%d?audio_features=true&genres=true", playlistsSnapshots[0].Timestamp)).Data, &snapshot))
+	suite.Require().Equal(4, len(snapshot.Playlists))
+	for _, pl := range snapshot.Playlists {
+		for _, t := range pl.Tracks {
+			suite.NotNil(t.AudioFeatures, "track [%s] of playlist [%s] has no audio features", t.ID, pl.ID)
+		}
+	}
+	// tracks and artists of all playlists are looked up together, not playlist by playlist
+	suite.Equal(1, suite.fakeSpotify.RequestsCount("/v1/audio-features"))
+	suite.Equal(1, suite.fakeSpotify.RequestsCount("/v1/artists"))
+}
+
+func (suite *E2ETestSuite) TestRestoreFavTracks() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	apiResp := suite.getAPI("/save_current_tracks")
+	suite.Equal("52 favorite tracks saved successfully", apiResp.Message)
+	var favTracksSnapshots []models.DTOFavTracksSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssfavtracks").Data, &favTracksSnapshots))
+	suite.Require().Equal(1, len(favTracksSnapshots))
+	timestamp := favTracksSnapshots[0].Timestamp
+
+	// user removes 3 tracks by mistake, one of which is not available in user's country anymore
+	var removedTracks []models.SpAddedTrack
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		removedTracks = append(removedTracks, f.SavedTracks[:3]...)
+		f.SavedTracks = f.SavedTracks[3:]
+		f.UnavailableTracks = []string{removedTracks[1].Track.ID}
+	})
+
+	restorePath := fmt.Sprintf("/restore_fav_tracks/%d", timestamp)
+	suite.grantMissingScopes(restorePath, "user-library-modify")
+
+	// restore is planned first, nothing is changed until the plan is confirmed
+	var plan models.WriteBackPlan
+	apiResp = suite.getAPI(restorePath)
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &plan))
+	suite.Equal(fmt.Sprintf("2 of 3 removed tracks to restore, confirm plan %s to execute it", plan.ID), apiResp.Message)
+	suite.Equal(models.WriteBackStatusPlanned, plan.Status)
+	suite.Require().Equal(1, len(plan.Operations))
+	suite.Equal([]models.PlanTrack{
+		{URI: removedTracks[0].Track.URI, Name: removedTracks[0].Track.Name},
+		{URI: removedTracks[2].Track.URI, Name: removedTracks[2].Track.Name},
+	}, plan.Operations[0].Tracks)
+	suite.Equal([]models.PlanTrack{
+		{URI: removedTracks[1].Track.URI, Name: removedTracks[1].Track.Name, Reason: models.SkipReasonUnavailable},
+	}, plan.SkippedTracks)
+	suite.Equal(1, suite.fakeSpotify.RequestsCount("/v1/tracks"))
+
+	removedSinceSnapshot := func() []string {
+		var diff struct {
+			RemovedTracks []models.DTOTrack `json:"removedTracks"`
+		}
+		suite.Require().NoError(json.Unmarshal(suite.getAPI(fmt.Sprintf("/api/ssfavtracks/diff/%d", timestamp)).Data, &diff))
+		var ids []string
+		for _, t := range diff.RemovedTracks {
+			ids = append(ids, t.ID)
+		}
+		return ids
+	}
+	suite.Equal(3, len(removedSinceSnapshot()))
+
+	apiResp = suite.getAPI("/execute_plan/" + plan.ID)
+	suite.Equal("Plan executed: 1 operations run", apiResp.Message)
+	// only the unavailable track is still missing
+	suite.Equal([]string{removedTracks[1].Track.ID}, removedSinceSnapshot())
+
+	suite.Equal(models.SpError{Status: http.StatusBadRequest, Message: "Plan executed: Nothing left to execute"}, suite.getAPIError("/execute_plan/"+plan.ID))
+
+	// plans are kept along with the records of their executions
+	var plans []models.WriteBackPlan
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/plans").Data, &plans))
+	if suite.Equal(1, len(plans)) {
+		suite.Equal(models.WriteBackStatusExecuted, plans[0].Status)
+		suite.Equal(1, len(plans[0].Executions))
+	}
+
+	// restoring given tracks only
+	var onlyPlan models.WriteBackPlan
+	apiResp = suite.getAPI(fmt.Sprintf("%s?ids=%s,unknown-track", restorePath, removedTracks[0].Track.ID))
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &onlyPlan))
+	suite.Equal(fmt.Sprintf("0 of 0 removed tracks to restore, confirm plan %s to execute it", onlyPlan.ID), apiResp.Message)
+	suite.Empty(onlyPlan.Operations)
+	suite.Equal([]models.PlanTrack{
+		{URI: removedTracks[0].Track.URI, Name: removedTracks[0].Track.Name, Reason: models.SkipReasonNotRemoved},
+		{URI: "spotify:track:unknown-track", Reason: models.SkipReasonNotRemoved},
+	}, onlyPlan.SkippedTracks)
+	suite.Equal(1, suite.fakeSpotify.RequestsCount("/v1/tracks"))
+
+	// the executed plan can be undone
+	apiResp = suite.getAPI("/undo_plan/" + plan.ID)
+	suite.Equal("Plan undone: 1 operations run", apiResp.Message)
+	suite.Equal(3, len(removedSinceSnapshot()))
+}
+
+func (suite *E2ETestSuite) TestRestorePlaylists() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	apiResp := suite.getAPI("/save_current_playlists")
+	suite.Equal("4 playlists saved successfully (0 unchanged, 4 downloaded)", apiResp.Message)
+	var playlistsSnapshots []models.DTOPlaylistSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssplaylists").Data, &playlistsSnapshots))
+	suite.Require().Equal(1, len(playlistsSnapshots))
+	timestamp := playlistsSnapshots[0].Timestamp
+
+	// user removes the first track of the playlist, moves the last one to the top, and adds another one
+	var snapshotTracks []models.SpPlaylistTrack
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		tracks := f.Playlists[0].Tracks
+		snapshotTracks = append(snapshotTracks, tracks...)
+		changed := append([]models.SpPlaylistTrack{tracks[7]}, tracks[1:7]...)
+		f.Playlists[0].Tracks = append(changed, f.Playlists[1].Tracks[0])
+	})
+	var snapshotURIs []string
+	for _, t := range snapshotTracks {
+		snapshotURIs = append(snapshotURIs, t.Track.URI)
+	}
+
+	rollbackPath := fmt.Sprintf("/rollback_playlist/%d/playlist-1", timestamp)
+	suite.grantMissingScopes(rollbackPath, "playlist-modify-public", "playlist-modify-private")
+
+	// the plan shows the changes, without changing the playlist
+	var plan models.WriteBackPlan
+	apiResp = suite.getAPI(rollbackPath)
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &plan))
+	suite.Equal(fmt.Sprintf("3 playlist operations planned, confirm plan %s to execute it", plan.ID), apiResp.Message)
+	suite.Equal(models.WriteBackRollbackPlaylist, plan.Kind)
+	suite.Equal("playlist-1", plan.PlaylistID)
+	suite.Require().Equal(3, len(plan.Operations))
+	suite.Equal(models.PlaylistOpRemove, plan.Operations[0].Type)
+	suite.Equal(models.PlaylistOpReorder, plan.Operations[1].Type)
+	suite.Equal(models.PlaylistOpAdd, plan.Operations[2].Type)
+	suite.Equal([]models.PlanTrack{{URI: snapshotURIs[0], Name: snapshotTracks[0].Track.Name, Position: 0}}, plan.Operations[2].Tracks)
+	changedURIs := suite.playlistTracks("playlist-1")
+	suite.Equal(changedURIs, plan.Operations[0].Before)
+	suite.Equal(snapshotURIs, plan.Operations[2].After)
+
+	apiResp = suite.getAPI("/execute_plan/" + plan.ID)
+	suite.Equal("Plan executed: 3 operations run", apiResp.Message)
+	suite.Equal(snapshotURIs, suite.playlistTracks("playlist-1"))
+
+	// nothing left to roll back
+	apiResp = suite.getAPI(rollbackPath)
+	suite.Equal(models.SpError{Status: http.StatusBadRequest, Message: "Plan planned: Nothing left to execute"}, suite.getAPIError("/execute_plan/"+suite.planID(apiResp)))
+
+	// undo brings the changes back, in reverse order
+	apiResp = suite.getAPI("/undo_plan/" + plan.ID)
+	suite.Equal("Plan undone: 3 operations run", apiResp.Message)
+	suite.Equal(changedURIs, suite.playlistTracks("playlist-1"))
+
+	// user deletes the playlist, and recreates it from the snapshot
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		f.Playlists = f.Playlists[1:]
+	})
+	apiResp = suite.getAPI(fmt.Sprintf("/recreate_playlist/%d/playlist-1", timestamp))
+	apiResp = suite.getAPI("/execute_plan/" + suite.planID(apiResp))
+	suite.Equal("Plan executed: 2 operations run", apiResp.Message)
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &plan))
+	suite.NotEmpty(plan.PlaylistID)
+	suite.NotEqual("playlist-1", plan.PlaylistID)
+	suite.Equal(snapshotURIs, suite.playlistTracks(plan.PlaylistID))
+
+	// undo deletes the recreated playlist
+	suite.getAPI("/undo_plan/" + plan.ID)
+	suite.Empty(suite.playlistTracks(plan.PlaylistID))
+
+	suite.Equal(models.SpError{Status: http.StatusNotFound, Message: "Playlist not found in the snapshot"}, suite.getAPIError(fmt.Sprintf("/recreate_playlist/%d/unknown", timestamp)))
+	suite.Equal(models.SpError{Status: http.StatusNotFound, Message: "Plan not found"}, suite.getAPIError("/execute_plan/unknown"))
+}
+
+func (suite *E2ETestSuite) TestPlaylistDuplicates() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	// two tracks of the Workout playlist are in the Evening playlist as well
+	var duplicates models.PlaylistDuplicates
+	apiResp := suite.getAPI("/find_duplicates")
+	suite.Equal("0 duplicates within playlists, 2 across playlists", apiResp.Message)
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &duplicates))
+	suite.Require().Equal(2, len(duplicates.Across))
+	suite.Equal(models.DuplicateMatchID, duplicates.Across[0].Match)
+	suite.Equal([]string{"playlist-2", "playlist-4"}, []string{duplicates.Across[0].Tracks[0].PlaylistID, duplicates.Across[0].Tracks[1].PlaylistID})
+
+	// user adds a track to the Morning playlist twice, the second time as a relinked copy, with another ID
+	originalURIs := suite.playlistTracks("playlist-1")
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		tracks := f.Playlists[0].Tracks
+		relinked := tracks[3]
+		relinked.Track.ID = "track-3-relinked"
+		relinked.Track.URI = "spotify:track:track-3-relinked"
+		f.Playlists[0].Tracks = append(append(tracks[:4:4], tracks[2]), append(tracks[4:], relinked)...)
+	})
+	apiResp = suite.getAPI("/find_duplicates?ids=playlist-1")
+	suite.Equal("2 duplicates within playlists, 0 across playlists", apiResp.Message)
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &duplicates))
+	suite.Require().Equal(2, len(duplicates.Within))
+	suite.Equal(models.DuplicateMatchID, duplicates.Within[0].Match)
+	suite.Equal(models.DuplicateMatchISRC, duplicates.Within[1].Match)
+
+	// the same duplicates are found in the playlists snapshot
+	suite.getAPI("/save_current_playlists")
+	var playlistsSnapshots []models.DTOPlaylistSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssplaylists").Data, &playlistsSnapshots))
+	suite.Require().Equal(1, len(playlistsSnapshots))
+	timestamp := playlistsSnapshots[0].Timestamp
+	suite.Require().NoError(json.Unmarshal(suite.getAPI(fmt.Sprintf("/api/ssplaylists/duplicates/%d", timestamp)).Data, &duplicates))
+	suite.Equal(2, len(duplicates.Within))
+	suite.Equal(2, len(duplicates.Across))
+	suite.Equal(models.SpError{Status: http.StatusNotFound, Message: "Error occurred: playlist [unknown] not found in the snapshot"},
+		suite.getAPIError(fmt.Sprintf("/api/ssplaylists/duplicates/%d?ids=unknown", timestamp)))
+
+	// dedup removes the copies, keeping the first ones
+	duplicatedURIs := suite.playlistTracks("playlist-1")
+	resumed := suite.grantMissingScopes("/dedup_playlist/playlist-1", "playlist-modify-public", "playlist-modify-private")
+	suite.Equal("dedup_playlist", resumed, "playlist edits must be resumed by their own action")
+	apiResp = suite.getAPI("/dedup_playlist/playlist-1")
+	planID := suite.planID(apiResp)
+	suite.Equal(fmt.Sprintf("2 duplicate tracks to remove, confirm plan %s to execute it", planID), apiResp.Message)
+	suite.Equal(duplicatedURIs, suite.playlistTracks("playlist-1"), "nothing must be changed before the plan is confirmed")
+	apiResp = suite.getAPI("/execute_plan/" + planID)
+	suite.Equal("Plan executed: 1 operations run", apiResp.Message)
+	suite.Equal(originalURIs, suite.playlistTracks("playlist-1"))
+	suite.getAPI("/undo_plan/" + planID)
+	suite.Equal(duplicatedURIs, suite.playlistTracks("playlist-1"))
+
+	// merge creates a new playlist, without the copies, unless they are kept
+	var plan models.WriteBackPlan
+	apiResp = suite.getAPI("/merge_playlists?ids=playlist-2,playlist-4")
+	suite.Equal(fmt.Sprintf("58 tracks of 2 playlists to merge, confirm plan %s to execute it", suite.planID(apiResp)), apiResp.Message)
+	apiResp = suite.getAPI("/execute_plan/" + suite.planID(apiResp))
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &plan))
+	suite.Equal(58, len(suite.playlistTracks(plan.PlaylistID)))
+	suite.Equal("Workout + Evening", plan.Operations[0].Name)
+
+	apiResp = suite.getAPI(fmt.Sprintf("/merge_playlists?ids=playlist-4,playlist-1&timestamp=%d&keep_duplicates=true&name=Evenings", timestamp))
+	suite.Equal(fmt.Sprintf("18 tracks of 2 playlists to merge, confirm plan %s to execute it", suite.planID(apiResp)), apiResp.Message)
+	apiResp = suite.getAPI("/execute_plan/" + suite.planID(apiResp))
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &plan))
+	suite.Equal(append(suite.playlistTracks("playlist-4"), duplicatedURIs...), suite.playlistTracks(plan.PlaylistID))
+	suite.Equal("Evenings", plan.Operations[0].Name)
+
+	suite.Equal(models.SpError{Status: http.StatusBadRequest, Message: "At least two playlists needed to merge"}, suite.getAPIError("/merge_playlists?ids=playlist-1"))
+	suite.Equal(models.SpError{Status: http.StatusNotFound, Message: "Playlist [unknown] not found"}, suite.getAPIError("/merge_playlists?ids=playlist-1,unknown"))
+}
+
+func (suite *E2ETestSuite) TestSnapshotQueryPlaylist() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	// user unlikes 3 tracks between two snapshots
+	suite.getAPI("/save_current_tracks")
+	var unlikedURIs []string
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		for _, t := range f.SavedTracks[:3] {
+			unlikedURIs = append(unlikedURIs, t.Track.URI)
+		}
+		f.SavedTracks = f.SavedTracks[3:]
+	})
+	time.Sleep(time.Second)
+	suite.getAPI("/save_current_tracks")
+
+	// unliked tracks are in any snapshot, but not in the latest one
+	var result models.SnapshotQueryResult
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/query?source=fav_tracks&since=30d&not_in=latest").Data, &result))
+	suite.Equal(models.QuerySnapshotAny, result.Query.In)
+	suite.Require().Equal(3, len(result.Tracks))
+	var resultURIs []string
+	for _, t := range result.Tracks {
+		resultURIs = append(resultURIs, t.URI)
+	}
+	suite.ElementsMatch(unlikedURIs, resultURIs)
+
+	queryPath := "/create_query_playlist?since=30d&not_in=latest&name=Unliked"
+	resumed := suite.grantMissingScopes(queryPath, "playlist-modify-public", "playlist-modify-private")
+	suite.Equal("create_query_playlist", resumed)
+	apiResp := suite.getAPI(queryPath)
+	planID := suite.planID(apiResp)
+	suite.Equal(fmt.Sprintf("3 tracks to add to the new playlist, confirm plan %s to execute it", planID), apiResp.Message)
+
+	var plan models.WriteBackPlan
+	apiResp = suite.getAPI("/execute_plan/" + planID)
+	suite.Equal("Plan executed: 2 operations run", apiResp.Message)
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &plan))
+	suite.Equal("Unliked", plan.Operations[0].Name)
+	suite.Equal(resultURIs, suite.playlistTracks(plan.PlaylistID), "tracks are added in the order they were liked")
+
+	suite.Equal(models.SpError{Status: http.StatusBadRequest, Message: "Invalid query: invalid source [albums], expected fav_tracks or playlists"}, suite.getAPIError("/api/query?source=albums"))
+	suite.Equal(models.SpError{Status: http.StatusNotFound, Message: "Snapshot [123] not found"}, suite.getAPIError("/create_query_playlist?in=123"))
+}
+
+func (suite *E2ETestSuite) TestScheduledSnapshots() {
+	suite.startSpotilizer("e2e-client-secret")
+	suite.login()
+
+	apiResp := suite.getAPI("/schedule_snapshots?frequency=daily")
+	var schedule models.SnapshotSchedule
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &schedule))
+	suite.Equal("Snapshots scheduled daily, next run at "+schedule.NextRun.Format(time.RFC822), apiResp.Message)
+	suite.Equal([]string{models.ScheduledFavTracks, models.ScheduledPlaylists}, schedule.Snapshots)
+	suite.Equal("0 0 * * *", schedule.Cron)
+	suite.True(schedule.NextRun.After(time.Now()))
+
+	// nothing is taken until the next run is due
+	services.SnapshotScheduler.RunDue(time.Now())
+	var favTracksSnapshots []models.DTOFavTracksSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssfavtracks").Data, &favTracksSnapshots))
+	suite.Empty(favTracksSnapshots)
+
+	services.SnapshotScheduler.RunDue(schedule.NextRun)
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssfavtracks").Data, &favTracksSnapshots))
+	suite.Equal(1, len(favTracksSnapshots))
+	var playlistsSnapshots []models.DTOPlaylistSnapshot
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/ssplaylists").Data, &playlistsSnapshots))
+	suite.Equal(1, len(playlistsSnapshots))
+
+	var ranSchedule models.SnapshotSchedule
+	suite.Require().NoError(json.Unmarshal(suite.getAPI("/api/schedule").Data, &ranSchedule))
+	suite.Require().NotNil(ranSchedule.LastRun)
+	suite.True(ranSchedule.LastRun.Equal(schedule.NextRun))
+	suite.True(ranSchedule.NextRun.After(schedule.NextRun.Add(23*time.Hour)), "next run should be the day after")
+	suite.Empty(ranSchedule.LastError)
+
+	apiResp = suite.getAPI("/schedule_snapshots?frequency=cron&cron=30+6+*+*+1-5&snapshots=fav_tracks")
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &schedule))
+	suite.Equal("Snapshots scheduled [30 6 * * 1-5], next run at "+schedule.NextRun.Format(time.RFC822), apiResp.Message)
+	suite.Equal([]string{models.ScheduledFavTracks}, schedule.Snapshots)
+	suite.Nil(schedule.LastRun, "replaced schedule starts over")
+
+	suite.Equal(models.SpError{Status: http.StatusBadRequest, Message: "invalid minute [61]: [61] out of range 0-59"},
+		suite.getAPIError("/schedule_snapshots?frequency=cron&cron=61+*+*+*+*"))
+	suite.Equal(models.SpError{Status: http.StatusBadRequest, Message: "Invalid snapshots [albums], expected fav_tracks or playlists"},
+		suite.getAPIError("/schedule_snapshots?frequency=daily&snapshots=albums"))
+	suite.Equal(models.SpError{Status: http.StatusBadRequest, Message: "Playlists snapshots can be scheduled at most daily, [0 * * * *] runs 24 times a day"},
+		suite.getAPIError("/schedule_snapshots?frequency=hourly"))
+
+	suite.Equal("Scheduled snapshots stopped", suite.getAPI("/unschedule_snapshots").Message)
+	suite.Equal(models.SpError{Status: http.StatusNotFound, Message: "No snapshots scheduled"}, suite.getAPIError("/api/schedule"))
+	suite.Equal(models.SpError{Status: http.StatusNotFound, Message: "No snapshots scheduled"}, suite.getAPIError("/unschedule_snapshots"))
+}
+
+func (suite *E2ETestSuite) TestLoginPKCE() {
+	config.Conf.AuthFlow = config.AuthFlowPKCE
+	// no client secret needed
+	suite.startSpotilizer("")
+	suite.login()
+
+	apiResp := suite.getAPI("/save_current_tracks")
+	suite.Equal("52 favorite tracks saved successfully", apiResp.Message)
+
+	// refreshing tokens works without the client secret as well
+	suite.fakeSpotify.ExpireAccessTokens()
+	apiResp = suite.getAPI("/save_current_tracks")
+	suite.Equal("52 favorite tracks saved successfully", apiResp.Message)
+	suite.Equal(2, suite.fakeSpotify.RequestsCount("/api/token"))
+}
+
+func (suite *E2ETestSuite) login() {
+	resp, err := suite.client.Get(suite.spotilizerServer.URL + "/login")
+	suite.Require().NoError(err)
+	resp.Body.Close()
+	suite.Require().Equal(http.StatusOK, resp.StatusCode)
+	suite.Require().Equal("/callback", resp.Request.URL.Path, "login should end up at the callback")
+}
+
+// grantMissingScopes returns the feature resumed after the consent
+func (suite *E2ETestSuite) grantMissingScopes(path string, expectedMissingScopes ...string) (resumed string) {
+	resp, err := suite.client.Get(suite.spotilizerServer.URL + path)
+	suite.Require().NoError(err)
+	scopesRequired := models.DTOScopesRequired{}
+	err = json.NewDecoder(resp.Body).Decode(&scopesRequired)
+	resp.Body.Close()
+	suite.Require().NoError(err)
+	suite.Require().Equal(expectedMissingScopes, scopesRequired.MissingScopes)
+
+	resp, err = suite.client.Get(suite.spotilizerServer.URL + scopesRequired.ConsentURL)
+	suite.Require().NoError(err)
+	resp.Body.Close()
+	suite.Require().Equal(http.StatusOK, resp.StatusCode)
+	suite.Require().Equal("/", resp.Request.URL.Path, "user should be returned to index after consent")
+	resumed = resp.Request.URL.Query().Get("resume")
+	suite.Require().NotEmpty(resumed)
+	return resumed
+}
+
+func (suite *E2ETestSuite) getAPI(path string) *e2eAPIResponse {
+	resp, err := suite.client.Get(suite.spotilizerServer.URL + path)
+	suite.Require().NoError(err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	suite.Require().NoError(err)
+
+	apiResp := &e2eAPIResponse{}
+	suite.Require().NoError(json.Unmarshal(body, apiResp), string(body))
+	suite.Require().Nil(apiResp.Error, string(body))
+	suite.Require().Equal(http.StatusOK, apiResp.Status, string(body))
+	return apiResp
+}
+
+// getAPIError requests the path, expecting an API error response
+func (suite *E2ETestSuite) getAPIError(path string) models.SpError {
+	resp, err := suite.client.Get(suite.spotilizerServer.URL + path)
+	suite.Require().NoError(err)
+	defer resp.Body.Close()
+	apiErr := models.SpAPIError{}
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&apiErr))
+	return apiErr.Error
+}
+
+// planID is the ID of the write-back plan in the response
+func (suite *E2ETestSuite) planID(apiResp *e2eAPIResponse) string {
+	var plan models.WriteBackPlan
+	suite.Require().NoError(json.Unmarshal(apiResp.Data, &plan))
+	suite.Require().NotEmpty(plan.ID)
+	return plan.ID
+}
+
+// playlistTracks are the URIs of the playlist tracks on the fake Spotify server
+func (suite *E2ETestSuite) playlistTracks(playlistID string) []string {
+	var uris []string
+	suite.fakeSpotify.UpdateFixtures(func(f *fakespotify.Fixtures) {
+		for _, plf := range f.Playlists {
+			if plf.Playlist.ID != playlistID {
+				continue
+			}
+			for _, t := range plf.Tracks {
+				uris = append(uris, t.Track.URI)
+			}
+		}
+	})
+	return uris
+}
+
+func TestE2ETestSuite(t *testing.T) {
+	suite.Run(t, new(E2ETestSuite))
+}
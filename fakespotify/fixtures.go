@@ -0,0 +1,94 @@
+package fakespotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// Fixtures hold the data served by the fake Spotify Web API server, for a single user
+type Fixtures struct {
+	User            models.SpUser           `json:"user"`
+	Playlists       []PlaylistFixture       `json:"playlists"`
+	SavedTracks     []models.SpAddedTrack   `json:"saved_tracks"`
+	FollowedArtists []models.SpFullArtist   `json:"followed_artists"`
+	SavedAlbums     []models.SpSavedAlbum   `json:"saved_albums"`
+	SavedShows      []models.SpSavedShow    `json:"saved_shows"`
+	SavedEpisodes   []models.SpSavedEpisode `json:"saved_episodes"`
+	// RecentlyPlayed holds the played tracks, most recent first
+	RecentlyPlayed []models.SpPlayHistory `json:"recently_played"`
+	// TopTracks and TopArtists hold the rankings by time range (short_term, medium_term, long_term)
+	TopTracks     map[string][]models.SpTrack      `json:"top_tracks"`
+	TopArtists    map[string][]models.SpFullArtist `json:"top_artists"`
+	AudioFeatures []models.SpAudioFeatures         `json:"audio_features"`
+	// Artists hold the full artists of saved and playlist tracks
+	Artists []models.SpFullArtist `json:"artists"`
+	// UnavailableTracks hold IDs of the tracks not playable in user's country
+	UnavailableTracks []string `json:"unavailable_tracks"`
+}
+
+type PlaylistFixture struct {
+	Playlist models.SpPlaylist        `json:"playlist"`
+	Tracks   []models.SpPlaylistTrack `json:"tracks"`
+}
+
+// ReadFixtures reads JSON encoded fixtures
+func ReadFixtures(r io.Reader) (*Fixtures, error) {
+	fixtures := &Fixtures{}
+	if err := json.NewDecoder(r).Decode(fixtures); err != nil {
+		return nil, err
+	}
+	return fixtures, nil
+}
+
+// LoadFixtures reads fixtures from a JSON file
+func LoadFixtures(path string) (*Fixtures, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadFixtures(f)
+}
+
+// catalogTracks are all the tracks of the fixtures (saved, playlist and top tracks), by track ID
+func (f *Fixtures) catalogTracks() map[string]models.SpTrack {
+	tracks := make(map[string]models.SpTrack)
+	for _, t := range f.SavedTracks {
+		tracks[t.Track.ID] = t.Track
+	}
+	for _, plf := range f.Playlists {
+		for _, t := range plf.Tracks {
+			tracks[t.Track.ID] = t.Track
+		}
+	}
+	for _, rangeTracks := range f.TopTracks {
+		for _, t := range rangeTracks {
+			tracks[t.ID] = t
+		}
+	}
+	return tracks
+}
+
+// withTracksRef is the playlist along with the reference to its tracks, as the API serves it
+func (plf *PlaylistFixture) withTracksRef(r *http.Request) models.SpPlaylist {
+	pl := plf.Playlist
+	pl.Tracks = models.SpTracks{
+		Href:  fmt.Sprintf("%s/v1/playlists/%s/tracks", baseURL(r), pl.ID),
+		Total: len(plf.Tracks),
+	}
+	return pl
+}
+
+func (f *Fixtures) getPlaylist(id string) *PlaylistFixture {
+	for i := range f.Playlists {
+		if f.Playlists[i].Playlist.ID == id {
+			return &f.Playlists[i]
+		}
+	}
+	return nil
+}
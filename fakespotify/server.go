@@ -0,0 +1,1008 @@
+// Package fakespotify provides a fake Spotify Web API and Accounts server, serving fixture data.
+// It is meant for running spotilizer end to end, offline, e.g. in tests.
+package fakespotify
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+const maxPageLimit = 50
+
+// Fault is injected into responses of the endpoints starting with PathPrefix, for the next Count requests,
+// or for all of them when Count is 0. Status (e.g. 500, or 429 along with RetryAfter seconds) is responded
+// instead of the real response, while Delay makes the response slow.
+type Fault struct {
+	PathPrefix string
+	Status     int
+	RetryAfter int
+	Delay      time.Duration
+	Count      int
+}
+
+type authCode struct {
+	username      string
+	scope         string
+	codeChallenge string
+}
+
+type grant struct {
+	username string
+	scope    string
+}
+
+type issuedToken struct {
+	username  string
+	expiresAt time.Time
+}
+
+// Server is a fake Spotify server, serving both the Web API (/v1/...) and the Accounts service (/authorize, /api/token)
+type Server struct {
+	clientID     string
+	clientSecret string
+	router       *mux.Router
+
+	mutex    sync.Mutex
+	fixtures *Fixtures
+	// catalog holds the tracks of all fixtures so far, so the ones removed from fixtures can still be looked up
+	catalog       map[string]models.SpTrack
+	faults        []*Fault
+	tokenTTL      time.Duration
+	codes         map[string]authCode
+	accessTokens  map[string]issuedToken
+	refreshTokens map[string]grant
+	tokensCounter int
+	// playlistsCounter makes IDs of created playlists, and snapshot IDs of changed playlists
+	playlistsCounter int
+	requests         map[string]int
+}
+
+func NewServer(fixtures *Fixtures, clientID string, clientSecret string) *Server {
+	s := &Server{
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		fixtures:      fixtures,
+		catalog:       fixtures.catalogTracks(),
+		tokenTTL:      time.Hour,
+		codes:         make(map[string]authCode),
+		accessTokens:  make(map[string]issuedToken),
+		refreshTokens: make(map[string]grant),
+		requests:      make(map[string]int),
+	}
+
+	s.router = mux.NewRouter()
+	s.router.HandleFunc("/authorize", s.authorizeHandler).Methods("GET")
+	s.router.HandleFunc("/api/token", s.tokenHandler).Methods("POST")
+	s.router.HandleFunc("/api/token/", s.tokenHandler).Methods("POST")
+
+	apiRouter := s.router.PathPrefix("/v1").Subrouter()
+	apiRouter.HandleFunc("/me", s.apiHandler(s.currentUserHandler)).Methods("GET")
+	apiRouter.HandleFunc("/me/playlists", s.apiHandler(s.currentUserPlaylistsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/me/tracks", s.apiHandler(s.savedTracksHandler)).Methods("GET")
+	apiRouter.HandleFunc("/me/tracks", s.apiHandler(s.saveTracksHandler)).Methods("PUT")
+	apiRouter.HandleFunc("/me/tracks", s.apiHandler(s.removeSavedTracksHandler)).Methods("DELETE")
+	apiRouter.HandleFunc("/tracks", s.apiHandler(s.tracksHandler)).Methods("GET")
+	apiRouter.HandleFunc("/me/albums", s.apiHandler(s.savedAlbumsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/me/shows", s.apiHandler(s.savedShowsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/me/episodes", s.apiHandler(s.savedEpisodesHandler)).Methods("GET")
+	apiRouter.HandleFunc("/me/player/recently-played", s.apiHandler(s.recentlyPlayedHandler)).Methods("GET")
+	apiRouter.HandleFunc("/me/top/{type}", s.apiHandler(s.topItemsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/artists", s.apiHandler(s.artistsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/audio-features", s.apiHandler(s.audioFeaturesHandler)).Methods("GET")
+	apiRouter.HandleFunc("/me/following", s.apiHandler(s.followedArtistsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/playlists/{id}", s.apiHandler(s.playlistHandler)).Methods("GET")
+	apiRouter.HandleFunc("/playlists/{id}/tracks", s.apiHandler(s.playlistTracksHandler)).Methods("GET")
+	apiRouter.HandleFunc("/playlists/{id}/tracks", s.apiHandler(s.addPlaylistTracksHandler)).Methods("POST")
+	apiRouter.HandleFunc("/playlists/{id}/tracks", s.apiHandler(s.removePlaylistTracksHandler)).Methods("DELETE")
+	apiRouter.HandleFunc("/playlists/{id}/tracks", s.apiHandler(s.reorderPlaylistTracksHandler)).Methods("PUT")
+	apiRouter.HandleFunc("/playlists/{id}/followers", s.apiHandler(s.unfollowPlaylistHandler)).Methods("DELETE")
+	apiRouter.HandleFunc("/users/{id}/playlists", s.apiHandler(s.createPlaylistHandler)).Methods("POST")
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests[r.URL.Path]++
+	fault := s.takeFault(r.URL.Path)
+	s.mutex.Unlock()
+
+	if fault != nil {
+		if fault.Delay > 0 {
+			time.Sleep(fault.Delay)
+		}
+		if fault.Status > 0 {
+			if fault.Status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", strconv.Itoa(fault.RetryAfter))
+			}
+			sendAPIError(w, fault.Status, http.StatusText(fault.Status))
+			return
+		}
+	}
+
+	s.router.ServeHTTP(w, r)
+}
+
+// UpdateFixtures safely changes the served data, e.g. to simulate user removing a saved track
+func (s *Server) UpdateFixtures(update func(f *Fixtures)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	update(s.fixtures)
+	for id, t := range s.fixtures.catalogTracks() {
+		s.catalog[id] = t
+	}
+}
+
+func (s *Server) InjectFault(fault Fault) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = append(s.faults, &fault)
+}
+
+func (s *Server) ClearFaults() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = nil
+}
+
+// SetTokenTTL sets the lifetime of access tokens issued from now on
+func (s *Server) SetTokenTTL(ttl time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokenTTL = ttl
+}
+
+// ExpireAccessTokens makes all issued access tokens expired, so API responds with 401 until they are refreshed
+func (s *Server) ExpireAccessTokens() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for token, issued := range s.accessTokens {
+		issued.expiresAt = time.Now()
+		s.accessTokens[token] = issued
+	}
+}
+
+// RevokeRefreshTokens makes all issued refresh tokens invalid, refreshing them results in "invalid_grant"
+func (s *Server) RevokeRefreshTokens() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refreshTokens = make(map[string]grant)
+}
+
+// RequestsCount returns how many requests were made towards the given path
+func (s *Server) RequestsCount(path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests[path]
+}
+
+// takeFault must be called while holding the mutex
+func (s *Server) takeFault(path string) *Fault {
+	for i, f := range s.faults {
+		if !strings.HasPrefix(path, f.PathPrefix) {
+			continue
+		}
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+/****************** A C C O U N T S ****************************************************************/
+
+func (s *Server) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != s.clientID {
+		http.Error(w, "INVALID_CLIENT: Invalid client", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || len(q.Get("redirect_uri")) == 0 {
+		http.Error(w, "INVALID_CLIENT: Invalid redirect URI", http.StatusBadRequest)
+		return
+	}
+	codeChallenge := q.Get("code_challenge")
+	if len(codeChallenge) > 0 && q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "INVALID_REQUEST: code_challenge_method must be S256", http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	s.tokensCounter++
+	code := fmt.Sprintf("code-%d", s.tokensCounter)
+	s.codes[code] = authCode{username: s.fixtures.User.ID, scope: q.Get("scope"), codeChallenge: codeChallenge}
+	s.mutex.Unlock()
+
+	callbackQuery := redirectURI.Query()
+	callbackQuery.Set("code", code)
+	callbackQuery.Set("state", q.Get("state"))
+	redirectURI.RawQuery = callbackQuery.Encode()
+	log.Tracef(" > fake spotify: authorized, redirecting to [%s]", redirectURI.String())
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		sendLoginError(w, "invalid_request", err.Error())
+		return
+	}
+	if !s.clientAuthorized(r) {
+		sendLoginError(w, "invalid_client", "Invalid client")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var granted grant
+	refreshToken := ""
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, found := s.codes[r.PostForm.Get("code")]
+		if !found {
+			sendLoginError(w, "invalid_grant", "Invalid authorization code")
+			return
+		}
+		delete(s.codes, r.PostForm.Get("code"))
+		if len(code.codeChallenge) > 0 && !verifyCodeChallenge(code.codeChallenge, r.PostForm.Get("code_verifier")) {
+			sendLoginError(w, "invalid_grant", "code_verifier was incorrect")
+			return
+		}
+		if len(code.codeChallenge) == 0 && !hasBasicAuth(r) {
+			sendLoginError(w, "invalid_request", "code_verifier required")
+			return
+		}
+		granted = grant{username: code.username, scope: code.scope}
+		s.tokensCounter++
+		refreshToken = fmt.Sprintf("refresh-token-%d", s.tokensCounter)
+		s.refreshTokens[refreshToken] = granted
+	case "refresh_token":
+		var found bool
+		granted, found = s.refreshTokens[r.PostForm.Get("refresh_token")]
+		if !found {
+			sendLoginError(w, "invalid_grant", "Refresh token revoked")
+			return
+		}
+	default:
+		sendLoginError(w, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return
+	}
+
+	s.tokensCounter++
+	accessToken := fmt.Sprintf("access-token-%d", s.tokensCounter)
+	s.accessTokens[accessToken] = issuedToken{username: granted.username, expiresAt: time.Now().Add(s.tokenTTL)}
+
+	sendJSON(w, http.StatusOK, models.SpotifyAuthOptions{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		Scope:        granted.scope,
+		ExpiresIn:    int(s.tokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+	})
+}
+
+// clientAuthorized accepts both confidential clients (Basic auth with client secret),
+// and public PKCE clients sending only client_id
+func (s *Server) clientAuthorized(r *http.Request) bool {
+	if !hasBasicAuth(r) {
+		return r.PostForm.Get("client_id") == s.clientID
+	}
+	credentials, err := b64.StdEncoding.DecodeString(strings.TrimPrefix(r.Header.Get("Authorization"), "Basic "))
+	return err == nil && string(credentials) == s.clientID+":"+s.clientSecret
+}
+
+func hasBasicAuth(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), "Basic ")
+}
+
+func verifyCodeChallenge(codeChallenge string, codeVerifier string) bool {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return len(codeVerifier) >= 43 && b64.RawURLEncoding.EncodeToString(hash[:]) == codeChallenge
+}
+
+/****************** W E B   A P I ******************************************************************/
+
+// apiHandler checks the access token before serving the API response
+func (s *Server) apiHandler(handle func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mutex.Lock()
+		issued, found := s.accessTokens[token]
+		s.mutex.Unlock()
+		if !found {
+			sendAPIError(w, http.StatusUnauthorized, "Invalid access token")
+			return
+		}
+		if time.Now().After(issued.expiresAt) {
+			sendAPIError(w, http.StatusUnauthorized, "The access token expired")
+			return
+		}
+		handle(w, r)
+	}
+}
+
+func (s *Server) currentUserHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	user := s.fixtures.User
+	s.mutex.Unlock()
+	s.sendCachable(w, r, user)
+}
+
+func (s *Server) currentUserPlaylistsHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	var playlists []interface{}
+	for _, plf := range s.fixtures.Playlists {
+		playlists = append(playlists, plf.withTracksRef(r))
+	}
+	s.mutex.Unlock()
+	s.sendPage(w, r, playlists)
+}
+
+func (s *Server) playlistHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	plf := s.fixtures.getPlaylist(mux.Vars(r)["id"])
+	if plf == nil {
+		s.mutex.Unlock()
+		sendAPIError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	playlist := plf.withTracksRef(r)
+	s.mutex.Unlock()
+	s.sendCachable(w, r, playlist)
+}
+
+// createPlaylistHandler creates an empty playlist, for the current user only
+func (s *Server) createPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Public      *bool  `json:"public"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || len(reqBody.Name) == 0 {
+		sendAPIError(w, http.StatusBadRequest, "Missing required field: name")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if mux.Vars(r)["id"] != s.fixtures.User.ID {
+		sendAPIError(w, http.StatusForbidden, "You cannot create a playlist for another user")
+		return
+	}
+	s.playlistsCounter++
+	id := fmt.Sprintf("created-playlist-%d", s.playlistsCounter)
+	plf := PlaylistFixture{
+		Playlist: models.SpPlaylist{
+			ID:          id,
+			Name:        reqBody.Name,
+			Description: reqBody.Description,
+			Public:      reqBody.Public == nil || *reqBody.Public,
+			Owner:       s.fixtures.User,
+			SnapshotID:  fmt.Sprintf("%s-snapshot-%d", id, s.playlistsCounter),
+			Type:        "playlist",
+			URI:         "spotify:playlist:" + id,
+		},
+		Tracks: []models.SpPlaylistTrack{},
+	}
+	s.fixtures.Playlists = append(s.fixtures.Playlists, plf)
+	sendJSON(w, http.StatusCreated, plf.withTracksRef(r))
+}
+
+// unfollowPlaylistHandler removes the playlist from user's playlists, which is the way of deleting own playlists
+func (s *Server) unfollowPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := mux.Vars(r)["id"]
+	for i, plf := range s.fixtures.Playlists {
+		if plf.Playlist.ID == id {
+			s.fixtures.Playlists = append(s.fixtures.Playlists[:i], s.fixtures.Playlists[i+1:]...)
+			break
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// addPlaylistTracksHandler inserts the tracks given by uris (100 at most) at the position, or at the end of the playlist
+func (s *Server) addPlaylistTracksHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody struct {
+		URIs     []string `json:"uris"`
+		Position *int     `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(reqBody.URIs) > 100 {
+		sendAPIError(w, http.StatusBadRequest, "You can add a maximum of 100 tracks per request.")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	plf := s.fixtures.getPlaylist(mux.Vars(r)["id"])
+	if plf == nil {
+		sendAPIError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	position := len(plf.Tracks)
+	if reqBody.Position != nil {
+		position = *reqBody.Position
+	}
+	if position < 0 || position > len(plf.Tracks) {
+		sendAPIError(w, http.StatusBadRequest, "Index out of bounds.")
+		return
+	}
+	var added []models.SpPlaylistTrack
+	for _, uri := range reqBody.URIs {
+		t, found := s.catalog[strings.TrimPrefix(uri, "spotify:track:")]
+		if !found {
+			sendAPIError(w, http.StatusBadRequest, "Invalid track uri: "+uri)
+			return
+		}
+		added = append(added, models.SpPlaylistTrack{AddedAt: time.Now(), AddedBy: models.SpAddedBy{ID: s.fixtures.User.ID, Type: "user"}, Track: t})
+	}
+	plf.Tracks = append(plf.Tracks[:position], append(added, plf.Tracks[position:]...)...)
+	s.sendPlaylistChanged(w, plf, http.StatusCreated)
+}
+
+// removePlaylistTracksHandler removes the tracks given by uri, at the given positions only when positions are set.
+// Positions refer to the playlist version given by snapshot_id, which must be the current one in the fake server.
+func (s *Server) removePlaylistTracksHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody struct {
+		Tracks []struct {
+			URI       string `json:"uri"`
+			Positions []int  `json:"positions"`
+		} `json:"tracks"`
+		SnapshotID string `json:"snapshot_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(reqBody.Tracks) > 100 {
+		sendAPIError(w, http.StatusBadRequest, "You can remove a maximum of 100 tracks per request.")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	plf := s.fixtures.getPlaylist(mux.Vars(r)["id"])
+	if plf == nil {
+		sendAPIError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	if len(reqBody.SnapshotID) > 0 && reqBody.SnapshotID != plf.Playlist.SnapshotID {
+		sendAPIError(w, http.StatusBadRequest, "Invalid snapshot id")
+		return
+	}
+	toRemove := make(map[int]bool)
+	for _, removed := range reqBody.Tracks {
+		if len(removed.Positions) == 0 {
+			for pos, t := range plf.Tracks {
+				if t.Track.URI == removed.URI {
+					toRemove[pos] = true
+				}
+			}
+			continue
+		}
+		for _, pos := range removed.Positions {
+			if pos < 0 || pos >= len(plf.Tracks) || plf.Tracks[pos].Track.URI != removed.URI {
+				sendAPIError(w, http.StatusBadRequest, fmt.Sprintf("Could not remove tracks, please check parameters: track [%s] not at position [%d]", removed.URI, pos))
+				return
+			}
+			toRemove[pos] = true
+		}
+	}
+	var left []models.SpPlaylistTrack
+	for pos, t := range plf.Tracks {
+		if !toRemove[pos] {
+			left = append(left, t)
+		}
+	}
+	plf.Tracks = left
+	s.sendPlaylistChanged(w, plf, http.StatusOK)
+}
+
+// reorderPlaylistTracksHandler moves range_length tracks from range_start to before insert_before, where insert_before
+// is a position in the playlist before the move. Snapshot ID, when given, must be the current one.
+func (s *Server) reorderPlaylistTracksHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody struct {
+		RangeStart   int    `json:"range_start"`
+		InsertBefore int    `json:"insert_before"`
+		RangeLength  int    `json:"range_length"`
+		SnapshotID   string `json:"snapshot_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if reqBody.RangeLength <= 0 {
+		reqBody.RangeLength = 1
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	plf := s.fixtures.getPlaylist(mux.Vars(r)["id"])
+	if plf == nil {
+		sendAPIError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	if len(reqBody.SnapshotID) > 0 && reqBody.SnapshotID != plf.Playlist.SnapshotID {
+		sendAPIError(w, http.StatusBadRequest, "Invalid snapshot id")
+		return
+	}
+	start, end := reqBody.RangeStart, reqBody.RangeStart+reqBody.RangeLength
+	if start < 0 || end > len(plf.Tracks) || reqBody.InsertBefore < 0 || reqBody.InsertBefore > len(plf.Tracks) {
+		sendAPIError(w, http.StatusBadRequest, "Index out of bounds.")
+		return
+	}
+	moved := append([]models.SpPlaylistTrack{}, plf.Tracks[start:end]...)
+	var reordered []models.SpPlaylistTrack
+	for pos := 0; pos <= len(plf.Tracks); pos++ {
+		if pos == reqBody.InsertBefore {
+			reordered = append(reordered, moved...)
+		}
+		if pos < len(plf.Tracks) && (pos < start || pos >= end) {
+			reordered = append(reordered, plf.Tracks[pos])
+		}
+	}
+	plf.Tracks = reordered
+	s.sendPlaylistChanged(w, plf, http.StatusOK)
+}
+
+// sendPlaylistChanged gives the changed playlist a new snapshot ID, and responds with it
+func (s *Server) sendPlaylistChanged(w http.ResponseWriter, plf *PlaylistFixture, status int) {
+	s.playlistsCounter++
+	plf.Playlist.SnapshotID = fmt.Sprintf("%s-snapshot-%d", plf.Playlist.ID, s.playlistsCounter)
+	sendJSON(w, status, models.SpPlaylistSnapshotResp{SnapshotID: plf.Playlist.SnapshotID})
+}
+
+func (s *Server) playlistTracksHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	plf := s.fixtures.getPlaylist(mux.Vars(r)["id"])
+	if plf == nil {
+		s.mutex.Unlock()
+		sendAPIError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	var tracks []interface{}
+	for _, t := range plf.Tracks {
+		tracks = append(tracks, t)
+	}
+	s.mutex.Unlock()
+	s.sendPage(w, r, tracks)
+}
+
+func (s *Server) savedTracksHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	var tracks []interface{}
+	for _, t := range s.fixtures.SavedTracks {
+		tracks = append(tracks, t)
+	}
+	s.mutex.Unlock()
+	s.sendPage(w, r, tracks)
+}
+
+func (s *Server) savedAlbumsHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	var albums []interface{}
+	for _, a := range s.fixtures.SavedAlbums {
+		albums = append(albums, a)
+	}
+	s.mutex.Unlock()
+	s.sendPage(w, r, albums)
+}
+
+func (s *Server) savedShowsHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	var shows []interface{}
+	for _, sh := range s.fixtures.SavedShows {
+		shows = append(shows, sh)
+	}
+	s.mutex.Unlock()
+	s.sendPage(w, r, shows)
+}
+
+func (s *Server) savedEpisodesHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	var episodes []interface{}
+	for _, e := range s.fixtures.SavedEpisodes {
+		episodes = append(episodes, e)
+	}
+	s.mutex.Unlock()
+	s.sendPage(w, r, episodes)
+}
+
+// topItemsHandler responds with user's top tracks or artists, for the time_range query param (medium_term by default)
+func (s *Server) topItemsHandler(w http.ResponseWriter, r *http.Request) {
+	timeRange := r.URL.Query().Get("time_range")
+	if timeRange == "" {
+		timeRange = models.TopTimeRangeMedium
+	}
+	if timeRange != models.TopTimeRangeShort && timeRange != models.TopTimeRangeMedium && timeRange != models.TopTimeRangeLong {
+		sendAPIError(w, http.StatusBadRequest, "Invalid time range")
+		return
+	}
+
+	s.mutex.Lock()
+	var items []interface{}
+	switch mux.Vars(r)["type"] {
+	case "tracks":
+		for _, t := range s.fixtures.TopTracks[timeRange] {
+			items = append(items, t)
+		}
+	case "artists":
+		for _, a := range s.fixtures.TopArtists[timeRange] {
+			items = append(items, a)
+		}
+	default:
+		s.mutex.Unlock()
+		sendAPIError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	s.mutex.Unlock()
+	s.sendPage(w, r, items)
+}
+
+// artistsHandler responds with artists given by ids query param (50 at most), in the same order, null for unknown
+// artists
+func (s *Server) artistsHandler(w http.ResponseWriter, r *http.Request) {
+	ids := strings.Split(r.URL.Query().Get("ids"), ",")
+	if len(ids) > 50 {
+		sendAPIError(w, http.StatusBadRequest, "Too many ids requested")
+		return
+	}
+
+	s.mutex.Lock()
+	artists := make(map[string]models.SpFullArtist)
+	for _, a := range s.fixtures.Artists {
+		artists[a.ID] = a
+	}
+	s.mutex.Unlock()
+
+	var response models.SpGetArtistsResp
+	for _, id := range ids {
+		if a, found := artists[id]; found {
+			response.Artists = append(response.Artists, &a)
+		} else {
+			response.Artists = append(response.Artists, nil)
+		}
+	}
+	sendJSON(w, http.StatusOK, response)
+}
+
+// saveTracksHandler adds tracks given by ids in JSON body (50 at most) to saved tracks, unless already saved
+func (s *Server) saveTracksHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(reqBody.IDs) > 50 {
+		sendAPIError(w, http.StatusBadRequest, "Too many ids requested")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, id := range reqBody.IDs {
+		if _, found := s.catalog[id]; !found {
+			sendAPIError(w, http.StatusBadRequest, "Invalid id")
+			return
+		}
+	}
+	saved := make(map[string]bool)
+	for _, t := range s.fixtures.SavedTracks {
+		saved[t.Track.ID] = true
+	}
+	for _, id := range reqBody.IDs {
+		if saved[id] {
+			continue
+		}
+		saved[id] = true
+		// most recently saved tracks come first
+		addedTrack := models.SpAddedTrack{AddedAt: time.Now(), Track: s.catalog[id]}
+		s.fixtures.SavedTracks = append([]models.SpAddedTrack{addedTrack}, s.fixtures.SavedTracks...)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) removeSavedTracksHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(reqBody.IDs) > 50 {
+		sendAPIError(w, http.StatusBadRequest, "Too many ids requested")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	removed := make(map[string]bool)
+	for _, id := range reqBody.IDs {
+		removed[id] = true
+	}
+	var left []models.SpAddedTrack
+	for _, t := range s.fixtures.SavedTracks {
+		if !removed[t.Track.ID] {
+			left = append(left, t)
+		}
+	}
+	s.fixtures.SavedTracks = left
+	w.WriteHeader(http.StatusOK)
+}
+
+// tracksHandler responds with catalog tracks given by ids query param (50 at most), in the same order, null for
+// unknown tracks. When market is given, tracks tell if they are playable.
+func (s *Server) tracksHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ids := strings.Split(q.Get("ids"), ",")
+	if len(ids) > 50 {
+		sendAPIError(w, http.StatusBadRequest, "Too many ids requested")
+		return
+	}
+
+	s.mutex.Lock()
+	unavailable := make(map[string]bool)
+	for _, id := range s.fixtures.UnavailableTracks {
+		unavailable[id] = true
+	}
+	var response models.SpGetTracksResp
+	for _, id := range ids {
+		t, found := s.catalog[id]
+		if !found {
+			response.Tracks = append(response.Tracks, nil)
+			continue
+		}
+		if len(q.Get("market")) > 0 {
+			playable := !unavailable[id]
+			t.IsPlayable = &playable
+		}
+		response.Tracks = append(response.Tracks, &t)
+	}
+	s.mutex.Unlock()
+	sendJSON(w, http.StatusOK, response)
+}
+
+// audioFeaturesHandler responds with audio features of tracks given by ids query param (100 at most), in the same
+// order, null for tracks without audio features
+func (s *Server) audioFeaturesHandler(w http.ResponseWriter, r *http.Request) {
+	ids := strings.Split(r.URL.Query().Get("ids"), ",")
+	if len(ids) > 100 {
+		sendAPIError(w, http.StatusBadRequest, "Too many ids requested")
+		return
+	}
+
+	s.mutex.Lock()
+	features := make(map[string]models.SpAudioFeatures)
+	for _, f := range s.fixtures.AudioFeatures {
+		features[f.ID] = f
+	}
+	s.mutex.Unlock()
+
+	var response models.SpGetAudioFeaturesResp
+	for _, id := range ids {
+		if f, found := features[id]; found {
+			response.AudioFeatures = append(response.AudioFeatures, &f)
+		} else {
+			response.AudioFeatures = append(response.AudioFeatures, nil)
+		}
+	}
+	sendJSON(w, http.StatusOK, response)
+}
+
+// recentlyPlayedHandler responds with at most limit (max 50) most recently played tracks, played after the "after"
+// cursor (unix ms) if given
+func (s *Server) recentlyPlayedHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > maxPageLimit {
+		sendAPIError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	var afterMs int64
+	if after := q.Get("after"); after != "" {
+		if afterMs, err = strconv.ParseInt(after, 10, 64); err != nil {
+			sendAPIError(w, http.StatusBadRequest, "Invalid after cursor")
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	plays := []models.SpPlayHistory{}
+	for _, p := range s.fixtures.RecentlyPlayed {
+		if len(plays) == limit {
+			break
+		}
+		if p.PlayedAt.UnixNano()/int64(time.Millisecond) > afterMs {
+			plays = append(plays, p)
+		}
+	}
+	s.mutex.Unlock()
+
+	page := map[string]interface{}{
+		"href":    fmt.Sprintf("%s%s?%s", baseURL(r), r.URL.Path, q.Encode()),
+		"items":   plays,
+		"limit":   limit,
+		"next":    nil,
+		"cursors": nil,
+	}
+	s.sendCachable(w, r, page)
+}
+
+// followedArtistsHandler responds with a cursor-based page of followed artists, the cursor being the ID of the last artist sent
+func (s *Server) followedArtistsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("type") != "artist" {
+		sendAPIError(w, http.StatusBadRequest, "Invalid type")
+		return
+	}
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > maxPageLimit {
+		sendAPIError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+
+	s.mutex.Lock()
+	artists := append([]models.SpFullArtist{}, s.fixtures.FollowedArtists...)
+	s.mutex.Unlock()
+
+	start := 0
+	if after := q.Get("after"); after != "" {
+		start = len(artists)
+		for i, a := range artists {
+			if a.ID == after {
+				start = i + 1
+				break
+			}
+		}
+	}
+	end := start + limit
+	if end > len(artists) {
+		end = len(artists)
+	}
+
+	pageURL := func(after string) string {
+		pq := url.Values{}
+		pq.Set("type", "artist")
+		pq.Set("limit", strconv.Itoa(limit))
+		if after != "" {
+			pq.Set("after", after)
+		}
+		return fmt.Sprintf("%s%s?%s", baseURL(r), r.URL.Path, pq.Encode())
+	}
+
+	page := map[string]interface{}{
+		"href":    pageURL(q.Get("after")),
+		"items":   append([]models.SpFullArtist{}, artists[start:end]...),
+		"limit":   limit,
+		"total":   len(artists),
+		"next":    nil,
+		"cursors": map[string]interface{}{"after": nil},
+	}
+	if end < len(artists) {
+		lastID := artists[end-1].ID
+		page["next"] = pageURL(lastID)
+		page["cursors"] = map[string]interface{}{"after": lastID}
+	}
+	s.sendCachable(w, r, map[string]interface{}{"artists": page})
+}
+
+// sendPage responds with a Spotify paging object, containing the items selected by offset and limit query params
+func (s *Server) sendPage(w http.ResponseWriter, r *http.Request, items []interface{}) {
+	q := r.URL.Query()
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > maxPageLimit {
+		sendAPIError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	if offset < 0 || offset > len(items) {
+		offset = len(items)
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+
+	pageURL := func(pageOffset int) string {
+		pq := url.Values{}
+		pq.Set("offset", strconv.Itoa(pageOffset))
+		pq.Set("limit", strconv.Itoa(limit))
+		return fmt.Sprintf("%s%s?%s", baseURL(r), r.URL.Path, pq.Encode())
+	}
+
+	page := map[string]interface{}{
+		"href":     pageURL(offset),
+		"items":    append([]interface{}{}, items[offset:end]...),
+		"limit":    limit,
+		"offset":   offset,
+		"total":    len(items),
+		"next":     nil,
+		"previous": nil,
+	}
+	if end < len(items) {
+		page["next"] = pageURL(end)
+	}
+	if offset > 0 {
+		prevOffset := offset - limit
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		page["previous"] = pageURL(prevOffset)
+	}
+	s.sendCachable(w, r, page)
+}
+
+// sendCachable responds with an ETag, and with 304 when the client already has the same response
+func (s *Server) sendCachable(w http.ResponseWriter, r *http.Request, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		sendAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	hash := sha1.Sum(body)
+	etag := `"` + hex.EncodeToString(hash[:]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func baseURL(r *http.Request) string {
+	return "http://" + r.Host
+}
+
+func sendJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Errorf(" >>> fake spotify: failed to send response: %s", err.Error())
+	}
+}
+
+func sendAPIError(w http.ResponseWriter, status int, message string) {
+	sendJSON(w, status, models.SpAPIError{Error: models.SpError{Status: status, Message: message}})
+}
+
+func sendLoginError(w http.ResponseWriter, errType string, description string) {
+	sendJSON(w, http.StatusBadRequest, models.SpLoginError{Error: errType, ErrorDescription: description})
+}
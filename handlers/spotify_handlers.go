@@ -3,82 +3,631 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/2beens/spotilizer/config"
 	"github.com/2beens/spotilizer/models"
 	"github.com/2beens/spotilizer/services"
 	"github.com/2beens/spotilizer/util"
 )
 
 func SaveCurrentTracksHandler(w http.ResponseWriter, r *http.Request) {
-	user, err := services.Users.GetUserByRequestCookieID(r)
-	if err != nil {
-		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+	user, authorized := authorizedUser(w, r, services.FeatureSaveTracks)
+	if !authorized {
 		return
 	}
 
 	log.Debugf(" > save fav tracks: username [%s]", user.Username)
 
-	tracks, apiErr := services.UserPlaylist.DownloadSavedFavTracks(user.Auth.AccessToken)
+	snapshot, apiErr := services.TakeFavTracksSnapshot(services.UserPlaylist, user)
 	if apiErr != nil {
 		log.Infof(" >>> error while saving current user tracks: %v", apiErr)
 		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
 		return
 	}
+	util.SendAPIOKResp(w, fmt.Sprintf("%d favorite tracks saved successfully", len(snapshot.Tracks)))
+}
 
-	log.Tracef(" > tracks count: %d", len(tracks))
+func SaveFollowedArtistsHandler(w http.ResponseWriter, r *http.Request) {
+	saveLibrarySnapshot(w, r, services.FeatureSaveFollowedArtists, "followed artists", func(user *models.User) (int, *models.SpAPIError, bool) {
+		artists, apiErr := services.UserPlaylist.DownloadFollowedArtists(user.AccessToken())
+		if apiErr != nil {
+			return 0, apiErr, false
+		}
+		snapshot := &models.FollowedArtistsSnapshot{Username: user.Username, Timestamp: time.Now(), Artists: artists}
+		return len(artists), nil, services.UserPlaylist.SaveFollowedArtistsSnapshot(snapshot)
+	})
+}
 
-	// save tracks to DB
-	tracksSnapshot := &models.FavTracksSnapshot{Username: user.Username, Timestamp: time.Now(), Tracks: tracks}
-	saved := services.UserPlaylist.SaveFavTracksSnapshot(tracksSnapshot)
-	if saved {
-		util.SendAPIOKResp(w, fmt.Sprintf("%d favorite tracks saved successfully", len(tracks)))
-	} else {
-		util.SendAPIErrorResp(w, "Favorite tracks not saved. Server internal error.", http.StatusInternalServerError)
+func SaveSavedAlbumsHandler(w http.ResponseWriter, r *http.Request) {
+	saveLibrarySnapshot(w, r, services.FeatureSaveAlbums, "saved albums", func(user *models.User) (int, *models.SpAPIError, bool) {
+		albums, apiErr := services.UserPlaylist.DownloadSavedAlbums(user.AccessToken())
+		if apiErr != nil {
+			return 0, apiErr, false
+		}
+		snapshot := &models.SavedAlbumsSnapshot{Username: user.Username, Timestamp: time.Now(), Albums: albums}
+		return len(albums), nil, services.UserPlaylist.SaveSavedAlbumsSnapshot(snapshot)
+	})
+}
+
+func SaveSavedShowsHandler(w http.ResponseWriter, r *http.Request) {
+	saveLibrarySnapshot(w, r, services.FeatureSaveShows, "saved shows", func(user *models.User) (int, *models.SpAPIError, bool) {
+		shows, apiErr := services.UserPlaylist.DownloadSavedShows(user.AccessToken())
+		if apiErr != nil {
+			return 0, apiErr, false
+		}
+		snapshot := &models.SavedShowsSnapshot{Username: user.Username, Timestamp: time.Now(), Shows: shows}
+		return len(shows), nil, services.UserPlaylist.SaveSavedShowsSnapshot(snapshot)
+	})
+}
+
+func SaveSavedEpisodesHandler(w http.ResponseWriter, r *http.Request) {
+	saveLibrarySnapshot(w, r, services.FeatureSaveEpisodes, "saved episodes", func(user *models.User) (int, *models.SpAPIError, bool) {
+		episodes, apiErr := services.UserPlaylist.DownloadSavedEpisodes(user.AccessToken())
+		if apiErr != nil {
+			return 0, apiErr, false
+		}
+		snapshot := &models.SavedEpisodesSnapshot{Username: user.Username, Timestamp: time.Now(), Episodes: episodes}
+		return len(episodes), nil, services.UserPlaylist.SaveSavedEpisodesSnapshot(snapshot)
+	})
+}
+
+// SaveTopItemsHandler saves user's top tracks and artists, for all time ranges
+func SaveTopItemsHandler(w http.ResponseWriter, r *http.Request) {
+	saveLibrarySnapshot(w, r, services.FeatureSaveTopItems, "top tracks and artists", func(user *models.User) (int, *models.SpAPIError, bool) {
+		topItems, apiErr := services.UserPlaylist.DownloadTopItems(user.AccessToken())
+		if apiErr != nil {
+			return 0, apiErr, false
+		}
+		count := 0
+		for _, timeRange := range models.TopTimeRanges {
+			count += len(topItems.Tracks[timeRange]) + len(topItems.Artists[timeRange])
+		}
+		snapshot := &models.TopItemsSnapshot{Username: user.Username, Timestamp: time.Now(), TopItems: topItems}
+		return count, nil, services.UserPlaylist.SaveTopItemsSnapshot(snapshot)
+	})
+}
+
+// EnablePlayHistoryHandler starts collecting user's recently played tracks into play history
+func EnablePlayHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	user, authorized := authorizedUser(w, r, services.FeaturePlayHistory)
+	if !authorized {
+		return
 	}
+
+	log.Debugf(" > enable play history: username [%s]", user.Username)
+
+	added, apiErr := services.PlayHistory.Enable(user)
+	if apiErr != nil {
+		log.Infof(" >>> error while enabling play history: %v", apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+
+	util.SendAPIOKResp(w, fmt.Sprintf("Play history enabled, %d plays collected", added))
 }
 
-func SaveCurrentPlaylistsHandler(w http.ResponseWriter, r *http.Request) {
+// DisablePlayHistoryHandler stops collecting user's play history, collected plays are kept
+func DisablePlayHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := services.Users.GetUserByRequestCookieID(r)
 	if err != nil {
 		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
 		return
 	}
 
-	log.Debugf(" > save playlists: username: %s", user.Username)
+	log.Debugf(" > disable play history: username [%s]", user.Username)
+	if err := services.PlayHistory.Disable(user.Username); err != nil {
+		log.Errorf(" >>> error while disabling play history: %s", err.Error())
+		util.SendAPIErrorResp(w, "Play history not disabled. Server internal error.", http.StatusInternalServerError)
+		return
+	}
+
+	util.SendAPIOKResp(w, "Play history disabled")
+}
+
+// ScheduleSnapshotsHandler schedules automatic snapshots of user's favorite tracks and/or playlists. Query params:
+// frequency (hourly, daily, weekly or cron), cron (the cron expression, with frequency=cron) and snapshots (comma
+// separated fav_tracks and playlists, both by default).
+func ScheduleSnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	user, authorized := authorizedUser(w, r, "")
+	if !authorized {
+		return
+	}
 
-	playlists, apiErr := services.UserPlaylist.DownloadCurrentUserPlaylists(user.Auth.AccessToken)
+	log.Debugf(" > schedule snapshots: username [%s]", user.Username)
+
+	snapshots := []string{models.ScheduledFavTracks, models.ScheduledPlaylists}
+	if param := r.URL.Query().Get("snapshots"); len(param) > 0 {
+		snapshots = strings.Split(param, ",")
+	}
+	for _, kind := range snapshots {
+		if feature, found := services.ScheduledSnapshotFeatures[kind]; found && !scopesGranted(w, user, feature) {
+			return
+		}
+	}
+
+	frequency := r.URL.Query().Get("frequency")
+	schedule, apiErr := services.SnapshotScheduler.Schedule(user.Username, frequency, r.URL.Query().Get("cron"), snapshots)
 	if apiErr != nil {
-		log.Infof(" >>> error while saving current user playlists: %v", apiErr)
+		log.Infof(" >>> error while scheduling snapshots: %v", apiErr)
 		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
 		return
 	}
 
-	log.Tracef(" > playlists count: %d", len(playlists))
+	message := fmt.Sprintf("Snapshots scheduled %s, next run at %s", frequency, schedule.NextRun.Format(time.RFC822))
+	if frequency == models.ScheduleCron {
+		message = fmt.Sprintf("Snapshots scheduled [%s], next run at %s", schedule.Cron, schedule.NextRun.Format(time.RFC822))
+	}
+	util.SendAPIOKRespWithData(w, message, schedule)
+}
+
+// UnscheduleSnapshotsHandler stops user's automatic snapshots, the snapshots already taken are kept
+func UnscheduleSnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := services.Users.GetUserByRequestCookieID(r)
+	if err != nil {
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return
+	}
 
-	snapshotPlaylists := []models.PlaylistSnapshot{}
-	for _, pl := range playlists {
-		playlistTracks, apiErr := services.UserPlaylist.DownloadPlaylistTracks(user.Auth.AccessToken, pl.Tracks.Href, pl.Tracks.Total)
+	log.Debugf(" > unschedule snapshots: username [%s]", user.Username)
+	if apiErr := services.SnapshotScheduler.Unschedule(user.Username); apiErr != nil {
+		log.Infof(" >>> error while unscheduling snapshots: %v", apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+
+	util.SendAPIOKResp(w, "Scheduled snapshots stopped")
+}
+
+// RestoreFavTracksHandler plans saving the tracks removed from favorite tracks since the snapshot given by timestamp
+// back to user's library. Optional ids query param (comma separated track IDs) restores only the given tracks.
+func RestoreFavTracksHandler(w http.ResponseWriter, r *http.Request) {
+	user, authorized := authorizedUser(w, r, services.FeatureRestoreTracks)
+	if !authorized {
+		return
+	}
+
+	timestamp := mux.Vars(r)["timestamp"]
+	log.Debugf(" > restore fav tracks from snapshot [%s]: username [%s]", timestamp, user.Username)
+
+	snapshot, err := services.UserPlaylist.GetFavTracksSnapshotByTimestamp(user.Username, timestamp)
+	if err != nil {
+		log.Errorf(" >>> error while trying to get fav. tracks snapshot: %s", err.Error())
+		util.SendAPIErrorResp(w, "Error occurred: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if snapshot == nil {
+		util.SendAPIErrorResp(w, "Favorite tracks snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	extendWriteDeadline(w)
+	currentTracks, apiErr := services.UserPlaylist.DownloadSavedFavTracks(user.AccessToken())
+	if apiErr != nil {
+		log.Infof(" >>> error while getting current user tracks: %v", apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+
+	ids := requestedIDs(r)
+	requested := make(map[string]bool)
+	for _, id := range ids {
+		requested[id] = true
+	}
+
+	var notRemoved []models.PlanTrack
+	var removedTracks []models.SpTrack
+	for _, t := range snapshot.Tracks {
+		if len(ids) > 0 && !requested[t.Track.ID] {
+			continue
+		}
+		delete(requested, t.Track.ID)
+		if models.ContainsAddedTrack(t, currentTracks) {
+			if len(ids) > 0 {
+				notRemoved = append(notRemoved, models.PlanTrack{URI: t.Track.URI, Name: t.Track.Name, Reason: models.SkipReasonNotRemoved})
+			}
+			continue
+		}
+		removedTracks = append(removedTracks, t.Track)
+	}
+	// requested tracks which are not in the snapshot at all
+	for _, id := range ids {
+		if !requested[id] {
+			continue
+		}
+		delete(requested, id)
+		notRemoved = append(notRemoved, models.PlanTrack{URI: "spotify:track:" + id, Reason: models.SkipReasonNotRemoved})
+	}
+
+	// tracks availability is checked in user's country
+	market := ""
+	if spUser, err := services.Users.GetUserFromSpotify(user.AccessToken()); err != nil {
+		log.Warnf(" >>> error while getting user's country, restoring tracks for any market: %s", err.Error())
+	} else {
+		market = spUser.Country
+	}
+
+	plan, apiErr := services.Library.PlanRestoreFavTracks(user.AccessToken(), market, removedTracks)
+	if apiErr != nil {
+		log.Infof(" >>> error while planning fav. tracks restore: %v", apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+	plan.Name = "Favorite tracks from " + snapshot.Timestamp.Format(time.RFC822)
+	plan.SkippedTracks = append(notRemoved, plan.SkippedTracks...)
+
+	restoredCount := len(removedTracks)
+	for _, t := range plan.SkippedTracks {
+		if t.Reason != models.SkipReasonNotRemoved {
+			restoredCount--
+		}
+	}
+	log.Tracef(" > fav tracks to restore [%d], skipped [%d]", restoredCount, len(plan.SkippedTracks))
+	createWriteBackPlan(w, user, plan, fmt.Sprintf("%d of %d removed tracks to restore", restoredCount, len(removedTracks)))
+}
+
+// RecreatePlaylistHandler plans creating a new playlist, with the name, description and tracks of the playlist snapshot
+// given by timestamp and playlist ID
+func RecreatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	restorePlaylist(w, r, func(user *models.User, snapshot models.PlaylistSnapshot) (*models.WriteBackPlan, *models.SpAPIError) {
+		return services.Library.PlanPlaylistRecreate(snapshot), nil
+	})
+}
+
+// RollbackPlaylistHandler plans changing the playlist back to the tracks and their order in the playlist snapshot given
+// by timestamp and playlist ID
+func RollbackPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	restorePlaylist(w, r, func(user *models.User, snapshot models.PlaylistSnapshot) (*models.WriteBackPlan, *models.SpAPIError) {
+		return services.Library.PlanPlaylistRollback(user.AccessToken(), snapshot)
+	})
+}
+
+// restorePlaylist finds the playlist of the restore in the snapshot, and stores the plan made by plan
+func restorePlaylist(w http.ResponseWriter, r *http.Request, plan func(user *models.User, snapshot models.PlaylistSnapshot) (*models.WriteBackPlan, *models.SpAPIError)) {
+	user, authorized := authorizedUser(w, r, services.FeatureRestorePlaylists)
+	if !authorized {
+		return
+	}
+
+	timestamp := mux.Vars(r)["timestamp"]
+	playlistID := mux.Vars(r)["id"]
+	log.Debugf(" > restore playlist [%s] from snapshot [%s]: username [%s]", playlistID, timestamp, user.Username)
+
+	snapshot, err := services.UserPlaylist.GetPlaylistsSnapshotByTimestamp(user.Username, timestamp)
+	if err != nil {
+		log.Errorf(" >>> error while trying to get playlists snapshot: %s", err.Error())
+		util.SendAPIErrorResp(w, "Error occurred: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if snapshot == nil {
+		util.SendAPIErrorResp(w, "Playlists snapshot not found", http.StatusNotFound)
+		return
+	}
+	var playlistSnapshot *models.PlaylistSnapshot
+	for i := range snapshot.Playlists {
+		if snapshot.Playlists[i].Playlist.ID == playlistID {
+			playlistSnapshot = &snapshot.Playlists[i]
+			break
+		}
+	}
+	if playlistSnapshot == nil {
+		util.SendAPIErrorResp(w, "Playlist not found in the snapshot", http.StatusNotFound)
+		return
+	}
+	// tracks of the playlist were not saved, restoring it would empty the playlist
+	if playlistSnapshot.DownloadFailed {
+		util.SendAPIErrorResp(w, "Playlist tracks are missing in the snapshot", http.StatusConflict)
+		return
+	}
+
+	playlistPlan, apiErr := plan(user, *playlistSnapshot)
+	if apiErr != nil {
+		log.Infof(" >>> error while planning playlist restore: %v", apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+	createWriteBackPlan(w, user, playlistPlan, fmt.Sprintf("%d playlist operations planned", len(playlistPlan.Operations)))
+}
+
+// FindDuplicatesHandler finds duplicate tracks inside user's current playlists, and across them. Optional ids query
+// param (comma separated playlist IDs) looks only into the given playlists.
+func FindDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	user, authorized := authorizedUser(w, r, services.FeatureSavePlaylists)
+	if !authorized {
+		return
+	}
+
+	log.Debugf(" > find playlist duplicates: username [%s]", user.Username)
+
+	extendWriteDeadline(w)
+	playlists, apiErr := services.Library.DownloadPlaylists(user.AccessToken(), requestedIDs(r))
+	if apiErr != nil {
+		log.Infof(" >>> error while downloading playlists: %v", apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+	duplicates := services.FindPlaylistDuplicates(playlists)
+	util.SendAPIOKRespWithData(w, fmt.Sprintf("%d duplicates within playlists, %d across playlists", len(duplicates.Within), len(duplicates.Across)), duplicates)
+}
+
+// DedupPlaylistHandler plans removing copies of duplicated tracks from the playlist given by ID, keeping the first copy
+// of each track
+func DedupPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	editPlaylists(w, r, "dedup_playlist", func(user *models.User) (*models.WriteBackPlan, string, *models.SpAPIError) {
+		plan, apiErr := services.Library.PlanPlaylistDedup(user.AccessToken(), mux.Vars(r)["id"])
+		if apiErr != nil {
+			return nil, "", apiErr
+		}
+		removed := 0
+		for _, op := range plan.Operations {
+			removed += len(op.Tracks)
+		}
+		return plan, fmt.Sprintf("%d duplicate tracks to remove", removed), nil
+	})
+}
+
+// MergePlaylistsHandler plans creating a new playlist with the tracks of the playlists given by ids query param (comma
+// separated playlist IDs), in order. Copies of duplicated tracks are left out, unless keep_duplicates=true. Current
+// playlists are merged, or the ones from the playlists snapshot given by optional timestamp query param. Optional name
+// query param names the new playlist.
+func MergePlaylistsHandler(w http.ResponseWriter, r *http.Request) {
+	editPlaylists(w, r, "merge_playlists", func(user *models.User) (*models.WriteBackPlan, string, *models.SpAPIError) {
+		ids := requestedIDs(r)
+		if len(ids) < 2 {
+			return nil, "", &models.SpAPIError{Error: models.SpError{Status: http.StatusBadRequest, Message: "At least two playlists needed to merge"}}
+		}
+
+		var playlists []models.PlaylistSnapshot
+		if timestamp := r.URL.Query().Get("timestamp"); len(timestamp) > 0 {
+			snapshot, err := services.UserPlaylist.GetPlaylistsSnapshotByTimestamp(user.Username, timestamp)
+			if err != nil || snapshot == nil {
+				return nil, "", &models.SpAPIError{Error: models.SpError{Status: http.StatusNotFound, Message: "Playlists snapshot not found"}}
+			}
+			if playlists, err = snapshot.PlaylistsByIDs(ids); err != nil {
+				return nil, "", &models.SpAPIError{Error: models.SpError{Status: http.StatusNotFound, Message: "Error occurred: " + err.Error()}}
+			}
+		} else {
+			var apiErr *models.SpAPIError
+			extendWriteDeadline(w)
+			if playlists, apiErr = services.Library.DownloadPlaylists(user.AccessToken(), ids); apiErr != nil {
+				return nil, "", apiErr
+			}
+		}
+
+		name := r.URL.Query().Get("name")
+		if len(name) == 0 {
+			var names []string
+			for _, pl := range playlists {
+				names = append(names, pl.Playlist.Name)
+			}
+			name = strings.Join(names, " + ")
+		}
+		plan := services.Library.PlanPlaylistsMerge(name, playlists, r.URL.Query().Get("keep_duplicates") == "true")
+		merged := 0
+		for _, op := range plan.Operations {
+			merged += len(op.Tracks)
+		}
+		return plan, fmt.Sprintf("%d tracks of %d playlists to merge", merged, len(playlists)), nil
+	})
+}
+
+// CreateQueryPlaylistHandler plans creating a new playlist with the tracks selected from the snapshots history by the
+// query given in request params, see services.ParseSnapshotQuery. Optional name query param names the new playlist.
+func CreateQueryPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	editPlaylists(w, r, "create_query_playlist", func(user *models.User) (*models.WriteBackPlan, string, *models.SpAPIError) {
+		query, err := services.ParseSnapshotQuery(r.URL.Query(), time.Now())
+		if err != nil {
+			return nil, "", &models.SpAPIError{Error: models.SpError{Status: http.StatusBadRequest, Message: "Invalid query: " + err.Error()}}
+		}
+		name := r.URL.Query().Get("name")
+		if len(name) == 0 {
+			name = "Snapshots query " + time.Now().Format("2006-01-02")
+		}
+		plan, apiErr := services.SnapshotQuery.PlanPlaylist(user.Username, query, name)
 		if apiErr != nil {
-			log.Warnf(" >>> error while saving current user playlists: %v", apiErr)
-			playlistTracks = []models.SpPlaylistTrack{}
+			return nil, "", apiErr
+		}
+		added := 0
+		for _, op := range plan.Operations {
+			added += len(op.Tracks)
 		}
-		log.Tracef(" > received [%d] tracks for playlist [%s]", len(playlistTracks), pl.Name)
-		plSnapshot := models.PlaylistSnapshot{
-			Playlist: pl,
-			Tracks:   playlistTracks,
+		return plan, fmt.Sprintf("%d tracks to add to the new playlist", added), nil
+	})
+}
+
+// editPlaylists stores the plan of the playlist edit made by plan, along with its message. All edits need the same
+// scopes, but each is resumed on its own after the consent, so action names the edit.
+func editPlaylists(w http.ResponseWriter, r *http.Request, action string, plan func(user *models.User) (*models.WriteBackPlan, string, *models.SpAPIError)) {
+	user, authorized := authorizedUser(w, r, "")
+	if !authorized || !actionScopesGranted(w, user, services.FeatureEditPlaylists, action) {
+		return
+	}
+
+	log.Debugf(" > %s: username [%s]", action, user.Username)
+
+	editPlan, message, apiErr := plan(user)
+	if apiErr != nil {
+		log.Infof(" >>> error while planning %s: %v", action, apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+	createWriteBackPlan(w, user, editPlan, message)
+}
+
+// authorizedUser returns the logged in user, if their Spotify authorization is still valid, and the scopes needed
+// for the feature are granted (none are needed for empty feature). Otherwise it responds with the error, and returns
+// false.
+func authorizedUser(w http.ResponseWriter, r *http.Request, feature string) (*models.User, bool) {
+	user, err := services.Users.GetUserByRequestCookieID(r)
+	if err != nil {
+		util.SendAPIErrorResp(w, "Not available when logged off", http.StatusForbidden)
+		return nil, false
+	}
+	if user.ReloginRequired() {
+		util.SendAPIErrorResp(w, "Spotify authorization revoked, please login again", http.StatusUnauthorized)
+		return nil, false
+	}
+	if !scopesGranted(w, user, feature) {
+		return nil, false
+	}
+	return user, true
+}
+
+// extendWriteDeadline gives long requests (downloading all user's playlists or liked tracks, executing write-back
+// plans) long_request_write_timeout to respond, instead of the server write timeout, which a user with a big library
+// would easily exceed
+func extendWriteDeadline(w http.ResponseWriter) {
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(config.Conf.LongRequestWriteTimeout)); err != nil {
+		log.Warnf(" >>> cannot extend response write deadline: %s", err.Error())
+	}
+}
+
+// requestedIDs are the IDs given by ids query param, comma separated
+func requestedIDs(r *http.Request) []string {
+	ids := r.URL.Query().Get("ids")
+	if len(ids) == 0 {
+		return nil
+	}
+	return strings.Split(ids, ",")
+}
+
+// writeBackFeatures are the features of write-back plan kinds, plans are executed only with the feature scopes granted
+var writeBackFeatures = map[string]string{
+	models.WriteBackRestoreFavTracks: services.FeatureRestoreTracks,
+	models.WriteBackRecreatePlaylist: services.FeatureRestorePlaylists,
+	models.WriteBackRollbackPlaylist: services.FeatureRestorePlaylists,
+	models.WriteBackDedupPlaylist:    services.FeatureEditPlaylists,
+	models.WriteBackMergePlaylists:   services.FeatureEditPlaylists,
+	models.WriteBackQueryPlaylist:    services.FeatureEditPlaylists,
+}
+
+// createWriteBackPlan stores the plan, and responds with it, for the user to review and confirm it. Plans change
+// nothing until they are confirmed, see ExecutePlanHandler.
+func createWriteBackPlan(w http.ResponseWriter, user *models.User, plan *models.WriteBackPlan, message string) {
+	if err := services.WriteBack.CreatePlan(user.Username, plan); err != nil {
+		log.Errorf(" >>> error while creating write-back plan: %s", err.Error())
+		util.SendAPIErrorResp(w, "Error occurred: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	util.SendAPIOKRespWithData(w, fmt.Sprintf("%s, confirm plan %s to execute it", message, plan.ID), plan)
+}
+
+// ExecutePlanHandler executes the write-back plan given by ID, or resumes it, if it was partially executed before
+func ExecutePlanHandler(w http.ResponseWriter, r *http.Request) {
+	runWriteBackPlan(w, r, false)
+}
+
+// UndoPlanHandler reverts the executed operations of the write-back plan given by ID
+func UndoPlanHandler(w http.ResponseWriter, r *http.Request) {
+	runWriteBackPlan(w, r, true)
+}
+
+func runWriteBackPlan(w http.ResponseWriter, r *http.Request, undo bool) {
+	user, authorized := authorizedUser(w, r, "")
+	if !authorized {
+		return
+	}
+
+	planID := mux.Vars(r)["id"]
+	log.Debugf(" > run write-back plan [%s], undo [%t]: username [%s]", planID, undo, user.Username)
+	plan := services.WriteBack.GetPlan(user.Username, planID)
+	if plan == nil {
+		util.SendAPIErrorResp(w, "Plan not found", http.StatusNotFound)
+		return
+	}
+	if !scopesGranted(w, user, writeBackFeatures[plan.Kind]) {
+		return
+	}
+
+	run := services.WriteBack.Execute
+	if undo {
+		run = services.WriteBack.Undo
+	}
+	extendWriteDeadline(w)
+	plan, apiErr := run(user.AccessToken(), user.Username, planID)
+	if apiErr != nil {
+		errMsg := apiErr.Error.Message
+		if plan != nil {
+			errMsg = fmt.Sprintf("Plan %s: %s", plan.Status, apiErr.Error.Message)
 		}
-		snapshotPlaylists = append(snapshotPlaylists, plSnapshot)
+		util.SendAPIErrorResp(w, errMsg, apiErr.Error.Status)
+		return
 	}
 
-	// save playlists to DB
-	playlistsSnapshot := &models.PlaylistsSnapshot{Username: user.Username, Timestamp: time.Now(), Playlists: snapshotPlaylists}
-	saved := services.UserPlaylist.SavePlaylistsSnapshot(playlistsSnapshot)
+	execution := plan.Executions[len(plan.Executions)-1]
+	util.SendAPIOKRespWithData(w, fmt.Sprintf("Plan %s: %d operations run", plan.Status, len(execution.Results)), plan)
+}
+
+// saveLibrarySnapshot calls snapshot to download and save the library items of the feature. Snapshot returns the count
+// of saved items.
+func saveLibrarySnapshot(w http.ResponseWriter, r *http.Request, feature string, what string, snapshot func(user *models.User) (count int, apiErr *models.SpAPIError, saved bool)) {
+	user, authorized := authorizedUser(w, r, feature)
+	if !authorized {
+		return
+	}
+
+	log.Debugf(" > save %s: username [%s]", what, user.Username)
+
+	count, apiErr, saved := snapshot(user)
+	if apiErr != nil {
+		log.Infof(" >>> error while saving %s: %v", what, apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+
+	log.Tracef(" > %s count: %d", what, count)
 	if saved {
-		util.SendAPIOKResp(w, fmt.Sprintf("%d playlists saved successfully", len(playlists)))
+		util.SendAPIOKResp(w, fmt.Sprintf("%d %s saved successfully", count, what))
 	} else {
-		util.SendAPIErrorResp(w, "Playlists not saved. Server internal error.", http.StatusInternalServerError)
+		util.SendAPIErrorResp(w, fmt.Sprintf("%s not saved. Server internal error.", strings.Title(what)), http.StatusInternalServerError)
+	}
+}
+
+func SaveCurrentPlaylistsHandler(w http.ResponseWriter, r *http.Request) {
+	user, authorized := authorizedUser(w, r, services.FeatureSavePlaylists)
+	if !authorized {
+		return
+	}
+
+	log.Debugf(" > save playlists: username: %s", user.Username)
+
+	extendWriteDeadline(w)
+	result, apiErr := services.TakePlaylistsSnapshot(services.UserPlaylist, user)
+	if apiErr != nil {
+		log.Infof(" >>> error while saving current user playlists: %v", apiErr)
+		util.SendAPIErrorResp(w, apiErr.Error.Message, apiErr.Error.Status)
+		return
+	}
+
+	failedPlaylists := []models.DTOPlaylistError{}
+	for _, failed := range result.Failed {
+		failedPlaylists = append(failedPlaylists, models.DTOPlaylistError{
+			ID:      failed.Playlist.ID,
+			Name:    failed.Playlist.Name,
+			Status:  failed.Err.Error.Status,
+			Message: failed.Err.Error.Message,
+		})
+	}
+
+	playlistsCount := len(result.Snapshot.Playlists)
+	reusedCount := result.ReusedCount
+	fetchedCount := playlistsCount - reusedCount
+	message := fmt.Sprintf("%d playlists saved successfully (%d unchanged, %d downloaded)", playlistsCount, reusedCount, fetchedCount)
+	if len(failedPlaylists) > 0 {
+		message = fmt.Sprintf("%d playlists saved (%d unchanged, %d downloaded), tracks of %d playlists could not be downloaded",
+			playlistsCount, reusedCount, fetchedCount, len(failedPlaylists))
 	}
+	util.SendAPIOKRespWithData(w, message, struct {
+		ReusedCount     int                       `json:"reusedCount"`
+		FetchedCount    int                       `json:"fetchedCount"`
+		FailedPlaylists []models.DTOPlaylistError `json:"failedPlaylists"`
+	}{
+		reusedCount,
+		fetchedCount,
+		failedPlaylists,
+	})
 }
@@ -1,17 +1,14 @@
 package handlers
 
 import (
-	b64 "encoding/base64"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/2beens/spotilizer/config"
 	"github.com/2beens/spotilizer/constants"
 	"github.com/2beens/spotilizer/models"
 	"github.com/2beens/spotilizer/services"
@@ -19,26 +16,49 @@ import (
 )
 
 var clientID string
-var clientSecret string
 
-func SetClientIDAndSecret(cID string, cSecret string) {
+func SetClientID(cID string) {
 	clientID = cID
-	clientSecret = cSecret
 }
 
+// GetSpotifyLoginHandler redirects to Spotify login. Additional scopes can be requested with the "scopes" param
+// (comma separated), while "return_to" param sets the local path the user returns to after login.
 func GetSpotifyLoginHandler(serverURL string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		scopes, err := loginScopes(r)
+		if err != nil {
+			log.Debugf(" > login failed: %s", err.Error())
+			util.RenderErrorView(w, "", "Login Failed", http.StatusBadRequest, err.Error())
+			return
+		}
+
 		state := util.GenerateRandomString(16)
 		util.AddCookie(&w, constants.CookieStateKey, state)
 
+		if returnTo := r.URL.Query().Get("return_to"); isLocalPath(returnTo) {
+			util.AddCookie(&w, constants.CookieReturnToKey, returnTo)
+		} else {
+			util.ClearCookie(&w, constants.CookieReturnToKey)
+		}
+
 		q := url.Values{}
 		q.Add("response_type", "code")
 		q.Add("client_id", clientID)
-		q.Add("scope", constants.Permissions)
+		q.Add("scope", strings.Join(scopes, " "))
 		q.Add("redirect_uri", fmt.Sprintf("%s/callback", serverURL))
 		q.Add("state", state)
+		if services.Auth.PKCEEnabled() {
+			codeChallenge, err := services.Auth.NewPKCEChallenge(state)
+			if err != nil {
+				log.Errorf(" >>> login failed, cannot generate PKCE code challenge: %s", err.Error())
+				util.RenderErrorView(w, "", "Login Failed", http.StatusInternalServerError, "Internal server error during login. Try again later.")
+				return
+			}
+			q.Add("code_challenge_method", "S256")
+			q.Add("code_challenge", codeChallenge)
+		}
 
-		redirectURL := "https://accounts.spotify.com/authorize?" + q.Encode()
+		redirectURL := config.Conf.SpotifyAccountsURL + config.Conf.URLAuthorize + "?" + q.Encode()
 		log.Trace(" > /login, redirect to: " + redirectURL)
 		http.Redirect(w, r, redirectURL, http.StatusFound)
 	}
@@ -57,19 +77,19 @@ func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 		util.SendAPIErrorResp(w, "Cannot find user by cookie, refresh token failed", 400)
 		return
 	}
-	log.Traceln(" > refresh token, value: " + user.Auth.RefreshToken)
+	log.Traceln(" > refresh token, value: " + user.CurrentAuth().RefreshToken)
 
-	data := url.Values{}
-	data.Set("refresh_token", user.Auth.RefreshToken)
-	data.Set("grant_type", "refresh_token")
-	newAuthOptions, authErr := getAccessToken(data)
+	authErr := services.Auth.RefreshUserToken(user)
+	if authErr == services.ErrReloginRequired {
+		log.Debugf(" > refresh token failed for user [%s]: relogin required", user.Username)
+		util.SendAPIErrorResp(w, "Spotify authorization revoked, please login again", http.StatusUnauthorized)
+		return
+	}
 	if authErr != nil {
+		log.Debugf(" > refresh token failed for user [%s]: %s", user.Username, authErr.Error())
 		util.SendAPIErrorResp(w, "Internal server error during refresh token. Try again later.", http.StatusInternalServerError)
 		return
 	}
-	user.Auth = newAuthOptions
-
-	services.Users.Save(user)
 
 	log.Tracef(" > refresh token success for user [%s]", user.Username)
 	util.SendAPIOKResp(w, "success")
@@ -112,7 +132,17 @@ func GetSpotifyCallbackHandler(serverURL string) func(w http.ResponseWriter, r *
 		data.Set("code", code[0])
 		data.Set("redirect_uri", fmt.Sprintf("%s/callback", serverURL))
 		data.Set("grant_type", "authorization_code")
-		authOptions, err := getAccessToken(data)
+		if services.Auth.PKCEEnabled() {
+			codeVerifier, found := services.Auth.TakePKCEVerifier(state[0])
+			if !found {
+				log.Debugf(" > login failed, error: PKCE code verifier not found for state [%s]", state[0])
+				util.RenderView(w, "error", models.ErrorViewData{Title: "Spotify Login",
+					Error: "Login to Spotify failed: login session expired, please try again"})
+				return
+			}
+			data.Set("code_verifier", codeVerifier)
+		}
+		authOptions, err := services.Auth.RequestAccessToken(data)
 		if err != nil {
 			log.Warn(" >>> login failed, getAccessToken error: " + err.Error())
 			util.RenderErrorView(w, "", "Login Failed", http.StatusInternalServerError, "Internal server error during login. Try again later.")
@@ -154,54 +184,81 @@ func GetSpotifyCallbackHandler(serverURL string) func(w http.ResponseWriter, r *
 				log.Debug(" > using previous cookie ID: " + cID)
 			}
 			cookieID = cID
-			user.Auth = authOptions
-			services.Users.Save(user)
+			services.Auth.ReplaceUserAuth(user, authOptions)
 		}
 
 		util.AddCookie(&w, constants.CookieUserIDKey, cookieID)
 
+		if returnTo, err := r.Cookie(constants.CookieReturnToKey); err == nil && isLocalPath(returnTo.Value) {
+			util.ClearCookie(&w, constants.CookieReturnToKey)
+			log.Tracef(" > login done, returning user [%s] to [%s]", user.Username, returnTo.Value)
+			http.Redirect(w, r, returnTo.Value, http.StatusFound)
+			return
+		}
+
 		GetIndexHandler(user.Username)(w, r)
 	}
 }
 
-func getAccessToken(data url.Values) (auth *models.SpotifyAuthOptions, err error) {
-	body, err := postReq(data, "https://accounts.spotify.com", "/api/token/")
-	if err != nil {
-		return nil, err
+// loginScopes returns the scopes to request at login: the default ones, the ones already granted by the user
+// (otherwise they would be dropped), and the additional ones requested
+func loginScopes(r *http.Request) ([]string, error) {
+	scopes := append([]string{}, config.Conf.Scopes...)
+	if user, err := services.Users.GetUserByRequestCookieID(r); err == nil && user.CurrentAuth() != nil {
+		scopes = append(scopes, user.CurrentAuth().GrantedScopes()...)
 	}
 
-	spLoginError := &models.SpLoginError{}
-	err = json.Unmarshal(body, &spLoginError)
-	if err != nil || (len(spLoginError.Error) > 0 && len(spLoginError.ErrorDescription) > 0) {
-		log.Warn(string(body))
-		return nil, fmt.Errorf("spotify login error, type [%s], details: %s", spLoginError.Error, spLoginError.ErrorDescription)
+	if requested := r.URL.Query().Get("scopes"); len(requested) > 0 {
+		for _, scope := range strings.Split(requested, ",") {
+			if !services.IsKnownScope(scope) {
+				return nil, fmt.Errorf("unknown scope requested: [%s]", scope)
+			}
+			scopes = append(scopes, scope)
+		}
 	}
 
-	auth = &models.SpotifyAuthOptions{}
-	err = json.Unmarshal(body, &auth)
-	if err != nil {
-		log.Warn(" >>> error while unmarshaling auth options: " + err.Error())
-		return nil, err
+	uniqueScopes := []string{}
+	added := make(map[string]bool)
+	for _, scope := range scopes {
+		if !added[scope] {
+			added[scope] = true
+			uniqueScopes = append(uniqueScopes, scope)
+		}
 	}
-	return
+	return uniqueScopes, nil
 }
 
-func postReq(data url.Values, uri string, path string) ([]byte, error) {
-	u, _ := url.ParseRequestURI(uri)
-	u.Path = path
+// consentURL is the login URL asking the user to grant additional scopes, and to return to returnTo afterwards
+func consentURL(scopes []string, returnTo string) string {
+	q := url.Values{}
+	q.Set("scopes", strings.Join(scopes, ","))
+	q.Set("return_to", returnTo)
+	return "/login?" + q.Encode()
+}
 
-	client := &http.Client{}
-	r, _ := http.NewRequest("POST", u.String(), strings.NewReader(data.Encode())) // URL-encoded payload
-	authEncoding := b64.StdEncoding.EncodeToString([]byte(clientID + ":" + clientSecret))
-	r.Header.Add("Authorization", "Basic "+authEncoding)
-	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	r.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
+// scopesGranted checks the user granted all the scopes the feature needs. If not, the response tells the
+// client where to send the user for the incremental consent, after which the feature is resumed.
+func scopesGranted(w http.ResponseWriter, user *models.User, feature string) bool {
+	return actionScopesGranted(w, user, feature, feature)
+}
 
-	resp, err := client.Do(r)
-	if err != nil {
-		return nil, err
+// actionScopesGranted is scopesGranted for one of the actions sharing the feature, which is resumed after the consent
+// instead of the feature
+func actionScopesGranted(w http.ResponseWriter, user *models.User, feature string, action string) bool {
+	missingScopes := services.MissingFeatureScopes(user, feature)
+	if len(missingScopes) == 0 {
+		return true
 	}
-	defer resp.Body.Close()
+	log.Debugf(" > user [%s] did not grant scopes %v needed for [%s]", user.Username, missingScopes, feature)
+	util.SendAPIResp(w, models.DTOScopesRequired{
+		Error:         models.SpError{Message: "Additional Spotify permissions needed", Status: http.StatusForbidden},
+		MissingScopes: missingScopes,
+		ConsentURL:    consentURL(missingScopes, "/?resume="+action),
+	})
+	return false
+}
 
-	return ioutil.ReadAll(resp.Body)
+// isLocalPath prevents redirects to other sites
+func isLocalPath(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") && !strings.Contains(path, "\\")
 }
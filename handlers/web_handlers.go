@@ -13,10 +13,18 @@ import (
 
 func GetIndexHandler(username string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		util.RenderView(w, "index", models.ViewData{Username: username})
+		util.RenderView(w, "index", models.ViewData{Username: username, ReloginRequired: reloginRequired(username)})
 	}
 }
 
+func reloginRequired(username string) bool {
+	if len(username) == 0 {
+		return false
+	}
+	user, err := services.Users.Get(username)
+	return err == nil && user.ReloginRequired()
+}
+
 func IndexHandler(w http.ResponseWriter, r *http.Request) {
 	username, _ := util.GetUsernameByRequestCookieID(r)
 	GetIndexHandler(username)(w, r)
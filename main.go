@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/2beens/spotilizer/api"
+	"github.com/2beens/spotilizer/config"
 	"github.com/2beens/spotilizer/constants"
 	"github.com/2beens/spotilizer/db"
 	"github.com/2beens/spotilizer/handlers"
@@ -24,7 +25,8 @@ import (
 	_ "net/http/pprof"
 )
 
-var serverURL = fmt.Sprintf("%s://%s:%s", constants.Protocol, constants.IPAddress, constants.Port)
+// set from config at startup, used for Spotify login callbacks
+var serverURL string
 
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -60,19 +62,85 @@ func routerSetup() (r *mux.Router) {
 	r.HandleFunc("/refresh_token", handlers.RefreshTokenHandler)
 	r.HandleFunc("/save_current_playlists", handlers.SaveCurrentPlaylistsHandler)
 	r.HandleFunc("/save_current_tracks", handlers.SaveCurrentTracksHandler)
-
-	apiFavTracksHandler := api.NewFavTracksHandler(services.Users, services.UserPlaylist)
+	r.HandleFunc("/save_followed_artists", handlers.SaveFollowedArtistsHandler)
+	r.HandleFunc("/save_albums", handlers.SaveSavedAlbumsHandler)
+	r.HandleFunc("/save_shows", handlers.SaveSavedShowsHandler)
+	r.HandleFunc("/save_episodes", handlers.SaveSavedEpisodesHandler)
+	r.HandleFunc("/save_top_items", handlers.SaveTopItemsHandler)
+	r.HandleFunc("/restore_fav_tracks/{timestamp}", handlers.RestoreFavTracksHandler)
+	r.HandleFunc("/recreate_playlist/{timestamp}/{id}", handlers.RecreatePlaylistHandler)
+	r.HandleFunc("/rollback_playlist/{timestamp}/{id}", handlers.RollbackPlaylistHandler)
+	r.HandleFunc("/find_duplicates", handlers.FindDuplicatesHandler)
+	r.HandleFunc("/dedup_playlist/{id}", handlers.DedupPlaylistHandler)
+	r.HandleFunc("/merge_playlists", handlers.MergePlaylistsHandler)
+	r.HandleFunc("/create_query_playlist", handlers.CreateQueryPlaylistHandler)
+	r.HandleFunc("/execute_plan/{id}", handlers.ExecutePlanHandler)
+	r.HandleFunc("/undo_plan/{id}", handlers.UndoPlanHandler)
+	r.HandleFunc("/enable_play_history", handlers.EnablePlayHistoryHandler)
+	r.HandleFunc("/disable_play_history", handlers.DisablePlayHistoryHandler)
+	r.HandleFunc("/schedule_snapshots", handlers.ScheduleSnapshotsHandler)
+	r.HandleFunc("/unschedule_snapshots", handlers.UnscheduleSnapshotsHandler)
+
+	apiFavTracksHandler := api.NewFavTracksHandler(services.Users, services.UserPlaylist, services.AudioFeatures, services.Artists)
 	apiPlaylistsHandler := api.NewPlaylistsHandler()
-
+	apiFollowedArtistsHandler := api.NewFollowedArtistsHandler(services.Users, services.UserPlaylist)
+	apiSavedAlbumsHandler := api.NewSavedAlbumsHandler(services.Users, services.UserPlaylist)
+	apiSavedShowsHandler := api.NewSavedShowsHandler(services.Users, services.UserPlaylist)
+	apiSavedEpisodesHandler := api.NewSavedEpisodesHandler(services.Users, services.UserPlaylist)
+	apiAudioFeaturesHandler := api.NewAudioFeaturesHandler(services.Users, services.UserPlaylist, services.AudioFeatures)
+	apiGenresHandler := api.NewGenresHandler(services.Users, services.UserPlaylist, services.Artists)
+	apiTopItemsHandler := api.NewTopItemsHandler(services.Users, services.UserPlaylist)
+	apiPlaylistDuplicatesHandler := api.NewPlaylistDuplicatesHandler(services.Users, services.UserPlaylist)
+	apiSnapshotQueryHandler := api.NewSnapshotQueryHandler(services.Users, services.SnapshotQuery)
+	apiPlayHistoryHandler := api.NewPlayHistoryHandler(services.Users, services.PlayHistory)
+	apiAuthStatusHandler := api.NewAuthStatusHandler(services.Users)
+	apiWriteBackPlansHandler := api.NewWriteBackPlansHandler(services.Users, services.WriteBack)
+	apiSnapshotScheduleHandler := api.NewSnapshotScheduleHandler(services.Users, services.SnapshotScheduler)
+
+	r.Handle("/api/auth", apiAuthStatusHandler)
+	r.Handle("/api/playhistory", apiPlayHistoryHandler)
+	r.Handle("/api/plans", apiWriteBackPlansHandler)
+	r.Handle("/api/plans/{id}", apiWriteBackPlansHandler)
+	r.Handle("/api/query", apiSnapshotQueryHandler)
+	r.Handle("/api/schedule", apiSnapshotScheduleHandler)
+	r.Handle("/api/audiofeatures/favtracks", apiAudioFeaturesHandler)
+	r.Handle("/api/audiofeatures/playlists/{id}", apiAudioFeaturesHandler)
+	r.Handle("/api/genres/favtracks/{timestamp}", apiGenresHandler)
+	r.Handle("/api/genres/playlists/{timestamp}/{id}", apiGenresHandler)
 	r.Handle("/api/ssplaylists", apiPlaylistsHandler)
 	r.Handle("/api/ssplaylists/full", apiPlaylistsHandler)
 	r.Handle("/api/ssplaylists/{timestamp}", apiPlaylistsHandler)
+	r.Handle("/api/ssplaylists/duplicates/{timestamp}", apiPlaylistDuplicatesHandler)
 	r.Handle("/api/ssfavtracks", apiFavTracksHandler)
 	r.Handle("/api/ssfavtracks/full", apiFavTracksHandler)
 	r.Handle("/api/ssfavtracks/{timestamp}", apiFavTracksHandler)
+	r.Handle("/api/ssartists", apiFollowedArtistsHandler)
+	r.Handle("/api/ssartists/full", apiFollowedArtistsHandler)
+	r.Handle("/api/ssartists/{timestamp}", apiFollowedArtistsHandler)
+	r.Handle("/api/ssalbums", apiSavedAlbumsHandler)
+	r.Handle("/api/ssalbums/full", apiSavedAlbumsHandler)
+	r.Handle("/api/ssalbums/{timestamp}", apiSavedAlbumsHandler)
+	r.Handle("/api/ssshows", apiSavedShowsHandler)
+	r.Handle("/api/ssshows/full", apiSavedShowsHandler)
+	r.Handle("/api/ssshows/{timestamp}", apiSavedShowsHandler)
+	r.Handle("/api/ssepisodes", apiSavedEpisodesHandler)
+	r.Handle("/api/ssepisodes/full", apiSavedEpisodesHandler)
+	r.Handle("/api/ssepisodes/{timestamp}", apiSavedEpisodesHandler)
+	r.Handle("/api/sstop", apiTopItemsHandler)
+	r.Handle("/api/sstop/full", apiTopItemsHandler)
+	r.Handle("/api/sstop/{timestamp}", apiTopItemsHandler)
 	// diffs
 	r.Handle("/api/ssplaylists/diff/{timestamp}", apiPlaylistsHandler)
 	r.Handle("/api/ssfavtracks/diff/{timestamp}", apiFavTracksHandler)
+	r.Handle("/api/ssartists/diff/{timestamp}", apiFollowedArtistsHandler)
+	r.Handle("/api/ssartists/diff/{timestamp}/{other}", apiFollowedArtistsHandler)
+	r.Handle("/api/ssalbums/diff/{timestamp}", apiSavedAlbumsHandler)
+	r.Handle("/api/ssalbums/diff/{timestamp}/{other}", apiSavedAlbumsHandler)
+	r.Handle("/api/ssshows/diff/{timestamp}", apiSavedShowsHandler)
+	r.Handle("/api/ssshows/diff/{timestamp}/{other}", apiSavedShowsHandler)
+	r.Handle("/api/ssepisodes/diff/{timestamp}", apiSavedEpisodesHandler)
+	r.Handle("/api/ssepisodes/diff/{timestamp}/{other}", apiSavedEpisodesHandler)
+	r.Handle("/api/sstop/moves/{timestamp}/{other}", apiTopItemsHandler)
 
 	// debugging
 	r.HandleFunc("/debug", handlers.DebugHandler)
@@ -89,13 +157,19 @@ func main() {
 	displayHelp := flag.Bool("h", false, "display info/help message")
 	flashDB := flag.Bool("flushdb", false, "Flush Redis DB")
 	logFileName := flag.String("logfile", "", "log file used to store server logs")
+	configFileName := flag.String("config", "", "JSON config file, values can be overridden by SPOTILIZER_* env variables")
+	recordDir := flag.String("record", "", "dir to record Spotify responses to, as fixture files")
+	replayDir := flag.String("replay", "", "dir with recorded fixture files, to replay Spotify responses from")
 	flag.Parse()
 
 	if *displayHelp {
 		fmt.Println(`
 			-h                      > show this message
 			-logfile=<logFileName>  > output log file name
-			-flushdb                > flush/clear redis DB before start`)
+			-config=<configFile>    > JSON config file (see config.example.json), SPOTILIZER_<NAME> env vars override it
+			-flushdb                > flush/clear redis DB before start
+			-record=<dir>           > record Spotify responses to fixture files in dir (tokens scrubbed)
+			-replay=<dir>           > replay Spotify responses from fixture files in dir, Spotify is not called`)
 		fmt.Println()
 		return
 	}
@@ -105,6 +179,11 @@ func main() {
 	//		Trace, Debug, Info, Warning, Error, Fatal, Panic
 	log.SetLevel(log.TraceLevel)
 
+	if err := config.Load(*configFileName); err != nil {
+		log.Fatal(err)
+	}
+	serverURL = config.Conf.ServerURL()
+
 	// read and set view templates from disk
 	util.SetupTemplates()
 
@@ -122,21 +201,44 @@ func main() {
 	// 	"number": 122,
 	// }).Warn("The group's number increased tremendously!")
 
-	// read spotify client ID & Secret
-	clientID, clientSecret, err := util.ReadSpotifyAuthData()
+	// read spotify client ID & Secret (not needed for PKCE login)
+	clientID, clientSecret, err := util.ReadSpotifyAuthData(config.Conf.AuthFlow != config.AuthFlowPKCE)
 	if err != nil {
 		log.Fatal(err)
 	}
-	handlers.SetClientIDAndSecret(clientID, clientSecret)
+	handlers.SetClientID(clientID)
 
 	// redis setup
 	db.InitRedisClient(*flashDB)
 	// services setup
-	services.InitServices()
+	services.InitServices(clientID, clientSecret)
+
+	if len(*recordDir) > 0 && len(*replayDir) > 0 {
+		log.Fatal(" >>> -record and -replay cannot be used together")
+	}
+	if len(*recordDir) > 0 {
+		if err := services.RecordSpotifyResponses(*recordDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(*replayDir) > 0 {
+		if err := services.ReplaySpotifyResponses(*replayDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	backgroundJobsStopCh := make(chan struct{})
+	// renew access tokens of logged in users before they expire
+	go services.Auth.RunTokenRefresher(config.Conf.TokenRefreshCheckInterval, config.Conf.TokenRefreshMargin, backgroundJobsStopCh)
+	// collect recently played tracks of users who enabled play history
+	go services.PlayHistory.RunCollector(config.Conf.PlayHistoryCollectInterval, backgroundJobsStopCh)
+	// take scheduled fav tracks and playlists snapshots
+	go services.SnapshotScheduler.RunScheduler(config.Conf.ScheduleCheckInterval, backgroundJobsStopCh)
 
 	router := routerSetup()
 
-	ipAndPort := fmt.Sprintf("%s:%s", constants.IPAddress, constants.Port)
+	ipAndPort := fmt.Sprintf("%s:%s", config.Conf.Host, config.Conf.Port)
+	// long running handlers (e.g. downloading all user's playlists) extend their write deadline, see long_request_write_timeout
 	httpServer := &http.Server{
 		Handler:      router,
 		Addr:         ipAndPort,
@@ -170,6 +272,7 @@ func main() {
 	go cli(interruptCh)
 
 	waitForInterruptSignal(interruptCh)
+	close(backgroundJobsStopCh)
 	gracefulShutdown(httpServer)
 }
 
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// CachedResponse is a Spotify API response body, stored along with its ETag, used for conditional requests
+type CachedResponse struct {
+	URL       string    `json:"url"`
+	ETag      string    `json:"etag"`
+	Body      []byte    `json:"body"`
+	StoredAt  time.Time `json:"stored_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Fresh tells if the cached response can be used without revalidating it with Spotify API
+func (cr CachedResponse) Fresh() bool {
+	return time.Now().Before(cr.ExpiresAt)
+}
+
+// CachedArtist is an artist kept in the artist cache shared by all the users, refreshed from Spotify API when stale
+type CachedArtist struct {
+	Artist   SpFullArtist `json:"artist"`
+	CachedAt time.Time    `json:"cached_at"`
+}
@@ -17,31 +17,20 @@ func SpPlaylist2dtoPlaylist(spPlaylist SpPlaylist, tracks []SpPlaylistTrack) DTO
 }
 
 func SpPlaylistTrack2dtoPlaylistTrack(spPlTrack SpPlaylistTrack) DTOTrack {
-	dtoTrack := DTOTrack{
-		AddedAt:     spPlTrack.AddedAt.Unix(),
-		AddedBy:     spPlTrack.AddedBy.ID,
-		ID:          spPlTrack.Track.ID,
-		DurationMs:  spPlTrack.Track.DurationMs,
-		Name:        spPlTrack.Track.Name,
-		TrackNumber: spPlTrack.Track.TrackNumber,
-		URI:         spPlTrack.Track.URI,
-		Artists:     SpArtists2dtoArtists(spPlTrack.Track.Artists),
-	}
+	dtoTrack := SpTrack2dtoTrack(spPlTrack.Track)
+	dtoTrack.AddedAt = spPlTrack.AddedAt.Unix()
+	dtoTrack.AddedBy = spPlTrack.AddedBy.ID
+	dtoTrack.Details.IsLocal = dtoTrack.Details.IsLocal || spPlTrack.IsLocal
 	return dtoTrack
 }
 
 func SpAddedTrack2dtoTrack(spAddedTrack SpAddedTrack) DTOTrack {
-	return DTOTrack{
-		AddedAt:     spAddedTrack.AddedAt.Unix(),
-		ID:          spAddedTrack.Track.ID,
-		DurationMs:  spAddedTrack.Track.DurationMs,
-		Name:        spAddedTrack.Track.Name,
-		TrackNumber: spAddedTrack.Track.TrackNumber,
-		URI:         spAddedTrack.Track.URI,
-		Artists:     SpArtists2dtoArtists(spAddedTrack.Track.Artists),
-	}
+	dtoTrack := SpTrack2dtoTrack(spAddedTrack.Track)
+	dtoTrack.AddedAt = spAddedTrack.AddedAt.Unix()
+	return dtoTrack
 }
 
+// SpTrack2dtoTrack fills in all the track details, see DTOTrack.Details for the compact projection
 func SpTrack2dtoTrack(spTrack SpTrack) DTOTrack {
 	return DTOTrack{
 		ID:          spTrack.ID,
@@ -49,18 +38,109 @@ func SpTrack2dtoTrack(spTrack SpTrack) DTOTrack {
 		Name:        spTrack.Name,
 		TrackNumber: spTrack.TrackNumber,
 		URI:         spTrack.URI,
+		Album:       spTrack.Album.Name,
 		Artists:     SpArtists2dtoArtists(spTrack.Artists),
+		Details: &DTOTrackDetails{
+			Album:      SpAlbum2dtoTrackAlbum(spTrack.Album),
+			ISRC:       spTrack.ExternalIds.Isrc,
+			Explicit:   spTrack.Explicit,
+			Popularity: spTrack.Popularity,
+			DiscNumber: spTrack.DiscNumber,
+			IsLocal:    spTrack.IsLocal,
+		},
+	}
+}
+
+func SpAlbum2dtoTrackAlbum(spAlbum SpAlbum) DTOTrackAlbum {
+	dtoAlbum := DTOTrackAlbum{
+		ID:          spAlbum.ID,
+		Name:        spAlbum.Name,
+		URI:         spAlbum.URI,
+		AlbumType:   spAlbum.AlbumType,
+		ReleaseDate: spAlbum.ReleaseDate,
+	}
+	largestWidth := -1
+	for _, img := range spAlbum.Images {
+		if img.Width > largestWidth {
+			largestWidth = img.Width
+			dtoAlbum.ImageURL = img.URL
+		}
+	}
+	return dtoAlbum
+}
+
+func SpAudioFeatures2dtoAudioFeatures(spFeatures SpAudioFeatures) *DTOAudioFeatures {
+	return &DTOAudioFeatures{
+		Tempo:        spFeatures.Tempo,
+		Energy:       spFeatures.Energy,
+		Valence:      spFeatures.Valence,
+		Danceability: spFeatures.Danceability,
+		Key:          spFeatures.Key,
+	}
+}
+
+func SpSavedAlbum2dtoAlbum(spSavedAlbum SpSavedAlbum) DTOAlbum {
+	return DTOAlbum{
+		AddedAt:     spSavedAlbum.AddedAt.Unix(),
+		ID:          spSavedAlbum.Album.ID,
+		Name:        spSavedAlbum.Album.Name,
+		URI:         spSavedAlbum.Album.URI,
+		AlbumType:   spSavedAlbum.Album.AlbumType,
+		ReleaseDate: spSavedAlbum.Album.ReleaseDate,
+		TotalTracks: spSavedAlbum.Album.TotalTracks,
+		Artists:     SpArtists2dtoArtists(spSavedAlbum.Album.Artists),
+	}
+}
+
+func SpSavedShow2dtoShow(spSavedShow SpSavedShow) DTOShow {
+	return DTOShow{
+		AddedAt:       spSavedShow.AddedAt.Unix(),
+		ID:            spSavedShow.Show.ID,
+		Name:          spSavedShow.Show.Name,
+		URI:           spSavedShow.Show.URI,
+		Publisher:     spSavedShow.Show.Publisher,
+		TotalEpisodes: spSavedShow.Show.TotalEpisodes,
+	}
+}
+
+func SpSavedEpisode2dtoEpisode(spSavedEpisode SpSavedEpisode) DTOEpisode {
+	return DTOEpisode{
+		AddedAt:     spSavedEpisode.AddedAt.Unix(),
+		ID:          spSavedEpisode.Episode.ID,
+		Name:        spSavedEpisode.Episode.Name,
+		URI:         spSavedEpisode.Episode.URI,
+		Show:        spSavedEpisode.Episode.Show.Name,
+		ReleaseDate: spSavedEpisode.Episode.ReleaseDate,
+		DurationMs:  spSavedEpisode.Episode.DurationMs,
 	}
 }
 
+func SpPlayHistory2dtoPlay(spPlay SpPlayHistory) DTOPlay {
+	dtoPlay := DTOPlay{
+		PlayedAt: spPlay.PlayedAt.Unix(),
+		Track:    SpTrack2dtoTrack(spPlay.Track),
+	}
+	if spPlay.Context != nil {
+		dtoPlay.Context = spPlay.Context.URI
+	}
+	return dtoPlay
+}
+
 func SpArtist2dtoArtist(spArtist SpArtist) DTOArtist {
 	return DTOArtist{
+		ID:   spArtist.ID,
 		Href: spArtist.Href,
 		Name: spArtist.Name,
 		Type: spArtist.Type,
 	}
 }
 
+func SpFullArtist2dtoArtist(spArtist SpFullArtist) DTOArtist {
+	dtoArtist := SpArtist2dtoArtist(spArtist.SpArtist)
+	dtoArtist.Genres = spArtist.Genres
+	return dtoArtist
+}
+
 func SpArtists2dtoArtists(spArtists []SpArtist) []DTOArtist {
 	var dtoArtists []DTOArtist
 	for _, spA := range spArtists {
@@ -1,5 +1,20 @@
 package models
 
+type DTOAuthStatus struct {
+	Username        string   `json:"username"`
+	ExpiresAt       int64    `json:"expires_at"`
+	ReloginRequired bool     `json:"relogin_required"`
+	GrantedScopes   []string `json:"granted_scopes"`
+}
+
+// DTOScopesRequired is sent instead of the response of a feature needing OAuth scopes the user has not granted yet.
+// Client should send the user to ConsentURL, to grant the missing scopes.
+type DTOScopesRequired struct {
+	Error         SpError  `json:"error"`
+	MissingScopes []string `json:"missing_scopes"`
+	ConsentURL    string   `json:"consent_url"`
+}
+
 type DTOPlaylistSnapshot struct {
 	Timestamp int64         `json:"timestamp"`
 	Playlists []DTOPlaylist `json:"playlists"`
@@ -11,6 +26,62 @@ type DTOFavTracksSnapshot struct {
 	Tracks      []DTOTrack `json:"tracks"`
 }
 
+type DTOFollowedArtistsSnapshot struct {
+	Timestamp    int64       `json:"timestamp"`
+	ArtistsCount int         `json:"artists_count"`
+	Artists      []DTOArtist `json:"artists"`
+}
+
+type DTOSavedAlbumsSnapshot struct {
+	Timestamp   int64      `json:"timestamp"`
+	AlbumsCount int        `json:"albums_count"`
+	Albums      []DTOAlbum `json:"albums"`
+}
+
+type DTOSavedShowsSnapshot struct {
+	Timestamp  int64     `json:"timestamp"`
+	ShowsCount int       `json:"shows_count"`
+	Shows      []DTOShow `json:"shows"`
+}
+
+type DTOSavedEpisodesSnapshot struct {
+	Timestamp     int64        `json:"timestamp"`
+	EpisodesCount int          `json:"episodes_count"`
+	Episodes      []DTOEpisode `json:"episodes"`
+}
+
+type DTOTopItemsSnapshot struct {
+	Timestamp int64                       `json:"timestamp"`
+	Ranges    map[string]DTOTopItemsRange `json:"ranges"`
+}
+
+type DTOTopItemsRange struct {
+	Tracks  []DTOTrack  `json:"tracks"`
+	Artists []DTOArtist `json:"artists"`
+}
+
+// DTORankMove describes how an item moved in the ranking between two snapshots, ranks start from 1,
+// with 0 meaning not ranked
+type DTORankMove struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Rank         int    `json:"rank"`
+	PreviousRank int    `json:"previous_rank"`
+	Move         string `json:"move"`
+}
+
+type DTOTopRangeMoves struct {
+	Tracks  []DTORankMove `json:"tracks"`
+	Artists []DTORankMove `json:"artists"`
+}
+
+type DTOPlaylistError struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
 type DTOPlaylist struct {
 	URI        string     `json:"uri"`
 	ID         string     `json:"id"`
@@ -29,10 +100,106 @@ type DTOTrack struct {
 	TrackNumber int         `json:"track_number"`
 	DurationMs  int         `json:"duration_ms"`
 	Name        string      `json:"name"`
+	// Details are included with the full projection only
+	Details *DTOTrackDetails `json:"details,omitempty"`
+	// AudioFeatures are included only when requested
+	AudioFeatures *DTOAudioFeatures `json:"audio_features,omitempty"`
+}
+
+// DTOTrackDetails tell apart tracks with the same name, e.g. the album version and the single
+type DTOTrackDetails struct {
+	Album      DTOTrackAlbum `json:"album"`
+	ISRC       string        `json:"isrc"`
+	Explicit   bool          `json:"explicit"`
+	Popularity int           `json:"popularity"`
+	DiscNumber int           `json:"disc_number"`
+	IsLocal    bool          `json:"is_local"`
+}
+
+type DTOTrackAlbum struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	URI         string `json:"uri"`
+	AlbumType   string `json:"album_type"`
+	ReleaseDate string `json:"release_date"`
+	// ImageURL is the URL of the largest album image, empty when album has no images
+	ImageURL string `json:"image_url"`
+}
+
+type DTOAudioFeatures struct {
+	Tempo        float64 `json:"tempo"`
+	Energy       float64 `json:"energy"`
+	Valence      float64 `json:"valence"`
+	Danceability float64 `json:"danceability"`
+	Key          int     `json:"key"`
+}
+
+// DTOGenreBreakdown tells how many tracks of a snapshot belong to each genre, most common genres first. A track
+// belongs to all the genres of its artists, tracks with no known genres are counted as UnknownGenreTracks.
+type DTOGenreBreakdown struct {
+	Timestamp          int64           `json:"timestamp"`
+	TracksCount        int             `json:"tracks_count"`
+	UnknownGenreTracks int             `json:"unknown_genre_tracks"`
+	Genres             []DTOGenreCount `json:"genres"`
+}
+
+type DTOGenreCount struct {
+	Genre       string `json:"genre"`
+	TracksCount int    `json:"tracks_count"`
+}
+
+// DTOAudioFeaturesAverage holds average audio features of tracks in a snapshot, only tracks with known audio
+// features (AnalyzedCount of TracksCount) are taken into account
+type DTOAudioFeaturesAverage struct {
+	Timestamp     int64   `json:"timestamp"`
+	TracksCount   int     `json:"tracks_count"`
+	AnalyzedCount int     `json:"analyzed_count"`
+	Tempo         float64 `json:"tempo"`
+	Energy        float64 `json:"energy"`
+	Valence       float64 `json:"valence"`
+	Danceability  float64 `json:"danceability"`
 }
 
 type DTOArtist struct {
-	Name string `json:"name"`
-	Type string `json:"type"`
-	Href string `json:"href"`
+	ID     string   `json:"id,omitempty"`
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Href   string   `json:"href"`
+	Genres []string `json:"genres,omitempty"`
+}
+
+type DTOAlbum struct {
+	AddedAt     int64       `json:"added_at"`
+	Artists     []DTOArtist `json:"artists"`
+	URI         string      `json:"uri"`
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	AlbumType   string      `json:"album_type"`
+	ReleaseDate string      `json:"release_date"`
+	TotalTracks int         `json:"total_tracks"`
+}
+
+type DTOShow struct {
+	AddedAt       int64  `json:"added_at"`
+	URI           string `json:"uri"`
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Publisher     string `json:"publisher"`
+	TotalEpisodes int    `json:"total_episodes"`
+}
+
+type DTOEpisode struct {
+	AddedAt     int64  `json:"added_at"`
+	URI         string `json:"uri"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Show        string `json:"show"`
+	ReleaseDate string `json:"release_date"`
+	DurationMs  int    `json:"duration_ms"`
+}
+
+type DTOPlay struct {
+	PlayedAt int64    `json:"played_at"`
+	Context  string   `json:"context,omitempty"`
+	Track    DTOTrack `json:"track"`
 }
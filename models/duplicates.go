@@ -0,0 +1,35 @@
+package models
+
+// ways duplicate tracks are matched, from the strictest one
+const (
+	// DuplicateMatchID is the same track, added more than once
+	DuplicateMatchID = "id"
+	// DuplicateMatchISRC is the same recording under different track IDs, e.g. relinked or re-released tracks
+	DuplicateMatchISRC = "isrc"
+	// DuplicateMatchTitleArtist is the same normalized title and main artist, e.g. remastered versions
+	DuplicateMatchTitleArtist = "title_artist"
+)
+
+// PlaylistDuplicates are the duplicate tracks found in playlists: the ones repeated inside a single playlist, and the
+// ones in more than one playlist
+type PlaylistDuplicates struct {
+	Within []DuplicateTracks `json:"within"`
+	Across []DuplicateTracks `json:"across"`
+}
+
+// DuplicateTracks are copies of the same track, in playlist order. Match tells what all the copies share: the track
+// ID, the ISRC, or only the title and artist.
+type DuplicateTracks struct {
+	Match  string           `json:"match"`
+	Tracks []DuplicateTrack `json:"tracks"`
+}
+
+type DuplicateTrack struct {
+	PlaylistID   string   `json:"playlist_id"`
+	PlaylistName string   `json:"playlist_name"`
+	Position     int      `json:"position"`
+	URI          string   `json:"uri"`
+	Name         string   `json:"name"`
+	Artists      []string `json:"artists"`
+	ISRC         string   `json:"isrc,omitempty"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// sources of snapshot queries
+const (
+	QuerySourceFavTracks = "fav_tracks"
+	QuerySourcePlaylists = "playlists"
+)
+
+// snapshot references of snapshot queries, besides snapshot timestamps
+const (
+	QuerySnapshotAny    = "any"
+	QuerySnapshotLatest = "latest"
+)
+
+// SnapshotQuery selects tracks from the history of user's snapshots, e.g. the tracks unliked in the last 90 days are
+// the ones in any favorite tracks snapshot since 90 days ago, but not in the latest one
+type SnapshotQuery struct {
+	// Source is the kind of snapshots queried: favorite tracks, or playlists
+	Source string `json:"source"`
+	// PlaylistID limits the playlists snapshots query to a single playlist
+	PlaylistID string `json:"playlist_id,omitempty"`
+	// In is the snapshot the tracks are in: snapshot timestamp, latest, or any snapshot taken between Since and Until
+	In    string     `json:"in"`
+	Since *time.Time `json:"since,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+	// NotIn is the snapshot the tracks are not in: snapshot timestamp, or latest
+	NotIn string `json:"not_in,omitempty"`
+	// AddedSince and AddedUntil limit the tracks by the time they were liked, or added to the playlist
+	AddedSince *time.Time `json:"added_since,omitempty"`
+	AddedUntil *time.Time `json:"added_until,omitempty"`
+}
+
+// SnapshotQueryResult are the tracks selected by the query, in the order they were added
+type SnapshotQueryResult struct {
+	Query       SnapshotQuery `json:"query"`
+	Description string        `json:"description"`
+	Tracks      []QueryTrack  `json:"tracks"`
+}
+
+type QueryTrack struct {
+	URI     string    `json:"uri"`
+	Name    string    `json:"name"`
+	Artists []string  `json:"artists"`
+	Album   string    `json:"album"`
+	AddedAt time.Time `json:"added_at"`
+	// LastSeen is the timestamp of the latest queried snapshot with the track
+	LastSeen time.Time `json:"last_seen"`
+	IsLocal  bool      `json:"is_local,omitempty"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// frequencies of snapshot schedules
+const (
+	ScheduleHourly = "hourly"
+	ScheduleDaily  = "daily"
+	ScheduleWeekly = "weekly"
+	ScheduleCron   = "cron"
+)
+
+// kinds of snapshots taken by snapshot schedules
+const (
+	ScheduledFavTracks = "fav_tracks"
+	ScheduledPlaylists = "playlists"
+)
+
+// SnapshotSchedule takes user's snapshots automatically, at the times matched by its cron expression (UTC), each run
+// delayed by a random jitter
+type SnapshotSchedule struct {
+	Username string `json:"username"`
+	// Snapshots are the kinds of snapshots taken: fav_tracks, playlists, or both
+	Snapshots []string `json:"snapshots"`
+	Frequency string   `json:"frequency"`
+	// Cron is the cron expression of the schedule, for hourly, daily and weekly schedules the one of the frequency
+	Cron      string     `json:"cron"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	NextRun   time.Time  `json:"next_run"`
+	// LastError tells why any of the snapshots of the last run failed, empty if all were taken
+	LastError string `json:"last_error,omitempty"`
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // PlaylistsSnapshot is an object representing the playlist snapshot in time
 type PlaylistsSnapshot struct {
@@ -12,6 +15,38 @@ type PlaylistsSnapshot struct {
 type PlaylistSnapshot struct {
 	Playlist SpPlaylist        `json:"playlist"`
 	Tracks   []SpPlaylistTrack `json:"tracks"`
+	// DownloadFailed is set when playlist tracks could not be downloaded, so Tracks are empty
+	DownloadFailed bool `json:"download_failed,omitempty"`
+}
+
+// PlaylistsByIDs returns the playlists of the snapshot given by IDs, in the same order, or all the playlists with
+// their tracks when no IDs are given. Requested playlists must be in the snapshot, along with their tracks.
+func (s *PlaylistsSnapshot) PlaylistsByIDs(ids []string) ([]PlaylistSnapshot, error) {
+	playlists := []PlaylistSnapshot{}
+	if len(ids) == 0 {
+		for _, pl := range s.Playlists {
+			if !pl.DownloadFailed {
+				playlists = append(playlists, pl)
+			}
+		}
+		return playlists, nil
+	}
+
+	byID := make(map[string]PlaylistSnapshot)
+	for _, pl := range s.Playlists {
+		byID[pl.Playlist.ID] = pl
+	}
+	for _, id := range ids {
+		pl, found := byID[id]
+		if !found {
+			return nil, fmt.Errorf("playlist [%s] not found in the snapshot", id)
+		}
+		if pl.DownloadFailed {
+			return nil, fmt.Errorf("tracks of playlist [%s] are missing in the snapshot", id)
+		}
+		playlists = append(playlists, pl)
+	}
+	return playlists, nil
 }
 
 // FavTracksSnapshot is an object representing the list of favorite saved tracks of a user
@@ -20,3 +55,68 @@ type FavTracksSnapshot struct {
 	Timestamp time.Time      `json:"timestamp"`
 	Tracks    []SpAddedTrack `json:"tracks"`
 }
+
+// ContainsAddedTrack tells if tracks contain the track, i.e. the same track of the same album
+func ContainsAddedTrack(track SpAddedTrack, tracks []SpAddedTrack) bool {
+	for _, t := range tracks {
+		if track.Track.Album.ID != t.Track.Album.ID {
+			continue
+		}
+		if track.Track.ID != t.Track.ID {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// SavedAlbumsSnapshot is an object representing the list of albums saved in user's library
+type SavedAlbumsSnapshot struct {
+	Username  string         `json:"username"`
+	Timestamp time.Time      `json:"timestamp"`
+	Albums    []SpSavedAlbum `json:"albums"`
+}
+
+// SavedShowsSnapshot is an object representing the list of podcast shows saved in user's library
+type SavedShowsSnapshot struct {
+	Username  string        `json:"username"`
+	Timestamp time.Time     `json:"timestamp"`
+	Shows     []SpSavedShow `json:"shows"`
+}
+
+// SavedEpisodesSnapshot is an object representing the list of podcast episodes saved in user's library
+type SavedEpisodesSnapshot struct {
+	Username  string           `json:"username"`
+	Timestamp time.Time        `json:"timestamp"`
+	Episodes  []SpSavedEpisode `json:"episodes"`
+}
+
+// FollowedArtistsSnapshot is an object representing the list of artists followed by a user
+type FollowedArtistsSnapshot struct {
+	Username  string         `json:"username"`
+	Timestamp time.Time      `json:"timestamp"`
+	Artists   []SpFullArtist `json:"artists"`
+}
+
+// time ranges of user's top tracks and artists: calculated from several years of data, last 6 months and last 4 weeks
+const (
+	TopTimeRangeLong   = "long_term"
+	TopTimeRangeMedium = "medium_term"
+	TopTimeRangeShort  = "short_term"
+)
+
+// TopTimeRanges lists all time ranges of user's top tracks and artists
+var TopTimeRanges = []string{TopTimeRangeShort, TopTimeRangeMedium, TopTimeRangeLong}
+
+// TopItems holds user's top tracks and artists, ranked, for each time range
+type TopItems struct {
+	Tracks  map[string][]SpTrack      `json:"tracks"`
+	Artists map[string][]SpFullArtist `json:"artists"`
+}
+
+// TopItemsSnapshot is an object representing user's top tracks and artists, for each time range
+type TopItemsSnapshot struct {
+	Username  string    `json:"username"`
+	Timestamp time.Time `json:"timestamp"`
+	TopItems
+}
@@ -28,6 +28,118 @@ type SpGetSavedTracksResp struct {
 	Items []SpAddedTrack `json:"items"`
 }
 
+type SpGetSavedAlbumsResp struct {
+	SpResponse
+	Items []SpSavedAlbum `json:"items"`
+}
+
+// SpCursorResponse is a page of cursor-based paged responses, used instead of offsets by e.g. followed artists endpoint
+type SpCursorResponse struct {
+	Href    string    `json:"href"`
+	Limit   int       `json:"limit"`
+	Next    string    `json:"next"`
+	Cursors SpCursors `json:"cursors"`
+	Total   int       `json:"total"`
+}
+
+type SpCursors struct {
+	After  string `json:"after"`
+	Before string `json:"before"`
+}
+
+type SpGetFollowedArtistsResp struct {
+	Artists struct {
+		SpCursorResponse
+		Items []SpFullArtist `json:"items"`
+	} `json:"artists"`
+}
+
+type SpGetTopTracksResp struct {
+	SpResponse
+	Items []SpTrack `json:"items"`
+}
+
+type SpGetTopArtistsResp struct {
+	SpResponse
+	Items []SpFullArtist `json:"items"`
+}
+
+// SpGetArtistsResp holds artists in the order of requested artist IDs, nil for unknown artists
+type SpGetArtistsResp struct {
+	Artists []*SpFullArtist `json:"artists"`
+}
+
+// SpPlaylistSnapshotResp holds the version of a playlist, after the playlist is changed
+type SpPlaylistSnapshotResp struct {
+	SnapshotID string `json:"snapshot_id"`
+}
+
+// SpGetTracksResp holds tracks in the order of requested track IDs, nil for unknown tracks
+type SpGetTracksResp struct {
+	Tracks []*SpTrack `json:"tracks"`
+}
+
+// SpGetAudioFeaturesResp holds audio features in the order of requested track IDs, nil for unknown tracks
+type SpGetAudioFeaturesResp struct {
+	AudioFeatures []*SpAudioFeatures `json:"audio_features"`
+}
+
+// SpGetRecentlyPlayedResp is a page of recently played tracks, most recent first
+type SpGetRecentlyPlayedResp struct {
+	SpCursorResponse
+	Items []SpPlayHistory `json:"items"`
+}
+
+// NextURL returns the URL of the next page, empty for the last page
+func (r SpResponse) NextURL() string {
+	return r.Next
+}
+
+// NextURL returns the URL of the next page, empty for the last page
+func (r SpGetFollowedArtistsResp) NextURL() string {
+	return r.Artists.Next
+}
+
+type SpGetSavedShowsResp struct {
+	SpResponse
+	Items []SpSavedShow `json:"items"`
+}
+
+type SpGetSavedEpisodesResp struct {
+	SpResponse
+	Items []SpSavedEpisode `json:"items"`
+}
+
+type SpSavedAlbum struct {
+	AddedAt time.Time `json:"added_at"`
+	Album   SpAlbum   `json:"album"`
+}
+
+type SpSavedShow struct {
+	AddedAt time.Time `json:"added_at"`
+	Show    SpShow    `json:"show"`
+}
+
+type SpSavedEpisode struct {
+	AddedAt time.Time `json:"added_at"`
+	Episode SpEpisode `json:"episode"`
+}
+
+// SpPlayHistory is a single play of a track, from user's recently played tracks
+type SpPlayHistory struct {
+	Track    SpTrack    `json:"track"`
+	PlayedAt time.Time  `json:"played_at"`
+	Context  *SpContext `json:"context"`
+}
+
+// SpContext is the context a track was played from, e.g. an album or a playlist
+type SpContext struct {
+	Type         string `json:"type"`
+	Href         string `json:"href"`
+	ExternalUrls SpURL  `json:"external_urls"`
+	URI          string `json:"uri"`
+}
+
 type SpAddedTrack struct {
 	AddedAt time.Time `json:"added_at"`
 	Track   SpTrack   `json:"track"`
@@ -45,6 +157,7 @@ type SpTrack struct {
 	Href             string        `json:"href"`
 	ID               string        `json:"id"`
 	IsLocal          bool          `json:"is_local"`
+	IsPlayable       *bool         `json:"is_playable,omitempty"`
 	Name             string        `json:"name"`
 	Popularity       int           `json:"popularity"`
 	PreviewURL       string        `json:"preview_url"`
@@ -53,6 +166,25 @@ type SpTrack struct {
 	URI              string        `json:"uri"`
 }
 
+// SpAudioFeatures more info: https://developer.spotify.com/documentation/web-api/reference/tracks/get-several-audio-features/
+type SpAudioFeatures struct {
+	ID               string  `json:"id"`
+	URI              string  `json:"uri"`
+	Acousticness     float64 `json:"acousticness"`
+	Danceability     float64 `json:"danceability"`
+	DurationMs       int     `json:"duration_ms"`
+	Energy           float64 `json:"energy"`
+	Instrumentalness float64 `json:"instrumentalness"`
+	Key              int     `json:"key"`
+	Liveness         float64 `json:"liveness"`
+	Loudness         float64 `json:"loudness"`
+	Mode             int     `json:"mode"`
+	Speechiness      float64 `json:"speechiness"`
+	Tempo            float64 `json:"tempo"`
+	TimeSignature    int     `json:"time_signature"`
+	Valence          float64 `json:"valence"`
+}
+
 type SpAlbum struct {
 	AlbumType            string     `json:"album_type"`
 	Artists              []SpArtist `json:"artists"`
@@ -69,8 +201,41 @@ type SpAlbum struct {
 	URI                  string     `json:"uri"`
 }
 
+type SpShow struct {
+	Description   string    `json:"description"`
+	Explicit      bool      `json:"explicit"`
+	ExternalUrls  SpURL     `json:"external_urls"`
+	Href          string    `json:"href"`
+	ID            string    `json:"id"`
+	Images        []SpImage `json:"images"`
+	Languages     []string  `json:"languages"`
+	MediaType     string    `json:"media_type"`
+	Name          string    `json:"name"`
+	Publisher     string    `json:"publisher"`
+	TotalEpisodes int       `json:"total_episodes"`
+	Type          string    `json:"type"`
+	URI           string    `json:"uri"`
+}
+
+type SpEpisode struct {
+	Description          string    `json:"description"`
+	DurationMs           int       `json:"duration_ms"`
+	Explicit             bool      `json:"explicit"`
+	ExternalUrls         SpURL     `json:"external_urls"`
+	Href                 string    `json:"href"`
+	ID                   string    `json:"id"`
+	Images               []SpImage `json:"images"`
+	Name                 string    `json:"name"`
+	ReleaseDate          string    `json:"release_date"`
+	ReleaseDatePrecision string    `json:"release_date_precision"`
+	Show                 SpShow    `json:"show"`
+	Type                 string    `json:"type"`
+	URI                  string    `json:"uri"`
+}
+
 type SpPlaylist struct {
 	Collaborative bool        `json:"collaborative"`
+	Description   string      `json:"description"`
 	ExternalUrls  SpURL       `json:"external_urls"`
 	Href          string      `json:"href"`
 	ID            string      `json:"id"`
@@ -113,6 +278,15 @@ type SpArtist struct {
 	URI          string `json:"uri"`
 }
 
+// SpFullArtist is the full artist object, as opposed to the simplified one (SpArtist) found in tracks and albums
+type SpFullArtist struct {
+	SpArtist
+	Followers  SpUserFollowers `json:"followers"`
+	Genres     []string        `json:"genres"`
+	Images     []SpImage       `json:"images"`
+	Popularity int             `json:"popularity"`
+}
+
 type SpError struct {
 	Status  int    `json:"status"`
 	Message string `json:"message"`
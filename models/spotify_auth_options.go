@@ -1,6 +1,10 @@
 package models
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // SpotifyAuthOptions is: https://developer.spotify.com/documentation/general/guides/authorization-guide/
 type SpotifyAuthOptions struct {
@@ -9,8 +13,33 @@ type SpotifyAuthOptions struct {
 	Scope        string `json:"scope"`
 	ExpiresIn    int    `json:"expires_in"`
 	RefreshToken string `json:"refresh_token"`
+	// IssuedAt and ExpiresAt are not part of the Spotify response, but set when the access token is received
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// ReloginRequired is set when the refresh token got revoked, and the user has to log in to Spotify again
+	ReloginRequired bool `json:"relogin_required"`
+}
+
+// SetIssuedAt records when the access token was issued, and computes its expiry time
+func (ao *SpotifyAuthOptions) SetIssuedAt(issuedAt time.Time) {
+	ao.IssuedAt = issuedAt
+	ao.ExpiresAt = issuedAt.Add(time.Duration(ao.ExpiresIn) * time.Second)
+}
+
+// ExpiresWithin tells if the access token expires in less than given duration. Unknown expiry time is never considered.
+func (ao SpotifyAuthOptions) ExpiresWithin(d time.Duration) bool {
+	if ao.ExpiresAt.IsZero() {
+		return false
+	}
+	return time.Until(ao.ExpiresAt) < d
+}
+
+// GrantedScopes returns the OAuth scopes user granted, Scope holds them space separated
+func (ao SpotifyAuthOptions) GrantedScopes() []string {
+	return strings.Fields(ao.Scope)
 }
 
 func (ao SpotifyAuthOptions) String() string {
-	return fmt.Sprintf("Spotify Auth Options = [tokenType: %s] [scope: %s] [expires in: %v] [at: %s] [rt: %s]", ao.TokenType, ao.Scope, ao.ExpiresIn, ao.AccessToken, ao.RefreshToken)
+	return fmt.Sprintf("Spotify Auth Options = [tokenType: %s] [scope: %s] [expires in: %v] [expires at: %v] [at: %s] [rt: %s]",
+		ao.TokenType, ao.Scope, ao.ExpiresIn, ao.ExpiresAt, ao.AccessToken, ao.RefreshToken)
 }
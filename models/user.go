@@ -2,14 +2,66 @@ package models
 
 import (
 	"fmt"
+	"sync"
 )
 
+// authMutex guards Auth of all users, since the token refresher replaces it while requests and background jobs read
+// it. Users are copied by value, so the lock is not a field of User.
+var authMutex sync.RWMutex
+
 // User is an object representing the user of this service, not Spotify
 type User struct {
 	Username string
-	Auth     *SpotifyAuthOptions
+	// Auth is set when the user is created, and read and replaced by CurrentAuth and SetAuth afterwards
+	Auth *SpotifyAuthOptions
+}
+
+// CurrentAuth returns user's current auth options. Auth options are replaced, never changed, so the returned ones
+// are safe to read.
+func (u *User) CurrentAuth() *SpotifyAuthOptions {
+	authMutex.RLock()
+	defer authMutex.RUnlock()
+	return u.Auth
+}
+
+// AccessToken returns user's current access token, empty if the user has no auth options
+func (u *User) AccessToken() string {
+	if auth := u.CurrentAuth(); auth != nil {
+		return auth.AccessToken
+	}
+	return ""
+}
+
+// SetAuth replaces user's auth options
+func (u *User) SetAuth(auth *SpotifyAuthOptions) {
+	authMutex.Lock()
+	defer authMutex.Unlock()
+	u.Auth = auth
+}
+
+// ReloginRequired tells if user's Spotify authorization is no longer valid, so the user must log in again
+func (u *User) ReloginRequired() bool {
+	auth := u.CurrentAuth()
+	return auth != nil && auth.ReloginRequired
+}
+
+// MissingScopes returns the required OAuth scopes the user has not granted yet
+func (u *User) MissingScopes(required []string) []string {
+	granted := make(map[string]bool)
+	if auth := u.CurrentAuth(); auth != nil {
+		for _, scope := range auth.GrantedScopes() {
+			granted[scope] = true
+		}
+	}
+	missing := []string{}
+	for _, scope := range required {
+		if !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
 }
 
-func (u User) String() string {
-	return fmt.Sprintf("[%s]: auth: [%v]", u.Username, *u.Auth)
+func (u *User) String() string {
+	return fmt.Sprintf("[%s]: auth: [%v]", u.Username, *u.CurrentAuth())
 }
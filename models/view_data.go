@@ -2,9 +2,10 @@ package models
 
 // ViewData object returned to frontend clients
 type ViewData struct {
-	Username string      `json:"username"`
-	Message  string      `json:"message"`
-	Data     interface{} `json:"data"`
+	Username        string      `json:"username"`
+	Message         string      `json:"message"`
+	ReloginRequired bool        `json:"relogin_required"`
+	Data            interface{} `json:"data"`
 }
 
 type ErrorViewData struct {
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"time"
+)
+
+// kinds of write-back plans
+const (
+	WriteBackRestoreFavTracks = "restore_fav_tracks"
+	WriteBackRecreatePlaylist = "recreate_playlist"
+	WriteBackRollbackPlaylist = "rollback_playlist"
+	WriteBackDedupPlaylist    = "dedup_playlist"
+	WriteBackMergePlaylists   = "merge_playlists"
+	WriteBackQueryPlaylist    = "query_playlist"
+)
+
+// operations of a write-back plan
+const (
+	WriteBackOpSaveTracks = "save_tracks"
+	PlaylistOpCreate      = "create"
+	PlaylistOpAdd         = "add"
+	PlaylistOpRemove      = "remove"
+	PlaylistOpReorder     = "reorder"
+)
+
+// statuses of a write-back plan, and of its operations
+const (
+	WriteBackStatusPlanned           = "planned"
+	WriteBackStatusExecuted          = "executed"
+	WriteBackStatusPartiallyExecuted = "partially_executed"
+	WriteBackStatusUndone            = "undone"
+	WriteBackStatusPartiallyUndone   = "partially_undone"
+	WriteBackStatusPending           = "pending"
+	WriteBackStatusDone              = "done"
+	WriteBackStatusFailed            = "failed"
+	// WriteBackStatusUnknown is the status of operations whose request timed out, so they may be applied or not
+	WriteBackStatusUnknown = "unknown"
+)
+
+// outcomes of a single track of a library operation run, e.g. of a track restored to saved tracks
+const (
+	RestoreStatusRestored = "restored"
+	RestoreStatusFailed   = "failed"
+	// RestoreStatusRemoved is the outcome of undoing the restore
+	RestoreStatusRemoved = "removed"
+	// RestoreStatusUnknown is the outcome of timed out runs, the track may be restored (or removed) or not
+	RestoreStatusUnknown = "unknown"
+)
+
+// reasons for skipping a track of a write-back plan
+const (
+	SkipReasonUnavailable = "unavailable"
+	SkipReasonLocal       = "local"
+	// SkipReasonNotRemoved is the reason for requested tracks which are not removed since the snapshot
+	SkipReasonNotRemoved = "not_removed"
+	// SkipReasonDuplicate is the reason for copies of tracks left out of a merged playlist
+	SkipReasonDuplicate = "duplicate"
+)
+
+// WriteBackPlan lists the operations which change user's Spotify account, e.g. restore removed tracks, or roll a
+// playlist back to a snapshot. Plans are stored, and nothing is changed until the user confirms the plan by its ID.
+// Operations are executed in order, and positions of each operation refer to the state left by the previous one.
+type WriteBackPlan struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Status    string    `json:"status"`
+	// PlaylistID is the playlist to change, empty until a recreated playlist is created
+	PlaylistID string `json:"playlist_id,omitempty"`
+	// SnapshotID is the version of the playlist the next operation applies to
+	SnapshotID string               `json:"snapshot_id,omitempty"`
+	Operations []WriteBackOperation `json:"operations"`
+	// SkippedTracks cannot be written back, e.g. local files, which cannot be added to playlists through Spotify API
+	SkippedTracks []PlanTrack `json:"skipped_tracks"`
+	// Executions record all the runs of the plan, both executions and undos
+	Executions []WriteBackExecution `json:"executions"`
+}
+
+// WriteBackOperation is a single change of user's account. Name, Description and Public are set for create
+// operations. Tracks of add operations are added together, at the position of the first one. Reorder operations move
+// a single track, from its position to before the InsertBefore position.
+type WriteBackOperation struct {
+	Type         string      `json:"type"`
+	Name         string      `json:"name,omitempty"`
+	Description  string      `json:"description,omitempty"`
+	Public       bool        `json:"public,omitempty"`
+	Tracks       []PlanTrack `json:"tracks,omitempty"`
+	InsertBefore *int        `json:"insert_before,omitempty"`
+	// Before and After are track URIs of the playlist before and after the operation, while for library operations
+	// they are track URIs of the operation found in the library
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+	Status string   `json:"status"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// PlanTrack is a track of a plan operation, at its position in the playlist
+type PlanTrack struct {
+	URI      string `json:"uri"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+	// RelinkedFrom is set when Spotify relinked the track, i.e. it is written back as another version of the same track
+	RelinkedFrom string `json:"relinked_from,omitempty"`
+	// Reason tells why the track is skipped
+	Reason string `json:"reason,omitempty"`
+}
+
+// WriteBackExecution is the record of a single run of the plan, with results of the operations run
+type WriteBackExecution struct {
+	Undo       bool              `json:"undo"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Results    []WriteBackResult `json:"results"`
+}
+
+type WriteBackResult struct {
+	// Operation is the index of the operation in the plan
+	Operation int    `json:"operation"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	// Verified is set when the operation of unknown outcome is found already applied (or undone), so it is not run again
+	Verified bool `json:"verified,omitempty"`
+	// Tracks are the outcomes of each track of save tracks operations
+	Tracks []TrackRestoreResult `json:"tracks,omitempty"`
+}
+
+// TrackRestoreResult is the outcome of restoring (or removing, when undone) a single track of the operation
+type TrackRestoreResult struct {
+	URI    string `json:"uri"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// RelinkedFrom is set when Spotify relinked the track, i.e. it is restored as another version of the same track
+	RelinkedFrom string `json:"relinked_from,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
@@ -314,6 +314,11 @@ function showPlaylistSnapshot(timestamp) {
                 <li class="list-group-item d-flex justify-content-between align-items-center">
                     ${p.name}
                     <span style="margin-left: 20px;" class="badge badge-primary badge-pill">${p.tracks.length}</span>
+                    <span>
+                        <button type="button" class="btn btn-outline-success btn-sm" onclick="restorePlaylist('rollback', ${timestamp}, '${p.id}')">Roll back</button>
+                        <button type="button" class="btn btn-outline-success btn-sm" onclick="restorePlaylist('recreate', ${timestamp}, '${p.id}')">Recreate</button>
+                        <button type="button" class="btn btn-outline-success btn-sm" onclick="dedupPlaylist('${p.id}')">Remove duplicates</button>
+                    </span>
                 </li>
             `);
         });
@@ -372,6 +377,8 @@ function showFavTracksDiff(timestamp, newTracks, removedTracks) {
     ssDiffCol.append(`<h5 style="margin-top: 20px;">Removed Tracks</h5>`);
     if (removedTracks.length === 0) {
         ssDiffCol.append(`<p>No removed tracks</p>`);
+    } else {
+        ssDiffCol.append(`<button type="button" class="btn btn-outline-success btn-sm" onclick="restoreFavTracks(${timestamp})">Restore removed tracks</button>`);
     }
     ssDiffCol.append(`<ul class="list-group">`);
     removedTracks.forEach(function (t) {
@@ -416,6 +423,9 @@ function saveCurrentTracks() {
             refreshTokenFunc();
             return;
         }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
         if (respObj.error) {
             toastr.error(respObj.error.message, 'Save fav tracks error');
         } else {
@@ -435,6 +445,9 @@ function saveCurrentPlaylists() {
             refreshTokenFunc();
             return;
         }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
         if (respObj.error) {
             toastr.error(respObj.error.message, 'Save current playlists error');
         } else {
@@ -446,6 +459,326 @@ function saveCurrentPlaylists() {
     });
 }
 
+function saveFollowedArtists() {
+    lastCalledFunc = saveFollowedArtists;
+    makeRequest('/save_followed_artists', function (response) {
+        console.log(' > received from server: ' + response);
+        const respObj = JSON.parse(response);
+        if (checkIfRefreshTokenNeeded(respObj)) {
+            console.log(' > refresh token needed ...');
+            refreshTokenFunc();
+            return;
+        }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
+        if (respObj.error) {
+            toastr.error(respObj.error.message, 'Save followed artists error');
+        } else {
+            toastr.success(respObj.message, 'Save followed artists');
+        }
+    });
+}
+
+function saveSavedAlbums() {
+    lastCalledFunc = saveSavedAlbums;
+    makeRequest('/save_albums', function (response) {
+        console.log(' > received from server: ' + response);
+        const respObj = JSON.parse(response);
+        if (checkIfRefreshTokenNeeded(respObj)) {
+            console.log(' > refresh token needed ...');
+            refreshTokenFunc();
+            return;
+        }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
+        if (respObj.error) {
+            toastr.error(respObj.error.message, 'Save albums error');
+        } else {
+            toastr.success(respObj.message, 'Save albums');
+        }
+    });
+}
+
+function saveSavedShows() {
+    lastCalledFunc = saveSavedShows;
+    makeRequest('/save_shows', function (response) {
+        console.log(' > received from server: ' + response);
+        const respObj = JSON.parse(response);
+        if (checkIfRefreshTokenNeeded(respObj)) {
+            console.log(' > refresh token needed ...');
+            refreshTokenFunc();
+            return;
+        }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
+        if (respObj.error) {
+            toastr.error(respObj.error.message, 'Save shows error');
+        } else {
+            toastr.success(respObj.message, 'Save shows');
+        }
+    });
+}
+
+function saveSavedEpisodes() {
+    lastCalledFunc = saveSavedEpisodes;
+    makeRequest('/save_episodes', function (response) {
+        console.log(' > received from server: ' + response);
+        const respObj = JSON.parse(response);
+        if (checkIfRefreshTokenNeeded(respObj)) {
+            console.log(' > refresh token needed ...');
+            refreshTokenFunc();
+            return;
+        }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
+        if (respObj.error) {
+            toastr.error(respObj.error.message, 'Save episodes error');
+        } else {
+            toastr.success(respObj.message, 'Save episodes');
+        }
+    });
+}
+
+function saveTopItems() {
+    lastCalledFunc = saveTopItems;
+    makeRequest('/save_top_items', function (response) {
+        console.log(' > received from server: ' + response);
+        const respObj = JSON.parse(response);
+        if (checkIfRefreshTokenNeeded(respObj)) {
+            console.log(' > refresh token needed ...');
+            refreshTokenFunc();
+            return;
+        }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
+        if (respObj.error) {
+            toastr.error(respObj.error.message, 'Save top tracks and artists error');
+        } else {
+            toastr.success(respObj.message, 'Save top tracks and artists');
+        }
+    });
+}
+
+// restoreFavTracks plans restoring the removed favorite tracks, and executes the plan after the user confirms it
+function restoreFavTracks(timestamp) {
+    lastCalledFunc = function () {
+        restoreFavTracks(timestamp);
+    };
+    // remembered for resuming the restore after the user grants the missing permissions
+    localStorage.setItem('restoreTimestamp', timestamp);
+    makeRequest('/restore_fav_tracks/' + timestamp, function (response) {
+        console.log(' > received from server: ' + response);
+        const respObj = JSON.parse(response);
+        if (checkIfRefreshTokenNeeded(respObj)) {
+            console.log(' > refresh token needed ...');
+            refreshTokenFunc();
+            return;
+        }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
+        if (respObj.error) {
+            toastr.error(respObj.error.message, 'Restore favorite tracks error');
+            return;
+        }
+        confirmWriteBackPlan(respObj.data, 'Restore favorite tracks', function () {
+            getFavTracksSnapshotDiff(timestamp);
+        });
+    });
+}
+
+// restorePlaylist plans rolling back or recreating the playlist, and executes the plan after the user confirms it
+function restorePlaylist(mode, timestamp, playlistID) {
+    lastCalledFunc = function () {
+        restorePlaylist(mode, timestamp, playlistID);
+    };
+    // remembered for resuming the restore after the user grants the missing permissions
+    localStorage.setItem('restorePlaylist', JSON.stringify({mode: mode, timestamp: timestamp, playlistID: playlistID}));
+    makeRequest('/' + mode + '_playlist/' + timestamp + '/' + playlistID, function (response) {
+        console.log(' > received from server: ' + response);
+        const respObj = JSON.parse(response);
+        if (checkIfRefreshTokenNeeded(respObj)) {
+            console.log(' > refresh token needed ...');
+            refreshTokenFunc();
+            return;
+        }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
+        if (respObj.error) {
+            toastr.error(respObj.error.message, 'Restore playlist error');
+            return;
+        }
+        confirmWriteBackPlan(respObj.data, 'Restore playlist');
+    });
+}
+
+// dedupPlaylist plans removing duplicate tracks from the current playlist, and executes the plan after the user confirms it
+function dedupPlaylist(playlistID) {
+    lastCalledFunc = function () {
+        dedupPlaylist(playlistID);
+    };
+    // remembered for resuming the dedup after the user grants the missing permissions
+    localStorage.setItem('dedupPlaylistID', playlistID);
+    makeRequest('/dedup_playlist/' + playlistID, function (response) {
+        console.log(' > received from server: ' + response);
+        const respObj = JSON.parse(response);
+        if (checkIfRefreshTokenNeeded(respObj)) {
+            console.log(' > refresh token needed ...');
+            refreshTokenFunc();
+            return;
+        }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
+        if (respObj.error) {
+            toastr.error(respObj.error.message, 'Remove duplicates error');
+            return;
+        }
+        confirmWriteBackPlan(respObj.data, 'Remove duplicates');
+    });
+}
+
+// confirmWriteBackPlan shows the planned changes of user's Spotify account, and executes them once the user confirms
+function confirmWriteBackPlan(plan, title, onExecuted) {
+    if (plan.operations.length === 0) {
+        toastr.info('Nothing to change, plan ' + plan.id + ' is empty', title);
+        return;
+    }
+    const counts = {};
+    plan.operations.forEach(function (op) {
+        counts[op.type] = (counts[op.type] || 0) + (op.type === 'create' ? 1 : op.tracks.length);
+    });
+    let summary = `${title} "${plan.name}" (plan ${plan.id}):\n`;
+    Object.keys(counts).forEach(function (type) {
+        summary += ` - ${type}: ${counts[type]}\n`;
+    });
+    if (plan.skipped_tracks.length > 0) {
+        summary += `${plan.skipped_tracks.length} tracks will be skipped\n`;
+    }
+    if (confirm(summary)) {
+        runWriteBackPlan('execute', plan.id, title, onExecuted);
+    }
+}
+
+// runWriteBackPlan executes or undoes the plan; once executed, clicking the message undoes it
+function runWriteBackPlan(action, planID, title, onDone) {
+    makeRequest('/' + action + '_plan/' + planID, function (response) {
+        console.log(' > received from server: ' + response);
+        const respObj = JSON.parse(response);
+        if (checkIfRefreshTokenNeeded(respObj)) {
+            console.log(' > refresh token needed ...');
+            refreshTokenFunc();
+            return;
+        }
+        if (respObj.error) {
+            toastr.error(respObj.error.message, title + ' error');
+        } else if (action === 'execute') {
+            toastr.success(respObj.message + ' (click to undo)', title, {
+                onclick: function () {
+                    if (confirm('Undo plan ' + planID + '?')) {
+                        runWriteBackPlan('undo', planID, title, onDone);
+                    }
+                },
+            });
+        } else {
+            toastr.success(respObj.message, title);
+        }
+        if (onDone) {
+            onDone();
+        }
+    });
+}
+
+function enablePlayHistory() {
+    lastCalledFunc = enablePlayHistory;
+    makeRequest('/enable_play_history', function (response) {
+        console.log(' > received from server: ' + response);
+        const respObj = JSON.parse(response);
+        if (checkIfRefreshTokenNeeded(respObj)) {
+            console.log(' > refresh token needed ...');
+            refreshTokenFunc();
+            return;
+        }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
+        if (respObj.error) {
+            toastr.error(respObj.error.message, 'Play history error');
+        } else {
+            toastr.success(respObj.message, 'Play history');
+        }
+    });
+}
+
+function scheduleSnapshots() {
+    lastCalledFunc = scheduleSnapshots;
+    const frequency = $('#schedule-frequency').val();
+    let url = '/schedule_snapshots?frequency=' + frequency;
+    // playlists snapshots are taken at most daily
+    if (frequency === 'hourly') {
+        url += '&snapshots=fav_tracks';
+    }
+    makeRequest(url, function (response) {
+        console.log(' > received from server: ' + response);
+        const respObj = JSON.parse(response);
+        if (checkIfRefreshTokenNeeded(respObj)) {
+            console.log(' > refresh token needed ...');
+            refreshTokenFunc();
+            return;
+        }
+        if (checkIfConsentNeeded(respObj)) {
+            return;
+        }
+        if (respObj.error) {
+            toastr.error(respObj.error.message, 'Schedule snapshots error');
+        } else {
+            toastr.success(respObj.message, 'Schedule snapshots');
+            showSnapshotSchedule();
+        }
+    });
+}
+
+function unscheduleSnapshots() {
+    makeRequest('/unschedule_snapshots', function (response) {
+        const respObj = JSON.parse(response);
+        if (respObj.error) {
+            toastr.error(respObj.error.message, 'Scheduled snapshots error');
+        } else {
+            toastr.success(respObj.message, 'Scheduled snapshots');
+            showSnapshotSchedule();
+        }
+    });
+}
+
+// showSnapshotSchedule shows user's snapshot schedule, with its last run, next run and last error
+function showSnapshotSchedule() {
+    makeRequest('/api/schedule', function (response) {
+        const respObj = JSON.parse(response);
+        const statusElem = $('#schedule-status');
+        if (respObj.error) {
+            statusElem.text('No snapshots scheduled');
+            return;
+        }
+        const schedule = respObj.data;
+        let status = 'Snapshots of ' + schedule.snapshots.join(', ') + ' scheduled ' + schedule.frequency
+            + ' [' + schedule.cron + '], next run: ' + new Date(schedule.next_run).toLocaleString();
+        if (schedule.last_run) {
+            status += ', last run: ' + new Date(schedule.last_run).toLocaleString();
+        }
+        if (schedule.last_error) {
+            status += ', last error: ' + schedule.last_error;
+        }
+        statusElem.text(status + ' ');
+        statusElem.append($('<a style="cursor: pointer">stop</a>').click(unscheduleSnapshots));
+    });
+}
+
 var ssPlaylists = null;
 var ssTracks = null;
 var ssTimestamp2playlistsMap = new Map();
@@ -482,6 +815,38 @@ function refreshData() {
     }, 650);
 }
 
+// features to resume when user returns from granting additional Spotify permissions
+const resumableFeatures = {
+    save_tracks: saveCurrentTracks,
+    save_playlists: saveCurrentPlaylists,
+    save_followed_artists: saveFollowedArtists,
+    save_albums: saveSavedAlbums,
+    save_shows: saveSavedShows,
+    save_episodes: saveSavedEpisodes,
+    save_top_items: saveTopItems,
+    play_history: enablePlayHistory,
+    restore_tracks: function () {
+        restoreFavTracks(localStorage.getItem('restoreTimestamp'));
+    },
+    restore_playlists: function () {
+        const restore = JSON.parse(localStorage.getItem('restorePlaylist'));
+        restorePlaylist(restore.mode, restore.timestamp, restore.playlistID);
+    },
+    // playlist edits share the permissions, but each is resumed by its own action
+    dedup_playlist: function () {
+        dedupPlaylist(localStorage.getItem('dedupPlaylistID'));
+    },
+};
+
+function resumeFeature() {
+    const feature = new URLSearchParams(window.location.search).get('resume');
+    if (!feature || !resumableFeatures[feature]) {
+        return;
+    }
+    window.history.replaceState(null, '', window.location.pathname);
+    resumableFeatures[feature]();
+}
+
 document.addEventListener('DOMContentLoaded', function (event) {
     if (isLoggedIn()) {
         $('#spotify-controls-div').removeClass('invisible-elem');
@@ -490,6 +855,8 @@ document.addEventListener('DOMContentLoaded', function (event) {
         getDataFromLocalStorage();
         populateFavTracksSnapshots();
         populatePlaylistSnapshots();
+        showSnapshotSchedule();
+        resumeFeature();
     } else {
         $('#spotify-controls-div').addClass('invisible-elem');
         $('#refresh-button-div').addClass('invisible-elem');
@@ -80,6 +80,18 @@ function checkIfRefreshTokenNeeded(response) {
     return true;
 }
 
+// checkIfConsentNeeded sends the user to grant additional Spotify permissions (scopes), if the feature needs them
+function checkIfConsentNeeded(response) {
+    if (!response.consent_url) {
+        return false;
+    }
+    toastr.info('Additional Spotify permissions needed: ' + response.missing_scopes.join(', '), 'Redirecting to Spotify ...');
+    setTimeout(function() {
+        window.location.href = response.consent_url;
+    }, 1500);
+    return true;
+}
+
 let lastCalledFunc = null;
 
 function refreshTokenFunc() {
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/config"
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// Spotify API accepts at most 50 artist IDs in a single artists request
+const artistsBatchSize = 50
+
+// ArtistsService looks up full artists (genres, popularity, images), which tracks and albums carry only simplified
+// artists for. Artists are cached for all the users, and refreshed when cached longer than cacheTTL.
+type ArtistsService struct {
+	spotifyDB     db.SpotifyDBClient
+	spotifyAPIURL string
+	urlArtists    string
+	cacheTTL      time.Duration
+}
+
+func NewArtistsService(spotifyDB db.SpotifyDBClient) *ArtistsService {
+	return &ArtistsService{
+		spotifyDB:     spotifyDB,
+		spotifyAPIURL: config.Conf.SpotifyAPIURL,
+		urlArtists:    config.Conf.URLArtists,
+		cacheTTL:      config.Conf.ArtistCacheTTL,
+	}
+}
+
+// GetArtists returns full artists, by artist ID. Artists not cached, or cached longer than cache TTL, are downloaded
+// in batches and cached. Artists unknown to Spotify are left out.
+func (as *ArtistsService) GetArtists(accessToken string, artistIDs []string) (map[string]models.SpFullArtist, *models.SpAPIError) {
+	// artists of many tracks are requested at once, so each artist is looked up only once
+	artistIDs = uniqueIDs(artistIDs)
+	artists := make(map[string]models.SpFullArtist)
+	cached := as.spotifyDB.GetArtists(artistIDs)
+
+	var toDownload []string
+	for _, id := range artistIDs {
+		if c, found := cached[id]; found && time.Since(c.CachedAt) < as.cacheTTL {
+			artists[id] = c.Artist
+			continue
+		}
+		toDownload = append(toDownload, id)
+	}
+	log.Debugf(" > artists: [%d] artists cached, [%d] to download", len(artists), len(toDownload))
+
+	for start := 0; start < len(toDownload); start += artistsBatchSize {
+		end := start + artistsBatchSize
+		if end > len(toDownload) {
+			end = len(toDownload)
+		}
+		downloaded, err := as.downloadArtists(accessToken, toDownload[start:end])
+		if err != nil {
+			return nil, err
+		}
+		as.spotifyDB.SaveArtists(downloaded, time.Now())
+		for _, a := range downloaded {
+			artists[a.ID] = a
+		}
+	}
+
+	return artists, nil
+}
+
+// downloadArtists more info: https://developer.spotify.com/documentation/web-api/reference/artists/get-several-artists/
+func (as *ArtistsService) downloadArtists(accessToken string, artistIDs []string) ([]models.SpFullArtist, *models.SpAPIError) {
+	path := fmt.Sprintf("%s?ids=%s", as.urlArtists, strings.Join(artistIDs, ","))
+	body, getErr := getFromSpotify(as.spotifyAPIURL, path, accessToken)
+	if getErr != nil {
+		errMsg := fmt.Sprintf(" >>> error getting artists. details: %s", getErr.Error())
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+	if apiErr, isError := getAPIError(body); isError {
+		log.Printf(" >>> API getting artists error: status [%d] -> [%s]\n", apiErr.Error.Status, apiErr.Error.Message)
+		return nil, &apiErr
+	}
+
+	var response models.SpGetArtistsResp
+	if unmarshalErr := json.Unmarshal(body, &response); unmarshalErr != nil {
+		errMsg := fmt.Sprintf(" >>> error occurred while unmarshaling artists response: %s", unmarshalErr.Error())
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+
+	artists := []models.SpFullArtist{}
+	for _, a := range response.Artists {
+		if a != nil {
+			artists = append(artists, *a)
+		}
+	}
+	return artists, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// artistsHTTPClientMock serves artists with popularity set to artist's index, for artists named "artist-<index>",
+// and null for other artists; requested IDs are recorded
+type artistsHTTPClientMock struct {
+	mutex        sync.Mutex
+	requestedIDs [][]string
+}
+
+func (c *artistsHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	ids := strings.Split(req.URL.Query().Get("ids"), ",")
+	c.mutex.Lock()
+	c.requestedIDs = append(c.requestedIDs, ids)
+	c.mutex.Unlock()
+
+	var artists []string
+	for _, id := range ids {
+		var index int
+		if _, err := fmt.Sscanf(id, "artist-%d", &index); err != nil {
+			artists = append(artists, "null")
+			continue
+		}
+		artists = append(artists, fmt.Sprintf(`{"id": "%s", "popularity": %d, "genres": ["genre %d"]}`, id, index, index%3))
+	}
+	respBody := fmt.Sprintf(`{"artists": [%s]}`, strings.Join(artists, ", "))
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(respBody)),
+		StatusCode: 200,
+	}, nil
+}
+
+// artistsDBMock records the artist IDs looked up in the artists cache
+type artistsDBMock struct {
+	*db.SpotifyDBTestClient
+	lookedUpIDs [][]string
+}
+
+func (m *artistsDBMock) GetArtists(artistIDs []string) map[string]models.CachedArtist {
+	m.lookedUpIDs = append(m.lookedUpIDs, artistIDs)
+	return m.SpotifyDBTestClient.GetArtists(artistIDs)
+}
+
+func TestGetArtists(t *testing.T) {
+	httpClient := &artistsHTTPClientMock{}
+	reqClient = requestClient{httpClient: httpClient, requestTimeoutSeconds: 1}
+	spotifyDB := &artistsDBMock{SpotifyDBTestClient: db.NewSpotifyDBTest()}
+	as := &ArtistsService{spotifyDB: spotifyDB, spotifyAPIURL: "http://test", urlArtists: "/artists", cacheTTL: time.Hour}
+
+	var artistIDs []string
+	for i := 0; i < 120; i++ {
+		artistIDs = append(artistIDs, fmt.Sprintf("artist-%d", i))
+	}
+	artistIDs = append(artistIDs, "artist-7", "", "unknown")
+
+	// artist-0 is cached already, artist-1 is cached, but stale
+	spotifyDB.SaveArtists([]models.SpFullArtist{{SpArtist: models.SpArtist{ID: "artist-0"}, Popularity: 100}}, time.Now())
+	spotifyDB.SaveArtists([]models.SpFullArtist{{SpArtist: models.SpArtist{ID: "artist-1"}, Popularity: 100}}, time.Now().Add(-2*time.Hour))
+
+	artists, err := as.GetArtists("test-token", artistIDs)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 120, len(artists))
+	assert.Equal(t, 100, artists["artist-0"].Popularity)
+	assert.Equal(t, 1, artists["artist-1"].Popularity)
+	assert.Equal(t, []string{"genre 2"}, artists["artist-119"].Genres)
+
+	if assert.Equal(t, 3, len(httpClient.requestedIDs)) {
+		assert.Equal(t, 50, len(httpClient.requestedIDs[0]))
+		assert.Equal(t, "artist-1", httpClient.requestedIDs[0][0])
+		assert.Equal(t, 50, len(httpClient.requestedIDs[1]))
+		assert.Equal(t, 20, len(httpClient.requestedIDs[2]))
+	}
+	// each artist is looked up in the cache once, however many times it is requested
+	if assert.Equal(t, 1, len(spotifyDB.lookedUpIDs)) {
+		assert.Equal(t, 121, len(spotifyDB.lookedUpIDs[0]))
+	}
+
+	// refreshed artists are cached again
+	artists, err = as.GetArtists("test-token", artistIDs[:120])
+	assert.Nil(t, err)
+	assert.Equal(t, 120, len(artists))
+	assert.Equal(t, 3, len(httpClient.requestedIDs))
+}
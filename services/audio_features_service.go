@@ -0,0 +1,93 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/config"
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// Spotify API accepts at most 100 track IDs in a single audio features request
+const audioFeaturesBatchSize = 100
+
+// AudioFeaturesService enriches tracks with their audio features (tempo, energy, valence, ...). Audio features of
+// a track never change, so they are downloaded once per track and cached in the DB.
+type AudioFeaturesService struct {
+	spotifyDB        db.SpotifyDBClient
+	spotifyAPIURL    string
+	urlAudioFeatures string
+}
+
+func NewAudioFeaturesService(spotifyDB db.SpotifyDBClient) *AudioFeaturesService {
+	return &AudioFeaturesService{
+		spotifyDB:        spotifyDB,
+		spotifyAPIURL:    config.Conf.SpotifyAPIURL,
+		urlAudioFeatures: config.Conf.URLAudioFeatures,
+	}
+}
+
+// GetAudioFeatures returns audio features of given tracks, by track ID. Features not cached yet are downloaded
+// in batches and cached. Tracks Spotify has no audio features for (e.g. local files) are left out.
+func (afs *AudioFeaturesService) GetAudioFeatures(accessToken string, trackIDs []string) (map[string]models.SpAudioFeatures, *models.SpAPIError) {
+	// tracks of many snapshots are requested at once, so each track is looked up only once
+	trackIDs = uniqueIDs(trackIDs)
+	features := afs.spotifyDB.GetAudioFeatures(trackIDs)
+
+	var missingIDs []string
+	for _, id := range trackIDs {
+		if _, cached := features[id]; !cached {
+			missingIDs = append(missingIDs, id)
+		}
+	}
+	log.Debugf(" > audio features: [%d] tracks cached, [%d] to download", len(features), len(missingIDs))
+
+	for start := 0; start < len(missingIDs); start += audioFeaturesBatchSize {
+		end := start + audioFeaturesBatchSize
+		if end > len(missingIDs) {
+			end = len(missingIDs)
+		}
+		downloaded, err := afs.downloadAudioFeatures(accessToken, missingIDs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		afs.spotifyDB.SaveAudioFeatures(downloaded)
+		for _, f := range downloaded {
+			features[f.ID] = f
+		}
+	}
+
+	return features, nil
+}
+
+// downloadAudioFeatures more info: https://developer.spotify.com/documentation/web-api/reference/tracks/get-several-audio-features/
+func (afs *AudioFeaturesService) downloadAudioFeatures(accessToken string, trackIDs []string) ([]models.SpAudioFeatures, *models.SpAPIError) {
+	path := fmt.Sprintf("%s?ids=%s", afs.urlAudioFeatures, strings.Join(trackIDs, ","))
+	body, getErr := getFromSpotify(afs.spotifyAPIURL, path, accessToken)
+	if getErr != nil {
+		errMsg := fmt.Sprintf(" >>> error getting audio features. details: %s", getErr.Error())
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+	if apiErr, isError := getAPIError(body); isError {
+		log.Printf(" >>> API getting audio features error: status [%d] -> [%s]\n", apiErr.Error.Status, apiErr.Error.Message)
+		return nil, &apiErr
+	}
+
+	var response models.SpGetAudioFeaturesResp
+	if unmarshalErr := json.Unmarshal(body, &response); unmarshalErr != nil {
+		errMsg := fmt.Sprintf(" >>> error occurred while unmarshaling audio features response: %s", unmarshalErr.Error())
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+
+	features := []models.SpAudioFeatures{}
+	for _, f := range response.AudioFeatures {
+		if f != nil {
+			features = append(features, *f)
+		}
+	}
+	return features, nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// audioFeaturesHTTPClientMock serves audio features with tempo set to track's index, for tracks named "track-<index>",
+// and null for other tracks; requested IDs are recorded
+type audioFeaturesHTTPClientMock struct {
+	mutex        sync.Mutex
+	requestedIDs [][]string
+}
+
+func (c *audioFeaturesHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	ids := strings.Split(req.URL.Query().Get("ids"), ",")
+	c.mutex.Lock()
+	c.requestedIDs = append(c.requestedIDs, ids)
+	c.mutex.Unlock()
+
+	var features []string
+	for _, id := range ids {
+		var index int
+		if _, err := fmt.Sscanf(id, "track-%d", &index); err != nil {
+			features = append(features, "null")
+			continue
+		}
+		features = append(features, fmt.Sprintf(`{"id": "%s", "tempo": %d, "energy": 0.5}`, id, index))
+	}
+	respBody := fmt.Sprintf(`{"audio_features": [%s]}`, strings.Join(features, ", "))
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(respBody)),
+		StatusCode: 200,
+	}, nil
+}
+
+// audioFeaturesDBMock records the track IDs looked up in the audio features cache
+type audioFeaturesDBMock struct {
+	*db.SpotifyDBTestClient
+	lookedUpIDs [][]string
+}
+
+func (m *audioFeaturesDBMock) GetAudioFeatures(trackIDs []string) map[string]models.SpAudioFeatures {
+	m.lookedUpIDs = append(m.lookedUpIDs, trackIDs)
+	return m.SpotifyDBTestClient.GetAudioFeatures(trackIDs)
+}
+
+func TestGetAudioFeatures(t *testing.T) {
+	httpClient := &audioFeaturesHTTPClientMock{}
+	reqClient = requestClient{httpClient: httpClient, requestTimeoutSeconds: 1}
+	spotifyDB := &audioFeaturesDBMock{SpotifyDBTestClient: db.NewSpotifyDBTest()}
+	afs := &AudioFeaturesService{spotifyDB: spotifyDB, spotifyAPIURL: "http://test", urlAudioFeatures: "/audio-features"}
+
+	var trackIDs []string
+	for i := 0; i < 250; i++ {
+		trackIDs = append(trackIDs, fmt.Sprintf("track-%d", i))
+	}
+	// duplicates, local tracks without ID, and tracks without audio features
+	trackIDs = append(trackIDs, "track-7", "", "unknown")
+
+	features, err := afs.GetAudioFeatures("test-token", trackIDs)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 250, len(features))
+	assert.Equal(t, float64(42), features["track-42"].Tempo)
+	assert.Equal(t, 0.5, features["track-249"].Energy)
+	_, found := features["unknown"]
+	assert.False(t, found)
+
+	if assert.Equal(t, 3, len(httpClient.requestedIDs)) {
+		assert.Equal(t, 100, len(httpClient.requestedIDs[0]))
+		assert.Equal(t, 100, len(httpClient.requestedIDs[1]))
+		assert.Equal(t, 51, len(httpClient.requestedIDs[2]))
+	}
+
+	// cached features are not downloaded again, only the ones Spotify had none for
+	features, err = afs.GetAudioFeatures("test-token", trackIDs)
+	assert.Nil(t, err)
+	assert.Equal(t, 250, len(features))
+	if assert.Equal(t, 4, len(httpClient.requestedIDs)) {
+		assert.Equal(t, []string{"unknown"}, httpClient.requestedIDs[3])
+	}
+	// each track is looked up in the cache once, however many times it is requested
+	for _, lookedUpIDs := range spotifyDB.lookedUpIDs {
+		assert.Equal(t, 251, len(lookedUpIDs))
+	}
+}
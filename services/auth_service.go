@@ -0,0 +1,300 @@
+package services
+
+import (
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/config"
+	"github.com/2beens/spotilizer/models"
+)
+
+// rotated access tokens are remembered for a while, so in-flight requests still using the old token
+// can pick up the new one, instead of triggering yet another refresh
+var rotatedTokenTTL = 10 * time.Minute
+
+// ErrReloginRequired is returned for users whose refresh token got revoked
+var ErrReloginRequired = errors.New("spotify authorization revoked, login required")
+
+// AuthError is returned when Spotify Accounts service refuses to issue an access token
+type AuthError struct {
+	Type        string
+	Description string
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("spotify login error, type [%s], details: %s", e.Type, e.Description)
+}
+
+type rotatedToken struct {
+	accessToken string
+	rotatedAt   time.Time
+}
+
+// SpotifyAuthService talks to the Spotify Accounts service, and takes care of getting and refreshing access tokens
+type SpotifyAuthService struct {
+	clientID     string
+	clientSecret string
+	users        *UserService
+	// public client, using PKCE instead of the client secret
+	pkce bool
+
+	mutex         sync.Mutex
+	userLocks     map[string]*sync.Mutex
+	rotatedTokens map[string]rotatedToken
+	pkceVerifiers map[string]pkceVerifier
+}
+
+func NewSpotifyAuthService(clientID string, clientSecret string, users *UserService) *SpotifyAuthService {
+	as := new(SpotifyAuthService)
+	as.clientID = clientID
+	as.clientSecret = clientSecret
+	as.users = users
+	as.pkce = config.Conf.AuthFlow == config.AuthFlowPKCE
+	as.userLocks = make(map[string]*sync.Mutex)
+	as.rotatedTokens = make(map[string]rotatedToken)
+	as.pkceVerifiers = make(map[string]pkceVerifier)
+	return as
+}
+
+// RequestAccessToken more info: https://developer.spotify.com/documentation/general/guides/authorization-guide/
+func (as *SpotifyAuthService) RequestAccessToken(data url.Values) (auth *models.SpotifyAuthOptions, err error) {
+	body, err := as.postReq(data, config.Conf.SpotifyAccountsURL, config.Conf.URLAccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	spLoginError := &models.SpLoginError{}
+	err = json.Unmarshal(body, &spLoginError)
+	if err != nil || (len(spLoginError.Error) > 0 && len(spLoginError.ErrorDescription) > 0) {
+		log.Warn(string(body))
+		return nil, &AuthError{Type: spLoginError.Error, Description: spLoginError.ErrorDescription}
+	}
+
+	auth = &models.SpotifyAuthOptions{}
+	err = json.Unmarshal(body, &auth)
+	if err != nil {
+		log.Warn(" >>> error while unmarshaling auth options: " + err.Error())
+		return nil, err
+	}
+	auth.SetIssuedAt(time.Now())
+	return
+}
+
+// RefreshUserToken gets a new access token using the stored refresh token, and persists the new auth options
+func (as *SpotifyAuthService) RefreshUserToken(user *models.User) error {
+	userLock := as.getUserLock(user.Username)
+	userLock.Lock()
+	defer userLock.Unlock()
+	return as.refreshUserToken(user)
+}
+
+// RefreshAccessToken returns a valid access token to be used instead of the expired one. Concurrent calls
+// for the same user result in a single refresh, all the others reuse its result.
+func (as *SpotifyAuthService) RefreshAccessToken(expiredToken string) (string, error) {
+	// user auth options are replaced while holding the mutex, so look for the token owner in the same section
+	as.mutex.Lock()
+	if rt, rotated := as.rotatedTokens[expiredToken]; rotated {
+		as.mutex.Unlock()
+		return rt.accessToken, nil
+	}
+	user, err := as.users.GetUserByAccessToken(expiredToken)
+	as.mutex.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	userLock := as.getUserLock(user.Username)
+	userLock.Lock()
+	defer userLock.Unlock()
+
+	// some other request refreshed the token while we were waiting for the lock
+	if user.AccessToken() != expiredToken {
+		return user.AccessToken(), nil
+	}
+
+	if err := as.refreshUserToken(user); err != nil {
+		return "", err
+	}
+	return user.AccessToken(), nil
+}
+
+// TokenOwner returns the username of the user the access token belongs to, including recently rotated tokens
+func (as *SpotifyAuthService) TokenOwner(accessToken string) (username string, found bool) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	if rt, rotated := as.rotatedTokens[accessToken]; rotated {
+		accessToken = rt.accessToken
+	}
+	user, err := as.users.GetUserByAccessToken(accessToken)
+	if err != nil {
+		return "", false
+	}
+	return user.Username, true
+}
+
+func (as *SpotifyAuthService) refreshUserToken(user *models.User) error {
+	auth := user.CurrentAuth()
+	if auth == nil || len(auth.RefreshToken) == 0 {
+		return errors.New("refresh token missing")
+	}
+	if user.ReloginRequired() {
+		return ErrReloginRequired
+	}
+
+	log.Tracef(" > refreshing access token for user [%s]", user.Username)
+	data := url.Values{}
+	data.Set("refresh_token", auth.RefreshToken)
+	data.Set("grant_type", "refresh_token")
+	newAuthOptions, err := as.RequestAccessToken(data)
+	if authErr, ok := err.(*AuthError); ok && authErr.Type == "invalid_grant" {
+		log.Warnf(" >>> refresh token revoked for user [%s]: %s", user.Username, authErr.Description)
+		as.markReloginRequired(user)
+		return ErrReloginRequired
+	}
+	if err != nil {
+		return err
+	}
+	// spotify does not always issue a new refresh token, in that case the old one remains valid
+	if len(newAuthOptions.RefreshToken) == 0 {
+		newAuthOptions.RefreshToken = auth.RefreshToken
+	}
+	// same goes for the granted scopes
+	if len(newAuthOptions.Scope) == 0 {
+		newAuthOptions.Scope = auth.Scope
+	}
+
+	as.mutex.Lock()
+	as.rememberRotatedToken(auth.AccessToken, newAuthOptions.AccessToken)
+	user.SetAuth(newAuthOptions)
+	as.mutex.Unlock()
+
+	if !as.users.Save(user) {
+		log.Warnf(" >>> refreshed access token for user [%s] not stored", user.Username)
+	}
+	log.Debugf(" > access token refreshed for user [%s]", user.Username)
+	return nil
+}
+
+// ReplaceUserAuth sets the auth options of a user who logged in again, and persists them. The options are replaced
+// under the user lock, so they never race with a token refresh of the same user.
+func (as *SpotifyAuthService) ReplaceUserAuth(user *models.User, auth *models.SpotifyAuthOptions) {
+	userLock := as.getUserLock(user.Username)
+	userLock.Lock()
+	defer userLock.Unlock()
+
+	as.mutex.Lock()
+	user.SetAuth(auth)
+	as.mutex.Unlock()
+
+	if !as.users.Save(user) {
+		log.Warnf(" >>> auth options for user [%s] not stored", user.Username)
+	}
+}
+
+// RunTokenRefresher periodically renews access tokens of logged in users, shortly before they expire
+func (as *SpotifyAuthService) RunTokenRefresher(checkInterval time.Duration, refreshMargin time.Duration, stopChan <-chan struct{}) {
+	log.Debugf(" > token refresher started, check interval [%v], refresh margin [%v]", checkInterval, refreshMargin)
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopChan:
+			log.Debug(" > token refresher stopped")
+			return
+		case <-ticker.C:
+			as.refreshExpiringTokens(refreshMargin)
+		}
+	}
+}
+
+func (as *SpotifyAuthService) refreshExpiringTokens(refreshMargin time.Duration) {
+	for _, user := range as.users.GetActiveUsers() {
+		userLock := as.getUserLock(user.Username)
+		userLock.Lock()
+		if auth := user.CurrentAuth(); auth != nil && !auth.ReloginRequired && auth.ExpiresWithin(refreshMargin) {
+			if err := as.refreshUserToken(user); err != nil {
+				log.Warnf(" >>> background token refresh failed for user [%s]: %s", user.Username, err.Error())
+			}
+		}
+		userLock.Unlock()
+	}
+}
+
+func (as *SpotifyAuthService) markReloginRequired(user *models.User) {
+	as.mutex.Lock()
+	reloginAuth := *user.CurrentAuth()
+	reloginAuth.ReloginRequired = true
+	user.SetAuth(&reloginAuth)
+	as.mutex.Unlock()
+
+	if !as.users.Save(user) {
+		log.Warnf(" >>> relogin required state for user [%s] not stored", user.Username)
+	}
+}
+
+func (as *SpotifyAuthService) getUserLock(username string) *sync.Mutex {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	userLock, found := as.userLocks[username]
+	if !found {
+		userLock = &sync.Mutex{}
+		as.userLocks[username] = userLock
+	}
+	return userLock
+}
+
+// rememberRotatedToken must be called while holding the service mutex
+func (as *SpotifyAuthService) rememberRotatedToken(oldToken string, newToken string) {
+	now := time.Now()
+	for t, rt := range as.rotatedTokens {
+		if now.Sub(rt.rotatedAt) > rotatedTokenTTL {
+			delete(as.rotatedTokens, t)
+		}
+	}
+	if len(oldToken) > 0 {
+		as.rotatedTokens[oldToken] = rotatedToken{accessToken: newToken, rotatedAt: now}
+	}
+}
+
+func (as *SpotifyAuthService) postReq(data url.Values, uri string, path string) ([]byte, error) {
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path
+
+	// public (PKCE) clients identify themselves with client ID only, there is no secret to authenticate with
+	if as.pkce {
+		data.Set("client_id", as.clientID)
+	}
+
+	r, err := http.NewRequest("POST", u.String(), strings.NewReader(data.Encode())) // URL-encoded payload
+	if err != nil {
+		return nil, err
+	}
+	if !as.pkce {
+		authEncoding := b64.StdEncoding.EncodeToString([]byte(as.clientID + ":" + as.clientSecret))
+		r.Header.Add("Authorization", "Basic "+authEncoding)
+	}
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
+
+	resp, err := reqClient.httpClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
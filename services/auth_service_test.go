@@ -0,0 +1,123 @@
+package services
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/config"
+	"github.com/2beens/spotilizer/models"
+)
+
+type tokenHTTPClientMock struct {
+	tokenRequests int32
+}
+
+func (c *tokenHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, config.Conf.URLAccessToken) {
+		atomic.AddInt32(&c.tokenRequests, 1)
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"access_token": "new-token", "token_type": "Bearer", "expires_in": 3600}`)),
+			StatusCode: 200,
+		}, nil
+	}
+	if req.Header.Get("Authorization") != "Bearer new-token" {
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"error": {"status": 401, "message": "The access token expired"}}`)),
+			StatusCode: 401,
+		}, nil
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString("OK")),
+		StatusCode: 200,
+	}, nil
+}
+
+func TestGetFromSpotifyRefreshesExpiredToken(t *testing.T) {
+	users := NewUserServiceTest()
+	users.Add(&models.User{Username: "user1", Auth: &models.SpotifyAuthOptions{AccessToken: "old-token", RefreshToken: "refresh-token"}})
+
+	clientMock := &tokenHTTPClientMock{}
+	reqClient = requestClient{
+		httpClient:            clientMock,
+		requestTimeoutSeconds: 1,
+		tokenRefresher:        NewSpotifyAuthService("client-id", "client-secret", users),
+	}
+	defer func() { reqClient.tokenRefresher = nil }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, err := getFromSpotify(testURL, testPathOK, "old-token")
+			assert.NoError(t, err)
+			assert.Equal(t, "OK", string(body))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&clientMock.tokenRequests), "access token should be refreshed only once")
+	user, _ := users.Get("user1")
+	assert.Equal(t, "new-token", user.Auth.AccessToken)
+	// refresh token is kept when spotify does not send a new one
+	assert.Equal(t, "refresh-token", user.Auth.RefreshToken)
+}
+
+func TestRefreshUserTokenWhileReadingAuth(t *testing.T) {
+	users := NewUserServiceTest()
+	user := &models.User{Username: "user1", Auth: &models.SpotifyAuthOptions{AccessToken: "old-token", RefreshToken: "refresh-token"}}
+	users.Add(user)
+
+	reqClient = requestClient{httpClient: &tokenHTTPClientMock{}, requestTimeoutSeconds: 1}
+	authService := NewSpotifyAuthService("client-id", "client-secret", users)
+
+	// handlers and background jobs read user's auth while it is replaced, which the race detector must not flag
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token := user.AccessToken()
+			assert.True(t, token == "old-token" || token == "new-token")
+			assert.False(t, user.ReloginRequired())
+		}()
+	}
+	assert.NoError(t, authService.RefreshUserToken(user))
+	wg.Wait()
+
+	assert.Equal(t, "new-token", user.AccessToken())
+	assert.Equal(t, "refresh-token", user.CurrentAuth().RefreshToken)
+}
+
+type revokedTokenHTTPClientMock struct{}
+
+func (c revokedTokenHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"error": "invalid_grant", "error_description": "Refresh token revoked"}`)),
+		StatusCode: 400,
+	}, nil
+}
+
+func TestRefreshUserTokenRevoked(t *testing.T) {
+	users := NewUserServiceTest()
+	user := &models.User{Username: "user1", Auth: &models.SpotifyAuthOptions{AccessToken: "old-token", RefreshToken: "refresh-token"}}
+	users.Add(user)
+
+	reqClient = requestClient{httpClient: &revokedTokenHTTPClientMock{}, requestTimeoutSeconds: 1}
+	authService := NewSpotifyAuthService("client-id", "client-secret", users)
+
+	err := authService.RefreshUserToken(user)
+	assert.Equal(t, ErrReloginRequired, err)
+	assert.True(t, user.ReloginRequired())
+
+	// no more refresh attempts once the refresh token is known to be revoked
+	_, err = authService.RefreshAccessToken("old-token")
+	assert.Equal(t, ErrReloginRequired, err)
+}
@@ -1,10 +1,14 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/2beens/spotilizer/models"
@@ -15,9 +19,18 @@ type httpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// tokenRefresher provides a new access token when Spotify API rejects the old one
+type tokenRefresher interface {
+	RefreshAccessToken(expiredToken string) (newToken string, err error)
+}
+
 type requestClient struct {
 	httpClient
 	requestTimeoutSeconds int
+	tokenRefresher        tokenRefresher
+	rateLimiter           *rateLimiter
+	maxRateLimitRetries   int
+	responseCache         *responseCache
 }
 
 var reqClient = requestClient{
@@ -25,52 +38,184 @@ var reqClient = requestClient{
 	// https://golang.org/pkg/net/http/#Client
 	httpClient:            &http.Client{},
 	requestTimeoutSeconds: 30,
+	maxRateLimitRetries:   3,
 }
 
+// when Spotify API responds with 429 without Retry-After header, wait this long before retrying
+var defaultRetryAfter = 1 * time.Second
+
+// errRequestTimeout is returned when Spotify API does not respond in time. The request is cancelled then, but Spotify
+// may have applied it already, so the outcome of a timed out change is unknown.
+var errRequestTimeout = errors.New("timeout occurred")
+
 func getFromSpotify(apiURL string, path string, accessToken string) (body []byte, err error) {
-	log.Tracef(" > getting from Spotify API [%s]: %s", apiURL, path)
-	req, err := http.NewRequest("GET", apiURL+path, nil)
+	cacheKey, cached, fresh := reqClient.responseCache.lookup(apiURL+path, accessToken)
+	if fresh {
+		log.Tracef(" > serving cached Spotify API response [%s]: %s", apiURL, path)
+		return cached.Body, nil
+	}
+	etag := ""
+	if cached != nil {
+		etag = cached.ETag
+	}
+
+	resp, err := requestSpotify("GET", apiURL, path, accessToken, etag, nil)
 	if err != nil {
-		log.Infof(" >>> error getting spotify response. details: %s", err.Error())
 		return nil, err
 	}
 
+	switch {
+	case resp.statusCode == http.StatusNotModified && cached != nil:
+		log.Tracef(" > Spotify API response not modified [%s]: %s", apiURL, path)
+		reqClient.responseCache.revalidated(cacheKey, apiURL+path, cached)
+		return cached.Body, nil
+	case resp.statusCode == http.StatusOK:
+		reqClient.responseCache.store(cacheKey, apiURL+path, resp.etag, resp.body)
+	}
+	return resp.body, nil
+}
+
+// sendToSpotify sends a request changing user's data on Spotify (PUT, POST, DELETE), with JSON encoded reqBody.
+// Responses are never cached.
+func sendToSpotify(method string, apiURL string, path string, accessToken string, reqBody interface{}) (body []byte, err error) {
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := requestSpotify(method, apiURL, path, accessToken, "", jsonBody)
+	if err != nil {
+		return nil, err
+	}
+	return resp.body, nil
+}
+
+// requestSpotify sends the request to Spotify API, refreshing the access token when needed
+func requestSpotify(method string, apiURL string, path string, accessToken string, etag string, reqBody []byte) (resp spotifyResponse, err error) {
+	resp, err = requestSpotifyRateLimited(method, apiURL, path, accessToken, etag, reqBody)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.statusCode == http.StatusUnauthorized && reqClient.tokenRefresher != nil {
+		// access token expired (or got revoked) - refresh it and replay the request once
+		log.Debugf(" > got 401 from Spotify API [%s], will try to refresh access token", path)
+		newAccessToken, refreshErr := reqClient.tokenRefresher.RefreshAccessToken(accessToken)
+		if refreshErr != nil {
+			log.Warnf(" >>> failed to refresh access token: %s", refreshErr.Error())
+			return resp, nil
+		}
+
+		return requestSpotifyRateLimited(method, apiURL, path, newAccessToken, etag, reqBody)
+	}
+	return resp, nil
+}
+
+type spotifyResponse struct {
+	body       []byte
+	statusCode int
+	etag       string
+	retryAfter time.Duration
+}
+
+// requestSpotifyRateLimited waits for the shared rate limiter before each request, and retries
+// the requests rejected with 429 (Too Many Requests) after the time Spotify API asks for
+func requestSpotifyRateLimited(method string, apiURL string, path string, accessToken string, etag string, reqBody []byte) (resp spotifyResponse, err error) {
+	for attempt := 0; ; attempt++ {
+		if reqClient.rateLimiter != nil {
+			reqClient.rateLimiter.Wait()
+		}
+		resp, err = doRequestSpotify(method, apiURL, path, accessToken, etag, reqBody)
+		if err != nil || resp.statusCode != http.StatusTooManyRequests || attempt >= reqClient.maxRateLimitRetries {
+			return resp, err
+		}
+
+		log.Debugf(" > rate limited by Spotify API [%s], will retry after [%v]", path, resp.retryAfter)
+		if reqClient.rateLimiter != nil {
+			reqClient.rateLimiter.BlockFor(resp.retryAfter)
+		} else {
+			time.Sleep(resp.retryAfter)
+		}
+	}
+}
+
+func doRequestSpotify(method string, apiURL string, path string, accessToken string, etag string, reqBody []byte) (resp spotifyResponse, err error) {
+	log.Tracef(" > %s Spotify API [%s]: %s", method, apiURL, path)
+	var bodyReader io.Reader
+	if reqBody != nil {
+		bodyReader = bytes.NewReader(reqBody)
+	}
+	// the request is cancelled once this call returns, so a timed out request never reaches Spotify API later
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, apiURL+path, bodyReader)
+	if err != nil {
+		log.Infof(" >>> error getting spotify response. details: %s", err.Error())
+		return spotifyResponse{}, err
+	}
+
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Authorization", "Bearer "+accessToken)
+	if len(etag) > 0 {
+		req.Header.Add("If-None-Match", etag)
+	}
 
 	// complicating this function on purpose to demonstrate the usage of channels and goroutines
 	// through implementing a request timeout mechanism
 	timeoutChan := time.After(time.Duration(reqClient.requestTimeoutSeconds) * time.Second)
-	respChannel := make(chan []byte)
-	errChannel := make(chan error)
+	respChannel := make(chan spotifyResponse, 1)
+	errChannel := make(chan error, 1)
 
+	// the goroutine may outlive this call after a timeout, so it must not read reqClient, which can be replaced meanwhile
+	client := reqClient.httpClient
 	go func() {
-		resp, reqErr := reqClient.httpClient.Do(req)
+		httpResp, reqErr := client.Do(req)
 		if reqErr != nil {
 			errChannel <- reqErr
 			return
 		}
-		defer resp.Body.Close()
+		defer httpResp.Body.Close()
 
-		body, reqErr = ioutil.ReadAll(resp.Body)
+		respBody, reqErr := ioutil.ReadAll(httpResp.Body)
 		if reqErr != nil {
 			errChannel <- reqErr
 			return
 		}
-		respChannel <- body
+		respChannel <- spotifyResponse{
+			body:       respBody,
+			statusCode: httpResp.StatusCode,
+			etag:       httpResp.Header.Get("ETag"),
+			retryAfter: getRetryAfter(httpResp.Header),
+		}
 	}()
 
 	select {
 	case <-timeoutChan:
-		return nil, errors.New("timeout occurred")
-	case body = <-respChannel:
-		return body, nil
+		return spotifyResponse{}, errRequestTimeout
+	case resp = <-respChannel:
+		return resp, nil
 	case err = <-errChannel:
-		return nil, err
+		return spotifyResponse{}, err
 	}
 }
 
+func getRetryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return defaultRetryAfter
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// sendErrorStatus is the status of errors sending changes to Spotify API: 504 (Gateway Timeout) for timed out requests,
+// since their outcome is unknown, otherwise 500
+func sendErrorStatus(err error) int {
+	if errors.Is(err, errRequestTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
 func getAPIError(body []byte) (spErr models.SpAPIError, isError bool) {
 	err := json.Unmarshal(body, &spErr)
 	if err == nil && len(spErr.Error.Message) > 0 && spErr.Error.Status > 0 {
@@ -78,3 +223,17 @@ func getAPIError(body []byte) (spErr models.SpAPIError, isError bool) {
 	}
 	return models.SpAPIError{}, false
 }
+
+// uniqueIDs returns the IDs without duplicates and empty IDs (e.g. of local tracks), in their original order
+func uniqueIDs(ids []string) []string {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] || len(id) == 0 {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io/ioutil"
 	"net/http"
@@ -12,7 +13,10 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-type httpClientMock struct{}
+// httpClientMock responds to the timeout path after the delay, which must be longer than the request timeout
+type httpClientMock struct {
+	delay time.Duration
+}
 
 var testURL = "test-url"
 var testPathOK = "/test/path/ok"
@@ -25,7 +29,7 @@ func (c httpClientMock) Do(req *http.Request) (*http.Response, error) {
 	log.Println(" > http client mock, Do(req) path: " + req.URL.Path)
 	switch req.URL.Path {
 	case testURL + testPathTimeout:
-		time.Sleep(time.Duration(reqClient.requestTimeoutSeconds+5) * time.Second)
+		time.Sleep(c.delay)
 		return &http.Response{
 			Body:       ioutil.NopCloser(bytes.NewBufferString("OK")),
 			StatusCode: 200,
@@ -44,7 +48,7 @@ func (c httpClientMock) Do(req *http.Request) (*http.Response, error) {
 
 func TestGetFromSpotify(t *testing.T) {
 	log.Println(" > TestGetFromSpotify: starting ...")
-	reqClient = requestClient{httpClient: &httpClientMock{}, requestTimeoutSeconds: 1}
+	reqClient = requestClient{httpClient: &httpClientMock{delay: 6 * time.Second}, requestTimeoutSeconds: 1}
 
 	body, err := getFromSpotify(testURL, testPathOK, accessToken)
 	assert.NoError(t, err)
@@ -67,6 +71,32 @@ func TestGetFromSpotify(t *testing.T) {
 	log.Println(" > TestGetFromSpotify: tests finished!")
 }
 
+// cancelledHTTPClientMock never responds, and reports when the request is cancelled
+type cancelledHTTPClientMock struct {
+	cancelled chan error
+}
+
+func (c *cancelledHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	c.cancelled <- req.Context().Err()
+	return nil, req.Context().Err()
+}
+
+func TestSendToSpotifyTimeout(t *testing.T) {
+	client := &cancelledHTTPClientMock{cancelled: make(chan error, 1)}
+	reqClient = requestClient{httpClient: client, requestTimeoutSeconds: 1}
+
+	_, err := sendToSpotify("POST", testURL, "/test/path/change", accessToken, nil)
+	assert.Equal(t, errRequestTimeout, err)
+	assert.Equal(t, http.StatusGatewayTimeout, sendErrorStatus(err))
+	select {
+	case cancelErr := <-client.cancelled:
+		assert.Equal(t, context.Canceled, cancelErr)
+	case <-time.After(time.Second):
+		t.Error("timed out request must be cancelled")
+	}
+}
+
 func TestGetAPIError(t *testing.T) {
 	log.Println(" > TestGetAPIError: starting ...")
 
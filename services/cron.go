@@ -0,0 +1,166 @@
+package services
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// cron expressions of the preset schedule frequencies
+var cronPresets = map[string]string{
+	models.ScheduleHourly: "0 * * * *",
+	models.ScheduleDaily:  "0 0 * * *",
+	models.ScheduleWeekly: "0 0 * * 0",
+}
+
+// cronSearchLimit bounds the search for the next time matched, e.g. "0 0 30 2 *" matches no time at all
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronField is a set of the values matched by a field of a cron expression, a bit per value
+type cronField uint64
+
+func (f cronField) has(value int) bool {
+	return f&(1<<uint(value)) != 0
+}
+
+// cronSchedule is a parsed cron expression of 5 fields: minute, hour, day of month, month and day of week. Fields
+// are lists of values, ranges and steps, e.g. "0,30 8-18/2 * * 1-5". As in cron, with both day of month and day of
+// week restricted, a day matching either of them is matched.
+type cronSchedule struct {
+	minutes     cronField
+	hours       cronField
+	daysOfMonth cronField
+	months      cronField
+	daysOfWeek  cronField
+	// anyDayOfMonth and anyDayOfWeek tell if the day fields are *, i.e. not restricted
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression [%s] must have 5 fields: minute, hour, day of month, month, day of week", expr)
+	}
+	bounds := []struct {
+		name     string
+		min, max int
+	}{
+		{"minute", 0, 59},
+		{"hour", 0, 23},
+		{"day of month", 1, 31},
+		{"month", 1, 12},
+		// both 0 and 7 are sunday
+		{"day of week", 0, 7},
+	}
+	parsed := make([]cronField, len(fields))
+	for i, field := range fields {
+		value, err := parseCronField(field, bounds[i].min, bounds[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s [%s]: %s", bounds[i].name, field, err.Error())
+		}
+		parsed[i] = value
+	}
+	if parsed[4].has(7) {
+		parsed[4] |= 1
+	}
+	return &cronSchedule{
+		minutes:       parsed[0],
+		hours:         parsed[1],
+		daysOfMonth:   parsed[2],
+		months:        parsed[3],
+		daysOfWeek:    parsed[4],
+		anyDayOfMonth: strings.HasPrefix(fields[2], "*"),
+		anyDayOfWeek:  strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField parses a comma separated list of: *, a value, or a range (a-b), each optionally with a step (/n)
+func parseCronField(field string, min int, max int) (cronField, error) {
+	var values cronField
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step [%s]", part[i+1:])
+			}
+		}
+
+		from, to := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value [%s]", bounds[0])
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value [%s]", bounds[1])
+				}
+			} else if strings.Contains(part, "/") {
+				// a value with a step, e.g. 5/15, is the range from the value to the maximum
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("[%s] out of range %d-%d", rangePart, min, max)
+		}
+		for v := from; v <= to; v += step {
+			values |= 1 << uint(v)
+		}
+	}
+	return values, nil
+}
+
+// next returns the first time matched after given time, at the start of a minute, in the location of given time.
+// Found is false if no time is matched in the next 5 years.
+func (c *cronSchedule) next(after time.Time) (next time.Time, found bool) {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(cronSearchLimit)
+	for t.Before(limit) {
+		if !c.months.has(int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.hours.has(t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.minutes.has(t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// runsPerDay returns how many times a day the schedule runs, on the days it runs at all
+func (c *cronSchedule) runsPerDay() int {
+	return bits.OnesCount64(uint64(c.minutes)) * bits.OnesCount64(uint64(c.hours))
+}
+
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := c.daysOfMonth.has(t.Day())
+	dayOfWeek := c.daysOfWeek.has(int(t.Weekday()))
+	switch {
+	case c.anyDayOfMonth && c.anyDayOfWeek:
+		return true
+	case c.anyDayOfMonth:
+		return dayOfWeek
+	case c.anyDayOfWeek:
+		return dayOfMonth
+	}
+	return dayOfMonth || dayOfWeek
+}
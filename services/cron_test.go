@@ -0,0 +1,69 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+func TestCronNext(t *testing.T) {
+	// a wednesday
+	after := time.Date(2020, 1, 15, 10, 20, 30, 0, time.UTC)
+	cases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{expr: cronPresets[models.ScheduleHourly], expected: time.Date(2020, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{expr: cronPresets[models.ScheduleDaily], expected: time.Date(2020, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{expr: cronPresets[models.ScheduleWeekly], expected: time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{expr: "* * * * *", expected: time.Date(2020, 1, 15, 10, 21, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", expected: time.Date(2020, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{expr: "5/20 * * * *", expected: time.Date(2020, 1, 15, 10, 25, 0, 0, time.UTC)},
+		{expr: "0,30 8-18/2 * * 1-5", expected: time.Date(2020, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{expr: "0 9 * * 6,7", expected: time.Date(2020, 1, 18, 9, 0, 0, 0, time.UTC)},
+		{expr: "0 3 1 * *", expected: time.Date(2020, 2, 1, 3, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", expected: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "30 23 31 12 *", expected: time.Date(2020, 12, 31, 23, 30, 0, 0, time.UTC)},
+		// with both days restricted, either of them is matched: the 20th, or a friday
+		{expr: "0 0 20 * 5", expected: time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		cron, err := parseCron(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		next, found := cron.next(after)
+		if assert.True(t, found, c.expr) {
+			assert.Equal(t, c.expected, next, c.expr)
+		}
+	}
+
+	cron, _ := parseCron("0 0 30 2 *")
+	_, found := cron.next(after)
+	assert.False(t, found, "there is no 30th of february")
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"0 0 * JAN *",
+	}
+	for _, expr := range invalid {
+		_, err := parseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,541 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/config"
+	"github.com/2beens/spotilizer/models"
+)
+
+// Spotify API accepts at most 50 track IDs in a single tracks lookup, and in a single save tracks request
+const tracksBatchSize = 50
+
+// LibraryService changes user's Spotify library, e.g. to restore the tracks removed by mistake, or playlists
+type LibraryService struct {
+	srvPlaylists              UserPlaylistService
+	spotifyAPIURL             string
+	urlCurrentUserSavedTracks string
+	urlTracks                 string
+	urlPlaylists              string
+	urlUsers                  string
+}
+
+func NewLibraryService(srvPlaylists UserPlaylistService) *LibraryService {
+	return &LibraryService{
+		srvPlaylists:              srvPlaylists,
+		spotifyAPIURL:             config.Conf.SpotifyAPIURL,
+		urlCurrentUserSavedTracks: config.Conf.URLCurrentUserSavedTracks,
+		urlTracks:                 config.Conf.URLTracks,
+		urlPlaylists:              config.Conf.URLPlaylists,
+		urlUsers:                  config.Conf.URLUsers,
+	}
+}
+
+// PlanRestoreFavTracks plans saving given tracks back to user's saved tracks, in batches. Tracks no longer available
+// in the market (user's country, or any market if empty) are skipped.
+func (ls *LibraryService) PlanRestoreFavTracks(accessToken string, market string, tracks []models.SpTrack) (*models.WriteBackPlan, *models.SpAPIError) {
+	plan := &models.WriteBackPlan{
+		Kind:          models.WriteBackRestoreFavTracks,
+		Operations:    []models.WriteBackOperation{},
+		SkippedTracks: []models.PlanTrack{},
+	}
+	var restored []models.PlanTrack
+	for start := 0; start < len(tracks); start += tracksBatchSize {
+		end := start + tracksBatchSize
+		if end > len(tracks) {
+			end = len(tracks)
+		}
+		batchRestored, apiErr := ls.checkTracksAvailable(accessToken, market, tracks[start:end], plan)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		restored = append(restored, batchRestored...)
+	}
+
+	for start := 0; start < len(restored); start += tracksBatchSize {
+		end := start + tracksBatchSize
+		if end > len(restored) {
+			end = len(restored)
+		}
+		op := models.WriteBackOperation{Type: models.WriteBackOpSaveTracks, Tracks: restored[start:end], Before: []string{}}
+		for _, t := range op.Tracks {
+			op.After = append(op.After, t.URI)
+		}
+		plan.Operations = append(plan.Operations, op)
+	}
+	return plan, nil
+}
+
+// checkTracksAvailable looks up the tracks in Spotify catalog, returning the ones which can be restored, while the
+// others are added to the plan skipped tracks
+func (ls *LibraryService) checkTracksAvailable(accessToken string, market string, tracks []models.SpTrack, plan *models.WriteBackPlan) ([]models.PlanTrack, *models.SpAPIError) {
+	var lookupIDs []string
+	var lookupTracks []models.SpTrack
+	for _, t := range tracks {
+		// local files are not in Spotify catalog, so they cannot be saved through the API
+		if t.IsLocal || len(t.ID) == 0 {
+			plan.SkippedTracks = append(plan.SkippedTracks, models.PlanTrack{URI: t.URI, Name: t.Name, Reason: models.SkipReasonLocal})
+			continue
+		}
+		lookupIDs = append(lookupIDs, t.ID)
+		lookupTracks = append(lookupTracks, t)
+	}
+	if len(lookupIDs) == 0 {
+		return nil, nil
+	}
+
+	catalogTracks, apiErr := ls.downloadTracks(accessToken, market, lookupIDs)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	var restored []models.PlanTrack
+	for i, t := range lookupTracks {
+		var catalogTrack *models.SpTrack
+		if i < len(catalogTracks) {
+			catalogTrack = catalogTracks[i]
+		}
+		// tracks removed from Spotify catalog come as null, while the ones not licensed in the market are not playable
+		if catalogTrack == nil || (catalogTrack.IsPlayable != nil && !*catalogTrack.IsPlayable) {
+			plan.SkippedTracks = append(plan.SkippedTracks, models.PlanTrack{URI: savedTrackURI(t.ID), Name: t.Name, Reason: models.SkipReasonUnavailable})
+			continue
+		}
+		track := models.PlanTrack{URI: savedTrackURI(catalogTrack.ID), Name: t.Name}
+		if catalogTrack.ID != t.ID {
+			track.RelinkedFrom = savedTrackURI(t.ID)
+		}
+		restored = append(restored, track)
+	}
+	return restored, nil
+}
+
+// downloadTracks more info: https://developer.spotify.com/documentation/web-api/reference/tracks/get-several-tracks/
+func (ls *LibraryService) downloadTracks(accessToken string, market string, trackIDs []string) ([]*models.SpTrack, *models.SpAPIError) {
+	path := fmt.Sprintf("%s?ids=%s", ls.urlTracks, strings.Join(trackIDs, ","))
+	if len(market) > 0 {
+		path = fmt.Sprintf("%s&market=%s", path, market)
+	}
+	body, getErr := getFromSpotify(ls.spotifyAPIURL, path, accessToken)
+	if getErr != nil {
+		errMsg := fmt.Sprintf(" >>> error getting tracks. details: %s", getErr.Error())
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+	if apiErr, isError := getAPIError(body); isError {
+		log.Printf(" >>> API getting tracks error: status [%d] -> [%s]\n", apiErr.Error.Status, apiErr.Error.Message)
+		return nil, &apiErr
+	}
+
+	var response models.SpGetTracksResp
+	if unmarshalErr := json.Unmarshal(body, &response); unmarshalErr != nil {
+		errMsg := fmt.Sprintf(" >>> error occurred while unmarshaling tracks response: %s", unmarshalErr.Error())
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+	return response.Tracks, nil
+}
+
+// changeSavedTracks saves (PUT) or removes (DELETE) the tracks, more info:
+// https://developer.spotify.com/documentation/web-api/reference/library/save-tracks-user/
+// https://developer.spotify.com/documentation/web-api/reference/library/remove-tracks-user/
+func (ls *LibraryService) changeSavedTracks(method string, accessToken string, tracks []models.PlanTrack) *models.SpAPIError {
+	reqBody := struct {
+		IDs []string `json:"ids"`
+	}{}
+	for _, t := range tracks {
+		reqBody.IDs = append(reqBody.IDs, strings.TrimPrefix(t.URI, "spotify:track:"))
+	}
+	body, sendErr := sendToSpotify(method, ls.spotifyAPIURL, ls.urlCurrentUserSavedTracks, accessToken, reqBody)
+	if sendErr != nil {
+		errMsg := fmt.Sprintf(" >>> error changing saved tracks. details: %s", sendErr.Error())
+		return &models.SpAPIError{Error: models.SpError{Status: sendErrorStatus(sendErr), Message: errMsg}}
+	}
+	if apiErr, isError := getAPIError(body); isError {
+		log.Printf(" >>> API changing saved tracks error: status [%d] -> [%s]\n", apiErr.Error.Status, apiErr.Error.Message)
+		return &apiErr
+	}
+	return nil
+}
+
+// savedTracksResults reports the outcome of each track of a save tracks operation run. Tracks are saved or removed
+// in a single request, so they all share its outcome.
+func savedTracksResults(op *models.WriteBackOperation, undo bool, runErr *models.SpAPIError) []models.TrackRestoreResult {
+	status := models.RestoreStatusRestored
+	if undo {
+		status = models.RestoreStatusRemoved
+	}
+	results := []models.TrackRestoreResult{}
+	for _, t := range op.Tracks {
+		result := models.TrackRestoreResult{URI: t.URI, Name: t.Name, Status: status, RelinkedFrom: t.RelinkedFrom}
+		if runErr != nil {
+			result.Status = models.RestoreStatusFailed
+			if op.Status == models.WriteBackStatusUnknown {
+				result.Status = models.RestoreStatusUnknown
+			}
+			result.Error = runErr.Error.Message
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// PlanPlaylistRecreate plans recreating the playlist of the snapshot as a new playlist
+func (ls *LibraryService) PlanPlaylistRecreate(snapshot models.PlaylistSnapshot) *models.WriteBackPlan {
+	return planPlaylistRecreate(snapshot)
+}
+
+// PlanPlaylistRollback plans rolling the playlist back to the snapshot, by comparing the snapshot to the current tracks
+func (ls *LibraryService) PlanPlaylistRollback(accessToken string, snapshot models.PlaylistSnapshot) (*models.WriteBackPlan, *models.SpAPIError) {
+	playlist, apiErr := ls.downloadPlaylist(accessToken, snapshot.Playlist.ID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	current, apiErr := ls.srvPlaylists.DownloadPlaylistTracks(accessToken, playlist.Tracks.Href, playlist.Tracks.Total)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	plan := planPlaylistRollback(current, snapshot)
+	plan.PlaylistID = playlist.ID
+	plan.SnapshotID = playlist.SnapshotID
+	return plan, nil
+}
+
+// DownloadPlaylists downloads user's current playlists given by IDs, in the same order, along with their tracks. All
+// user's playlists are downloaded when no IDs are given.
+func (ls *LibraryService) DownloadPlaylists(accessToken string, ids []string) ([]models.PlaylistSnapshot, *models.SpAPIError) {
+	current, apiErr := ls.srvPlaylists.DownloadCurrentUserPlaylists(accessToken)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	playlists := current
+	if len(ids) > 0 {
+		byID := make(map[string]models.SpPlaylist)
+		for _, pl := range current {
+			byID[pl.ID] = pl
+		}
+		playlists = []models.SpPlaylist{}
+		for _, id := range ids {
+			pl, found := byID[id]
+			if !found {
+				return nil, &models.SpAPIError{Error: models.SpError{Status: 404, Message: fmt.Sprintf("Playlist [%s] not found", id)}}
+			}
+			playlists = append(playlists, pl)
+		}
+	}
+
+	var snapshots []models.PlaylistSnapshot
+	for _, result := range ls.srvPlaylists.DownloadPlaylistsTracks(accessToken, playlists) {
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		snapshots = append(snapshots, models.PlaylistSnapshot{Playlist: result.Playlist, Tracks: result.Tracks})
+	}
+	return snapshots, nil
+}
+
+// PlanPlaylistDedup plans removing copies of duplicated tracks from the current playlist
+func (ls *LibraryService) PlanPlaylistDedup(accessToken string, playlistID string) (*models.WriteBackPlan, *models.SpAPIError) {
+	playlist, apiErr := ls.downloadPlaylist(accessToken, playlistID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	current, apiErr := ls.srvPlaylists.DownloadPlaylistTracks(accessToken, playlist.Tracks.Href, playlist.Tracks.Total)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	plan := planPlaylistDedup(*playlist, current)
+	plan.PlaylistID = playlist.ID
+	plan.SnapshotID = playlist.SnapshotID
+	return plan, nil
+}
+
+// PlanPlaylistsMerge plans merging the playlists into a new playlist with given name
+func (ls *LibraryService) PlanPlaylistsMerge(name string, playlists []models.PlaylistSnapshot, keepDuplicates bool) *models.WriteBackPlan {
+	return planPlaylistsMerge(name, playlists, keepDuplicates)
+}
+
+// WriteBackOperators execute and undo the library and playlist changes of write-back plans, by operation type.
+// Saving tracks which are saved already, or removing the removed ones, changes nothing, so save tracks operations of
+// unknown outcome are run again, while playlist operations are verified first.
+func (ls *LibraryService) WriteBackOperators() map[string]WriteBackOperator {
+	return map[string]WriteBackOperator{
+		models.WriteBackOpSaveTracks: {
+			Execute: func(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+				return ls.changeSavedTracks("PUT", accessToken, op.Tracks)
+			},
+			Undo: func(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+				return ls.changeSavedTracks("DELETE", accessToken, op.Tracks)
+			},
+			TrackResults: savedTracksResults,
+		},
+		models.PlaylistOpCreate:  {Execute: ls.createPlaylist, Undo: ls.unfollowPlaylist, Verify: ls.verifyPlaylistCreated},
+		models.PlaylistOpAdd:     {Execute: ls.addPlaylistTracks, Undo: ls.undoAddPlaylistTracks, Verify: ls.verifyPlaylistTracks},
+		models.PlaylistOpRemove:  {Execute: ls.removePlaylistTracks, Undo: ls.undoRemovePlaylistTracks, Verify: ls.verifyPlaylistTracks},
+		models.PlaylistOpReorder: {Execute: ls.reorderPlaylistTracks, Undo: ls.undoReorderPlaylistTracks, Verify: ls.verifyPlaylistTracks},
+	}
+}
+
+// verifyPlaylistCreated looks up the playlist created by the operation among user's playlists, by its name. A created
+// playlist is still empty, as the next operations are not run yet. Once found, the next operations change it.
+func (ls *LibraryService) verifyPlaylistCreated(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) (bool, *models.SpAPIError) {
+	playlists, apiErr := ls.srvPlaylists.DownloadCurrentUserPlaylists(accessToken)
+	if apiErr != nil {
+		return false, apiErr
+	}
+	var created []models.SpPlaylist
+	for _, pl := range playlists {
+		if pl.Name == op.Name && pl.Owner.ID == plan.Username && pl.Tracks.Total == 0 {
+			created = append(created, pl)
+		}
+	}
+	switch len(created) {
+	case 0:
+		plan.PlaylistID = ""
+		plan.SnapshotID = ""
+		return false, nil
+	case 1:
+		plan.PlaylistID = created[0].ID
+		plan.SnapshotID = created[0].SnapshotID
+		return true, nil
+	}
+	errMsg := fmt.Sprintf("Found %d empty playlists named [%s], cannot tell which one is created by the plan", len(created), op.Name)
+	return false, &models.SpAPIError{Error: models.SpError{Status: 409, Message: errMsg}}
+}
+
+// verifyPlaylistTracks compares the current playlist tracks to the ones after the operation, and before it, taking the
+// current playlist version for the next operations
+func (ls *LibraryService) verifyPlaylistTracks(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) (bool, *models.SpAPIError) {
+	playlist, apiErr := ls.downloadPlaylist(accessToken, plan.PlaylistID)
+	if apiErr != nil {
+		return false, apiErr
+	}
+	current, apiErr := ls.srvPlaylists.DownloadPlaylistTracks(accessToken, playlist.Tracks.Href, playlist.Tracks.Total)
+	if apiErr != nil {
+		return false, apiErr
+	}
+	currentURIs := []string{}
+	for _, t := range current {
+		currentURIs = append(currentURIs, trackURI(t))
+	}
+
+	plan.SnapshotID = playlist.SnapshotID
+	switch {
+	case equalURIs(currentURIs, op.After):
+		return true, nil
+	case equalURIs(currentURIs, op.Before):
+		return false, nil
+	}
+	errMsg := fmt.Sprintf("Playlist [%s] is changed meanwhile, cannot tell if the operation is applied", playlist.Name)
+	return false, &models.SpAPIError{Error: models.SpError{Status: 409, Message: errMsg}}
+}
+
+// createPlaylist more info: https://developer.spotify.com/documentation/web-api/reference/playlists/create-playlist/
+func (ls *LibraryService) createPlaylist(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+	reqBody := struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Public      bool   `json:"public"`
+	}{op.Name, op.Description, op.Public}
+	var playlist models.SpPlaylist
+	path := fmt.Sprintf("%s/%s/playlists", ls.urlUsers, plan.Username)
+	if err := ls.changePlaylist("POST", path, accessToken, "creating playlist", reqBody, &playlist); err != nil {
+		return err
+	}
+	plan.PlaylistID = playlist.ID
+	plan.SnapshotID = playlist.SnapshotID
+	return nil
+}
+
+// unfollowPlaylist is the way of deleting a playlist, more info:
+// https://developer.spotify.com/documentation/web-api/reference/follow/unfollow-playlist/
+func (ls *LibraryService) unfollowPlaylist(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+	path := fmt.Sprintf("%s/%s/followers", ls.urlPlaylists, plan.PlaylistID)
+	if err := ls.changePlaylist("DELETE", path, accessToken, "unfollowing playlist", nil, nil); err != nil {
+		return err
+	}
+	plan.SnapshotID = ""
+	return nil
+}
+
+// addPlaylistTracks more info: https://developer.spotify.com/documentation/web-api/reference/playlists/add-tracks-to-playlist/
+func (ls *LibraryService) addPlaylistTracks(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+	return ls.insertPlaylistTracks(accessToken, plan, op.Tracks)
+}
+
+func (ls *LibraryService) undoAddPlaylistTracks(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+	// added tracks are next to each other, starting with the position of the first one
+	var added []models.PlanTrack
+	for i, t := range op.Tracks {
+		added = append(added, models.PlanTrack{URI: t.URI, Name: t.Name, Position: op.Tracks[0].Position + i})
+	}
+	return ls.deletePlaylistTracks(accessToken, plan, added)
+}
+
+// removePlaylistTracks more info: https://developer.spotify.com/documentation/web-api/reference/playlists/remove-tracks-playlist/
+func (ls *LibraryService) removePlaylistTracks(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+	return ls.deletePlaylistTracks(accessToken, plan, op.Tracks)
+}
+
+func (ls *LibraryService) undoRemovePlaylistTracks(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+	// removed tracks are added back from the first one, next to each other ones together, so each one lands at its
+	// position from before the removal
+	positions := make([]models.PlanTrack, len(op.Tracks))
+	copy(positions, op.Tracks)
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Position < positions[j].Position
+	})
+	for start := 0; start < len(positions); {
+		end := start + 1
+		for end < len(positions) && positions[end].Position == positions[end-1].Position+1 {
+			end++
+		}
+		if err := ls.insertPlaylistTracks(accessToken, plan, positions[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// reorderPlaylistTracks more info: https://developer.spotify.com/documentation/web-api/reference/playlists/reorder-playlists-tracks/
+func (ls *LibraryService) reorderPlaylistTracks(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+	return ls.movePlaylistTrack(accessToken, plan, op.Tracks[0].Position, *op.InsertBefore)
+}
+
+func (ls *LibraryService) undoReorderPlaylistTracks(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+	from, insertBefore := op.Tracks[0].Position, *op.InsertBefore
+	// the track is moved back from where it landed, to its position before the move
+	movedTo := insertBefore
+	if insertBefore > from {
+		movedTo = insertBefore - 1
+	}
+	insertBackBefore := from
+	if from > movedTo {
+		insertBackBefore = from + 1
+	}
+	return ls.movePlaylistTrack(accessToken, plan, movedTo, insertBackBefore)
+}
+
+func (ls *LibraryService) insertPlaylistTracks(accessToken string, plan *models.WriteBackPlan, tracks []models.PlanTrack) *models.SpAPIError {
+	reqBody := struct {
+		URIs     []string `json:"uris"`
+		Position int      `json:"position"`
+	}{Position: tracks[0].Position}
+	for _, t := range tracks {
+		reqBody.URIs = append(reqBody.URIs, t.URI)
+	}
+	var resp models.SpPlaylistSnapshotResp
+	if err := ls.changePlaylist("POST", ls.playlistTracksPath(plan.PlaylistID), accessToken, "adding playlist tracks", reqBody, &resp); err != nil {
+		return err
+	}
+	plan.SnapshotID = resp.SnapshotID
+	return nil
+}
+
+func (ls *LibraryService) deletePlaylistTracks(accessToken string, plan *models.WriteBackPlan, tracks []models.PlanTrack) *models.SpAPIError {
+	type removedTrack struct {
+		URI       string `json:"uri"`
+		Positions []int  `json:"positions"`
+	}
+	reqBody := struct {
+		Tracks     []removedTrack `json:"tracks"`
+		SnapshotID string         `json:"snapshot_id"`
+	}{SnapshotID: plan.SnapshotID}
+	trackIndexes := make(map[string]int)
+	for _, t := range tracks {
+		i, found := trackIndexes[t.URI]
+		if !found {
+			i = len(reqBody.Tracks)
+			trackIndexes[t.URI] = i
+			reqBody.Tracks = append(reqBody.Tracks, removedTrack{URI: t.URI})
+		}
+		reqBody.Tracks[i].Positions = append(reqBody.Tracks[i].Positions, t.Position)
+	}
+	var resp models.SpPlaylistSnapshotResp
+	if err := ls.changePlaylist("DELETE", ls.playlistTracksPath(plan.PlaylistID), accessToken, "removing playlist tracks", reqBody, &resp); err != nil {
+		return err
+	}
+	plan.SnapshotID = resp.SnapshotID
+	return nil
+}
+
+func (ls *LibraryService) movePlaylistTrack(accessToken string, plan *models.WriteBackPlan, from int, insertBefore int) *models.SpAPIError {
+	reqBody := struct {
+		RangeStart   int    `json:"range_start"`
+		InsertBefore int    `json:"insert_before"`
+		SnapshotID   string `json:"snapshot_id"`
+	}{from, insertBefore, plan.SnapshotID}
+	var resp models.SpPlaylistSnapshotResp
+	if err := ls.changePlaylist("PUT", ls.playlistTracksPath(plan.PlaylistID), accessToken, "reordering playlist tracks", reqBody, &resp); err != nil {
+		return err
+	}
+	plan.SnapshotID = resp.SnapshotID
+	return nil
+}
+
+func (ls *LibraryService) playlistTracksPath(playlistID string) string {
+	return fmt.Sprintf("%s/%s/tracks", ls.urlPlaylists, playlistID)
+}
+
+// downloadPlaylist more info: https://developer.spotify.com/documentation/web-api/reference/playlists/get-playlist/
+func (ls *LibraryService) downloadPlaylist(accessToken string, playlistID string) (*models.SpPlaylist, *models.SpAPIError) {
+	body, getErr := getFromSpotify(ls.spotifyAPIURL, fmt.Sprintf("%s/%s", ls.urlPlaylists, playlistID), accessToken)
+	if getErr != nil {
+		errMsg := fmt.Sprintf(" >>> error getting playlist. details: %s", getErr.Error())
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+	if apiErr, isError := getAPIError(body); isError {
+		log.Printf(" >>> API getting playlist error: status [%d] -> [%s]\n", apiErr.Error.Status, apiErr.Error.Message)
+		return nil, &apiErr
+	}
+
+	var playlist models.SpPlaylist
+	if unmarshalErr := json.Unmarshal(body, &playlist); unmarshalErr != nil {
+		errMsg := fmt.Sprintf(" >>> error occurred while unmarshaling playlist response: %s", unmarshalErr.Error())
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+	return &playlist, nil
+}
+
+// changePlaylist sends a playlist change to Spotify API, and unmarshals the response into resp, unless resp is nil.
+// What is used in error messages.
+func (ls *LibraryService) changePlaylist(method string, path string, accessToken string, what string, reqBody interface{}, resp interface{}) *models.SpAPIError {
+	body, sendErr := sendToSpotify(method, ls.spotifyAPIURL, path, accessToken, reqBody)
+	if sendErr != nil {
+		errMsg := fmt.Sprintf(" >>> error %s. details: %s", what, sendErr.Error())
+		return &models.SpAPIError{Error: models.SpError{Status: sendErrorStatus(sendErr), Message: errMsg}}
+	}
+	if apiErr, isError := getAPIError(body); isError {
+		log.Printf(" >>> API %s error: status [%d] -> [%s]\n", what, apiErr.Error.Status, apiErr.Error.Message)
+		return &apiErr
+	}
+	if resp == nil {
+		return nil
+	}
+	if unmarshalErr := json.Unmarshal(body, resp); unmarshalErr != nil {
+		errMsg := fmt.Sprintf(" >>> error occurred while unmarshaling %s response: %s", what, unmarshalErr.Error())
+		return &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+	return nil
+}
+
+func equalURIs(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func savedTrackURI(trackID string) string {
+	return "spotify:track:" + trackID
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// libraryHTTPClientMock looks up catalog tracks, where "gone" tracks are removed from the catalog, "blocked" ones are
+// not playable, while "old" ones are relinked to their "new" version. Saving "failing" tracks fails, until fixed.
+type libraryHTTPClientMock struct {
+	lookups [][]string
+	saved   [][]string
+	removed [][]string
+	fixed   bool
+}
+
+func (c *libraryHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	var respBody string
+	switch req.Method {
+	case "GET":
+		ids := strings.Split(req.URL.Query().Get("ids"), ",")
+		c.lookups = append(c.lookups, ids)
+		var tracks []string
+		for _, id := range ids {
+			switch {
+			case strings.HasPrefix(id, "gone"):
+				tracks = append(tracks, "null")
+			case strings.HasPrefix(id, "blocked"):
+				tracks = append(tracks, fmt.Sprintf(`{"id": "%s", "is_playable": false}`, id))
+			case strings.HasPrefix(id, "old"):
+				tracks = append(tracks, fmt.Sprintf(`{"id": "new%s", "is_playable": true}`, strings.TrimPrefix(id, "old")))
+			default:
+				tracks = append(tracks, fmt.Sprintf(`{"id": "%s", "is_playable": true}`, id))
+			}
+		}
+		respBody = fmt.Sprintf(`{"tracks": [%s]}`, strings.Join(tracks, ", "))
+	case "PUT", "DELETE":
+		var reqBody struct {
+			IDs []string `json:"ids"`
+		}
+		json.NewDecoder(req.Body).Decode(&reqBody)
+		if req.Method == "DELETE" {
+			c.removed = append(c.removed, reqBody.IDs)
+			break
+		}
+		for _, id := range reqBody.IDs {
+			if strings.HasPrefix(id, "failing") && !c.fixed {
+				return &http.Response{
+					Body:       ioutil.NopCloser(bytes.NewBufferString(`{"error": {"status": 400, "message": "Invalid id"}}`)),
+					StatusCode: 400,
+				}, nil
+			}
+		}
+		c.saved = append(c.saved, reqBody.IDs)
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(respBody)),
+		StatusCode: 200,
+	}, nil
+}
+
+func TestPlanRestoreFavTracks(t *testing.T) {
+	client := &libraryHTTPClientMock{}
+	reqClient = requestClient{httpClient: client, requestTimeoutSeconds: 1}
+	ls := &LibraryService{spotifyAPIURL: "http://test", urlCurrentUserSavedTracks: "/me/tracks", urlTracks: "/tracks"}
+
+	tracks := []models.SpTrack{
+		{ID: "track-0", Name: "zero"},
+		{ID: "gone-0"},
+		{ID: "blocked-0"},
+		{ID: "local-0", URI: "spotify:local:local-0", IsLocal: true},
+		{ID: "old-0"},
+		{ID: "track-1"},
+	}
+	plan, apiErr := ls.PlanRestoreFavTracks("test-token", "DE", tracks)
+	if !assert.Nil(t, apiErr) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, models.WriteBackRestoreFavTracks, plan.Kind)
+	if assert.Equal(t, 1, len(plan.Operations)) {
+		assert.Equal(t, models.WriteBackOpSaveTracks, plan.Operations[0].Type)
+		assert.Equal(t, []models.PlanTrack{
+			{URI: "spotify:track:track-0", Name: "zero"},
+			{URI: "spotify:track:new-0", RelinkedFrom: "spotify:track:old-0"},
+			{URI: "spotify:track:track-1"},
+		}, plan.Operations[0].Tracks)
+		assert.Empty(t, plan.Operations[0].Before)
+		assert.Equal(t, []string{"spotify:track:track-0", "spotify:track:new-0", "spotify:track:track-1"}, plan.Operations[0].After)
+	}
+	assert.Equal(t, []models.PlanTrack{
+		{URI: "spotify:local:local-0", Reason: models.SkipReasonLocal},
+		{URI: "spotify:track:gone-0", Reason: models.SkipReasonUnavailable},
+		{URI: "spotify:track:blocked-0", Reason: models.SkipReasonUnavailable},
+	}, plan.SkippedTracks)
+
+	assert.Equal(t, [][]string{{"track-0", "gone-0", "blocked-0", "old-0", "track-1"}}, client.lookups, "local tracks must not be looked up")
+	assert.Empty(t, client.saved, "nothing must be saved while planning")
+}
+
+func TestRestoreFavTracksExecution(t *testing.T) {
+	client := &libraryHTTPClientMock{}
+	reqClient = requestClient{httpClient: client, requestTimeoutSeconds: 1}
+	ls := &LibraryService{spotifyAPIURL: "http://test", urlCurrentUserSavedTracks: "/me/tracks", urlTracks: "/tracks"}
+	wbs := NewWriteBackService(db.NewSpotifyDBTest(), ls.WriteBackOperators())
+
+	var tracks []models.SpTrack
+	for i := 0; i < 120; i++ {
+		id := fmt.Sprintf("track-%d", i)
+		// a failing track fails only the save request of its own batch
+		if i == 70 {
+			id = "failing-70"
+		}
+		if i == 1 {
+			id = "old-1"
+		}
+		tracks = append(tracks, models.SpTrack{ID: id})
+	}
+	plan, apiErr := ls.PlanRestoreFavTracks("test-token", "", tracks)
+	if !assert.Nil(t, apiErr) || !assert.Nil(t, wbs.CreatePlan("user", plan)) {
+		t.FailNow()
+	}
+	assert.Equal(t, 3, len(client.lookups))
+	if assert.Equal(t, 3, len(plan.Operations)) {
+		assert.Equal(t, 50, len(plan.Operations[0].Tracks))
+		assert.Equal(t, 50, len(plan.Operations[1].Tracks))
+		assert.Equal(t, 20, len(plan.Operations[2].Tracks))
+	}
+
+	// execution stops at the failing batch
+	plan, apiErr = wbs.Execute("test-token", "user", plan.ID)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, 400, apiErr.Error.Status)
+	}
+	assert.Equal(t, models.WriteBackStatusPartiallyExecuted, plan.Status)
+	assert.Equal(t, models.WriteBackStatusDone, plan.Operations[0].Status)
+	assert.Equal(t, models.WriteBackStatusFailed, plan.Operations[1].Status)
+	assert.Equal(t, "Invalid id", plan.Operations[1].Error)
+	assert.Equal(t, models.WriteBackStatusPending, plan.Operations[2].Status)
+	assert.Equal(t, 1, len(client.saved))
+
+	// each track of the run is reported, with its batch outcome
+	results := plan.Executions[0].Results
+	if assert.Equal(t, 2, len(results)) && assert.Equal(t, 50, len(results[0].Tracks)) && assert.Equal(t, 50, len(results[1].Tracks)) {
+		assert.Equal(t, models.TrackRestoreResult{URI: "spotify:track:new-1", Status: models.RestoreStatusRestored, RelinkedFrom: "spotify:track:old-1"}, results[0].Tracks[1])
+		assert.Equal(t, models.TrackRestoreResult{URI: "spotify:track:failing-70", Status: models.RestoreStatusFailed, Error: "Invalid id"}, results[1].Tracks[20])
+	}
+
+	// resuming starts with the failed batch
+	client.fixed = true
+	plan, apiErr = wbs.Execute("test-token", "user", plan.ID)
+	assert.Nil(t, apiErr)
+	assert.Equal(t, models.WriteBackStatusExecuted, plan.Status)
+	assert.Equal(t, 3, len(client.saved))
+	assert.Equal(t, "failing-70", client.saved[1][20])
+	if results := plan.Executions[1].Results; assert.Equal(t, 2, len(results)) {
+		assert.Equal(t, models.RestoreStatusRestored, results[0].Tracks[20].Status)
+		assert.Equal(t, 20, len(results[1].Tracks))
+	}
+
+	// undo removes the saved tracks again, last batch first
+	plan, apiErr = wbs.Undo("test-token", "user", plan.ID)
+	assert.Nil(t, apiErr)
+	assert.Equal(t, models.WriteBackStatusUndone, plan.Status)
+	if assert.Equal(t, 3, len(client.removed)) {
+		assert.Equal(t, 20, len(client.removed[0]))
+		assert.Equal(t, "track-0", client.removed[2][0])
+	}
+	if results := plan.Executions[2].Results; assert.Equal(t, 3, len(results)) {
+		assert.Equal(t, models.RestoreStatusRemoved, results[2].Tracks[0].Status)
+	}
+}
+
+// playlistWritesHTTPClientMock applies playlist changes, but the first request of each change times out after the
+// change is applied, the way a slow Spotify API response does
+type playlistWritesHTTPClientMock struct {
+	mutex    sync.Mutex
+	requests map[string]int
+	created  bool
+	tracks   []string
+}
+
+func (c *playlistWritesHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	c.mutex.Lock()
+	request := req.Method + " " + req.URL.Path
+	c.requests[request]++
+	var respBody string
+	switch request {
+	case "POST /users/user/playlists":
+		c.created = true
+		respBody = `{"id": "new-pl", "snapshot_id": "snapshot-0"}`
+	case "POST /playlists/new-pl/tracks":
+		var reqBody struct {
+			URIs []string `json:"uris"`
+		}
+		json.NewDecoder(req.Body).Decode(&reqBody)
+		c.tracks = append(c.tracks, reqBody.URIs...)
+		respBody = fmt.Sprintf(`{"snapshot_id": "snapshot-%d"}`, len(c.tracks))
+	case "GET /playlists/new-pl":
+		respBody = fmt.Sprintf(`{"id": "new-pl", "name": "mix", "snapshot_id": "snapshot-%d", "tracks": {"total": %d}}`, len(c.tracks), len(c.tracks))
+	}
+	timesOut := req.Method == "POST" && c.requests[request] == 1
+	c.mutex.Unlock()
+
+	if timesOut {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(respBody)),
+		StatusCode: 200,
+	}, nil
+}
+
+// playlistWritesServiceMock serves the playlists and tracks changed through the client
+type playlistWritesServiceMock struct {
+	UserPlaylistService
+	client *playlistWritesHTTPClientMock
+}
+
+func (s *playlistWritesServiceMock) DownloadCurrentUserPlaylists(accessToken string) ([]models.SpPlaylist, *models.SpAPIError) {
+	s.client.mutex.Lock()
+	defer s.client.mutex.Unlock()
+	playlists := []models.SpPlaylist{{ID: "other-pl", Name: "mix", Owner: models.SpUser{ID: "user"}, Tracks: models.SpTracks{Total: 3}}}
+	if s.client.created {
+		playlists = append(playlists, models.SpPlaylist{ID: "new-pl", Name: "mix", Owner: models.SpUser{ID: "user"}, SnapshotID: "snapshot-0"})
+	}
+	return playlists, nil
+}
+
+func (s *playlistWritesServiceMock) DownloadPlaylistTracks(accessToken string, href string, total int) ([]models.SpPlaylistTrack, *models.SpAPIError) {
+	s.client.mutex.Lock()
+	defer s.client.mutex.Unlock()
+	var tracks []models.SpPlaylistTrack
+	for _, uri := range s.client.tracks {
+		tracks = append(tracks, models.SpPlaylistTrack{Track: models.SpTrack{URI: uri}})
+	}
+	return tracks, nil
+}
+
+func TestResumeTimedOutPlaylistOperations(t *testing.T) {
+	client := &playlistWritesHTTPClientMock{requests: make(map[string]int)}
+	reqClient = requestClient{httpClient: client, requestTimeoutSeconds: 1}
+	ls := &LibraryService{
+		srvPlaylists:  &playlistWritesServiceMock{UserPlaylistService: NewUserPlaylistTestService(nil, nil), client: client},
+		spotifyAPIURL: "http://test",
+		urlPlaylists:  "/playlists",
+		urlUsers:      "/users",
+	}
+	wbs := NewWriteBackService(db.NewSpotifyDBTest(), ls.WriteBackOperators())
+
+	plan := ls.PlanPlaylistRecreate(models.PlaylistSnapshot{
+		Playlist: models.SpPlaylist{Name: "mix"},
+		Tracks:   planTestTracks("a b"),
+	})
+	if !assert.Nil(t, wbs.CreatePlan("user", plan)) {
+		t.FailNow()
+	}
+
+	// the playlist is created, but the request times out
+	plan, apiErr := wbs.Execute("test-token", "user", plan.ID)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, http.StatusGatewayTimeout, apiErr.Error.Status)
+	}
+	assert.Equal(t, models.WriteBackStatusUnknown, plan.Operations[0].Status)
+	assert.Equal(t, models.WriteBackStatusUnknown, plan.Executions[0].Results[0].Status)
+	assert.Equal(t, models.WriteBackStatusFailed, plan.Status)
+	assert.Empty(t, plan.PlaylistID)
+
+	// resuming finds the created playlist by name, instead of creating another one, then the tracks are added, but
+	// the request times out
+	plan, apiErr = wbs.Execute("test-token", "user", plan.ID)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, http.StatusGatewayTimeout, apiErr.Error.Status)
+	}
+	assert.Equal(t, "new-pl", plan.PlaylistID)
+	assert.Equal(t, models.WriteBackResult{Operation: 0, Status: models.WriteBackStatusDone, Verified: true}, plan.Executions[1].Results[0])
+	assert.Equal(t, models.WriteBackStatusUnknown, plan.Operations[1].Status)
+	assert.Equal(t, models.WriteBackStatusPartiallyExecuted, plan.Status)
+
+	// resuming finds the tracks added
+	plan, apiErr = wbs.Execute("test-token", "user", plan.ID)
+	assert.Nil(t, apiErr)
+	assert.Equal(t, models.WriteBackStatusExecuted, plan.Status)
+	assert.True(t, plan.Executions[2].Results[0].Verified)
+	assert.Equal(t, "snapshot-2", plan.SnapshotID)
+
+	assert.Equal(t, 1, client.requests["POST /users/user/playlists"], "playlist must be created once")
+	assert.Equal(t, 1, client.requests["POST /playlists/new-pl/tracks"], "tracks must be added once")
+	assert.Equal(t, []string{"a", "b"}, client.tracks)
+}
+
+func TestVerifyChangedPlaylist(t *testing.T) {
+	client := &playlistWritesHTTPClientMock{requests: make(map[string]int), created: true, tracks: []string{"spotify:track:x"}}
+	reqClient = requestClient{httpClient: client, requestTimeoutSeconds: 1}
+	ls := &LibraryService{
+		srvPlaylists:  &playlistWritesServiceMock{UserPlaylistService: NewUserPlaylistTestService(nil, nil), client: client},
+		spotifyAPIURL: "http://test",
+		urlPlaylists:  "/playlists",
+	}
+
+	plan := &models.WriteBackPlan{PlaylistID: "new-pl"}
+	op := &models.WriteBackOperation{Type: models.PlaylistOpAdd, Before: []string{}, After: []string{"spotify:track:a"}}
+	applied, apiErr := ls.verifyPlaylistTracks("test-token", plan, op)
+	assert.False(t, applied)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, 409, apiErr.Error.Status, "playlist changed meanwhile must not be changed further")
+	}
+
+	op.Before = []string{"spotify:track:x"}
+	applied, apiErr = ls.verifyPlaylistTracks("test-token", plan, op)
+	assert.Nil(t, apiErr)
+	assert.False(t, applied)
+	assert.Equal(t, "snapshot-1", plan.SnapshotID)
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// spotifyPage is a single page of a paged Spotify API response, both offset and cursor based.
+// NextURL is the full URL of the next page, empty for the last page.
+type spotifyPage interface {
+	NextURL() string
+}
+
+// pageIterator streams the pages of a paged Spotify API endpoint, starting with apiURL+path and following next URLs,
+// so callers can process each page as soon as it arrives:
+//
+//	it := newPageIterator(apiURL, path, accessToken, "saved tracks", func() spotifyPage { return &models.SpGetSavedTracksResp{} })
+//	for it.Next() {
+//		page := it.Page().(*models.SpGetSavedTracksResp)
+//		tracks = append(tracks, page.Items[:it.Take(len(page.Items))]...)
+//	}
+//	if err := it.Err(); err != nil { ... }
+//
+// Both offset and cursor paging work the same way, as next URLs hold the offset or the cursor of the next page.
+// Iteration ends with the last page, with an error, when maxPages or maxItems are reached, or when Stop is called.
+type pageIterator struct {
+	apiURL      string
+	path        string
+	accessToken string
+	// what is being downloaded, used in error messages
+	what    string
+	newPage func() spotifyPage
+
+	// limits of the download, zero meaning no limit
+	maxPages int
+	maxItems int
+
+	page      spotifyPage
+	pages     int
+	items     int
+	pageItems int
+	visited   map[string]bool
+	done      bool
+	err       *models.SpAPIError
+}
+
+func newPageIterator(apiURL string, path string, accessToken string, what string, newPage func() spotifyPage) *pageIterator {
+	return &pageIterator{
+		apiURL:      apiURL,
+		path:        path,
+		accessToken: accessToken,
+		what:        what,
+		newPage:     newPage,
+		pageItems:   -1,
+		visited:     make(map[string]bool),
+	}
+}
+
+// Next downloads the next page, returning false when there are no more pages to process
+func (it *pageIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	if it.page != nil && !it.moveToNextPage() {
+		it.Stop()
+		return false
+	}
+	if it.maxPages > 0 && it.pages >= it.maxPages {
+		log.Debugf(" > max pages [%d] of %s downloaded, stop", it.maxPages, it.what)
+		it.Stop()
+		return false
+	}
+
+	body, err := getFromSpotify(it.apiURL, it.path, it.accessToken)
+	if err != nil {
+		errMsg := fmt.Sprintf(" >>> error getting %s. details: %s", it.what, err.Error())
+		return it.fail(&models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}})
+	}
+	if apiErr, isError := getAPIError(body); isError {
+		log.Printf(" >>> API getting %s error: status [%d] -> [%s]\n", it.what, apiErr.Error.Status, apiErr.Error.Message)
+		return it.fail(&apiErr)
+	}
+
+	page := it.newPage()
+	if err := json.Unmarshal(body, page); err != nil {
+		errMsg := fmt.Sprintf(" >>> error occurred while unmarshaling %s response: %s", it.what, err.Error())
+		return it.fail(&models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}})
+	}
+
+	it.visited[it.apiURL+it.path] = true
+	it.page = page
+	it.pages++
+	it.pageItems = -1
+	return true
+}
+
+// moveToNextPage points the iterator to the page after the current one, if there is one to download
+func (it *pageIterator) moveToNextPage() bool {
+	if it.maxItems > 0 && it.items >= it.maxItems {
+		log.Debugf(" > max items [%d] of %s downloaded, stop", it.maxItems, it.what)
+		return false
+	}
+	nextURL := it.page.NextURL()
+	if len(nextURL) == 0 {
+		return false
+	}
+	// safety mechanisms against infinite loop - if the same page is coming again, or no new items are coming in, bail out
+	if it.visited[nextURL] {
+		log.Printf(" > page [%s] of %s already downloaded, bail out\n", nextURL, it.what)
+		return false
+	}
+	if it.pageItems == 0 {
+		log.Printf(" > no new %s coming in, bail out\n", it.what)
+		return false
+	}
+	it.apiURL, it.path = nextURL, ""
+	return true
+}
+
+// Page is the page downloaded by the last call to Next
+func (it *pageIterator) Page() spotifyPage {
+	return it.page
+}
+
+// Take reports the count of items in the current page, and tells how many of them to keep within maxItems
+func (it *pageIterator) Take(count int) int {
+	if it.maxItems > 0 && it.items+count > it.maxItems {
+		count = it.maxItems - it.items
+	}
+	it.items += count
+	it.pageItems = count
+	return count
+}
+
+// Stop ends the iteration early, no more pages are downloaded
+func (it *pageIterator) Stop() {
+	it.done = true
+}
+
+// Err is the error which ended the iteration, nil if there was none
+func (it *pageIterator) Err() *models.SpAPIError {
+	return it.err
+}
+
+func (it *pageIterator) fail(err *models.SpAPIError) bool {
+	it.err = err
+	it.Stop()
+	return false
+}
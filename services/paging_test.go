@@ -0,0 +1,188 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// pagingHTTPClientMock serves 5 saved tracks, 2 per page, with offset paging on /tracks and cursor paging on
+// /following, while /looping always points back to itself and /empty keeps serving empty pages
+type pagingHTTPClientMock struct {
+	requests []string
+}
+
+func (c *pagingHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	c.requests = append(c.requests, req.URL.String())
+
+	const total = 5
+	var respBody string
+	q := req.URL.Query()
+	switch req.URL.Path {
+	case "/tracks":
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		next := "null"
+		if offset+2 < total {
+			next = fmt.Sprintf(`"http://test/tracks?offset=%d"`, offset+2)
+		}
+		respBody = fmt.Sprintf(`{"total": %d, "next": %s, "items": [%s]}`, total, next, pagingMockTracks(offset, total))
+	case "/following":
+		after, _ := strconv.Atoi(q.Get("after"))
+		next := "null"
+		if after+2 < total {
+			next = fmt.Sprintf(`"http://test/following?after=%d"`, after+2)
+		}
+		respBody = fmt.Sprintf(`{"artists": {"next": %s, "items": [{"id": "artist-%d"}]}}`, next, after)
+	case "/looping":
+		respBody = `{"next": "http://test/looping", "items": [{"track": {"id": "track-0"}}]}`
+	case "/empty":
+		page, _ := strconv.Atoi(q.Get("page"))
+		respBody = fmt.Sprintf(`{"next": "http://test/empty?page=%d", "items": []}`, page+1)
+	default:
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"error": {"status": 404, "message": "Not found."}}`)),
+			StatusCode: 404,
+		}, nil
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(respBody)),
+		StatusCode: 200,
+	}, nil
+}
+
+func pagingMockTracks(offset int, total int) string {
+	items := ""
+	for i := offset; i < offset+2 && i < total; i++ {
+		if len(items) > 0 {
+			items += ", "
+		}
+		items += fmt.Sprintf(`{"track": {"id": "track-%d"}}`, i)
+	}
+	return items
+}
+
+func collectSavedTracks(pages *pageIterator) []string {
+	var ids []string
+	for pages.Next() {
+		page := pages.Page().(*models.SpGetSavedTracksResp)
+		for _, t := range page.Items[:pages.Take(len(page.Items))] {
+			ids = append(ids, t.Track.ID)
+		}
+	}
+	return ids
+}
+
+func newSavedTracksIterator(path string) *pageIterator {
+	return newPageIterator("http://test", path, "test-token", "saved tracks",
+		func() spotifyPage { return &models.SpGetSavedTracksResp{} })
+}
+
+func TestPageIteratorOffsetPaging(t *testing.T) {
+	client := &pagingHTTPClientMock{}
+	reqClient = requestClient{httpClient: client, requestTimeoutSeconds: 1}
+
+	pages := newSavedTracksIterator("/tracks?offset=0")
+	ids := collectSavedTracks(pages)
+
+	assert.Nil(t, pages.Err())
+	assert.Equal(t, []string{"track-0", "track-1", "track-2", "track-3", "track-4"}, ids)
+	assert.Equal(t, 3, len(client.requests))
+	assert.False(t, pages.Next(), "finished iterator must stay finished")
+	assert.Equal(t, 3, len(client.requests))
+}
+
+func TestPageIteratorCursorPaging(t *testing.T) {
+	client := &pagingHTTPClientMock{}
+	reqClient = requestClient{httpClient: client, requestTimeoutSeconds: 1}
+
+	pages := newPageIterator("http://test", "/following?after=0", "test-token", "followed artists",
+		func() spotifyPage { return &models.SpGetFollowedArtistsResp{} })
+	var ids []string
+	for pages.Next() {
+		page := pages.Page().(*models.SpGetFollowedArtistsResp)
+		for _, a := range page.Artists.Items[:pages.Take(len(page.Artists.Items))] {
+			ids = append(ids, a.ID)
+		}
+	}
+
+	assert.Nil(t, pages.Err())
+	assert.Equal(t, []string{"artist-0", "artist-2", "artist-4"}, ids)
+}
+
+func TestPageIteratorLimits(t *testing.T) {
+	client := &pagingHTTPClientMock{}
+	reqClient = requestClient{httpClient: client, requestTimeoutSeconds: 1}
+
+	pages := newSavedTracksIterator("/tracks?offset=0")
+	pages.maxPages = 2
+	assert.Equal(t, []string{"track-0", "track-1", "track-2", "track-3"}, collectSavedTracks(pages))
+	assert.Nil(t, pages.Err())
+	assert.Equal(t, 2, len(client.requests))
+
+	client.requests = nil
+	pages = newSavedTracksIterator("/tracks?offset=0")
+	pages.maxItems = 3
+	assert.Equal(t, []string{"track-0", "track-1", "track-2"}, collectSavedTracks(pages))
+	assert.Nil(t, pages.Err())
+	assert.Equal(t, 2, len(client.requests))
+
+	client.requests = nil
+	pages = newSavedTracksIterator("/tracks?offset=0")
+	pages.maxItems = 4
+	assert.Equal(t, []string{"track-0", "track-1", "track-2", "track-3"}, collectSavedTracks(pages))
+	assert.Equal(t, 2, len(client.requests), "no page must be downloaded after max items are reached")
+}
+
+func TestPageIteratorEarlyStop(t *testing.T) {
+	client := &pagingHTTPClientMock{}
+	reqClient = requestClient{httpClient: client, requestTimeoutSeconds: 1}
+
+	pages := newSavedTracksIterator("/tracks?offset=0")
+	var ids []string
+	for pages.Next() {
+		page := pages.Page().(*models.SpGetSavedTracksResp)
+		for _, t := range page.Items[:pages.Take(len(page.Items))] {
+			ids = append(ids, t.Track.ID)
+			if t.Track.ID == "track-2" {
+				pages.Stop()
+			}
+		}
+	}
+
+	assert.Nil(t, pages.Err())
+	assert.Equal(t, []string{"track-0", "track-1", "track-2", "track-3"}, ids)
+	assert.Equal(t, 2, len(client.requests))
+}
+
+func TestPageIteratorBailsOut(t *testing.T) {
+	client := &pagingHTTPClientMock{}
+	reqClient = requestClient{httpClient: client, requestTimeoutSeconds: 1}
+
+	pages := newSavedTracksIterator("/looping")
+	assert.Equal(t, []string{"track-0"}, collectSavedTracks(pages))
+	assert.Nil(t, pages.Err())
+	assert.Equal(t, 1, len(client.requests))
+
+	client.requests = nil
+	pages = newSavedTracksIterator("/empty?page=0")
+	assert.Empty(t, collectSavedTracks(pages))
+	assert.Nil(t, pages.Err())
+	assert.Equal(t, 1, len(client.requests))
+}
+
+func TestPageIteratorError(t *testing.T) {
+	reqClient = requestClient{httpClient: &pagingHTTPClientMock{}, requestTimeoutSeconds: 1}
+
+	pages := newSavedTracksIterator("/unknown")
+	assert.Empty(t, collectSavedTracks(pages))
+	if assert.NotNil(t, pages.Err()) {
+		assert.Equal(t, 404, pages.Err().Error.Status)
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"time"
+)
+
+// login has to be finished within pkceVerifierTTL, otherwise the code verifier is forgotten
+var pkceVerifierTTL = 10 * time.Minute
+
+type pkceVerifier struct {
+	verifier  string
+	createdAt time.Time
+}
+
+// PKCEEnabled tells if the login uses Authorization Code with PKCE flow, instead of the client secret
+func (as *SpotifyAuthService) PKCEEnabled() bool {
+	return as.pkce
+}
+
+// NewPKCEChallenge generates a new code verifier for the login identified by state (the value of the state
+// cookie), and returns its S256 code challenge, to be sent to Spotify authorize endpoint
+func (as *SpotifyAuthService) NewPKCEChallenge(state string) (codeChallenge string, err error) {
+	// 32 random bytes give 43 chars long verifier, the minimum length allowed
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	verifier := b64.RawURLEncoding.EncodeToString(randomBytes)
+
+	as.mutex.Lock()
+	now := time.Now()
+	for s, v := range as.pkceVerifiers {
+		if now.Sub(v.createdAt) > pkceVerifierTTL {
+			delete(as.pkceVerifiers, s)
+		}
+	}
+	as.pkceVerifiers[state] = pkceVerifier{verifier: verifier, createdAt: now}
+	as.mutex.Unlock()
+
+	hash := sha256.Sum256([]byte(verifier))
+	return b64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
+
+// TakePKCEVerifier returns the code verifier of the login identified by state. Each verifier can be taken only once.
+func (as *SpotifyAuthService) TakePKCEVerifier(state string) (verifier string, found bool) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	v, found := as.pkceVerifiers[state]
+	if !found || time.Since(v.createdAt) > pkceVerifierTTL {
+		return "", false
+	}
+	delete(as.pkceVerifiers, state)
+	return v.verifier, true
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/config"
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// PlayHistoryService collects recently played tracks of users who enabled it, into a long-term play history.
+// Spotify keeps only the last 50 played tracks, so they are collected periodically, see RunCollector.
+type PlayHistoryService struct {
+	spotifyDB         db.SpotifyDBClient
+	users             *UserService
+	spotifyAPIURL     string
+	urlRecentlyPlayed string
+}
+
+// PlayHistoryQuery selects plays from the play history; empty TrackID and ArtistID match all plays
+type PlayHistoryQuery struct {
+	From     time.Time
+	To       time.Time
+	TrackID  string
+	ArtistID string
+}
+
+func NewPlayHistoryService(spotifyDB db.SpotifyDBClient, users *UserService) *PlayHistoryService {
+	return &PlayHistoryService{
+		spotifyDB:         spotifyDB,
+		users:             users,
+		spotifyAPIURL:     config.Conf.SpotifyAPIURL,
+		urlRecentlyPlayed: config.Conf.URLRecentlyPlayed,
+	}
+}
+
+// Enable adds the user to users whose play history is collected, and collects the recently played tracks right away
+func (phs *PlayHistoryService) Enable(user *models.User) (added int, err *models.SpAPIError) {
+	if dbErr := phs.spotifyDB.SetPlayHistoryEnabled(user.Username, true); dbErr != nil {
+		errMsg := fmt.Sprintf(" >>> error enabling play history for user [%s]: %s", user.Username, dbErr.Error())
+		return 0, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+	return phs.Collect(user)
+}
+
+// Disable stops collecting user's play history, already collected plays are kept
+func (phs *PlayHistoryService) Disable(username string) error {
+	return phs.spotifyDB.SetPlayHistoryEnabled(username, false)
+}
+
+func (phs *PlayHistoryService) Enabled(username string) bool {
+	return phs.spotifyDB.PlayHistoryEnabled(username)
+}
+
+// Collect downloads tracks played by the user since the latest play in the history, and appends them to the history
+func (phs *PlayHistoryService) Collect(user *models.User) (added int, err *models.SpAPIError) {
+	// with no plays collected yet, all recently played tracks are taken (zero time)
+	after, _ := phs.spotifyDB.GetLatestPlayedAt(user.Username)
+	plays, err := phs.DownloadRecentlyPlayed(user.AccessToken(), after)
+	if err != nil {
+		return 0, err
+	}
+	return phs.spotifyDB.AddPlays(user.Username, plays), nil
+}
+
+// CollectAll collects play history of all users who enabled it, skipping the ones who need to login again
+// or have not granted the needed scopes
+func (phs *PlayHistoryService) CollectAll() {
+	for _, username := range phs.spotifyDB.GetPlayHistoryUsers() {
+		user, err := phs.users.Get(username)
+		if err != nil || user.CurrentAuth() == nil {
+			log.Debugf(" > play history: user [%s] not found, skipping", username)
+			continue
+		}
+		if user.ReloginRequired() || len(MissingFeatureScopes(user, FeaturePlayHistory)) > 0 {
+			log.Debugf(" > play history: user [%s] authorization not valid, skipping", username)
+			continue
+		}
+		added, apiErr := phs.Collect(user)
+		if apiErr != nil {
+			log.Warnf(" >>> play history: collecting for user [%s] failed: %s", username, apiErr.Error.Message)
+			continue
+		}
+		log.Debugf(" > play history: [%d] new plays collected for user [%s]", added, username)
+	}
+}
+
+// RunCollector periodically collects play history of all users who enabled it
+func (phs *PlayHistoryService) RunCollector(collectInterval time.Duration, stopChan <-chan struct{}) {
+	log.Debugf(" > play history collector started, collect interval [%v]", collectInterval)
+	ticker := time.NewTicker(collectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopChan:
+			log.Debug(" > play history collector stopped")
+			return
+		case <-ticker.C:
+			phs.CollectAll()
+		}
+	}
+}
+
+// DownloadRecentlyPlayed more info: https://developer.spotify.com/documentation/web-api/reference/player/get-recently-played/
+// Only the plays after given time are returned, oldest first.
+func (phs *PlayHistoryService) DownloadRecentlyPlayed(accessToken string, after time.Time) (plays []models.SpPlayHistory, err *models.SpAPIError) {
+	// Spotify returns 50 recently played tracks at most, so there is a single page to get
+	path := fmt.Sprintf("%s?limit=50", phs.urlRecentlyPlayed)
+	if !after.IsZero() {
+		path = fmt.Sprintf("%s&after=%d", path, after.UnixNano()/int64(time.Millisecond))
+	}
+	body, getErr := getFromSpotify(phs.spotifyAPIURL, path, accessToken)
+	if getErr != nil {
+		errMsg := fmt.Sprintf(" >>> error getting recently played tracks. details: %s", getErr.Error())
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+	if apiErr, isError := getAPIError(body); isError {
+		log.Printf(" >>> API getting recently played tracks error: status [%d] -> [%s]\n", apiErr.Error.Status, apiErr.Error.Message)
+		return nil, &apiErr
+	}
+
+	var response models.SpGetRecentlyPlayedResp
+	if unmarshalErr := json.Unmarshal(body, &response); unmarshalErr != nil {
+		errMsg := fmt.Sprintf(" >>> error occurred while unmarshaling recently played tracks response: %s", unmarshalErr.Error())
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+
+	plays = []models.SpPlayHistory{}
+	for i := len(response.Items) - 1; i >= 0; i-- {
+		if response.Items[i].PlayedAt.After(after) {
+			plays = append(plays, response.Items[i])
+		}
+	}
+	return plays, nil
+}
+
+// Query returns the plays from user's play history matching the query, oldest first
+func (phs *PlayHistoryService) Query(username string, query PlayHistoryQuery) []models.SpPlayHistory {
+	plays := []models.SpPlayHistory{}
+	for _, play := range phs.spotifyDB.GetPlays(username, query.From, query.To) {
+		if len(query.TrackID) > 0 && play.Track.ID != query.TrackID {
+			continue
+		}
+		if len(query.ArtistID) > 0 && !playedByArtist(play, query.ArtistID) {
+			continue
+		}
+		plays = append(plays, play)
+	}
+	return plays
+}
+
+func playedByArtist(play models.SpPlayHistory, artistID string) bool {
+	for _, a := range play.Track.Artists {
+		if a.ID == artistID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// recentlyPlayedHTTPClientMock serves the plays as recently played tracks, newest first, ignoring the after param
+// the way Spotify returns overlapping pages, and records the requested after params
+type recentlyPlayedHTTPClientMock struct {
+	plays  []models.SpPlayHistory
+	afters []string
+}
+
+func (c *recentlyPlayedHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	c.afters = append(c.afters, req.URL.Query().Get("after"))
+	var items []string
+	for i := len(c.plays) - 1; i >= 0; i-- {
+		p := c.plays[i]
+		items = append(items, fmt.Sprintf(`{"track": {"id": "%s", "artists": [{"id": "%s"}]}, "played_at": "%s"}`,
+			p.Track.ID, p.Track.Artists[0].ID, p.PlayedAt.Format(time.RFC3339Nano)))
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"items": [` + strings.Join(items, ", ") + `]}`)),
+		StatusCode: 200,
+	}, nil
+}
+
+func newPlay(trackID string, artistID string, playedAt time.Time) models.SpPlayHistory {
+	return models.SpPlayHistory{
+		Track:    models.SpTrack{ID: trackID, Artists: []models.SpArtist{{ID: artistID}}},
+		PlayedAt: playedAt,
+	}
+}
+
+func TestPlayHistoryCollect(t *testing.T) {
+	start := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	httpClient := &recentlyPlayedHTTPClientMock{plays: []models.SpPlayHistory{
+		newPlay("track-1", "artist-1", start),
+		newPlay("track-2", "artist-1", start.Add(3*time.Minute)),
+		newPlay("track-3", "artist-2", start.Add(7*time.Minute)),
+	}}
+	reqClient = requestClient{httpClient: httpClient, requestTimeoutSeconds: 1}
+	phs := &PlayHistoryService{spotifyDB: db.NewSpotifyDBTest(), spotifyAPIURL: "http://test", urlRecentlyPlayed: "/recently-played"}
+	user := &models.User{Username: "user", Auth: &models.SpotifyAuthOptions{AccessToken: accessToken}}
+
+	added, err := phs.Collect(user)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, added)
+
+	// nothing played since, so nothing is added again
+	added, err = phs.Collect(user)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, added)
+
+	httpClient.plays = append(httpClient.plays, newPlay("track-1", "artist-1", start.Add(10*time.Minute)))
+	added, err = phs.Collect(user)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, added)
+	assert.Equal(t, []string{"", "1583057220000", "1583057220000"}, httpClient.afters, "plays must be collected after the latest one")
+
+	// plays are identified by their played_at time
+	added = phs.spotifyDB.AddPlays("user", httpClient.plays)
+	assert.Equal(t, 0, added)
+	assert.Equal(t, 4, len(phs.Query("user", PlayHistoryQuery{From: start, To: start.Add(time.Hour)})))
+}
+
+func TestPlayHistoryQuery(t *testing.T) {
+	start := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	phs := &PlayHistoryService{spotifyDB: db.NewSpotifyDBTest()}
+	// added out of order, and for another user as well
+	phs.spotifyDB.AddPlays("user", []models.SpPlayHistory{
+		newPlay("track-3", "artist-2", start.Add(20*time.Minute)),
+		newPlay("track-1", "artist-1", start),
+		newPlay("track-2", "artist-1", start.Add(10*time.Minute)),
+		newPlay("track-1", "artist-1", start.Add(30*time.Minute)),
+	})
+	phs.spotifyDB.AddPlays("other-user", []models.SpPlayHistory{newPlay("track-9", "artist-9", start.Add(15*time.Minute))})
+
+	playedTracks := func(query PlayHistoryQuery) []string {
+		var tracks []string
+		for _, p := range phs.Query("user", query) {
+			tracks = append(tracks, fmt.Sprintf("%s@%d", p.Track.ID, p.PlayedAt.Sub(start)/time.Minute))
+		}
+		return tracks
+	}
+
+	all := PlayHistoryQuery{From: start, To: start.Add(time.Hour)}
+	assert.Equal(t, []string{"track-1@0", "track-2@10", "track-3@20", "track-1@30"}, playedTracks(all), "plays must be oldest first")
+	assert.Equal(t, []string{"track-2@10", "track-3@20"}, playedTracks(PlayHistoryQuery{From: start.Add(10 * time.Minute), To: start.Add(20 * time.Minute)}), "range must be inclusive")
+	assert.Empty(t, playedTracks(PlayHistoryQuery{From: start.Add(time.Minute), To: start.Add(9 * time.Minute)}))
+	assert.Equal(t, []string{"track-1@0", "track-1@30"}, playedTracks(PlayHistoryQuery{From: start, To: start.Add(time.Hour), TrackID: "track-1"}))
+	assert.Equal(t, []string{"track-3@20"}, playedTracks(PlayHistoryQuery{From: start, To: start.Add(time.Hour), ArtistID: "artist-2"}))
+
+	latest, found := phs.spotifyDB.GetLatestPlayedAt("user")
+	if assert.True(t, found) {
+		assert.True(t, start.Add(30*time.Minute).Equal(latest))
+	}
+	_, found = phs.spotifyDB.GetLatestPlayedAt("no-plays-user")
+	assert.False(t, found)
+}
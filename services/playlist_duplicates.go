@@ -0,0 +1,235 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+var (
+	// bracketed and " - " separated title parts, e.g. "(Remastered 2011)", "[Deluxe Edition]", " - Mono Version"
+	titleParts = regexp.MustCompile(`\s*[(\[][^)\]]*[)\]]|\s+-\s+.*$`)
+	// title parts telling apart releases of the same recording
+	titleReleaseInfo = regexp.MustCompile(`(?i)\b(remaster(ed)?|deluxe|edition|mono|stereo|explicit|clean)\b`)
+	// title parts telling apart other recordings of the song, never left out, e.g. "(Live - Remastered 2011)"
+	titleRecordingInfo = regexp.MustCompile(`(?i)\b(live|acoustic|instrumental|remix(ed)?|mix|edit|demo|unplugged|karaoke)\b`)
+	nonAlphanumeric    = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+)
+
+// trackOccurrence is a track at its position in a playlist
+type trackOccurrence struct {
+	playlist *models.SpPlaylist
+	position int
+	track    models.SpTrack
+}
+
+// FindPlaylistDuplicates finds the tracks repeated inside each of the playlists, and the tracks in more than one of
+// them. Tracks match by track ID, by ISRC, or by normalized title and main artist. Local files are left out.
+func FindPlaylistDuplicates(playlists []models.PlaylistSnapshot) models.PlaylistDuplicates {
+	duplicates := models.PlaylistDuplicates{
+		Within: []models.DuplicateTracks{},
+		Across: []models.DuplicateTracks{},
+	}
+	var all []trackOccurrence
+	for i := range playlists {
+		occurrences := playlistOccurrences(&playlists[i])
+		for _, group := range groupDuplicates(occurrences) {
+			duplicates.Within = append(duplicates.Within, duplicateTracks(occurrences, group))
+		}
+		all = append(all, occurrences...)
+	}
+	for _, group := range groupDuplicates(all) {
+		playlistIDs := make(map[string]bool)
+		for _, i := range group {
+			playlistIDs[all[i].playlist.ID] = true
+		}
+		if len(playlistIDs) > 1 {
+			duplicates.Across = append(duplicates.Across, duplicateTracks(all, group))
+		}
+	}
+	return duplicates
+}
+
+// withoutDuplicates returns the tracks with only the first copy of each duplicated track, along with the left out copies.
+// Copies are left out automatically, so tracks matching only by title and artist must have the same duration as well.
+func withoutDuplicates(playlist *models.SpPlaylist, tracks []models.SpPlaylistTrack) (kept []models.SpPlaylistTrack, left []models.SpPlaylistTrack) {
+	occurrences := playlistOccurrences(&models.PlaylistSnapshot{Playlist: *playlist, Tracks: tracks})
+	copies := make(map[int]bool)
+	for _, group := range groupDuplicatesBy(occurrences, removableDuplicateKeys) {
+		for _, i := range group[1:] {
+			copies[occurrences[i].position] = true
+		}
+	}
+	for pos, t := range tracks {
+		if copies[pos] {
+			left = append(left, t)
+		} else {
+			kept = append(kept, t)
+		}
+	}
+	return kept, left
+}
+
+func playlistOccurrences(playlist *models.PlaylistSnapshot) []trackOccurrence {
+	var occurrences []trackOccurrence
+	for pos, t := range playlist.Tracks {
+		if isLocalTrack(t) {
+			continue
+		}
+		occurrences = append(occurrences, trackOccurrence{playlist: &playlist.Playlist, position: pos, track: t.Track})
+	}
+	return occurrences
+}
+
+// groupDuplicates returns groups of indexes of the occurrences matching each other, directly or through other
+// occurrences, ordered by their first occurrence. Occurrences without copies are left out.
+func groupDuplicates(occurrences []trackOccurrence) [][]int {
+	return groupDuplicatesBy(occurrences, duplicateKeys)
+}
+
+// groupDuplicatesBy groups the occurrences sharing any of the keys given by keysOf
+func groupDuplicatesBy(occurrences []trackOccurrence, keysOf func(track models.SpTrack) []string) [][]int {
+	// union-find, with the first occurrence as the root of its group
+	parent := make([]int, len(occurrences))
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	firstWithKey := make(map[string]int)
+	for i, o := range occurrences {
+		parent[i] = i
+		for _, key := range keysOf(o.track) {
+			first, found := firstWithKey[key]
+			if !found {
+				firstWithKey[key] = i
+				continue
+			}
+			if root, otherRoot := find(i), find(first); root < otherRoot {
+				parent[otherRoot] = root
+			} else {
+				parent[root] = otherRoot
+			}
+		}
+	}
+
+	var groups [][]int
+	groupIndexes := make(map[int]int)
+	for i := range occurrences {
+		root := find(i)
+		gi, found := groupIndexes[root]
+		if !found {
+			gi = len(groups)
+			groupIndexes[root] = gi
+			groups = append(groups, nil)
+		}
+		groups[gi] = append(groups[gi], i)
+	}
+	var duplicated [][]int
+	for _, group := range groups {
+		if len(group) > 1 {
+			duplicated = append(duplicated, group)
+		}
+	}
+	return duplicated
+}
+
+// duplicateKeys are the keys of the track, tracks sharing any of them are duplicates
+func duplicateKeys(track models.SpTrack) []string {
+	var keys []string
+	if uri := duplicateTrackURI(track); len(uri) > 0 {
+		keys = append(keys, "uri:"+uri)
+	}
+	if len(track.ExternalIds.Isrc) > 0 {
+		keys = append(keys, "isrc:"+strings.ToUpper(track.ExternalIds.Isrc))
+	}
+	if titleArtist := normalizedTitleArtist(track); len(titleArtist) > 0 {
+		keys = append(keys, "title:"+titleArtist)
+	}
+	return keys
+}
+
+// removableDuplicateKeys are the keys of the track, tracks sharing any of them are copies which can be removed. Unlike
+// duplicateKeys, title and artist match only with the same duration, to the second, so e.g. a radio edit mistaken
+// for a copy of the song is never removed.
+func removableDuplicateKeys(track models.SpTrack) []string {
+	var keys []string
+	for _, key := range duplicateKeys(track) {
+		if strings.HasPrefix(key, "title:") {
+			if track.DurationMs <= 0 {
+				continue
+			}
+			key = fmt.Sprintf("%s|%d", key, track.DurationMs/1000)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func duplicateTrackURI(track models.SpTrack) string {
+	if len(track.URI) > 0 || len(track.ID) == 0 {
+		return track.URI
+	}
+	return savedTrackURI(track.ID)
+}
+
+// normalizedTitleArtist is the track title, without release info, and its main artist, both lowercase and without
+// punctuation, or empty if the track has no title or artist
+func normalizedTitleArtist(track models.SpTrack) string {
+	if len(track.Artists) == 0 {
+		return ""
+	}
+	title := normalize(titleParts.ReplaceAllStringFunc(track.Name, func(part string) string {
+		if titleReleaseInfo.MatchString(part) && !titleRecordingInfo.MatchString(part) {
+			return ""
+		}
+		return part
+	}))
+	artist := normalize(track.Artists[0].Name)
+	if len(title) == 0 || len(artist) == 0 {
+		return ""
+	}
+	return title + "|" + artist
+}
+
+func normalize(s string) string {
+	return strings.TrimSpace(nonAlphanumeric.ReplaceAllString(strings.ToLower(s), " "))
+}
+
+func duplicateTracks(occurrences []trackOccurrence, group []int) models.DuplicateTracks {
+	var duplicates models.DuplicateTracks
+	first := occurrences[group[0]].track
+	sameID, sameISRC := true, len(first.ExternalIds.Isrc) > 0
+	for _, i := range group {
+		o := occurrences[i]
+		sameID = sameID && duplicateTrackURI(o.track) == duplicateTrackURI(first)
+		sameISRC = sameISRC && strings.EqualFold(o.track.ExternalIds.Isrc, first.ExternalIds.Isrc)
+		track := models.DuplicateTrack{
+			PlaylistID:   o.playlist.ID,
+			PlaylistName: o.playlist.Name,
+			Position:     o.position,
+			URI:          o.track.URI,
+			Name:         o.track.Name,
+			Artists:      []string{},
+			ISRC:         o.track.ExternalIds.Isrc,
+		}
+		for _, a := range o.track.Artists {
+			track.Artists = append(track.Artists, a.Name)
+		}
+		duplicates.Tracks = append(duplicates.Tracks, track)
+	}
+
+	switch {
+	case sameID:
+		duplicates.Match = models.DuplicateMatchID
+	case sameISRC:
+		duplicates.Match = models.DuplicateMatchISRC
+	default:
+		duplicates.Match = models.DuplicateMatchTitleArtist
+	}
+	return duplicates
+}
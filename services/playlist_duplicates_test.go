@@ -0,0 +1,155 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+func duplicatesTestTrack(id string, isrc string, name string, artist string) models.SpPlaylistTrack {
+	return models.SpPlaylistTrack{Track: models.SpTrack{
+		ID:          id,
+		URI:         "spotify:track:" + id,
+		Name:        name,
+		Artists:     []models.SpArtist{{Name: artist}},
+		ExternalIds: models.SpExternalIds{Isrc: isrc},
+	}}
+}
+
+func TestNormalizedTitleArtist(t *testing.T) {
+	cases := []struct {
+		name     string
+		artist   string
+		expected string
+	}{
+		{name: "Song", artist: "Artist", expected: "song|artist"},
+		{name: "Song (Remastered 2011)", artist: "Artist", expected: "song|artist"},
+		{name: "Song - 2009 Remaster", artist: "Artist", expected: "song|artist"},
+		{name: "Song [Deluxe Edition]", artist: "Artist", expected: "song|artist"},
+		{name: "Song - Mono Version", artist: "The  Artist!", expected: "song|the artist"},
+		{name: "Song (Live)", artist: "Artist", expected: "song live|artist"},
+		{name: "Song - Radio Edit", artist: "Artist", expected: "song radio edit|artist"},
+		// other recordings of the song are never the same track
+		{name: "Hurt (Live Version)", artist: "Artist", expected: "hurt live version|artist"},
+		{name: "Hurt (Acoustic Version)", artist: "Artist", expected: "hurt acoustic version|artist"},
+		{name: "Hurt - Instrumental Version", artist: "Artist", expected: "hurt instrumental version|artist"},
+		{name: "Hurt - Live / Remastered 2011", artist: "Artist", expected: "hurt live remastered 2011|artist"},
+		{name: "Hurt (Remix) [Remastered]", artist: "Artist", expected: "hurt remix|artist"},
+		{name: "Hurt (Extended Mix)", artist: "Artist", expected: "hurt extended mix|artist"},
+		{name: "Hurt (Explicit)", artist: "Artist", expected: "hurt|artist"},
+		{name: "Señor, Don't Stop", artist: "Artist", expected: "señor don t stop|artist"},
+		{name: "", artist: "Artist", expected: ""},
+		{name: "Song", artist: "", expected: ""},
+	}
+	for _, c := range cases {
+		track := models.SpTrack{Name: c.name, Artists: []models.SpArtist{{Name: c.artist}}}
+		assert.Equal(t, c.expected, normalizedTitleArtist(track), "title [%s], artist [%s]", c.name, c.artist)
+	}
+	assert.Empty(t, normalizedTitleArtist(models.SpTrack{Name: "Song"}))
+}
+
+func TestFindPlaylistDuplicates(t *testing.T) {
+	local := models.SpPlaylistTrack{IsLocal: true, Track: models.SpTrack{URI: "spotify:local:song", Name: "Song", Artists: []models.SpArtist{{Name: "Artist"}}}}
+	playlists := []models.PlaylistSnapshot{
+		{
+			Playlist: models.SpPlaylist{ID: "pl-1", Name: "First"},
+			Tracks: []models.SpPlaylistTrack{
+				duplicatesTestTrack("a", "ISRC-A", "Song", "Artist"),
+				duplicatesTestTrack("b", "ISRC-B", "Other", "Artist"),
+				duplicatesTestTrack("a", "ISRC-A", "Song", "Artist"),
+				local,
+				duplicatesTestTrack("c", "ISRC-C", "Third", "Band"),
+			},
+		},
+		{
+			Playlist: models.SpPlaylist{ID: "pl-2", Name: "Second"},
+			Tracks: []models.SpPlaylistTrack{
+				// relinked copy of b
+				duplicatesTestTrack("b2", "isrc-b", "Other", "Artist"),
+				// remastered release of c
+				duplicatesTestTrack("c2", "ISRC-C2", "Third (Remastered 2011)", "Band"),
+				duplicatesTestTrack("d", "ISRC-D", "Fourth", "Band"),
+			},
+		},
+	}
+
+	duplicates := FindPlaylistDuplicates(playlists)
+	if assert.Equal(t, 1, len(duplicates.Within)) {
+		within := duplicates.Within[0]
+		assert.Equal(t, models.DuplicateMatchID, within.Match)
+		assert.Equal(t, []models.DuplicateTrack{
+			{PlaylistID: "pl-1", PlaylistName: "First", Position: 0, URI: "spotify:track:a", Name: "Song", Artists: []string{"Artist"}, ISRC: "ISRC-A"},
+			{PlaylistID: "pl-1", PlaylistName: "First", Position: 2, URI: "spotify:track:a", Name: "Song", Artists: []string{"Artist"}, ISRC: "ISRC-A"},
+		}, within.Tracks)
+	}
+
+	if assert.Equal(t, 2, len(duplicates.Across)) {
+		assert.Equal(t, models.DuplicateMatchISRC, duplicates.Across[0].Match)
+		assert.Equal(t, "spotify:track:b", duplicates.Across[0].Tracks[0].URI)
+		assert.Equal(t, "spotify:track:b2", duplicates.Across[0].Tracks[1].URI)
+
+		assert.Equal(t, models.DuplicateMatchTitleArtist, duplicates.Across[1].Match)
+		assert.Equal(t, 4, duplicates.Across[1].Tracks[0].Position)
+		assert.Equal(t, "pl-2", duplicates.Across[1].Tracks[1].PlaylistID)
+		assert.Equal(t, 1, duplicates.Across[1].Tracks[1].Position)
+	}
+
+	noDuplicates := FindPlaylistDuplicates(playlists[1:])
+	assert.Empty(t, noDuplicates.Within)
+	assert.Empty(t, noDuplicates.Across)
+}
+
+func TestWithoutDuplicatesTitleMatches(t *testing.T) {
+	track := func(id string, name string, durationMs int) models.SpPlaylistTrack {
+		t := duplicatesTestTrack(id, "", name, "Artist")
+		t.Track.DurationMs = durationMs
+		return t
+	}
+	tracks := []models.SpPlaylistTrack{
+		track("a", "Hurt", 218000),
+		track("b", "Hurt (Live Version)", 218000),
+		track("c", "Hurt (Acoustic Version)", 218000),
+		track("d", "Hurt - Instrumental Version", 218000),
+		// re-released, but with a different duration
+		track("e", "Hurt (Remastered 2011)", 221000),
+		// re-released, with the same duration
+		track("f", "Hurt - 2011 Remaster", 218400),
+		// unknown duration
+		track("g", "Hurt [Deluxe Edition]", 0),
+	}
+
+	kept, left := withoutDuplicates(&models.SpPlaylist{ID: "pl"}, tracks)
+	var keptIDs, leftIDs []string
+	for _, t := range kept {
+		keptIDs = append(keptIDs, t.Track.ID)
+	}
+	for _, t := range left {
+		leftIDs = append(leftIDs, t.Track.ID)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "g"}, keptIDs)
+	assert.Equal(t, []string{"f"}, leftIDs)
+
+	// all the releases are still reported as duplicates, while other recordings are not
+	duplicates := FindPlaylistDuplicates([]models.PlaylistSnapshot{{Playlist: models.SpPlaylist{ID: "pl"}, Tracks: tracks}})
+	if assert.Equal(t, 1, len(duplicates.Within)) {
+		var ids []string
+		for _, t := range duplicates.Within[0].Tracks {
+			ids = append(ids, t.URI)
+		}
+		assert.Equal(t, []string{"spotify:track:a", "spotify:track:e", "spotify:track:f", "spotify:track:g"}, ids)
+	}
+}
+
+func TestGroupDuplicatesTransitively(t *testing.T) {
+	// a and b share the ISRC, b and c share the title and artist, so all of them are copies of the same track, even
+	// though a and c have nothing in common
+	occurrences := []trackOccurrence{
+		{position: 0, track: duplicatesTestTrack("a", "ISRC-1", "Song", "Artist").Track},
+		{position: 1, track: duplicatesTestTrack("x", "ISRC-X", "Unrelated", "Artist").Track},
+		{position: 2, track: duplicatesTestTrack("c", "", "Song (Live)", "Artist").Track},
+		{position: 3, track: duplicatesTestTrack("b", "ISRC-1", "Song - Live", "Artist").Track},
+	}
+	assert.Equal(t, [][]int{{0, 2, 3}}, groupDuplicates(occurrences))
+}
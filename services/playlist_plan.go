@@ -0,0 +1,312 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// Spotify API accepts at most 100 tracks in a single add or remove playlist tracks request
+const playlistTracksBatchSize = 100
+
+// planPlaylistRecreate plans creating a new playlist, with the name, description and track order of the snapshot
+func planPlaylistRecreate(snapshot models.PlaylistSnapshot) *models.WriteBackPlan {
+	plan := &models.WriteBackPlan{
+		Kind:          models.WriteBackRecreatePlaylist,
+		Name:          snapshot.Playlist.Name,
+		Operations:    []models.WriteBackOperation{},
+		SkippedTracks: []models.PlanTrack{},
+	}
+	plan.Operations = append(plan.Operations, models.WriteBackOperation{
+		Type:        models.PlaylistOpCreate,
+		Name:        snapshot.Playlist.Name,
+		Description: snapshot.Playlist.Description,
+		Public:      snapshot.Playlist.Public,
+	})
+
+	var tracks []models.PlanTrack
+	for i, t := range snapshot.Tracks {
+		if isLocalTrack(t) {
+			plan.SkippedTracks = append(plan.SkippedTracks, models.PlanTrack{URI: trackURI(t), Name: t.Track.Name, Position: i, Reason: models.SkipReasonLocal})
+			continue
+		}
+		tracks = append(tracks, models.PlanTrack{URI: trackURI(t), Name: t.Track.Name, Position: len(tracks)})
+	}
+	for start := 0; start < len(tracks); start += playlistTracksBatchSize {
+		end := start + playlistTracksBatchSize
+		if end > len(tracks) {
+			end = len(tracks)
+		}
+		plan.Operations = append(plan.Operations, models.WriteBackOperation{Type: models.PlaylistOpAdd, Tracks: tracks[start:end]})
+	}
+	fillPlaylistStates(nil, plan)
+	return plan
+}
+
+// planPlaylistRollback plans the minimal changes turning current playlist tracks into the snapshot tracks: tracks
+// not in the snapshot are removed, tracks out of the snapshot order are moved, and missing tracks are added.
+// Only the tracks outside of the longest run of tracks already in the snapshot order are moved.
+func planPlaylistRollback(current []models.SpPlaylistTrack, snapshot models.PlaylistSnapshot) *models.WriteBackPlan {
+	plan := &models.WriteBackPlan{
+		Kind:          models.WriteBackRollbackPlaylist,
+		Name:          snapshot.Playlist.Name,
+		Operations:    []models.WriteBackOperation{},
+		SkippedTracks: []models.PlanTrack{},
+	}
+	target := snapshot.Tracks
+
+	// each current track is matched to the next unmatched occurrence of the same track in the snapshot
+	targetIndexes := make(map[string][]int)
+	for ti, t := range target {
+		uri := trackURI(t)
+		targetIndexes[uri] = append(targetIndexes[uri], ti)
+	}
+	var working []planItem
+	var removed []planItem
+	for _, t := range current {
+		item := planItem{track: models.PlanTrack{URI: trackURI(t), Name: t.Track.Name}, targetIndex: -1}
+		if indexes := targetIndexes[item.track.URI]; len(indexes) > 0 {
+			item.targetIndex = indexes[0]
+			targetIndexes[item.track.URI] = indexes[1:]
+		}
+		working = append(working, item)
+		if item.targetIndex < 0 {
+			removed = append(removed, item)
+		}
+	}
+
+	// removing, in batches, with positions in the playlist as left by the previous batch
+	for start := 0; start < len(removed); start += playlistTracksBatchSize {
+		end := start + playlistTracksBatchSize
+		if end > len(removed) {
+			end = len(removed)
+		}
+		op := models.WriteBackOperation{Type: models.PlaylistOpRemove}
+		toRemove := make(map[int]bool)
+		removedInBatch := 0
+		for pos, item := range working {
+			if item.targetIndex >= 0 || removedInBatch == end-start {
+				continue
+			}
+			removedInBatch++
+			toRemove[pos] = true
+			op.Tracks = append(op.Tracks, models.PlanTrack{URI: item.track.URI, Name: item.track.Name, Position: pos})
+		}
+		var left []planItem
+		for pos, item := range working {
+			if !toRemove[pos] {
+				left = append(left, item)
+			}
+		}
+		working = left
+		plan.Operations = append(plan.Operations, op)
+	}
+
+	// moving the tracks out of order, one by one, right after the closest preceding track already in order
+	inOrder := longestIncreasingRun(working)
+	var toMove []int
+	for _, item := range working {
+		if !inOrder[item.targetIndex] {
+			toMove = append(toMove, item.targetIndex)
+		}
+	}
+	sort.Ints(toMove)
+	for _, targetIndex := range toMove {
+		from := indexOfTarget(working, targetIndex)
+		item := working[from]
+		working = append(working[:from], working[from+1:]...)
+		to := 0
+		for pos, other := range working {
+			if inOrder[other.targetIndex] && other.targetIndex < targetIndex {
+				to = pos + 1
+			}
+		}
+		working = append(working[:to], append([]planItem{item}, working[to:]...)...)
+		inOrder[targetIndex] = true
+
+		// Spotify expects the insert position in the playlist before the track is moved
+		insertBefore := to
+		if to > from {
+			insertBefore = to + 1
+		}
+		item.track.Position = from
+		plan.Operations = append(plan.Operations, models.WriteBackOperation{
+			Type:         models.PlaylistOpReorder,
+			Tracks:       []models.PlanTrack{item.track},
+			InsertBefore: &insertBefore,
+		})
+	}
+
+	// adding the missing tracks, consecutive ones together, at their positions in the snapshot
+	matched := make(map[int]bool)
+	for _, item := range working {
+		matched[item.targetIndex] = true
+	}
+	var addOp *models.WriteBackOperation
+	lastAdded := -1
+	for ti, t := range target {
+		if matched[ti] {
+			continue
+		}
+		track := models.PlanTrack{URI: trackURI(t), Name: t.Track.Name}
+		if isLocalTrack(t) {
+			track.Position = ti
+			track.Reason = models.SkipReasonLocal
+			plan.SkippedTracks = append(plan.SkippedTracks, track)
+			continue
+		}
+		for _, item := range working {
+			if item.targetIndex < ti {
+				track.Position++
+			}
+		}
+		if addOp == nil || lastAdded != ti-1 || len(addOp.Tracks) == playlistTracksBatchSize {
+			plan.Operations = append(plan.Operations, models.WriteBackOperation{Type: models.PlaylistOpAdd})
+			addOp = &plan.Operations[len(plan.Operations)-1]
+		}
+		addOp.Tracks = append(addOp.Tracks, track)
+		working = append(working[:track.Position], append([]planItem{{track: track, targetIndex: ti}}, working[track.Position:]...)...)
+		lastAdded = ti
+	}
+
+	var currentURIs []string
+	for _, t := range current {
+		currentURIs = append(currentURIs, trackURI(t))
+	}
+	fillPlaylistStates(currentURIs, plan)
+	return plan
+}
+
+// planPlaylistDedup plans removing copies of duplicated tracks from the playlist, keeping the first copy of each one
+func planPlaylistDedup(playlist models.SpPlaylist, current []models.SpPlaylistTrack) *models.WriteBackPlan {
+	kept, _ := withoutDuplicates(&playlist, current)
+	// rolling back to the playlist without the copies only removes them, as the kept tracks are in order
+	plan := planPlaylistRollback(current, models.PlaylistSnapshot{Playlist: playlist, Tracks: kept})
+	plan.Kind = models.WriteBackDedupPlaylist
+	return plan
+}
+
+// planPlaylistsMerge plans creating a new playlist with the tracks of all the playlists, in order. Copies of duplicated
+// tracks are left out, unless keepDuplicates is set.
+func planPlaylistsMerge(name string, playlists []models.PlaylistSnapshot, keepDuplicates bool) *models.WriteBackPlan {
+	merged := models.PlaylistSnapshot{Playlist: models.SpPlaylist{Name: name}}
+	var names []string
+	for _, pl := range playlists {
+		merged.Tracks = append(merged.Tracks, pl.Tracks...)
+		names = append(names, pl.Playlist.Name)
+	}
+	merged.Playlist.Description = "Merged from " + strings.Join(names, ", ")
+
+	var copies []models.SpPlaylistTrack
+	if !keepDuplicates {
+		merged.Tracks, copies = withoutDuplicates(&merged.Playlist, merged.Tracks)
+	}
+	plan := planPlaylistRecreate(merged)
+	plan.Kind = models.WriteBackMergePlaylists
+	for _, t := range copies {
+		plan.SkippedTracks = append(plan.SkippedTracks, models.PlanTrack{URI: trackURI(t), Name: t.Track.Name, Reason: models.SkipReasonDuplicate})
+	}
+	return plan
+}
+
+// fillPlaylistStates sets track URIs of the playlist before and after each plan operation, starting with given tracks
+func fillPlaylistStates(tracks []string, plan *models.WriteBackPlan) {
+	for i := range plan.Operations {
+		op := &plan.Operations[i]
+		op.Before = append([]string{}, tracks...)
+		tracks = applyPlaylistOperation(tracks, op)
+		op.After = append([]string{}, tracks...)
+	}
+}
+
+// applyPlaylistOperation returns track URIs of the playlist after the operation, the way Spotify API applies it
+func applyPlaylistOperation(tracks []string, op *models.WriteBackOperation) []string {
+	changed := []string{}
+	switch op.Type {
+	case models.PlaylistOpAdd:
+		pos := op.Tracks[0].Position
+		changed = append(changed, tracks[:pos]...)
+		for _, t := range op.Tracks {
+			changed = append(changed, t.URI)
+		}
+		changed = append(changed, tracks[pos:]...)
+	case models.PlaylistOpRemove:
+		removed := make(map[int]bool)
+		for _, t := range op.Tracks {
+			removed[t.Position] = true
+		}
+		for pos, uri := range tracks {
+			if !removed[pos] {
+				changed = append(changed, uri)
+			}
+		}
+	case models.PlaylistOpReorder:
+		from := op.Tracks[0].Position
+		for pos := 0; pos <= len(tracks); pos++ {
+			if pos == *op.InsertBefore {
+				changed = append(changed, tracks[from])
+			}
+			if pos < len(tracks) && pos != from {
+				changed = append(changed, tracks[pos])
+			}
+		}
+	}
+	return changed
+}
+
+// planItem is a track of the playlist being planned, along with its index in the snapshot, -1 if not in the snapshot
+type planItem struct {
+	track       models.PlanTrack
+	targetIndex int
+}
+
+// longestIncreasingRun finds the longest subsequence of items in the snapshot order, returning their snapshot indexes
+func longestIncreasingRun(items []planItem) map[int]bool {
+	// tails[l] is the index of the item ending the best run of length l+1, previous links the items of the runs
+	var tails []int
+	previous := make([]int, len(items))
+	for i, item := range items {
+		l := sort.Search(len(tails), func(l int) bool {
+			return items[tails[l]].targetIndex >= item.targetIndex
+		})
+		previous[i] = -1
+		if l > 0 {
+			previous[i] = tails[l-1]
+		}
+		if l == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[l] = i
+		}
+	}
+
+	inOrder := make(map[int]bool)
+	if len(tails) == 0 {
+		return inOrder
+	}
+	for i := tails[len(tails)-1]; i >= 0; i = previous[i] {
+		inOrder[items[i].targetIndex] = true
+	}
+	return inOrder
+}
+
+func indexOfTarget(items []planItem, targetIndex int) int {
+	for i, item := range items {
+		if item.targetIndex == targetIndex {
+			return i
+		}
+	}
+	return -1
+}
+
+func trackURI(t models.SpPlaylistTrack) string {
+	if len(t.Track.URI) > 0 {
+		return t.Track.URI
+	}
+	return "spotify:track:" + t.Track.ID
+}
+
+func isLocalTrack(t models.SpPlaylistTrack) bool {
+	return t.IsLocal || t.Track.IsLocal
+}
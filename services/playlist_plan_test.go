@@ -0,0 +1,215 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// applyPlan runs plan operations over the playlist track URIs, the way Spotify API does
+func applyPlan(t *testing.T, tracks []string, plan *models.WriteBackPlan) []string {
+	tracks = append([]string{}, tracks...)
+	for _, op := range plan.Operations {
+		switch op.Type {
+		case models.PlaylistOpCreate:
+			tracks = []string{}
+		case models.PlaylistOpAdd:
+			pos := op.Tracks[0].Position
+			if !assert.True(t, pos <= len(tracks), "add position out of range") {
+				t.FailNow()
+			}
+			var added []string
+			for _, track := range op.Tracks {
+				added = append(added, track.URI)
+			}
+			tracks = append(tracks[:pos], append(added, tracks[pos:]...)...)
+		case models.PlaylistOpRemove:
+			toRemove := make(map[int]bool)
+			for _, track := range op.Tracks {
+				if !assert.Equal(t, track.URI, tracks[track.Position], "removed track must be at its position") {
+					t.FailNow()
+				}
+				toRemove[track.Position] = true
+			}
+			var left []string
+			for pos, uri := range tracks {
+				if !toRemove[pos] {
+					left = append(left, uri)
+				}
+			}
+			tracks = left
+		case models.PlaylistOpReorder:
+			from, insertBefore := op.Tracks[0].Position, *op.InsertBefore
+			if !assert.Equal(t, op.Tracks[0].URI, tracks[from], "moved track must be at its position") {
+				t.FailNow()
+			}
+			moved := tracks[from]
+			var reordered []string
+			for pos, uri := range tracks {
+				if pos == insertBefore {
+					reordered = append(reordered, moved)
+				}
+				if pos != from {
+					reordered = append(reordered, uri)
+				}
+			}
+			if insertBefore == len(tracks) {
+				reordered = append(reordered, moved)
+			}
+			tracks = reordered
+		}
+	}
+	return tracks
+}
+
+func planTestTracks(uris string) []models.SpPlaylistTrack {
+	var tracks []models.SpPlaylistTrack
+	for _, uri := range strings.Fields(uris) {
+		track := models.SpPlaylistTrack{Track: models.SpTrack{URI: uri, Name: "name-" + uri}}
+		if strings.HasPrefix(uri, "local") {
+			track.IsLocal = true
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks
+}
+
+func countOps(plan *models.WriteBackPlan, opType string) int {
+	count := 0
+	for _, op := range plan.Operations {
+		if op.Type == opType {
+			count++
+		}
+	}
+	return count
+}
+
+func TestPlanPlaylistRollback(t *testing.T) {
+	cases := []struct {
+		current  string
+		snapshot string
+		removes  int
+		moves    int
+		adds     int
+	}{
+		{current: "a b c", snapshot: "a b c"},
+		{current: "", snapshot: "a b c", adds: 1},
+		{current: "a b c", snapshot: "", removes: 1},
+		{current: "a x b y c", snapshot: "a b c", removes: 1},
+		{current: "a c", snapshot: "a b c d", adds: 2},
+		{current: "c a b", snapshot: "a b c", moves: 1},
+		{current: "b c d e a", snapshot: "a b c d e", moves: 1},
+		{current: "e d c b a", snapshot: "a b c d e", moves: 4},
+		{current: "a b a c", snapshot: "a a b c", moves: 1},
+		{current: "x c a y b", snapshot: "a b z c", removes: 1, moves: 1, adds: 1},
+		{current: "d a c b", snapshot: "a b c d", moves: 2},
+	}
+	for _, c := range cases {
+		snapshot := models.PlaylistSnapshot{Tracks: planTestTracks(c.snapshot)}
+		plan := planPlaylistRollback(planTestTracks(c.current), snapshot)
+
+		result := applyPlan(t, strings.Fields(c.current), plan)
+		assert.Equal(t, strings.Fields(c.snapshot), append([]string{}, result...), "rolling back [%s] to [%s]", c.current, c.snapshot)
+		assert.Equal(t, c.removes, countOps(plan, models.PlaylistOpRemove), "removes of [%s] to [%s]", c.current, c.snapshot)
+		assert.Equal(t, c.moves, countOps(plan, models.PlaylistOpReorder), "moves of [%s] to [%s]", c.current, c.snapshot)
+		assert.Equal(t, c.adds, countOps(plan, models.PlaylistOpAdd), "adds of [%s] to [%s]", c.current, c.snapshot)
+
+		// states before and after each operation are chained, from the current tracks to the snapshot ones
+		before := strings.Fields(c.current)
+		for _, op := range plan.Operations {
+			assert.Equal(t, before, op.Before)
+			before = op.After
+		}
+		assert.Equal(t, strings.Fields(c.snapshot), before)
+	}
+}
+
+func TestPlanPlaylistRollbackSkipsLocalTracks(t *testing.T) {
+	snapshot := models.PlaylistSnapshot{Tracks: planTestTracks("a local-0 b c")}
+	plan := planPlaylistRollback(planTestTracks("a c"), snapshot)
+
+	assert.Equal(t, []string{"a", "b", "c"}, applyPlan(t, []string{"a", "c"}, plan))
+	if assert.Equal(t, 1, len(plan.SkippedTracks)) {
+		assert.Equal(t, "local-0", plan.SkippedTracks[0].URI)
+		assert.Equal(t, 1, plan.SkippedTracks[0].Position)
+	}
+}
+
+func TestPlanPlaylistRollbackBatches(t *testing.T) {
+	var current, target []string
+	for i := 0; i < 250; i++ {
+		current = append(current, fmt.Sprintf("removed-%d", i))
+		target = append(target, fmt.Sprintf("added-%d", i))
+	}
+	snapshot := models.PlaylistSnapshot{Tracks: planTestTracks(strings.Join(target, " "))}
+	plan := planPlaylistRollback(planTestTracks(strings.Join(current, " ")), snapshot)
+
+	assert.Equal(t, target, applyPlan(t, current, plan))
+	assert.Equal(t, 3, countOps(plan, models.PlaylistOpRemove))
+	assert.Equal(t, 3, countOps(plan, models.PlaylistOpAdd))
+	for _, op := range plan.Operations {
+		assert.True(t, len(op.Tracks) <= playlistTracksBatchSize)
+	}
+}
+
+func TestPlanPlaylistRecreate(t *testing.T) {
+	snapshot := models.PlaylistSnapshot{
+		Playlist: models.SpPlaylist{Name: "road trip", Description: "songs for the road", Public: true},
+		Tracks:   planTestTracks("a local-0 b c"),
+	}
+	plan := planPlaylistRecreate(snapshot)
+
+	if assert.Equal(t, 2, len(plan.Operations)) {
+		create := plan.Operations[0]
+		assert.Equal(t, models.PlaylistOpCreate, create.Type)
+		assert.Equal(t, "road trip", create.Name)
+		assert.Equal(t, "songs for the road", create.Description)
+		assert.True(t, create.Public)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, applyPlan(t, nil, plan))
+	assert.Equal(t, 1, len(plan.SkippedTracks))
+}
+
+func TestPlanPlaylistDedup(t *testing.T) {
+	current := planTestTracks("a b a local-0 c b local-0 a")
+	// c is a relinked copy of a, with the same ISRC
+	current[0].Track.ExternalIds.Isrc = "ISRC-A"
+	current[4].Track.ExternalIds.Isrc = "ISRC-A"
+	plan := planPlaylistDedup(models.SpPlaylist{ID: "pl", Name: "dups"}, current)
+
+	assert.Equal(t, models.WriteBackDedupPlaylist, plan.Kind)
+	assert.Equal(t, []string{"a", "b", "local-0", "local-0"}, applyPlan(t, strings.Fields("a b a local-0 c b local-0 a"), plan))
+	assert.Equal(t, 1, countOps(plan, models.PlaylistOpRemove))
+	assert.Equal(t, 0, countOps(plan, models.PlaylistOpReorder))
+	assert.Equal(t, 0, countOps(plan, models.PlaylistOpAdd))
+
+	plan = planPlaylistDedup(models.SpPlaylist{ID: "pl"}, planTestTracks("a b c"))
+	assert.Empty(t, plan.Operations)
+}
+
+func TestPlanPlaylistsMerge(t *testing.T) {
+	playlists := []models.PlaylistSnapshot{
+		{Playlist: models.SpPlaylist{ID: "pl-1", Name: "first"}, Tracks: planTestTracks("a b local-0")},
+		{Playlist: models.SpPlaylist{ID: "pl-2", Name: "second"}, Tracks: planTestTracks("c a d")},
+	}
+
+	plan := planPlaylistsMerge("merged", playlists, false)
+	assert.Equal(t, models.WriteBackMergePlaylists, plan.Kind)
+	if assert.Equal(t, models.PlaylistOpCreate, plan.Operations[0].Type) {
+		assert.Equal(t, "merged", plan.Operations[0].Name)
+		assert.Equal(t, "Merged from first, second", plan.Operations[0].Description)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, applyPlan(t, nil, plan))
+	if assert.Equal(t, 2, len(plan.SkippedTracks)) {
+		assert.Equal(t, models.SkipReasonLocal, plan.SkippedTracks[0].Reason)
+		assert.Equal(t, models.PlanTrack{URI: "a", Name: "name-a", Reason: models.SkipReasonDuplicate}, plan.SkippedTracks[1])
+	}
+
+	plan = planPlaylistsMerge("merged", playlists, true)
+	assert.Equal(t, []string{"a", "b", "c", "a", "d"}, applyPlan(t, nil, plan))
+	assert.Equal(t, 1, len(plan.SkippedTracks))
+}
@@ -1,8 +1,8 @@
 package services
 
 import (
-	"encoding/json"
 	"fmt"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 
@@ -14,6 +14,8 @@ import (
 type UserPlaylistService interface {
 	DownloadCurrentUserPlaylists(accessToken string) (playlists []models.SpPlaylist, err *models.SpAPIError)
 	DownloadPlaylistTracks(accessToken string, href string, total int) (tracks []models.SpPlaylistTrack, err *models.SpAPIError)
+	DownloadPlaylistsTracks(accessToken string, playlists []models.SpPlaylist) []PlaylistTracksResult
+	DownloadChangedPlaylistsTracks(accessToken string, playlists []models.SpPlaylist, previous *models.PlaylistsSnapshot) []PlaylistTracksResult
 	DownloadSavedFavTracks(accessToken string) (tracks []models.SpAddedTrack, err *models.SpAPIError)
 	SaveFavTracksSnapshot(ft *models.FavTracksSnapshot) (saved bool)
 	SavePlaylistsSnapshot(ps *models.PlaylistsSnapshot) (saved bool)
@@ -21,8 +23,48 @@ type UserPlaylistService interface {
 	GetPlaylistsSnapshotByTimestamp(username string, timestamp string) (*models.PlaylistsSnapshot, error)
 	GetAllFavTracksSnapshots(username string) []models.FavTracksSnapshot
 	GetAllPlaylistsSnapshots(username string) []models.PlaylistsSnapshot
+	GetLatestPlaylistsSnapshot(username string) *models.PlaylistsSnapshot
 	DeletePlaylistsSnapshot(username string, timestamp string) (*models.PlaylistsSnapshot, error)
 	DeleteFavTracksSnapshot(username string, timestamp string) (*models.FavTracksSnapshot, error)
+
+	DownloadFollowedArtists(accessToken string) (artists []models.SpFullArtist, err *models.SpAPIError)
+	SaveFollowedArtistsSnapshot(s *models.FollowedArtistsSnapshot) (saved bool)
+	GetFollowedArtistsSnapshotByTimestamp(username string, timestamp string) (*models.FollowedArtistsSnapshot, error)
+	GetAllFollowedArtistsSnapshots(username string) []models.FollowedArtistsSnapshot
+	DeleteFollowedArtistsSnapshot(username string, timestamp string) (*models.FollowedArtistsSnapshot, error)
+
+	DownloadSavedAlbums(accessToken string) (albums []models.SpSavedAlbum, err *models.SpAPIError)
+	SaveSavedAlbumsSnapshot(s *models.SavedAlbumsSnapshot) (saved bool)
+	GetSavedAlbumsSnapshotByTimestamp(username string, timestamp string) (*models.SavedAlbumsSnapshot, error)
+	GetAllSavedAlbumsSnapshots(username string) []models.SavedAlbumsSnapshot
+	DeleteSavedAlbumsSnapshot(username string, timestamp string) (*models.SavedAlbumsSnapshot, error)
+
+	DownloadSavedShows(accessToken string) (shows []models.SpSavedShow, err *models.SpAPIError)
+	SaveSavedShowsSnapshot(s *models.SavedShowsSnapshot) (saved bool)
+	GetSavedShowsSnapshotByTimestamp(username string, timestamp string) (*models.SavedShowsSnapshot, error)
+	GetAllSavedShowsSnapshots(username string) []models.SavedShowsSnapshot
+	DeleteSavedShowsSnapshot(username string, timestamp string) (*models.SavedShowsSnapshot, error)
+
+	DownloadSavedEpisodes(accessToken string) (episodes []models.SpSavedEpisode, err *models.SpAPIError)
+	SaveSavedEpisodesSnapshot(s *models.SavedEpisodesSnapshot) (saved bool)
+	GetSavedEpisodesSnapshotByTimestamp(username string, timestamp string) (*models.SavedEpisodesSnapshot, error)
+	GetAllSavedEpisodesSnapshots(username string) []models.SavedEpisodesSnapshot
+	DeleteSavedEpisodesSnapshot(username string, timestamp string) (*models.SavedEpisodesSnapshot, error)
+
+	DownloadTopItems(accessToken string) (topItems models.TopItems, err *models.SpAPIError)
+	SaveTopItemsSnapshot(s *models.TopItemsSnapshot) (saved bool)
+	GetTopItemsSnapshotByTimestamp(username string, timestamp string) (*models.TopItemsSnapshot, error)
+	GetAllTopItemsSnapshots(username string) []models.TopItemsSnapshot
+	DeleteTopItemsSnapshot(username string, timestamp string) (*models.TopItemsSnapshot, error)
+}
+
+// PlaylistTracksResult holds the tracks downloaded for a single playlist, or the error that occurred meanwhile.
+// Reused is set when the tracks are taken from a previous snapshot instead of being downloaded.
+type PlaylistTracksResult struct {
+	Playlist models.SpPlaylist
+	Tracks   []models.SpPlaylistTrack
+	Err      *models.SpAPIError
+	Reused   bool
 }
 
 // TODO: removed this, it is unnecessary, especially that all these values can be found in config obj
@@ -31,6 +73,13 @@ type SpotifyUserPlaylistService struct {
 	spotifyAPIURL             string
 	urlCurrentUserPlaylists   string
 	urlCurrentUserSavedTracks string
+	urlFollowedArtists        string
+	urlSavedAlbums            string
+	urlSavedShows             string
+	urlSavedEpisodes          string
+	urlTopTracks              string
+	urlTopArtists             string
+	playlistDownloadWorkers   int
 }
 
 func NewSpotifyUserPlaylistService(spotifyDB db.SpotifyDBClient) UserPlaylistService {
@@ -39,123 +88,124 @@ func NewSpotifyUserPlaylistService(spotifyDB db.SpotifyDBClient) UserPlaylistSer
 	ps.spotifyAPIURL = config.Conf.SpotifyAPIURL
 	ps.urlCurrentUserPlaylists = config.Conf.URLCurrentUserPlaylists
 	ps.urlCurrentUserSavedTracks = config.Conf.URLCurrentUserSavedTracks
+	ps.urlFollowedArtists = config.Conf.URLFollowedArtists
+	ps.urlSavedAlbums = config.Conf.URLSavedAlbums
+	ps.urlSavedShows = config.Conf.URLSavedShows
+	ps.urlSavedEpisodes = config.Conf.URLSavedEpisodes
+	ps.urlTopTracks = config.Conf.URLTopTracks
+	ps.urlTopArtists = config.Conf.URLTopArtists
+	ps.playlistDownloadWorkers = config.Conf.PlaylistDownloadWorkers
 	return ps
 }
 
 // DownloadCurrentUserPlaylists more info: https://developer.spotify.com/console/get-current-user-playlists/
 func (ups *SpotifyUserPlaylistService) DownloadCurrentUserPlaylists(accessToken string) (playlists []models.SpPlaylist, err *models.SpAPIError) {
-	offset := 0
-	prevCount := 0
-	for {
-		path := fmt.Sprintf("%s?offset=%d&limit=50", ups.urlCurrentUserPlaylists, offset)
-		body, err := getFromSpotify(ups.spotifyAPIURL, path, accessToken)
-		if err != nil {
-			errMsg := fmt.Sprintf(" >>> error getting current user playlists. details: %s", err.Error())
-			return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
-		}
-		if apiErr, isError := getAPIError(body); isError {
-			log.Printf(" >>> API error: status [%d] -> [%s]\n", apiErr.Error.Status, apiErr.Error.Message)
-			return nil, &apiErr
-		}
-
-		var response models.SpGetCurrentPlaylistsResp
-		err = json.Unmarshal(body, &response)
-		if err != nil {
-			errMsg := fmt.Sprintf(" >>> error occurred while unmarshaling get playlists response: %s", err.Error())
-			return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
-		}
-
-		playlists = append(playlists, response.Items...)
-
-		if len(response.Next) == 0 {
-			return playlists, nil
-		}
-
-		// safety mechanism against infinite loop - if no new tracks are added, bail out
-		if prevCount == len(playlists) {
-			log.Println(" > no new tracks coming in, bail out")
-			return playlists, nil
-		}
-		prevCount = len(playlists)
-
-		offset += 50
+	path := fmt.Sprintf("%s?offset=0&limit=50", ups.urlCurrentUserPlaylists)
+	pages := newPageIterator(ups.spotifyAPIURL, path, accessToken, "current user playlists",
+		func() spotifyPage { return &models.SpGetCurrentPlaylistsResp{} })
+	for pages.Next() {
+		page := pages.Page().(*models.SpGetCurrentPlaylistsResp)
+		playlists = append(playlists, page.Items[:pages.Take(len(page.Items))]...)
+	}
+	if err = pages.Err(); err != nil {
+		return nil, err
 	}
+	return playlists, nil
 }
 
 func (ups *SpotifyUserPlaylistService) DownloadPlaylistTracks(accessToken string, href string, total int) (tracks []models.SpPlaylistTrack, err *models.SpAPIError) {
 	tracks = []models.SpPlaylistTrack{}
-	prevCount := 0
-	nextHref := href
-	for {
-		body, err := getFromSpotify(nextHref, "", accessToken)
-		if err != nil {
-			errMsg := fmt.Sprintf(" >>> error getting playlist tracks. details: %s", err.Error())
-			return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
-		}
-		if apiErr, isError := getAPIError(body); isError {
-			log.Printf(" >>> API getting playlist tracks error: status [%d] -> [%s]\n", apiErr.Error.Status, apiErr.Error.Message)
-			return nil, &apiErr
-		}
+	pages := newPageIterator(href, "", accessToken, "playlist tracks",
+		func() spotifyPage { return &models.SpGetPlaylistTracksResp{} })
+	pages.maxItems = total
+	for pages.Next() {
+		page := pages.Page().(*models.SpGetPlaylistTracksResp)
+		tracks = append(tracks, page.Items[:pages.Take(len(page.Items))]...)
+	}
+	if err = pages.Err(); err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
 
-		var response models.SpGetPlaylistTracksResp
-		err = json.Unmarshal(body, &response)
-		if err != nil {
-			errMsg := fmt.Sprintf(" >>> error occurred while unmarshaling get playlist tracks response: %s", err.Error())
-			return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
-		}
+// DownloadPlaylistsTracks downloads tracks of given playlists concurrently, using a bounded pool of workers.
+// Results are in the same order as the playlists.
+func (ups *SpotifyUserPlaylistService) DownloadPlaylistsTracks(accessToken string, playlists []models.SpPlaylist) []PlaylistTracksResult {
+	workersCount := ups.playlistDownloadWorkers
+	if workersCount < 1 {
+		workersCount = 1
+	}
 
-		tracks = append(tracks, response.Items...)
-		if len(response.Next) == 0 || len(tracks) >= total {
-			return tracks, nil
-		}
-		nextHref = response.Next
+	results := make([]PlaylistTracksResult, len(playlists))
+	playlistIndexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workersCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for plIndex := range playlistIndexes {
+				pl := playlists[plIndex]
+				tracks, apiErr := ups.DownloadPlaylistTracks(accessToken, pl.Tracks.Href, pl.Tracks.Total)
+				results[plIndex] = PlaylistTracksResult{Playlist: pl, Tracks: tracks, Err: apiErr}
+			}
+		}()
+	}
 
-		// safety mechanism against infinite loop - if no new tracks are added, bail out
-		if prevCount == len(tracks) {
-			log.Println(" > no new tracks coming in, bail out")
-			return tracks, nil
-		}
-		prevCount = len(tracks)
+	for i := range playlists {
+		playlistIndexes <- i
 	}
+	close(playlistIndexes)
+	wg.Wait()
+
+	return results
 }
 
-func (ups *SpotifyUserPlaylistService) DownloadSavedFavTracks(accessToken string) (tracks []models.SpAddedTrack, err *models.SpAPIError) {
-	offset := 0
-	prevCount := 0
-	for {
-		path := fmt.Sprintf("%s?offset=%d&limit=50", ups.urlCurrentUserSavedTracks, offset)
-		body, err := getFromSpotify(ups.spotifyAPIURL, path, accessToken)
-		if err != nil {
-			errMsg := fmt.Sprintf(" >>> error getting current user tracks. details: %s", err.Error())
-			return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
-		}
-		if apiErr, isError := getAPIError(body); isError {
-			log.Printf(" >>> API error: status [%d] -> [%s]\n", apiErr.Error.Status, apiErr.Error.Message)
-			return nil, &apiErr
+// DownloadChangedPlaylistsTracks downloads tracks only for the playlists changed since the previous snapshot, i.e. the ones
+// with a different Spotify snapshot ID. Tracks of unchanged playlists are reused from the previous snapshot.
+func (ups *SpotifyUserPlaylistService) DownloadChangedPlaylistsTracks(accessToken string, playlists []models.SpPlaylist, previous *models.PlaylistsSnapshot) []PlaylistTracksResult {
+	previousPlaylists := make(map[string]models.PlaylistSnapshot)
+	if previous != nil {
+		for _, pl := range previous.Playlists {
+			if pl.DownloadFailed || len(pl.Playlist.SnapshotID) == 0 {
+				continue
+			}
+			previousPlaylists[pl.Playlist.ID] = pl
 		}
+	}
 
-		var response models.SpGetSavedTracksResp
-		err = json.Unmarshal(body, &response)
-		if err != nil {
-			errMsg := fmt.Sprintf(" >>> error occurred while unmarshaling get tracks response: %s", err.Error())
-			return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	results := make([]PlaylistTracksResult, len(playlists))
+	var changedPlaylists []models.SpPlaylist
+	var changedIndexes []int
+	for i, pl := range playlists {
+		previousPl, found := previousPlaylists[pl.ID]
+		if found && previousPl.Playlist.SnapshotID == pl.SnapshotID {
+			results[i] = PlaylistTracksResult{Playlist: pl, Tracks: previousPl.Tracks, Reused: true}
+			continue
 		}
+		changedPlaylists = append(changedPlaylists, pl)
+		changedIndexes = append(changedIndexes, i)
+	}
 
-		tracks = append(tracks, response.Items...)
-
-		if len(response.Next) == 0 {
-			return tracks, nil
-		}
+	log.Tracef(" > playlists unchanged [%d], changed [%d]", len(playlists)-len(changedPlaylists), len(changedPlaylists))
+	for i, result := range ups.DownloadPlaylistsTracks(accessToken, changedPlaylists) {
+		results[changedIndexes[i]] = result
+	}
 
-		// safety mechanism against infinite loop - if no new tracks are added, bail out
-		if prevCount == len(tracks) {
-			log.Println(" > no new tracks coming in, bail out")
-			return tracks, nil
-		}
-		prevCount = len(tracks)
+	return results
+}
 
-		offset += 50
+func (ups *SpotifyUserPlaylistService) DownloadSavedFavTracks(accessToken string) (tracks []models.SpAddedTrack, err *models.SpAPIError) {
+	path := fmt.Sprintf("%s?offset=0&limit=50", ups.urlCurrentUserSavedTracks)
+	pages := newPageIterator(ups.spotifyAPIURL, path, accessToken, "current user tracks",
+		func() spotifyPage { return &models.SpGetSavedTracksResp{} })
+	for pages.Next() {
+		page := pages.Page().(*models.SpGetSavedTracksResp)
+		tracks = append(tracks, page.Items[:pages.Take(len(page.Items))]...)
+	}
+	if err = pages.Err(); err != nil {
+		return nil, err
 	}
+	return tracks, nil
 }
 
 func (ups *SpotifyUserPlaylistService) SaveFavTracksSnapshot(ft *models.FavTracksSnapshot) (saved bool) {
@@ -182,6 +232,10 @@ func (ups *SpotifyUserPlaylistService) GetAllPlaylistsSnapshots(username string)
 	return ups.spotifyDB.GetAllPlaylistsSnapshots(username)
 }
 
+func (ups *SpotifyUserPlaylistService) GetLatestPlaylistsSnapshot(username string) *models.PlaylistsSnapshot {
+	return ups.spotifyDB.GetLatestPlaylistsSnapshot(username)
+}
+
 func (ups *SpotifyUserPlaylistService) DeletePlaylistsSnapshot(username string, timestamp string) (*models.PlaylistsSnapshot, error) {
 	return ups.spotifyDB.DeletePlaylistsSnapshot(username, timestamp)
 }
@@ -189,3 +243,185 @@ func (ups *SpotifyUserPlaylistService) DeletePlaylistsSnapshot(username string,
 func (ups *SpotifyUserPlaylistService) DeleteFavTracksSnapshot(username string, timestamp string) (*models.FavTracksSnapshot, error) {
 	return ups.spotifyDB.DeleteFavTracksSnapshot(username, timestamp)
 }
+
+// DownloadFollowedArtists more info: https://developer.spotify.com/documentation/web-api/reference/follow/get-followed/
+func (ups *SpotifyUserPlaylistService) DownloadFollowedArtists(accessToken string) (artists []models.SpFullArtist, err *models.SpAPIError) {
+	artists = []models.SpFullArtist{}
+	// followed artists endpoint is cursor based, next page URLs hold the "after" cursor
+	path := fmt.Sprintf("%s?type=artist&limit=50", ups.urlFollowedArtists)
+	pages := newPageIterator(ups.spotifyAPIURL, path, accessToken, "followed artists",
+		func() spotifyPage { return &models.SpGetFollowedArtistsResp{} })
+	for pages.Next() {
+		page := pages.Page().(*models.SpGetFollowedArtistsResp)
+		artists = append(artists, page.Artists.Items[:pages.Take(len(page.Artists.Items))]...)
+	}
+	if err = pages.Err(); err != nil {
+		return nil, err
+	}
+	return artists, nil
+}
+
+func (ups *SpotifyUserPlaylistService) SaveFollowedArtistsSnapshot(s *models.FollowedArtistsSnapshot) (saved bool) {
+	return ups.spotifyDB.SaveFollowedArtistsSnapshot(s)
+}
+
+func (ups *SpotifyUserPlaylistService) GetFollowedArtistsSnapshotByTimestamp(username string, timestamp string) (*models.FollowedArtistsSnapshot, error) {
+	return ups.spotifyDB.GetFollowedArtistsSnapshotByTimestamp(username, timestamp)
+}
+
+func (ups *SpotifyUserPlaylistService) GetAllFollowedArtistsSnapshots(username string) []models.FollowedArtistsSnapshot {
+	return ups.spotifyDB.GetAllFollowedArtistsSnapshots(username)
+}
+
+func (ups *SpotifyUserPlaylistService) DeleteFollowedArtistsSnapshot(username string, timestamp string) (*models.FollowedArtistsSnapshot, error) {
+	return ups.spotifyDB.DeleteFollowedArtistsSnapshot(username, timestamp)
+}
+
+// DownloadSavedAlbums more info: https://developer.spotify.com/documentation/web-api/reference/library/get-users-saved-albums/
+func (ups *SpotifyUserPlaylistService) DownloadSavedAlbums(accessToken string) (albums []models.SpSavedAlbum, err *models.SpAPIError) {
+	albums = []models.SpSavedAlbum{}
+	path := fmt.Sprintf("%s?offset=0&limit=50", ups.urlSavedAlbums)
+	pages := newPageIterator(ups.spotifyAPIURL, path, accessToken, "saved albums",
+		func() spotifyPage { return &models.SpGetSavedAlbumsResp{} })
+	for pages.Next() {
+		page := pages.Page().(*models.SpGetSavedAlbumsResp)
+		albums = append(albums, page.Items[:pages.Take(len(page.Items))]...)
+	}
+	if err = pages.Err(); err != nil {
+		return nil, err
+	}
+	return albums, nil
+}
+
+func (ups *SpotifyUserPlaylistService) SaveSavedAlbumsSnapshot(s *models.SavedAlbumsSnapshot) (saved bool) {
+	return ups.spotifyDB.SaveSavedAlbumsSnapshot(s)
+}
+
+func (ups *SpotifyUserPlaylistService) GetSavedAlbumsSnapshotByTimestamp(username string, timestamp string) (*models.SavedAlbumsSnapshot, error) {
+	return ups.spotifyDB.GetSavedAlbumsSnapshotByTimestamp(username, timestamp)
+}
+
+func (ups *SpotifyUserPlaylistService) GetAllSavedAlbumsSnapshots(username string) []models.SavedAlbumsSnapshot {
+	return ups.spotifyDB.GetAllSavedAlbumsSnapshots(username)
+}
+
+func (ups *SpotifyUserPlaylistService) DeleteSavedAlbumsSnapshot(username string, timestamp string) (*models.SavedAlbumsSnapshot, error) {
+	return ups.spotifyDB.DeleteSavedAlbumsSnapshot(username, timestamp)
+}
+
+// DownloadSavedShows more info: https://developer.spotify.com/documentation/web-api/reference/library/get-users-saved-shows/
+func (ups *SpotifyUserPlaylistService) DownloadSavedShows(accessToken string) (shows []models.SpSavedShow, err *models.SpAPIError) {
+	shows = []models.SpSavedShow{}
+	path := fmt.Sprintf("%s?offset=0&limit=50", ups.urlSavedShows)
+	pages := newPageIterator(ups.spotifyAPIURL, path, accessToken, "saved shows",
+		func() spotifyPage { return &models.SpGetSavedShowsResp{} })
+	for pages.Next() {
+		page := pages.Page().(*models.SpGetSavedShowsResp)
+		shows = append(shows, page.Items[:pages.Take(len(page.Items))]...)
+	}
+	if err = pages.Err(); err != nil {
+		return nil, err
+	}
+	return shows, nil
+}
+
+func (ups *SpotifyUserPlaylistService) SaveSavedShowsSnapshot(s *models.SavedShowsSnapshot) (saved bool) {
+	return ups.spotifyDB.SaveSavedShowsSnapshot(s)
+}
+
+func (ups *SpotifyUserPlaylistService) GetSavedShowsSnapshotByTimestamp(username string, timestamp string) (*models.SavedShowsSnapshot, error) {
+	return ups.spotifyDB.GetSavedShowsSnapshotByTimestamp(username, timestamp)
+}
+
+func (ups *SpotifyUserPlaylistService) GetAllSavedShowsSnapshots(username string) []models.SavedShowsSnapshot {
+	return ups.spotifyDB.GetAllSavedShowsSnapshots(username)
+}
+
+func (ups *SpotifyUserPlaylistService) DeleteSavedShowsSnapshot(username string, timestamp string) (*models.SavedShowsSnapshot, error) {
+	return ups.spotifyDB.DeleteSavedShowsSnapshot(username, timestamp)
+}
+
+// DownloadSavedEpisodes more info: https://developer.spotify.com/documentation/web-api/reference/library/get-users-saved-episodes/
+func (ups *SpotifyUserPlaylistService) DownloadSavedEpisodes(accessToken string) (episodes []models.SpSavedEpisode, err *models.SpAPIError) {
+	episodes = []models.SpSavedEpisode{}
+	path := fmt.Sprintf("%s?offset=0&limit=50", ups.urlSavedEpisodes)
+	pages := newPageIterator(ups.spotifyAPIURL, path, accessToken, "saved episodes",
+		func() spotifyPage { return &models.SpGetSavedEpisodesResp{} })
+	for pages.Next() {
+		page := pages.Page().(*models.SpGetSavedEpisodesResp)
+		episodes = append(episodes, page.Items[:pages.Take(len(page.Items))]...)
+	}
+	if err = pages.Err(); err != nil {
+		return nil, err
+	}
+	return episodes, nil
+}
+
+func (ups *SpotifyUserPlaylistService) SaveSavedEpisodesSnapshot(s *models.SavedEpisodesSnapshot) (saved bool) {
+	return ups.spotifyDB.SaveSavedEpisodesSnapshot(s)
+}
+
+func (ups *SpotifyUserPlaylistService) GetSavedEpisodesSnapshotByTimestamp(username string, timestamp string) (*models.SavedEpisodesSnapshot, error) {
+	return ups.spotifyDB.GetSavedEpisodesSnapshotByTimestamp(username, timestamp)
+}
+
+func (ups *SpotifyUserPlaylistService) GetAllSavedEpisodesSnapshots(username string) []models.SavedEpisodesSnapshot {
+	return ups.spotifyDB.GetAllSavedEpisodesSnapshots(username)
+}
+
+func (ups *SpotifyUserPlaylistService) DeleteSavedEpisodesSnapshot(username string, timestamp string) (*models.SavedEpisodesSnapshot, error) {
+	return ups.spotifyDB.DeleteSavedEpisodesSnapshot(username, timestamp)
+}
+
+// DownloadTopItems downloads user's top tracks and artists for all time ranges,
+// more info: https://developer.spotify.com/documentation/web-api/reference/personalization/get-users-top-artists-and-tracks/
+func (ups *SpotifyUserPlaylistService) DownloadTopItems(accessToken string) (topItems models.TopItems, err *models.SpAPIError) {
+	topItems = models.TopItems{
+		Tracks:  make(map[string][]models.SpTrack),
+		Artists: make(map[string][]models.SpFullArtist),
+	}
+	for _, timeRange := range models.TopTimeRanges {
+		tracks := []models.SpTrack{}
+		path := fmt.Sprintf("%s?time_range=%s&offset=0&limit=50", ups.urlTopTracks, timeRange)
+		pages := newPageIterator(ups.spotifyAPIURL, path, accessToken, "top tracks",
+			func() spotifyPage { return &models.SpGetTopTracksResp{} })
+		for pages.Next() {
+			page := pages.Page().(*models.SpGetTopTracksResp)
+			tracks = append(tracks, page.Items[:pages.Take(len(page.Items))]...)
+		}
+		if err = pages.Err(); err != nil {
+			return topItems, err
+		}
+		topItems.Tracks[timeRange] = tracks
+
+		artists := []models.SpFullArtist{}
+		path = fmt.Sprintf("%s?time_range=%s&offset=0&limit=50", ups.urlTopArtists, timeRange)
+		pages = newPageIterator(ups.spotifyAPIURL, path, accessToken, "top artists",
+			func() spotifyPage { return &models.SpGetTopArtistsResp{} })
+		for pages.Next() {
+			page := pages.Page().(*models.SpGetTopArtistsResp)
+			artists = append(artists, page.Items[:pages.Take(len(page.Items))]...)
+		}
+		if err = pages.Err(); err != nil {
+			return topItems, err
+		}
+		topItems.Artists[timeRange] = artists
+	}
+	return topItems, nil
+}
+
+func (ups *SpotifyUserPlaylistService) SaveTopItemsSnapshot(s *models.TopItemsSnapshot) (saved bool) {
+	return ups.spotifyDB.SaveTopItemsSnapshot(s)
+}
+
+func (ups *SpotifyUserPlaylistService) GetTopItemsSnapshotByTimestamp(username string, timestamp string) (*models.TopItemsSnapshot, error) {
+	return ups.spotifyDB.GetTopItemsSnapshotByTimestamp(username, timestamp)
+}
+
+func (ups *SpotifyUserPlaylistService) GetAllTopItemsSnapshots(username string) []models.TopItemsSnapshot {
+	return ups.spotifyDB.GetAllTopItemsSnapshots(username)
+}
+
+func (ups *SpotifyUserPlaylistService) DeleteTopItemsSnapshot(username string, timestamp string) (*models.TopItemsSnapshot, error) {
+	return ups.spotifyDB.DeleteTopItemsSnapshot(username, timestamp)
+}
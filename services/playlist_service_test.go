@@ -0,0 +1,107 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// playlistTracksHTTPClientMock serves a single track for each playlist, named after the playlist,
+// earlier playlists being slower, while the playlist "failing" responds with an API error
+type playlistTracksHTTPClientMock struct{}
+
+func (c playlistTracksHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	plID := strings.TrimPrefix(req.URL.Path, "/playlists/")
+	if plID == "failing" {
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"error": {"status": 404, "message": "Not found."}}`)),
+			StatusCode: 404,
+		}, nil
+	}
+
+	var plIndex int
+	fmt.Sscanf(plID, "pl%d", &plIndex)
+	time.Sleep(time.Duration(10-plIndex) * time.Millisecond)
+
+	respBody := fmt.Sprintf(`{"total": 1, "items": [{"track": {"id": "%s-track", "name": "%s track"}}]}`, plID, plID)
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(respBody)),
+		StatusCode: 200,
+	}, nil
+}
+
+func TestDownloadPlaylistsTracks(t *testing.T) {
+	reqClient = requestClient{httpClient: &playlistTracksHTTPClientMock{}, requestTimeoutSeconds: 1}
+	ups := &SpotifyUserPlaylistService{playlistDownloadWorkers: 3}
+
+	var playlists []models.SpPlaylist
+	for i := 0; i < 10; i++ {
+		plID := fmt.Sprintf("pl%d", i)
+		if i == 4 {
+			plID = "failing"
+		}
+		playlists = append(playlists, models.SpPlaylist{
+			ID:     plID,
+			Tracks: models.SpTracks{Href: "http://test/playlists/" + plID, Total: 1},
+		})
+	}
+
+	results := ups.DownloadPlaylistsTracks("test-token", playlists)
+	if !assert.Equal(t, len(playlists), len(results)) {
+		t.FailNow()
+	}
+	for i, result := range results {
+		assert.Equal(t, playlists[i].ID, result.Playlist.ID, "results must keep the playlists order")
+		if playlists[i].ID == "failing" {
+			if assert.NotNil(t, result.Err) {
+				assert.Equal(t, 404, result.Err.Error.Status)
+			}
+			continue
+		}
+		assert.Nil(t, result.Err)
+		if assert.Equal(t, 1, len(result.Tracks)) {
+			assert.Equal(t, playlists[i].ID+"-track", result.Tracks[0].Track.ID)
+		}
+	}
+}
+
+func TestDownloadChangedPlaylistsTracks(t *testing.T) {
+	reqClient = requestClient{httpClient: &playlistTracksHTTPClientMock{}, requestTimeoutSeconds: 1}
+	ups := &SpotifyUserPlaylistService{playlistDownloadWorkers: 2}
+
+	playlists := []models.SpPlaylist{
+		{ID: "pl0", SnapshotID: "snap-0", Tracks: models.SpTracks{Href: "http://test/playlists/pl0", Total: 1}},
+		{ID: "pl1", SnapshotID: "snap-1-changed", Tracks: models.SpTracks{Href: "http://test/playlists/pl1", Total: 1}},
+		{ID: "pl2", SnapshotID: "snap-2", Tracks: models.SpTracks{Href: "http://test/playlists/pl2", Total: 1}},
+	}
+	storedTrack := models.SpPlaylistTrack{Track: models.SpTrack{ID: "stored-track"}}
+	previous := &models.PlaylistsSnapshot{
+		Playlists: []models.PlaylistSnapshot{
+			{Playlist: models.SpPlaylist{ID: "pl0", SnapshotID: "snap-0"}, Tracks: []models.SpPlaylistTrack{storedTrack}},
+			{Playlist: models.SpPlaylist{ID: "pl1", SnapshotID: "snap-1"}, Tracks: []models.SpPlaylistTrack{storedTrack}},
+			{Playlist: models.SpPlaylist{ID: "pl2", SnapshotID: "snap-2"}, Tracks: []models.SpPlaylistTrack{}, DownloadFailed: true},
+		},
+	}
+
+	results := ups.DownloadChangedPlaylistsTracks("test-token", playlists, previous)
+	if !assert.Equal(t, 3, len(results)) {
+		t.FailNow()
+	}
+
+	assert.True(t, results[0].Reused)
+	assert.Equal(t, "stored-track", results[0].Tracks[0].Track.ID)
+	// snapshot ID changed
+	assert.False(t, results[1].Reused)
+	assert.Equal(t, "pl1-track", results[1].Tracks[0].Track.ID)
+	// previous download failed, so nothing to reuse
+	assert.False(t, results[2].Reused)
+	assert.Equal(t, "pl2-track", results[2].Tracks[0].Track.ID)
+}
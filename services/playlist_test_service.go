@@ -26,6 +26,14 @@ func (ups *UserPlaylistTestService) DownloadPlaylistTracks(accessToken string, h
 	return nil, nil
 }
 
+func (ups *UserPlaylistTestService) DownloadPlaylistsTracks(accessToken string, playlists []models.SpPlaylist) []PlaylistTracksResult {
+	return nil
+}
+
+func (ups *UserPlaylistTestService) DownloadChangedPlaylistsTracks(accessToken string, playlists []models.SpPlaylist, previous *models.PlaylistsSnapshot) []PlaylistTracksResult {
+	return nil
+}
+
 func (ups *UserPlaylistTestService) DownloadSavedFavTracks(accessToken string) (tracks []models.SpAddedTrack, err *models.SpAPIError) {
 	return ups.currentSnapshots, nil
 }
@@ -60,6 +68,10 @@ func (ups *UserPlaylistTestService) GetAllPlaylistsSnapshots(username string) []
 	return nil
 }
 
+func (ups *UserPlaylistTestService) GetLatestPlaylistsSnapshot(username string) *models.PlaylistsSnapshot {
+	return nil
+}
+
 func (ups *UserPlaylistTestService) DeletePlaylistsSnapshot(username string, timestamp string) (*models.PlaylistsSnapshot, error) {
 	return nil, nil
 }
@@ -67,3 +79,103 @@ func (ups *UserPlaylistTestService) DeletePlaylistsSnapshot(username string, tim
 func (ups *UserPlaylistTestService) DeleteFavTracksSnapshot(username string, timestamp string) (*models.FavTracksSnapshot, error) {
 	return nil, nil
 }
+
+func (ups *UserPlaylistTestService) DownloadFollowedArtists(accessToken string) (artists []models.SpFullArtist, err *models.SpAPIError) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) SaveFollowedArtistsSnapshot(s *models.FollowedArtistsSnapshot) (saved bool) {
+	return true
+}
+
+func (ups *UserPlaylistTestService) GetFollowedArtistsSnapshotByTimestamp(username string, timestamp string) (*models.FollowedArtistsSnapshot, error) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) GetAllFollowedArtistsSnapshots(username string) []models.FollowedArtistsSnapshot {
+	return nil
+}
+
+func (ups *UserPlaylistTestService) DeleteFollowedArtistsSnapshot(username string, timestamp string) (*models.FollowedArtistsSnapshot, error) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) DownloadSavedAlbums(accessToken string) (albums []models.SpSavedAlbum, err *models.SpAPIError) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) SaveSavedAlbumsSnapshot(s *models.SavedAlbumsSnapshot) (saved bool) {
+	return true
+}
+
+func (ups *UserPlaylistTestService) GetSavedAlbumsSnapshotByTimestamp(username string, timestamp string) (*models.SavedAlbumsSnapshot, error) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) GetAllSavedAlbumsSnapshots(username string) []models.SavedAlbumsSnapshot {
+	return nil
+}
+
+func (ups *UserPlaylistTestService) DeleteSavedAlbumsSnapshot(username string, timestamp string) (*models.SavedAlbumsSnapshot, error) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) DownloadSavedShows(accessToken string) (shows []models.SpSavedShow, err *models.SpAPIError) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) SaveSavedShowsSnapshot(s *models.SavedShowsSnapshot) (saved bool) {
+	return true
+}
+
+func (ups *UserPlaylistTestService) GetSavedShowsSnapshotByTimestamp(username string, timestamp string) (*models.SavedShowsSnapshot, error) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) GetAllSavedShowsSnapshots(username string) []models.SavedShowsSnapshot {
+	return nil
+}
+
+func (ups *UserPlaylistTestService) DeleteSavedShowsSnapshot(username string, timestamp string) (*models.SavedShowsSnapshot, error) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) DownloadSavedEpisodes(accessToken string) (episodes []models.SpSavedEpisode, err *models.SpAPIError) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) SaveSavedEpisodesSnapshot(s *models.SavedEpisodesSnapshot) (saved bool) {
+	return true
+}
+
+func (ups *UserPlaylistTestService) GetSavedEpisodesSnapshotByTimestamp(username string, timestamp string) (*models.SavedEpisodesSnapshot, error) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) GetAllSavedEpisodesSnapshots(username string) []models.SavedEpisodesSnapshot {
+	return nil
+}
+
+func (ups *UserPlaylistTestService) DeleteSavedEpisodesSnapshot(username string, timestamp string) (*models.SavedEpisodesSnapshot, error) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) DownloadTopItems(accessToken string) (topItems models.TopItems, err *models.SpAPIError) {
+	return models.TopItems{}, nil
+}
+
+func (ups *UserPlaylistTestService) SaveTopItemsSnapshot(s *models.TopItemsSnapshot) (saved bool) {
+	return true
+}
+
+func (ups *UserPlaylistTestService) GetTopItemsSnapshotByTimestamp(username string, timestamp string) (*models.TopItemsSnapshot, error) {
+	return nil, nil
+}
+
+func (ups *UserPlaylistTestService) GetAllTopItemsSnapshots(username string) []models.TopItemsSnapshot {
+	return nil
+}
+
+func (ups *UserPlaylistTestService) DeleteTopItemsSnapshot(username string, timestamp string) (*models.TopItemsSnapshot, error) {
+	return nil, nil
+}
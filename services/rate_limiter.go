@@ -0,0 +1,51 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is shared by all requests towards Spotify API, so concurrent downloads
+// don't end up exceeding the API rate limits
+type rateLimiter struct {
+	mutex        sync.Mutex
+	interval     time.Duration
+	nextSlot     time.Time
+	blockedUntil time.Time
+}
+
+func newRateLimiter(requestsPerSecond int) *rateLimiter {
+	if requestsPerSecond < 1 {
+		requestsPerSecond = 1
+	}
+	return &rateLimiter{
+		interval: time.Second / time.Duration(requestsPerSecond),
+	}
+}
+
+// Wait blocks until the next request is allowed to be made
+func (rl *rateLimiter) Wait() {
+	rl.mutex.Lock()
+	now := time.Now()
+	slot := rl.nextSlot
+	if slot.Before(now) {
+		slot = now
+	}
+	if slot.Before(rl.blockedUntil) {
+		slot = rl.blockedUntil
+	}
+	rl.nextSlot = slot.Add(rl.interval)
+	rl.mutex.Unlock()
+
+	time.Sleep(time.Until(slot))
+}
+
+// BlockFor stops all the requests for a given duration, e.g. after Spotify API responds with 429 and Retry-After
+func (rl *rateLimiter) BlockFor(d time.Duration) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	until := time.Now().Add(d)
+	if until.After(rl.blockedUntil) {
+		rl.blockedUntil = until
+	}
+}
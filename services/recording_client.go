@@ -0,0 +1,259 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/config"
+)
+
+const scrubbedValue = "scrubbed"
+
+// only these response headers matter to spotilizer, others are not stored in fixtures
+var recordedHeaders = []string{"Content-Type", "ETag", "Retry-After"}
+
+// tokens in Spotify Accounts responses must never end up in fixture files, whatever the scrubbed fields config is
+var tokenFields = []string{"access_token", "refresh_token"}
+
+// form fields of Spotify Accounts requests which differ on each login, left out of the fixture keys,
+// so token requests are replayed for any code or refresh token
+var volatileFormFields = []string{"code", "code_verifier", "refresh_token"}
+
+var fixtureNameRegex = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// httpFixture is a recorded Spotify request and response pair
+type httpFixture struct {
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	StatusCode int               `json:"status_code"`
+	Header     map[string]string `json:"header,omitempty"`
+	Body       string            `json:"body"`
+	RecordedAt time.Time         `json:"recorded_at"`
+}
+
+// recordingHTTPClient passes requests to the wrapped client, and stores each response as a fixture file
+type recordingHTTPClient struct {
+	client httpClient
+	dir    string
+	// matches string values of the tokens and scrubbed fields, e.g. "email": "..."
+	scrubRegex *regexp.Regexp
+}
+
+// newRecordingHTTPClient creates a client recording responses to dir, with tokens and given personal data
+// fields scrubbed
+func newRecordingHTTPClient(client httpClient, dir string, scrubbedFields []string) (*recordingHTTPClient, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	fields := []string{}
+	for _, f := range append(tokenFields, scrubbedFields...) {
+		fields = append(fields, regexp.QuoteMeta(f))
+	}
+	scrubRegex := regexp.MustCompile(`"(` + strings.Join(fields, "|") + `)"(\s*):(\s*)"(?:[^"\\]|\\.)*"`)
+	return &recordingHTTPClient{client: client, dir: dir, scrubRegex: scrubRegex}, nil
+}
+
+func (c *recordingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	bodyKey, err := fixtureBodyKey(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// 304 has no body to replay, the fixture of the full response is kept instead
+	if resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+
+	fixture := &httpFixture{
+		Method:     req.Method,
+		URL:        fixtureURL(req.URL),
+		StatusCode: resp.StatusCode,
+		Header:     make(map[string]string),
+		Body:       c.scrubRegex.ReplaceAllString(string(body), `"$1"$2:$3"`+scrubbedValue+`"`),
+		RecordedAt: time.Now(),
+	}
+	for _, h := range recordedHeaders {
+		if v := resp.Header.Get(h); len(v) > 0 {
+			fixture.Header[h] = v
+		}
+	}
+	if err := c.save(fixture, bodyKey); err != nil {
+		log.Printf(" >>> failed to record fixture [%s %s]: %s\n", fixture.Method, fixture.URL, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (c *recordingHTTPClient) save(fixture *httpFixture, bodyKey string) error {
+	fixtureJSON, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temp file first, so concurrent requests never leave a partially written fixture
+	tmpFile, err := ioutil.TempFile(c.dir, "fixture.*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(fixtureJSON)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), fixtureFilePath(c.dir, fixture.Method, fixture.URL, bodyKey))
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	log.Tracef(" > recorded fixture [%s %s]", fixture.Method, fixture.URL)
+	return nil
+}
+
+// replayHTTPClient serves the responses recorded by recordingHTTPClient, without calling Spotify at all
+type replayHTTPClient struct {
+	dir string
+}
+
+func newReplayHTTPClient(dir string) (*replayHTTPClient, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("fixtures path [%s] is not a directory", dir)
+	}
+	return &replayHTTPClient{dir: dir}, nil
+}
+
+func (c *replayHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	reqURL := fixtureURL(req.URL)
+	bodyKey, err := fixtureBodyKey(req)
+	if err != nil {
+		return nil, err
+	}
+	fixtureJSON, err := ioutil.ReadFile(fixtureFilePath(c.dir, req.Method, reqURL, bodyKey))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no recorded fixture for [%s %s]", req.Method, reqURL)
+		}
+		return nil, err
+	}
+
+	fixture := &httpFixture{}
+	if err := json.Unmarshal(fixtureJSON, fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture for [%s %s]: %s", req.Method, reqURL, err.Error())
+	}
+
+	resp := &http.Response{
+		StatusCode: fixture.StatusCode,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(bytes.NewBufferString(fixture.Body)),
+		Request:    req,
+	}
+	for h, v := range fixture.Header {
+		resp.Header.Set(h, v)
+	}
+
+	etag := fixture.Header["ETag"]
+	if len(etag) > 0 && req.Header.Get("If-None-Match") == etag {
+		resp.StatusCode = http.StatusNotModified
+		resp.Body = ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	return resp, nil
+}
+
+// fixtureURL leaves the host out, so fixtures recorded against Spotify can be replayed against any base URL
+func fixtureURL(u *url.URL) string {
+	if len(u.RawQuery) == 0 {
+		return u.Path
+	}
+	// query params are sorted by Encode
+	return u.Path + "?" + u.Query().Encode()
+}
+
+// fixtureBodyKey reads the request body, leaving it readable for the request, and returns it the way it is
+// hashed into the fixture key, so e.g. adding different tracks to the same playlist gets different fixtures
+func fixtureBodyKey(req *http.Request) (string, error) {
+	if req.Body == nil {
+		return "", nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if req.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for _, f := range volatileFormFields {
+				form.Del(f)
+			}
+			// form fields are sorted by Encode
+			return form.Encode(), nil
+		}
+	}
+	return string(body), nil
+}
+
+// fixtureFilePath gives readable file names, e.g. GET_v1_me_playlists_<hash>.json
+func fixtureFilePath(dir string, method string, fixtureURL string, bodyKey string) string {
+	keySource := method + " " + fixtureURL
+	if len(bodyKey) > 0 {
+		keySource += "\n" + bodyKey
+	}
+	hash := sha1.Sum([]byte(keySource))
+	u, _ := url.Parse(fixtureURL)
+	name := method
+	if u != nil {
+		name = name + "_" + strings.Trim(fixtureNameRegex.ReplaceAllString(u.Path, "_"), "_")
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s_%s.json", name, hex.EncodeToString(hash[:])[:10]))
+}
+
+// RecordSpotifyResponses makes all the requests to Spotify being recorded as fixture files in given dir
+func RecordSpotifyResponses(dir string) error {
+	recordingClient, err := newRecordingHTTPClient(reqClient.httpClient, dir, config.Conf.FixtureScrubbedFields)
+	if err != nil {
+		return err
+	}
+	reqClient.httpClient = recordingClient
+	log.Infof(" > recording Spotify responses to [%s]", dir)
+	return nil
+}
+
+// ReplaySpotifyResponses makes all the requests to Spotify being served from fixture files in given dir
+func ReplaySpotifyResponses(dir string) error {
+	replayClient, err := newReplayHTTPClient(dir)
+	if err != nil {
+		return err
+	}
+	reqClient.httpClient = replayClient
+	log.Infof(" > replaying Spotify responses from [%s]", dir)
+	return nil
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fixturesHTTPClientMock struct{}
+
+func (c fixturesHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	if req.Method == "POST" && req.URL.Path == "/v1/playlists/playlist-1/tracks" {
+		body, _ := ioutil.ReadAll(req.Body)
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"added": ` + string(body) + `}`)),
+			StatusCode: 201,
+		}, nil
+	}
+	if req.Method == "POST" {
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"access_token": "secret-access", "token_type": "Bearer", "refresh_token":"secret-refresh", "expires_in": 3600}`)),
+			StatusCode: 200,
+		}, nil
+	}
+	if req.URL.Path == "/v1/me" {
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"id": "user-1", "display_name": "Secret \"Name\"", "email" : "secret@mail.com"}`)),
+			StatusCode: 200,
+		}, nil
+	}
+	header := make(http.Header)
+	header.Set("ETag", `"v1"`)
+	header.Set("X-Unimportant", "yes")
+	return &http.Response{
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"items": [], "offset": ` + req.URL.Query().Get("offset") + `}`)),
+		StatusCode: 200,
+	}, nil
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spotilizer-fixtures")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recordingClient, err := newRecordingHTTPClient(&fixturesHTTPClientMock{}, dir, []string{"email", "display_name"})
+	require.NoError(t, err)
+
+	tokenReq, _ := http.NewRequest("POST", "https://accounts.spotify.com/api/token", strings.NewReader(url.Values{"code": {"abc"}, "grant_type": {"authorization_code"}}.Encode()))
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := recordingClient.Do(tokenReq)
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "secret-access", "recording must not change responses")
+
+	// query params order does not matter
+	apiReq, _ := http.NewRequest("GET", "https://api.spotify.com/v1/me/tracks?offset=50&limit=50", nil)
+	apiReq.Header.Set("Authorization", "Bearer secret-access")
+	_, err = recordingClient.Do(apiReq)
+	require.NoError(t, err)
+
+	meReq, _ := http.NewRequest("GET", "https://api.spotify.com/v1/me", nil)
+	_, err = recordingClient.Do(meReq)
+	require.NoError(t, err)
+
+	// same request with different bodies are different fixtures
+	for _, tracks := range []string{`["track-1"]`, `["track-2"]`} {
+		addReq, _ := http.NewRequest("POST", "https://api.spotify.com/v1/playlists/playlist-1/tracks", strings.NewReader(tracks))
+		addReq.Header.Set("Content-Type", "application/json")
+		resp, err = recordingClient.Do(addReq)
+		require.NoError(t, err)
+		body, _ = ioutil.ReadAll(resp.Body)
+		assert.Equal(t, `{"added": `+tracks+`}`, string(body), "request body must reach the wrapped client")
+	}
+
+	fixtureFiles, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 5, len(fixtureFiles))
+	for _, f := range fixtureFiles {
+		fixtureJSON, _ := ioutil.ReadFile(dir + "/" + f.Name())
+		assert.NotContains(t, string(fixtureJSON), "secret", "tokens and personal data must be scrubbed from fixtures")
+		assert.NotContains(t, string(fixtureJSON), "X-Unimportant")
+	}
+
+	replayClient, err := newReplayHTTPClient(dir)
+	require.NoError(t, err)
+
+	replayReq, _ := http.NewRequest("GET", "http://localhost:8090/v1/me/tracks?limit=50&offset=50", nil)
+	resp, err = replayClient.Do(replayReq)
+	require.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, `{"items": [], "offset": 50}`, string(body))
+	assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+
+	replayReq.Header.Set("If-None-Match", `"v1"`)
+	resp, err = replayClient.Do(replayReq)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// token requests are replayed for any code
+	tokenReq, _ = http.NewRequest("POST", "http://localhost:8090/api/token", strings.NewReader(url.Values{"code": {"xyz"}, "grant_type": {"authorization_code"}}.Encode()))
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err = replayClient.Do(tokenReq)
+	require.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `"access_token": "scrubbed"`)
+
+	meReq, _ = http.NewRequest("GET", "http://localhost:8090/v1/me", nil)
+	resp, err = replayClient.Do(meReq)
+	require.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(t, `{"id": "user-1", "display_name": "scrubbed", "email" : "scrubbed"}`, string(body))
+
+	addReq, _ := http.NewRequest("POST", "http://localhost:8090/v1/playlists/playlist-1/tracks", strings.NewReader(`["track-2"]`))
+	resp, err = replayClient.Do(addReq)
+	require.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(t, `{"added": ["track-2"]}`, string(body))
+
+	missingReq, _ := http.NewRequest("GET", "http://localhost:8090/v1/me/tracks?offset=100", nil)
+	_, err = replayClient.Do(missingReq)
+	assert.Error(t, err)
+}
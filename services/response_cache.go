@@ -0,0 +1,123 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/config"
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// responseCache sits under getFromSpotify, and serves Spotify API responses from the cache while they are fresh,
+// otherwise revalidates them using ETag and If-None-Match headers
+type responseCache struct {
+	storage  db.ResponseCacheClient
+	policies []config.CachePolicy
+	owners   tokenOwners
+}
+
+// tokenOwners tells which user an access token belongs to, so user's responses are cached per user,
+// and stay cached when the access token is refreshed
+type tokenOwners interface {
+	TokenOwner(accessToken string) (username string, found bool)
+}
+
+func newResponseCache(storage db.ResponseCacheClient, policies []config.CachePolicy, owners tokenOwners) *responseCache {
+	return &responseCache{
+		storage:  storage,
+		policies: policies,
+		owners:   owners,
+	}
+}
+
+// newResponseCacheStorage creates the response cache storage of given type ("memory", "redis" or "disk")
+func newResponseCacheStorage(cacheType string, maxEntries int, dir string) (db.ResponseCacheClient, error) {
+	switch cacheType {
+	case "memory":
+		return db.NewResponseCacheMemoryClient(maxEntries), nil
+	case "redis":
+		return db.NewResponseCacheRedisClient(), nil
+	case "disk":
+		return db.NewResponseCacheDiskClient(dir)
+	default:
+		return nil, fmt.Errorf("unknown response cache type [%s]", cacheType)
+	}
+}
+
+// lookup returns the cached response for a given request, and tells if it can be used without asking Spotify API
+func (c *responseCache) lookup(reqURL string, accessToken string) (key string, cached *models.CachedResponse, fresh bool) {
+	if c == nil {
+		return "", nil, false
+	}
+	key, ok := c.cacheKey(reqURL, accessToken)
+	if !ok {
+		return "", nil, false
+	}
+	cached = c.storage.GetResponse(key)
+	if cached == nil {
+		return key, nil, false
+	}
+	return key, cached, cached.Fresh()
+}
+
+// store caches a successful response, if it can be revalidated later or has a TTL
+func (c *responseCache) store(key string, reqURL string, etag string, body []byte) {
+	if c == nil || len(key) == 0 {
+		return
+	}
+	ttl := c.getPolicy(reqURL).TTL
+	if len(etag) == 0 && ttl == 0 {
+		return
+	}
+	now := time.Now()
+	cached := &models.CachedResponse{URL: reqURL, ETag: etag, Body: body, StoredAt: now, ExpiresAt: now.Add(ttl)}
+	if !c.storage.SaveResponse(key, cached) {
+		log.Debugf(" >>> response from [%s] not cached", reqURL)
+	}
+}
+
+// revalidated extends the lifetime of the cached response, after Spotify API confirmed it did not change
+func (c *responseCache) revalidated(key string, reqURL string, cached *models.CachedResponse) {
+	if c == nil {
+		return
+	}
+	c.store(key, reqURL, cached.ETag, cached.Body)
+}
+
+func (c *responseCache) getPolicy(reqURL string) config.CachePolicy {
+	path := reqURL
+	if u, err := url.Parse(reqURL); err == nil {
+		path = u.Path
+	}
+	for _, p := range c.policies {
+		if strings.HasPrefix(path, p.PathPrefix) {
+			return p
+		}
+	}
+	return config.CachePolicy{}
+}
+
+// cacheKey is a hash of request URL, also containing the username for responses which depend on the user.
+// Responses of unknown users are not cached.
+func (c *responseCache) cacheKey(reqURL string, accessToken string) (key string, ok bool) {
+	keySource := reqURL
+	if !c.getPolicy(reqURL).Shared {
+		if c.owners == nil {
+			return "", false
+		}
+		username, found := c.owners.TokenOwner(accessToken)
+		if !found {
+			return "", false
+		}
+		keySource += "::" + username
+	}
+	hash := sha1.Sum([]byte(keySource))
+	return hex.EncodeToString(hash[:]), true
+}
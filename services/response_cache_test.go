@@ -0,0 +1,84 @@
+package services
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/config"
+	"github.com/2beens/spotilizer/db"
+)
+
+// etagHTTPClientMock responds with 304 when If-None-Match matches the ETag of the resource
+type etagHTTPClientMock struct {
+	requests      int
+	revalidations int
+}
+
+func (c *etagHTTPClientMock) Do(req *http.Request) (*http.Response, error) {
+	c.requests++
+	if req.Header.Get("If-None-Match") == `"etag-1"` {
+		c.revalidations++
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+			StatusCode: http.StatusNotModified,
+			Header:     http.Header{"Etag": []string{`"etag-1"`}},
+		}, nil
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"id": "resource-1"}`)),
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Etag": []string{`"etag-1"`}},
+	}, nil
+}
+
+// tokenOwnersMock maps access tokens to usernames
+type tokenOwnersMock map[string]string
+
+func (o tokenOwnersMock) TokenOwner(accessToken string) (string, bool) {
+	username, found := o[accessToken]
+	return username, found
+}
+
+func TestGetFromSpotifyResponseCache(t *testing.T) {
+	clientMock := &etagHTTPClientMock{}
+	policies := []config.CachePolicy{{PathPrefix: "/v1/albums", TTL: time.Hour, Shared: true}}
+	owners := tokenOwnersMock{accessToken: "user", "refreshed-token": "user", "other-user-token": "other-user"}
+	reqClient = requestClient{
+		httpClient:            clientMock,
+		requestTimeoutSeconds: 1,
+		responseCache:         newResponseCache(db.NewResponseCacheMemoryClient(10), policies, owners),
+	}
+	defer func() { reqClient.responseCache = nil }()
+
+	// no TTL for this endpoint, so the response is always revalidated
+	for i := 0; i < 3; i++ {
+		body, err := getFromSpotify("http://test", "/v1/me/tracks", accessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"id": "resource-1"}`, string(body))
+	}
+	assert.Equal(t, 3, clientMock.requests)
+	assert.Equal(t, 2, clientMock.revalidations)
+
+	// user's responses are cached per user, not per access token, so they survive token refreshes
+	clientMock.revalidations = 0
+	for _, token := range []string{"refreshed-token", "other-user-token", "unknown-token", "unknown-token"} {
+		body, err := getFromSpotify("http://test", "/v1/me/tracks", token)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"id": "resource-1"}`, string(body))
+	}
+	assert.Equal(t, 1, clientMock.revalidations, "only the user's response must be revalidated, others and unknown users' are not cached")
+
+	// albums are served from the cache without asking the API, even to other users
+	clientMock.requests = 0
+	for _, token := range []string{accessToken, "other-user-token"} {
+		body, err := getFromSpotify("http://test", "/v1/albums/album-1", token)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"id": "resource-1"}`, string(body))
+	}
+	assert.Equal(t, 1, clientMock.requests)
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"github.com/2beens/spotilizer/models"
+)
+
+// spotilizer features needing OAuth scopes, on top of the ones requested at login
+const (
+	FeatureSaveTracks          = "save_tracks"
+	FeatureSavePlaylists       = "save_playlists"
+	FeatureSaveFollowedArtists = "save_followed_artists"
+	FeatureSaveAlbums          = "save_albums"
+	FeatureSaveShows           = "save_shows"
+	FeatureSaveEpisodes        = "save_episodes"
+	FeaturePlayHistory         = "play_history"
+	FeatureSaveTopItems        = "save_top_items"
+	FeatureRestoreTracks       = "restore_tracks"
+	FeatureRestorePlaylists    = "restore_playlists"
+	FeatureEditPlaylists       = "edit_playlists"
+)
+
+// scopeRegistry holds all the OAuth scopes spotilizer may ask for, more info:
+// https://developer.spotify.com/documentation/general/guides/scopes/
+var scopeRegistry = map[string]string{
+	"user-read-private":           "Read your subscription details",
+	"user-read-email":             "Read your email address",
+	"user-library-read":           "Read your saved tracks and albums",
+	"user-library-modify":         "Save and remove tracks and albums in your library",
+	"playlist-read-private":       "Read your private playlists",
+	"playlist-read-collaborative": "Read collaborative playlists",
+	"playlist-modify-public":      "Create and change your public playlists",
+	"playlist-modify-private":     "Create and change your private playlists",
+	"user-follow-read":            "Read artists and users you follow",
+	"user-top-read":               "Read your top artists and tracks",
+	"user-read-recently-played":   "Read your recently played tracks",
+	"user-read-playback-position": "Read your position in shows and episodes",
+}
+
+// featureScopes lists the scopes needed by each feature
+var featureScopes = map[string][]string{
+	FeatureSaveTracks:          {"user-library-read"},
+	FeatureSavePlaylists:       {"playlist-read-private", "playlist-read-collaborative"},
+	FeatureSaveFollowedArtists: {"user-follow-read"},
+	FeatureSaveAlbums:          {"user-library-read"},
+	FeatureSaveShows:           {"user-library-read"},
+	// saved episodes endpoint needs the playback position scope as well
+	FeatureSaveEpisodes: {"user-library-read", "user-read-playback-position"},
+	FeaturePlayHistory:  {"user-read-recently-played"},
+	FeatureSaveTopItems: {"user-top-read"},
+	// tracks are checked against the current saved tracks before they are restored
+	FeatureRestoreTracks: {"user-library-read", "user-library-modify"},
+	// playlists are rolled back by comparing the snapshot to the current tracks, which may be private
+	FeatureRestorePlaylists: {"playlist-read-private", "playlist-read-collaborative", "playlist-modify-public", "playlist-modify-private"},
+	// playlists are deduplicated or merged from their current tracks
+	FeatureEditPlaylists: {"playlist-read-private", "playlist-read-collaborative", "playlist-modify-public", "playlist-modify-private"},
+}
+
+// IsKnownScope tells if scope is in the scope registry
+func IsKnownScope(scope string) bool {
+	_, known := scopeRegistry[scope]
+	return known
+}
+
+// ScopeDescription describes what given scope allows spotilizer to do
+func ScopeDescription(scope string) string {
+	return scopeRegistry[scope]
+}
+
+// FeatureScopes returns the scopes needed by given feature
+func FeatureScopes(feature string) []string {
+	return featureScopes[feature]
+}
+
+// MissingFeatureScopes returns the scopes the user has to grant before using given feature
+func MissingFeatureScopes(user *models.User, feature string) []string {
+	return user.MissingScopes(featureScopes[feature])
+}
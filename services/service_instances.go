@@ -3,12 +3,50 @@ package services
 // TODO: this just somehow does not seem the best way to do it - keeping an instances of services here
 // 		 gotta think about this a bit later
 
-import "github.com/2beens/spotilizer/db"
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/config"
+	"github.com/2beens/spotilizer/db"
+)
 
 var Users *UserService
 var UserPlaylist UserPlaylistService
+var Auth *SpotifyAuthService
+var PlayHistory *PlayHistoryService
+var AudioFeatures *AudioFeaturesService
+var Artists *ArtistsService
+var Library *LibraryService
+var WriteBack *WriteBackService
+var SnapshotQuery *SnapshotQueryService
+var SnapshotScheduler *SnapshotSchedulerService
+
+func InitServices(clientID string, clientSecret string) {
+	SetupServices(NewUserService(db.GetCookiesDBClient(), db.GetUsersDBClient()), db.GetSpotifyDBClient(), clientID, clientSecret)
+}
+
+// SetupServices creates service instances using given storage clients, e.g. in-memory ones for testing
+func SetupServices(users *UserService, spotifyDB db.SpotifyDBClient, clientID string, clientSecret string) {
+	Users = users
+	UserPlaylist = NewSpotifyUserPlaylistService(spotifyDB)
+	Auth = NewSpotifyAuthService(clientID, clientSecret, Users)
+	PlayHistory = NewPlayHistoryService(spotifyDB, Users)
+	AudioFeatures = NewAudioFeaturesService(spotifyDB)
+	Artists = NewArtistsService(spotifyDB)
+	Library = NewLibraryService(UserPlaylist)
+	WriteBack = NewWriteBackService(spotifyDB, Library.WriteBackOperators())
+	SnapshotQuery = NewSnapshotQueryService(UserPlaylist)
+	SnapshotScheduler = NewSnapshotSchedulerService(spotifyDB, Users, SnapshotTakers(UserPlaylist), config.Conf.ScheduleMaxJitter)
+	// expired access tokens are refreshed automatically when Spotify API responds with 401
+	reqClient.tokenRefresher = Auth
+	reqClient.rateLimiter = newRateLimiter(config.Conf.SpotifyAPIRequestsPerSecond)
 
-func InitServices() {
-	Users = NewUserService(db.GetCookiesDBClient(), db.GetUsersDBClient())
-	UserPlaylist = NewSpotifyUserPlaylistService(db.GetSpotifyDBClient())
+	if len(config.Conf.ResponseCacheType) > 0 {
+		cacheStorage, err := newResponseCacheStorage(config.Conf.ResponseCacheType, config.Conf.ResponseCacheMaxEntries, config.Conf.ResponseCacheDir)
+		if err != nil {
+			log.Fatalf(" >>> failed to create Spotify API response cache: %s", err.Error())
+		}
+		reqClient.responseCache = newResponseCache(cacheStorage, config.Conf.ResponseCachePolicies, Auth)
+		log.Debugf(" > Spotify API response cache [%s] enabled", config.Conf.ResponseCacheType)
+	}
 }
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+const queryDateLayout = "2006-01-02"
+
+// SnapshotQueryService selects tracks from the history of user's snapshots, to preview them, or to create a playlist
+type SnapshotQueryService struct {
+	srvPlaylists UserPlaylistService
+}
+
+func NewSnapshotQueryService(srvPlaylists UserPlaylistService) *SnapshotQueryService {
+	return &SnapshotQueryService{
+		srvPlaylists: srvPlaylists,
+	}
+}
+
+// historySnapshot is a favorite tracks or playlists snapshot, with the tracks the query is about
+type historySnapshot struct {
+	timestamp time.Time
+	tracks    []models.SpPlaylistTrack
+}
+
+// selectedTrack is a track selected by the query, along with the timestamp of the latest queried snapshot with it
+type selectedTrack struct {
+	track    models.SpPlaylistTrack
+	lastSeen time.Time
+}
+
+// ParseSnapshotQuery reads the query from request params: source, playlist, in, since, until, not_in, added_since and
+// added_until. Times are dates (2006-01-02), unix timestamps, or days before now (90d).
+func ParseSnapshotQuery(params url.Values, now time.Time) (models.SnapshotQuery, error) {
+	query := models.SnapshotQuery{
+		Source:     params.Get("source"),
+		PlaylistID: params.Get("playlist"),
+		In:         params.Get("in"),
+		NotIn:      params.Get("not_in"),
+	}
+	if len(query.Source) == 0 {
+		query.Source = models.QuerySourceFavTracks
+	}
+	if query.Source != models.QuerySourceFavTracks && query.Source != models.QuerySourcePlaylists {
+		return query, fmt.Errorf("invalid source [%s], expected fav_tracks or playlists", query.Source)
+	}
+	if len(query.PlaylistID) > 0 && query.Source != models.QuerySourcePlaylists {
+		return query, fmt.Errorf("playlist can be queried only in playlists snapshots")
+	}
+	if len(query.In) == 0 {
+		query.In = models.QuerySnapshotAny
+	}
+	if query.In != models.QuerySnapshotAny && !isSnapshotRef(query.In) {
+		return query, fmt.Errorf("invalid in [%s], expected snapshot timestamp, latest or any", query.In)
+	}
+	if len(query.NotIn) > 0 && !isSnapshotRef(query.NotIn) {
+		return query, fmt.Errorf("invalid not_in [%s], expected snapshot timestamp or latest", query.NotIn)
+	}
+
+	times := []struct {
+		param string
+		value **time.Time
+	}{
+		{"since", &query.Since},
+		{"until", &query.Until},
+		{"added_since", &query.AddedSince},
+		{"added_until", &query.AddedUntil},
+	}
+	for _, t := range times {
+		value, err := parseQueryTime(params.Get(t.param), now)
+		if err != nil {
+			return query, fmt.Errorf("invalid %s: %s", t.param, err.Error())
+		}
+		*t.value = value
+	}
+	if (query.Since != nil || query.Until != nil) && query.In != models.QuerySnapshotAny {
+		return query, fmt.Errorf("since and until can be used only with any snapshot")
+	}
+	return query, nil
+}
+
+// Run returns the tracks selected by the query
+func (sqs *SnapshotQueryService) Run(username string, query models.SnapshotQuery) (*models.SnapshotQueryResult, *models.SpAPIError) {
+	selected, apiErr := sqs.selectTracks(username, query)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	result := &models.SnapshotQueryResult{
+		Query:       query,
+		Description: DescribeSnapshotQuery(query),
+		Tracks:      []models.QueryTrack{},
+	}
+	for _, s := range selected {
+		track := models.QueryTrack{
+			URI:      trackURI(s.track),
+			Name:     s.track.Track.Name,
+			Artists:  []string{},
+			Album:    s.track.Track.Album.Name,
+			AddedAt:  s.track.AddedAt,
+			LastSeen: s.lastSeen,
+			IsLocal:  isLocalTrack(s.track),
+		}
+		for _, a := range s.track.Track.Artists {
+			track.Artists = append(track.Artists, a.Name)
+		}
+		result.Tracks = append(result.Tracks, track)
+	}
+	return result, nil
+}
+
+// PlanPlaylist plans creating a new playlist with given name, and the tracks selected by the query
+func (sqs *SnapshotQueryService) PlanPlaylist(username string, query models.SnapshotQuery, name string) (*models.WriteBackPlan, *models.SpAPIError) {
+	selected, apiErr := sqs.selectTracks(username, query)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	snapshot := models.PlaylistSnapshot{Playlist: models.SpPlaylist{Name: name, Description: DescribeSnapshotQuery(query)}}
+	for _, s := range selected {
+		snapshot.Tracks = append(snapshot.Tracks, s.track)
+	}
+	plan := planPlaylistRecreate(snapshot)
+	plan.Kind = models.WriteBackQueryPlaylist
+	return plan, nil
+}
+
+// selectTracks returns the tracks of the snapshots the query is about, each track once, in the order they were added
+func (sqs *SnapshotQueryService) selectTracks(username string, query models.SnapshotQuery) ([]selectedTrack, *models.SpAPIError) {
+	snapshots := sqs.history(username, query)
+	if len(snapshots) == 0 {
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 404, Message: "No snapshots to query"}}
+	}
+
+	var in []historySnapshot
+	if query.In == models.QuerySnapshotAny {
+		// the latest snapshot taken before since is the library at since, so tracks removed after since but before
+		// the next snapshot are selected as well
+		var since time.Time
+		if query.Since != nil {
+			since = *query.Since
+			for _, s := range snapshots {
+				if s.timestamp.After(*query.Since) {
+					break
+				}
+				since = s.timestamp
+			}
+		}
+		for _, s := range snapshots {
+			if s.timestamp.Before(since) {
+				continue
+			}
+			if query.Until != nil && !s.timestamp.Before(*query.Until) {
+				continue
+			}
+			in = append(in, s)
+		}
+	} else {
+		s, apiErr := findHistorySnapshot(snapshots, query.In)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		in = append(in, *s)
+	}
+
+	notIn := make(map[string]bool)
+	if len(query.NotIn) > 0 {
+		s, apiErr := findHistorySnapshot(snapshots, query.NotIn)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		for _, t := range s.tracks {
+			notIn[trackURI(t)] = true
+		}
+	}
+
+	var selected []selectedTrack
+	selectedIndexes := make(map[string]int)
+	for _, s := range in {
+		for _, t := range s.tracks {
+			uri := trackURI(t)
+			if notIn[uri] {
+				continue
+			}
+			if query.AddedSince != nil && t.AddedAt.Before(*query.AddedSince) {
+				continue
+			}
+			if query.AddedUntil != nil && !t.AddedAt.Before(*query.AddedUntil) {
+				continue
+			}
+			if i, found := selectedIndexes[uri]; found {
+				selected[i].lastSeen = s.timestamp
+				continue
+			}
+			selectedIndexes[uri] = len(selected)
+			selected = append(selected, selectedTrack{track: t, lastSeen: s.timestamp})
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].track.AddedAt.Before(selected[j].track.AddedAt)
+	})
+	return selected, nil
+}
+
+// history returns user's snapshots of the query source, oldest first. Playlists with tracks missing in the snapshot
+// are left out.
+func (sqs *SnapshotQueryService) history(username string, query models.SnapshotQuery) []historySnapshot {
+	var snapshots []historySnapshot
+	if query.Source == models.QuerySourceFavTracks {
+		for _, ft := range sqs.srvPlaylists.GetAllFavTracksSnapshots(username) {
+			s := historySnapshot{timestamp: ft.Timestamp}
+			for _, t := range ft.Tracks {
+				s.tracks = append(s.tracks, models.SpPlaylistTrack{AddedAt: t.AddedAt, IsLocal: t.Track.IsLocal, Track: t.Track})
+			}
+			snapshots = append(snapshots, s)
+		}
+	} else {
+		for _, ps := range sqs.srvPlaylists.GetAllPlaylistsSnapshots(username) {
+			s := historySnapshot{timestamp: ps.Timestamp}
+			for _, pl := range ps.Playlists {
+				if pl.DownloadFailed || (len(query.PlaylistID) > 0 && pl.Playlist.ID != query.PlaylistID) {
+					continue
+				}
+				s.tracks = append(s.tracks, pl.Tracks...)
+			}
+			snapshots = append(snapshots, s)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].timestamp.Before(snapshots[j].timestamp)
+	})
+	return snapshots
+}
+
+// findHistorySnapshot finds the snapshot by its reference: snapshot timestamp, or latest
+func findHistorySnapshot(snapshots []historySnapshot, ref string) (*historySnapshot, *models.SpAPIError) {
+	if ref == models.QuerySnapshotLatest {
+		return &snapshots[len(snapshots)-1], nil
+	}
+	for i := range snapshots {
+		if strconv.FormatInt(snapshots[i].timestamp.Unix(), 10) == ref {
+			return &snapshots[i], nil
+		}
+	}
+	return nil, &models.SpAPIError{Error: models.SpError{Status: 404, Message: fmt.Sprintf("Snapshot [%s] not found", ref)}}
+}
+
+// DescribeSnapshotQuery tells in words which tracks the query selects
+func DescribeSnapshotQuery(query models.SnapshotQuery) string {
+	description := "Favorite tracks"
+	if query.Source == models.QuerySourcePlaylists {
+		description = "Playlist tracks"
+		if len(query.PlaylistID) > 0 {
+			description = fmt.Sprintf("Tracks of playlist [%s]", query.PlaylistID)
+		}
+	}
+
+	description += " in " + describeSnapshotRef(query.In)
+	if query.Since != nil {
+		description += " since " + query.Since.Format(queryDateLayout)
+	}
+	if query.Until != nil {
+		description += " until " + query.Until.Format(queryDateLayout)
+	}
+	if len(query.NotIn) > 0 {
+		description += ", not in " + describeSnapshotRef(query.NotIn)
+	}
+	if query.AddedSince != nil || query.AddedUntil != nil {
+		description += ", added"
+		if query.AddedSince != nil {
+			description += " since " + query.AddedSince.Format(queryDateLayout)
+		}
+		if query.AddedUntil != nil {
+			description += " until " + query.AddedUntil.Format(queryDateLayout)
+		}
+	}
+	return description
+}
+
+func describeSnapshotRef(ref string) string {
+	switch ref {
+	case models.QuerySnapshotAny:
+		return "any snapshot"
+	case models.QuerySnapshotLatest:
+		return "the latest snapshot"
+	}
+	unix, _ := strconv.ParseInt(ref, 10, 64)
+	return "the snapshot of " + time.Unix(unix, 0).UTC().Format(time.RFC822)
+}
+
+func isSnapshotRef(ref string) bool {
+	if ref == models.QuerySnapshotLatest {
+		return true
+	}
+	_, err := strconv.ParseInt(ref, 10, 64)
+	return err == nil
+}
+
+// parseQueryTime parses a date (2006-01-02), unix timestamp, or days before now (90d), nil if the value is empty
+func parseQueryTime(value string, now time.Time) (*time.Time, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && days >= 0 {
+			t := now.AddDate(0, 0, -days)
+			return &t, nil
+		}
+	}
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		t := time.Unix(unix, 0)
+		return &t, nil
+	}
+	if t, err := time.Parse(queryDateLayout, value); err == nil {
+		return &t, nil
+	}
+	return nil, fmt.Errorf("[%s] is not a date (2006-01-02), unix timestamp, or days ago (90d)", value)
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+var queryTestNow = time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func queryTestFavTrack(id string, addedAt time.Time) models.SpAddedTrack {
+	return models.SpAddedTrack{AddedAt: addedAt, Track: models.SpTrack{ID: id, URI: "spotify:track:" + id, Name: "name-" + id}}
+}
+
+// newQueryTestService stores the fav. tracks snapshots: liked a (2019), b (2019) and c (2020) in January, unliked b in
+// February, and unliked a in the latest snapshot
+func newQueryTestService(t *testing.T) *SnapshotQueryService {
+	ups := NewSpotifyUserPlaylistService(db.NewSpotifyDBTest())
+	a := queryTestFavTrack("a", time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC))
+	b := queryTestFavTrack("b", time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC))
+	c := queryTestFavTrack("c", time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC))
+	snapshots := []models.FavTracksSnapshot{
+		{Username: "user", Timestamp: time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC), Tracks: []models.SpAddedTrack{c, b, a}},
+		{Username: "user", Timestamp: time.Date(2020, 2, 15, 0, 0, 0, 0, time.UTC), Tracks: []models.SpAddedTrack{c, a}},
+		{Username: "user", Timestamp: time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC), Tracks: []models.SpAddedTrack{c}},
+	}
+	for i := range snapshots {
+		if !assert.True(t, ups.SaveFavTracksSnapshot(&snapshots[i])) {
+			t.FailNow()
+		}
+	}
+	return NewSnapshotQueryService(ups)
+}
+
+func queryTestURIs(result *models.SnapshotQueryResult) []string {
+	uris := []string{}
+	for _, t := range result.Tracks {
+		uris = append(uris, t.URI)
+	}
+	return uris
+}
+
+func TestSnapshotQuery(t *testing.T) {
+	sqs := newQueryTestService(t)
+	january := fmt.Sprint(time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC).Unix())
+	february := fmt.Sprint(time.Date(2020, 2, 15, 0, 0, 0, 0, time.UTC).Unix())
+
+	cases := []struct {
+		params   string
+		expected []string
+	}{
+		{params: "", expected: []string{"spotify:track:a", "spotify:track:b", "spotify:track:c"}},
+		// unliked in the last 20 days: b was unliked after the January snapshot, which is the library 20 days ago
+		{params: "since=20d&not_in=latest", expected: []string{"spotify:track:a", "spotify:track:b"}},
+		// a was unliked after the February snapshot, i.e. maybe after since
+		{params: "since=2020-02-20&not_in=latest", expected: []string{"spotify:track:a"}},
+		{params: "since=2020-02-15&not_in=latest", expected: []string{"spotify:track:a"}},
+		{params: "since=2020-02-28", expected: []string{"spotify:track:c"}},
+		// unliked ever
+		{params: "not_in=latest", expected: []string{"spotify:track:a", "spotify:track:b"}},
+		// in one snapshot, but not in the other
+		{params: "in=" + january + "&not_in=" + february, expected: []string{"spotify:track:b"}},
+		{params: "in=" + february + "&not_in=" + january, expected: []string{}},
+		// liked in 2019, no longer liked
+		{params: "added_since=2019-01-01&added_until=2020-01-01&not_in=latest", expected: []string{"spotify:track:a", "spotify:track:b"}},
+		{params: "in=latest&added_since=2020-01-01", expected: []string{"spotify:track:c"}},
+		{params: "until=2020-02-01", expected: []string{"spotify:track:a", "spotify:track:b", "spotify:track:c"}},
+	}
+	for _, c := range cases {
+		params, _ := url.ParseQuery(c.params)
+		query, err := ParseSnapshotQuery(params, queryTestNow)
+		if !assert.NoError(t, err, c.params) {
+			continue
+		}
+		result, apiErr := sqs.Run("user", query)
+		if assert.Nil(t, apiErr, c.params) {
+			assert.Equal(t, c.expected, queryTestURIs(result), c.params)
+		}
+	}
+
+	params, _ := url.ParseQuery("not_in=latest")
+	query, _ := ParseSnapshotQuery(params, queryTestNow)
+	result, _ := sqs.Run("user", query)
+	assert.Equal(t, time.Date(2020, 2, 15, 0, 0, 0, 0, time.UTC), result.Tracks[0].LastSeen, "a was last seen in February")
+	assert.Equal(t, "Favorite tracks in any snapshot, not in the latest snapshot", result.Description)
+
+	query.NotIn = "12345"
+	_, apiErr := sqs.Run("user", query)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, models.SpError{Status: 404, Message: "Snapshot [12345] not found"}, apiErr.Error)
+	}
+	_, apiErr = sqs.Run("other-user", query)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, "No snapshots to query", apiErr.Error.Message)
+	}
+}
+
+func TestSnapshotQueryPlanPlaylist(t *testing.T) {
+	sqs := newQueryTestService(t)
+	params, _ := url.ParseQuery("added_since=2019-01-01&added_until=2020-01-01&not_in=latest")
+	query, _ := ParseSnapshotQuery(params, queryTestNow)
+
+	plan, apiErr := sqs.PlanPlaylist("user", query, "liked in 2019")
+	if !assert.Nil(t, apiErr) {
+		t.FailNow()
+	}
+	assert.Equal(t, models.WriteBackQueryPlaylist, plan.Kind)
+	if assert.Equal(t, 2, len(plan.Operations)) {
+		assert.Equal(t, "liked in 2019", plan.Operations[0].Name)
+		assert.Equal(t, "Favorite tracks in any snapshot, not in the latest snapshot, added since 2019-01-01 until 2020-01-01", plan.Operations[0].Description)
+		assert.Equal(t, []string{"spotify:track:a", "spotify:track:b"}, plan.Operations[1].After)
+	}
+}
+
+func TestParseSnapshotQuery(t *testing.T) {
+	params, _ := url.ParseQuery("source=playlists&playlist=pl-1&since=90d&until=1577836800&added_since=2019-01-01")
+	query, err := ParseSnapshotQuery(params, queryTestNow)
+	if assert.NoError(t, err) {
+		assert.Equal(t, models.QuerySourcePlaylists, query.Source)
+		assert.Equal(t, "pl-1", query.PlaylistID)
+		assert.Equal(t, models.QuerySnapshotAny, query.In)
+		assert.Equal(t, queryTestNow.AddDate(0, 0, -90), *query.Since)
+		assert.Equal(t, int64(1577836800), query.Until.Unix())
+		assert.Equal(t, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), *query.AddedSince)
+		assert.Nil(t, query.AddedUntil)
+	}
+
+	invalid := []string{
+		"source=albums",
+		"playlist=pl-1",
+		"in=yesterday",
+		"not_in=any",
+		"since=last-year",
+		"in=latest&since=90d",
+	}
+	for _, p := range invalid {
+		params, _ := url.ParseQuery(p)
+		_, err := ParseSnapshotQuery(params, queryTestNow)
+		assert.Error(t, err, p)
+	}
+}
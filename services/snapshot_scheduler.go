@@ -0,0 +1,217 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// SnapshotTaker takes and saves a snapshot of user's library, of a single kind
+type SnapshotTaker func(user *models.User) *models.SpAPIError
+
+// each playlists snapshot stores the tracks of all user's playlists, even of the unchanged ones, so they can be
+// scheduled at most daily, not to fill the DB
+const playlistsScheduleMaxRunsPerDay = 1
+
+// ScheduledSnapshotFeatures are the features, and so the scopes, needed to take scheduled snapshots, by snapshot kind
+var ScheduledSnapshotFeatures = map[string]string{
+	models.ScheduledFavTracks: FeatureSaveTracks,
+	models.ScheduledPlaylists: FeatureSavePlaylists,
+}
+
+// SnapshotSchedulerService takes users' snapshots automatically, by the schedules they configured. Schedules are
+// stored along with their next run, so they survive restarts; schedules missed while the server was down run at the
+// first check after it starts. Each run is delayed by a random jitter, up to maxJitter, to spread the load of users
+// with the same schedule.
+type SnapshotSchedulerService struct {
+	db        db.SnapshotScheduleDBClient
+	users     *UserService
+	takers    map[string]SnapshotTaker
+	maxJitter time.Duration
+	// mutex guards storing schedules, so a schedule changed by its user while running is not overwritten
+	mutex sync.Mutex
+}
+
+func NewSnapshotSchedulerService(db db.SnapshotScheduleDBClient, users *UserService, takers map[string]SnapshotTaker, maxJitter time.Duration) *SnapshotSchedulerService {
+	return &SnapshotSchedulerService{
+		db:        db,
+		users:     users,
+		takers:    takers,
+		maxJitter: maxJitter,
+	}
+}
+
+// Schedule creates user's snapshot schedule, replacing the existing one. Frequency is hourly, daily, weekly, or cron,
+// with the cron expression given. The first snapshots are taken at the next time of the schedule. Playlists snapshots
+// cannot be scheduled more often than daily.
+func (sss *SnapshotSchedulerService) Schedule(username string, frequency string, cronExpr string, snapshots []string) (*models.SnapshotSchedule, *models.SpAPIError) {
+	if frequency != models.ScheduleCron {
+		preset, found := cronPresets[frequency]
+		if !found {
+			errMsg := fmt.Sprintf("Invalid frequency [%s], expected hourly, daily, weekly or cron", frequency)
+			return nil, &models.SpAPIError{Error: models.SpError{Status: 400, Message: errMsg}}
+		}
+		cronExpr = preset
+	}
+	if len(snapshots) == 0 {
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 400, Message: "No snapshots to schedule"}}
+	}
+	scheduled := make(map[string]bool)
+	for _, kind := range snapshots {
+		if _, found := sss.takers[kind]; !found {
+			errMsg := fmt.Sprintf("Invalid snapshots [%s], expected fav_tracks or playlists", kind)
+			return nil, &models.SpAPIError{Error: models.SpError{Status: 400, Message: errMsg}}
+		}
+		if scheduled[kind] {
+			errMsg := fmt.Sprintf("Snapshots [%s] scheduled more than once", kind)
+			return nil, &models.SpAPIError{Error: models.SpError{Status: 400, Message: errMsg}}
+		}
+		scheduled[kind] = true
+	}
+	if cron, err := parseCron(cronExpr); err == nil && scheduled[models.ScheduledPlaylists] && cron.runsPerDay() > playlistsScheduleMaxRunsPerDay {
+		errMsg := fmt.Sprintf("Playlists snapshots can be scheduled at most daily, [%s] runs %d times a day", cronExpr, cron.runsPerDay())
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 400, Message: errMsg}}
+	}
+
+	now := time.Now()
+	nextRun, err := sss.nextRun(cronExpr, now)
+	if err != nil {
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 400, Message: err.Error()}}
+	}
+	schedule := &models.SnapshotSchedule{
+		Username:  username,
+		Snapshots: snapshots,
+		Frequency: frequency,
+		Cron:      cronExpr,
+		CreatedAt: now,
+		NextRun:   nextRun,
+	}
+
+	sss.mutex.Lock()
+	defer sss.mutex.Unlock()
+	if !sss.db.SaveSnapshotSchedule(schedule) {
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: "Snapshot schedule not saved. Server internal error."}}
+	}
+	log.Debugf(" > user [%s] snapshots %v scheduled [%s], next run [%v]", username, snapshots, cronExpr, nextRun)
+	return schedule, nil
+}
+
+// Unschedule removes user's snapshot schedule, the snapshots already taken are kept
+func (sss *SnapshotSchedulerService) Unschedule(username string) *models.SpAPIError {
+	sss.mutex.Lock()
+	defer sss.mutex.Unlock()
+	if sss.db.GetSnapshotSchedule(username) == nil {
+		return &models.SpAPIError{Error: models.SpError{Status: 404, Message: "No snapshots scheduled"}}
+	}
+	if err := sss.db.DeleteSnapshotSchedule(username); err != nil {
+		errMsg := fmt.Sprintf(" >>> error removing snapshot schedule for user [%s]: %s", username, err.Error())
+		return &models.SpAPIError{Error: models.SpError{Status: 500, Message: errMsg}}
+	}
+	return nil
+}
+
+// GetSchedule returns user's snapshot schedule, with its last and next run, nil if the user has none
+func (sss *SnapshotSchedulerService) GetSchedule(username string) *models.SnapshotSchedule {
+	return sss.db.GetSnapshotSchedule(username)
+}
+
+// RunDue runs all schedules with the next run due at given time
+func (sss *SnapshotSchedulerService) RunDue(now time.Time) {
+	for _, schedule := range sss.db.GetAllSnapshotSchedules() {
+		if schedule.NextRun.After(now) {
+			continue
+		}
+		sss.run(schedule, now)
+	}
+}
+
+// run takes the scheduled snapshots, and stores the schedule with its last run, last error and next run. Users who
+// need to login again, or have not granted the needed scopes, are skipped until the next run, with the last error
+// telling them why.
+func (sss *SnapshotSchedulerService) run(schedule models.SnapshotSchedule, now time.Time) {
+	var errs []string
+	user, err := sss.users.Get(schedule.Username)
+	switch {
+	case err != nil || user.CurrentAuth() == nil:
+		errs = append(errs, "user not found")
+	case user.ReloginRequired():
+		errs = append(errs, "Spotify authorization revoked, please login again")
+	default:
+		for _, kind := range schedule.Snapshots {
+			if missing := MissingFeatureScopes(user, ScheduledSnapshotFeatures[kind]); len(missing) > 0 {
+				errs = append(errs, fmt.Sprintf("%s: missing Spotify permissions: %s", kind, strings.Join(missing, ", ")))
+				continue
+			}
+			if apiErr := sss.takers[kind](user); apiErr != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", kind, apiErr.Error.Message))
+			}
+		}
+	}
+
+	schedule.LastRun = &now
+	schedule.LastError = strings.Join(errs, "; ")
+	nextRun, nextErr := sss.nextRun(schedule.Cron, now)
+	if nextErr != nil {
+		// not expected, the cron expression is checked when scheduled; the schedule is postponed not to run each check
+		log.Warnf(" >>> snapshot scheduler: user [%s] schedule: %s", schedule.Username, nextErr.Error())
+		nextRun = now.Add(cronSearchLimit)
+	}
+	schedule.NextRun = nextRun
+	if len(errs) > 0 {
+		log.Warnf(" >>> snapshot scheduler: user [%s] snapshots failed: %s", schedule.Username, schedule.LastError)
+	} else {
+		log.Debugf(" > snapshot scheduler: user [%s] snapshots %v taken, next run [%v]", schedule.Username, schedule.Snapshots, nextRun)
+	}
+
+	sss.mutex.Lock()
+	defer sss.mutex.Unlock()
+	if stored := sss.db.GetSnapshotSchedule(schedule.Username); stored == nil || !stored.CreatedAt.Equal(schedule.CreatedAt) {
+		log.Debugf(" > snapshot scheduler: user [%s] schedule changed while running, not saved", schedule.Username)
+		return
+	}
+	sss.db.SaveSnapshotSchedule(&schedule)
+}
+
+// nextRun returns the next time of the cron expression after given time, in UTC, delayed by a random jitter. The
+// jitter is at most half of the time until the following run, so frequent schedules never run late or twice in a row.
+func (sss *SnapshotSchedulerService) nextRun(cronExpr string, after time.Time) (time.Time, error) {
+	cron, err := parseCron(cronExpr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next, found := cron.next(after.UTC())
+	if !found {
+		return time.Time{}, fmt.Errorf("cron expression [%s] matches no time in the next 5 years", cronExpr)
+	}
+	maxJitter := sss.maxJitter
+	if following, found := cron.next(next); found && following.Sub(next)/2 < maxJitter {
+		maxJitter = following.Sub(next) / 2
+	}
+	if maxJitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(maxJitter))))
+	}
+	return next, nil
+}
+
+// RunScheduler periodically runs the schedules due
+func (sss *SnapshotSchedulerService) RunScheduler(checkInterval time.Duration, stopChan <-chan struct{}) {
+	log.Debugf(" > snapshot scheduler started, check interval [%v]", checkInterval)
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopChan:
+			log.Debug(" > snapshot scheduler stopped")
+			return
+		case <-ticker.C:
+			sss.RunDue(time.Now())
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// schedulerTestTakers count the snapshots taken by kind, and fail while the kind is in failing
+type schedulerTestTakers struct {
+	taken   map[string]int
+	failing map[string]bool
+}
+
+func (s *schedulerTestTakers) takers() map[string]SnapshotTaker {
+	takers := make(map[string]SnapshotTaker)
+	for _, kind := range []string{models.ScheduledFavTracks, models.ScheduledPlaylists} {
+		kind := kind
+		takers[kind] = func(user *models.User) *models.SpAPIError {
+			if s.failing[kind] {
+				return &models.SpAPIError{Error: models.SpError{Status: 502, Message: "failed " + kind}}
+			}
+			s.taken[kind]++
+			return nil
+		}
+	}
+	return takers
+}
+
+func newSchedulerTest(scope string, maxJitter time.Duration) (*SnapshotSchedulerService, *schedulerTestTakers, *models.User) {
+	users := NewUserServiceTest()
+	user := &models.User{Username: "user", Auth: &models.SpotifyAuthOptions{Scope: scope}}
+	users.Add(user)
+	takers := &schedulerTestTakers{taken: make(map[string]int), failing: make(map[string]bool)}
+	return NewSnapshotSchedulerService(db.NewSpotifyDBTest(), users, takers.takers(), maxJitter), takers, user
+}
+
+func TestSnapshotSchedulerSchedule(t *testing.T) {
+	sss, _, _ := newSchedulerTest("", 10*time.Minute)
+
+	schedule, apiErr := sss.Schedule("user", models.ScheduleDaily, "", []string{models.ScheduledFavTracks, models.ScheduledPlaylists})
+	if !assert.Nil(t, apiErr) {
+		t.FailNow()
+	}
+	assert.Equal(t, "0 0 * * *", schedule.Cron)
+	assert.Nil(t, schedule.LastRun)
+	midnight := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	assert.False(t, schedule.NextRun.Before(midnight), "next run must be at the next midnight, or later by the jitter")
+	assert.True(t, schedule.NextRun.Before(midnight.Add(10*time.Minute)), "jitter must not be longer than max jitter")
+	assert.Equal(t, schedule.Cron, sss.GetSchedule("user").Cron, "schedule must be stored")
+
+	schedule, apiErr = sss.Schedule("user", models.ScheduleCron, "30 6 * * 1-5", []string{models.ScheduledPlaylists})
+	if assert.Nil(t, apiErr) {
+		assert.Equal(t, []string{models.ScheduledPlaylists}, sss.GetSchedule("user").Snapshots, "schedule must be replaced")
+	}
+
+	// jitter of frequent schedules is at most half of the time between their runs
+	schedule, apiErr = sss.Schedule("user", models.ScheduleCron, "*/2 * * * *", []string{models.ScheduledFavTracks})
+	if assert.Nil(t, apiErr) {
+		scheduledAt := schedule.CreatedAt.UTC().Truncate(time.Minute)
+		assert.True(t, schedule.NextRun.Before(scheduledAt.Add(3*time.Minute)), "jitter must be capped by the schedule")
+	}
+
+	invalid := []struct {
+		frequency string
+		cron      string
+		snapshots []string
+	}{
+		{frequency: "monthly", snapshots: []string{models.ScheduledFavTracks}},
+		{frequency: models.ScheduleCron, cron: "every day", snapshots: []string{models.ScheduledFavTracks}},
+		{frequency: models.ScheduleCron, cron: "0 0 30 2 *", snapshots: []string{models.ScheduledFavTracks}},
+		{frequency: models.ScheduleDaily, snapshots: []string{}},
+		{frequency: models.ScheduleDaily, snapshots: []string{"albums"}},
+		{frequency: models.ScheduleDaily, snapshots: []string{models.ScheduledFavTracks, models.ScheduledFavTracks}},
+		// playlists snapshots are too big to be taken more often than daily
+		{frequency: models.ScheduleHourly, snapshots: []string{models.ScheduledFavTracks, models.ScheduledPlaylists}},
+		{frequency: models.ScheduleCron, cron: "0 6,18 * * *", snapshots: []string{models.ScheduledPlaylists}},
+	}
+	for _, c := range invalid {
+		_, apiErr := sss.Schedule("user", c.frequency, c.cron, c.snapshots)
+		if assert.NotNil(t, apiErr, "%s [%s] %v", c.frequency, c.cron, c.snapshots) {
+			assert.Equal(t, 400, apiErr.Error.Status)
+		}
+	}
+
+	assert.Nil(t, sss.Unschedule("user"))
+	assert.Nil(t, sss.GetSchedule("user"))
+	if apiErr := sss.Unschedule("user"); assert.NotNil(t, apiErr) {
+		assert.Equal(t, 404, apiErr.Error.Status)
+	}
+}
+
+func TestSnapshotSchedulerRunDue(t *testing.T) {
+	sss, takers, _ := newSchedulerTest("user-library-read playlist-read-private playlist-read-collaborative", 0)
+	if _, apiErr := sss.Schedule("user", models.ScheduleDaily, "", []string{models.ScheduledFavTracks, models.ScheduledPlaylists}); !assert.Nil(t, apiErr) {
+		t.FailNow()
+	}
+	nextRun := sss.GetSchedule("user").NextRun
+
+	sss.RunDue(nextRun.Add(-time.Second))
+	assert.Empty(t, takers.taken, "nothing must be taken before the next run")
+
+	sss.RunDue(nextRun)
+	assert.Equal(t, map[string]int{models.ScheduledFavTracks: 1, models.ScheduledPlaylists: 1}, takers.taken)
+	schedule := sss.GetSchedule("user")
+	if assert.NotNil(t, schedule.LastRun) {
+		assert.Equal(t, nextRun, *schedule.LastRun)
+	}
+	assert.Equal(t, nextRun.Add(24*time.Hour), schedule.NextRun)
+	assert.Empty(t, schedule.LastError)
+
+	// runs missed while the server was down are run once
+	takers.failing[models.ScheduledPlaylists] = true
+	late := nextRun.Add(5*24*time.Hour + 12*time.Hour)
+	sss.RunDue(late)
+	assert.Equal(t, 2, takers.taken[models.ScheduledFavTracks])
+	schedule = sss.GetSchedule("user")
+	assert.Equal(t, "playlists: failed playlists", schedule.LastError)
+	assert.Equal(t, nextRun.Add(6*24*time.Hour), schedule.NextRun)
+
+	delete(takers.failing, models.ScheduledPlaylists)
+	sss.RunDue(schedule.NextRun)
+	assert.Empty(t, sss.GetSchedule("user").LastError, "last error must be cleared by a successful run")
+}
+
+func TestSnapshotSchedulerRunDueAuthorization(t *testing.T) {
+	sss, takers, user := newSchedulerTest("user-library-read", 0)
+	if _, apiErr := sss.Schedule("user", models.ScheduleDaily, "", []string{models.ScheduledFavTracks, models.ScheduledPlaylists}); !assert.Nil(t, apiErr) {
+		t.FailNow()
+	}
+
+	nextRun := sss.GetSchedule("user").NextRun
+	sss.RunDue(nextRun)
+	assert.Equal(t, map[string]int{models.ScheduledFavTracks: 1}, takers.taken, "snapshots with scopes missing must be skipped")
+	schedule := sss.GetSchedule("user")
+	assert.Equal(t, "playlists: missing Spotify permissions: playlist-read-private, playlist-read-collaborative", schedule.LastError)
+
+	user.Auth.ReloginRequired = true
+	sss.RunDue(schedule.NextRun)
+	assert.Equal(t, 1, takers.taken[models.ScheduledFavTracks])
+	schedule = sss.GetSchedule("user")
+	assert.Equal(t, "Spotify authorization revoked, please login again", schedule.LastError)
+	assert.Equal(t, nextRun.Add(48*time.Hour), schedule.NextRun, "schedule must move on to the next run")
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/models"
+)
+
+// PlaylistsSnapshotResult is a saved playlists snapshot, along with the playlists reused from the previous snapshot,
+// and the ones with tracks which could not be downloaded
+type PlaylistsSnapshotResult struct {
+	Snapshot    *models.PlaylistsSnapshot
+	ReusedCount int
+	Failed      []PlaylistTracksResult
+}
+
+// TakeFavTracksSnapshot downloads user's saved tracks, and saves them as a new favorite tracks snapshot
+func TakeFavTracksSnapshot(srvPlaylists UserPlaylistService, user *models.User) (*models.FavTracksSnapshot, *models.SpAPIError) {
+	tracks, apiErr := srvPlaylists.DownloadSavedFavTracks(user.AccessToken())
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	log.Tracef(" > tracks count: %d", len(tracks))
+
+	snapshot := &models.FavTracksSnapshot{Username: user.Username, Timestamp: time.Now(), Tracks: tracks}
+	if !srvPlaylists.SaveFavTracksSnapshot(snapshot) {
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: "Favorite tracks not saved. Server internal error."}}
+	}
+	return snapshot, nil
+}
+
+// TakePlaylistsSnapshot downloads user's playlists, and saves them as a new playlists snapshot. Only the playlists
+// changed since the latest snapshot are downloaded, and the ones which failed to download are saved without tracks.
+func TakePlaylistsSnapshot(srvPlaylists UserPlaylistService, user *models.User) (*PlaylistsSnapshotResult, *models.SpAPIError) {
+	playlists, apiErr := srvPlaylists.DownloadCurrentUserPlaylists(user.AccessToken())
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	log.Tracef(" > playlists count: %d", len(playlists))
+
+	latestSnapshot := srvPlaylists.GetLatestPlaylistsSnapshot(user.Username)
+	result := &PlaylistsSnapshotResult{
+		Snapshot: &models.PlaylistsSnapshot{Username: user.Username, Timestamp: time.Now(), Playlists: []models.PlaylistSnapshot{}},
+		Failed:   []PlaylistTracksResult{},
+	}
+	for _, plResult := range srvPlaylists.DownloadChangedPlaylistsTracks(user.AccessToken(), playlists, latestSnapshot) {
+		plSnapshot := models.PlaylistSnapshot{
+			Playlist: plResult.Playlist,
+			Tracks:   plResult.Tracks,
+		}
+		if plResult.Reused {
+			result.ReusedCount++
+		}
+		if plResult.Err != nil {
+			log.Warnf(" >>> error while downloading tracks for playlist [%s]: %v", plResult.Playlist.Name, plResult.Err)
+			plSnapshot.Tracks = []models.SpPlaylistTrack{}
+			plSnapshot.DownloadFailed = true
+			result.Failed = append(result.Failed, plResult)
+		}
+		log.Tracef(" > got [%d] tracks for playlist [%s], reused [%t]", len(plSnapshot.Tracks), plResult.Playlist.Name, plResult.Reused)
+		result.Snapshot.Playlists = append(result.Snapshot.Playlists, plSnapshot)
+	}
+
+	if !srvPlaylists.SavePlaylistsSnapshot(result.Snapshot) {
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 500, Message: "Playlists not saved. Server internal error."}}
+	}
+	return result, nil
+}
+
+// SnapshotTakers take the snapshots of scheduled snapshots, by snapshot kind
+func SnapshotTakers(srvPlaylists UserPlaylistService) map[string]SnapshotTaker {
+	return map[string]SnapshotTaker{
+		models.ScheduledFavTracks: func(user *models.User) *models.SpAPIError {
+			_, apiErr := TakeFavTracksSnapshot(srvPlaylists, user)
+			return apiErr
+		},
+		models.ScheduledPlaylists: func(user *models.User) *models.SpAPIError {
+			result, apiErr := TakePlaylistsSnapshot(srvPlaylists, user)
+			if apiErr != nil {
+				return apiErr
+			}
+			// the snapshot is saved, but the user should know some of its playlists are missing tracks
+			if len(result.Failed) > 0 {
+				errMsg := fmt.Sprintf("tracks of %d playlists could not be downloaded", len(result.Failed))
+				return &models.SpAPIError{Error: models.SpError{Status: result.Failed[0].Err.Error.Status, Message: errMsg}}
+			}
+			return nil
+		},
+	}
+}
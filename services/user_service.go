@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 
@@ -14,9 +15,13 @@ import (
 	"github.com/2beens/spotilizer/models"
 )
 
+// UserService keeps users and their cookies in memory, backed by the users and cookies DB. The maps are guarded by
+// mutex, since background jobs (token refresher, play history collector, snapshot scheduler) read them while login
+// handlers change them.
 type UserService struct {
 	cookiesDB            db.CookiesDBClient
 	usersDB              db.UsersDBClient
+	mutex                sync.RWMutex
 	username2userMap     map[string]*models.User
 	cookieID2usernameMap map[string]string
 }
@@ -27,7 +32,6 @@ func NewUserService(cookiesDBClient db.CookiesDBClient, usersDB db.UsersDBClient
 	us.usersDB = usersDB
 
 	us.SyncWithDB()
-	us.cookieID2usernameMap = make(map[string]string)
 	us.cookieID2usernameMap = us.cookiesDB.GetCookiesInfo()
 	return us
 }
@@ -41,15 +45,21 @@ func NewUserServiceTest() *UserService {
 }
 
 func (us *UserService) AddUserCookie(cookieID string, username string) {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
 	us.cookieID2usernameMap[cookieID] = username
 }
 
 func (us *UserService) RemoveUserCookie(cookieID string) {
+	us.mutex.Lock()
 	delete(us.cookieID2usernameMap, cookieID)
+	us.mutex.Unlock()
 	log.Println(" > user cookie removed: " + cookieID)
 }
 
 func (us *UserService) GetCookieIDByUsername(username string) (string, error) {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
 	for c, un := range us.cookieID2usernameMap {
 		if un == username && len(c) > 0 {
 			return c, nil
@@ -62,50 +72,99 @@ func (us *UserService) GetCookieIDByUsername(username string) (string, error) {
 }
 
 func (us *UserService) GetUsernameByCookieID(cookieID string) (username string, found bool) {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
 	username, found = us.cookieID2usernameMap[cookieID]
 	return
 }
 
 func (us *UserService) GetUserByCookieID(cookieID string) (user *models.User, err error) {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
 	username, found := us.cookieID2usernameMap[cookieID]
-	if !found || !us.Exists(username) {
+	if found {
+		user, found = us.username2userMap[username]
+	}
+	if !found {
 		log.Printf(" >>> error, cannot find user by cookie ID: %s\n", cookieID)
 		return nil, errors.New("cannot find user by provided cookie ID")
 	}
-	user, _ = us.Get(username)
 	return user, nil
 }
 
+func (us *UserService) GetUserByAccessToken(accessToken string) (user *models.User, err error) {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
+	for _, u := range us.username2userMap {
+		if u.AccessToken() == accessToken {
+			return u, nil
+		}
+	}
+	return nil, errors.New("cannot find user by provided access token")
+}
+
+// GetActiveUsers returns users which are currently logged in, i.e. have a cookie assigned. The returned slice is
+// a copy, safe to iterate while users log in or out.
+func (us *UserService) GetActiveUsers() []*models.User {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
+	var activeUsers []*models.User
+	added := make(map[string]bool)
+	for _, username := range us.cookieID2usernameMap {
+		user, found := us.username2userMap[username]
+		if !found || added[username] {
+			continue
+		}
+		added[username] = true
+		activeUsers = append(activeUsers, user)
+	}
+	return activeUsers
+}
+
 func (us *UserService) SyncWithDB() {
-	us.username2userMap = make(map[string]*models.User)
+	username2userMap := make(map[string]*models.User)
 	// get all users from Redis
 	for _, u := range us.usersDB.GetAllUsers() {
 		user := u
-		us.username2userMap[u.Username] = &user
+		username2userMap[u.Username] = &user
 		log.Printf(" > found and added user: %s\n", u.Username)
 	}
+	us.mutex.Lock()
+	us.username2userMap = username2userMap
+	us.mutex.Unlock()
 }
 
 func (us *UserService) StoreCookiesToDB() {
-	us.cookiesDB.SaveCookiesInfo(us.cookieID2usernameMap)
+	us.mutex.RLock()
+	cookies := make(map[string]string, len(us.cookieID2usernameMap))
+	for cookieID, username := range us.cookieID2usernameMap {
+		cookies[cookieID] = username
+	}
+	us.mutex.RUnlock()
+	us.cookiesDB.SaveCookiesInfo(cookies)
 }
 
 func (us *UserService) Exists(username string) (found bool) {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
 	_, found = us.username2userMap[username]
 	return
 }
 
 func (us *UserService) Get(username string) (user *models.User, err error) {
-	if !us.Exists(username) {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
+	user, found := us.username2userMap[username]
+	if !found {
 		return nil, errors.New("cannot find user with provided ID")
 	}
-	user = us.username2userMap[username]
-	err = nil
-	return
+	return user, nil
 }
 
 func (us *UserService) Add(user *models.User) {
+	us.mutex.Lock()
 	us.username2userMap[user.Username] = user
+	us.mutex.Unlock()
 	us.usersDB.SaveUser(user)
 }
 
@@ -1,6 +1,8 @@
 package services_test
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
@@ -167,3 +169,33 @@ func TestUserServiceUsers(t *testing.T) {
 	}
 	log.Println(" > user4 not found, OK")
 }
+
+// background jobs iterate users while users log in, the maps must not be accessed concurrently without a lock
+func TestUserServiceConcurrentAccess(t *testing.T) {
+	userService := s.NewUserService(&cookiesDBClientMock{}, &usersDBClientMock{})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			username := fmt.Sprintf("user-%d", i)
+			userService.Add(&m.User{Username: username, Auth: &m.SpotifyAuthOptions{AccessToken: "token-" + username}})
+			userService.AddUserCookie("cookie-"+username, username)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			for _, user := range userService.GetActiveUsers() {
+				userService.Get(user.Username)
+			}
+			userService.GetUserByAccessToken("unknown-token")
+		}
+	}()
+	wg.Wait()
+
+	if len(userService.GetActiveUsers()) != 1002 {
+		failNow(t, " >>> all added users should be active")
+	}
+}
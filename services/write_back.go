@@ -0,0 +1,220 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// WriteBackOperator executes operations of a single type on user's Spotify account, and undoes them. Both may update
+// the plan state the next operations depend on, e.g. the playlist version. Operators of library operations report
+// the outcome of each track of the run by TrackResults, others leave it nil.
+// Requests which timed out are reported by 504 (Gateway Timeout) errors, as the operation may be applied or not. Before
+// such an operation is run again, Verify tells if it is applied, by the live state of the account. Operators which can
+// be safely run twice leave Verify nil.
+type WriteBackOperator struct {
+	Execute      func(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError
+	Undo         func(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError
+	Verify       func(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) (applied bool, err *models.SpAPIError)
+	TrackResults func(op *models.WriteBackOperation, undo bool, runErr *models.SpAPIError) []models.TrackRestoreResult
+}
+
+// WriteBackService stores plans of changes to user's Spotify account, and executes them once the user confirms them.
+// Each run of a plan is recorded with per-operation results, so a partially failed plan can be resumed, or undone.
+// Operations are executed by the operators registered for their types, so any part of the account can be written back.
+type WriteBackService struct {
+	db        db.WriteBackDBClient
+	operators map[string]WriteBackOperator
+
+	mutex sync.Mutex
+	// running plans, by plan ID, so the same plan is never run twice at the same time
+	running map[string]bool
+}
+
+func NewWriteBackService(db db.WriteBackDBClient, operators map[string]WriteBackOperator) *WriteBackService {
+	return &WriteBackService{
+		db:        db,
+		operators: operators,
+		running:   make(map[string]bool),
+	}
+}
+
+// CreatePlan stores a new user's plan, with all the operations pending, for the user to review it
+func (wbs *WriteBackService) CreatePlan(username string, plan *models.WriteBackPlan) error {
+	idBytes := make([]byte, 9)
+	if _, err := rand.Read(idBytes); err != nil {
+		return err
+	}
+	plan.ID = hex.EncodeToString(idBytes)
+	plan.Username = username
+	plan.CreatedAt = time.Now()
+	for i := range plan.Operations {
+		if _, found := wbs.operators[plan.Operations[i].Type]; !found {
+			return fmt.Errorf("unknown operation [%s]", plan.Operations[i].Type)
+		}
+		plan.Operations[i].Status = models.WriteBackStatusPending
+	}
+	plan.Status = models.WriteBackStatusPlanned
+	if plan.SkippedTracks == nil {
+		plan.SkippedTracks = []models.PlanTrack{}
+	}
+	plan.Executions = []models.WriteBackExecution{}
+	if !wbs.db.SaveWriteBackPlan(plan) {
+		return errors.New("failed to save plan")
+	}
+	log.Debugf(" > user [%s] write-back plan [%s] created: [%s], operations [%d]", username, plan.ID, plan.Kind, len(plan.Operations))
+	return nil
+}
+
+func (wbs *WriteBackService) GetPlan(username string, id string) *models.WriteBackPlan {
+	return wbs.db.GetWriteBackPlan(username, id)
+}
+
+func (wbs *WriteBackService) GetAllPlans(username string) []models.WriteBackPlan {
+	return wbs.db.GetAllWriteBackPlans(username)
+}
+
+// Execute runs the plan operations not done yet, in order, stopping at the first failing one. Executing a partially
+// executed plan again resumes it, starting with the failed operation, or with the one of unknown outcome, which is
+// verified first, so it is never applied twice.
+func (wbs *WriteBackService) Execute(accessToken string, username string, id string) (*models.WriteBackPlan, *models.SpAPIError) {
+	return wbs.run(accessToken, username, id, false)
+}
+
+// Undo reverts the done plan operations, in reverse order, stopping at the first failing one
+func (wbs *WriteBackService) Undo(accessToken string, username string, id string) (*models.WriteBackPlan, *models.SpAPIError) {
+	return wbs.run(accessToken, username, id, true)
+}
+
+func (wbs *WriteBackService) run(accessToken string, username string, id string, undo bool) (*models.WriteBackPlan, *models.SpAPIError) {
+	if !wbs.start(id) {
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 409, Message: "Plan is already running"}}
+	}
+	defer wbs.finish(id)
+
+	plan := wbs.db.GetWriteBackPlan(username, id)
+	if plan == nil {
+		return nil, &models.SpAPIError{Error: models.SpError{Status: 404, Message: "Plan not found"}}
+	}
+
+	var toRun []int
+	for i, op := range plan.Operations {
+		// an operation of unknown outcome is the last one run, so it comes first when undoing, and resuming
+		if undo && (op.Status == models.WriteBackStatusDone || op.Status == models.WriteBackStatusUnknown) {
+			toRun = append([]int{i}, toRun...)
+		} else if !undo && (op.Status == models.WriteBackStatusPending || op.Status == models.WriteBackStatusFailed || op.Status == models.WriteBackStatusUnknown) {
+			toRun = append(toRun, i)
+		}
+	}
+	if len(toRun) == 0 {
+		errMsg := "Nothing left to execute"
+		if undo {
+			errMsg = "Nothing to undo"
+		}
+		return plan, &models.SpAPIError{Error: models.SpError{Status: 400, Message: errMsg}}
+	}
+
+	// the record is saved after each operation, so it is never lost, even when the server stops during the run
+	plan.Executions = append(plan.Executions, models.WriteBackExecution{Undo: undo, StartedAt: time.Now(), Results: []models.WriteBackResult{}})
+	execution := &plan.Executions[len(plan.Executions)-1]
+	var runErr *models.SpAPIError
+	for _, i := range toRun {
+		op := &plan.Operations[i]
+		operator := wbs.operators[op.Type]
+		result := models.WriteBackResult{Operation: i, Status: models.WriteBackStatusDone}
+		if undo {
+			result.Status = models.WriteBackStatusUndone
+		}
+		if op.Status == models.WriteBackStatusUnknown && operator.Verify != nil {
+			var applied bool
+			applied, runErr = operator.Verify(accessToken, plan, op)
+			result.Verified = runErr == nil && applied != undo
+		}
+		switch {
+		case runErr != nil || result.Verified:
+		case undo:
+			runErr = operator.Undo(accessToken, plan, op)
+		default:
+			runErr = operator.Execute(accessToken, plan, op)
+		}
+
+		if runErr != nil {
+			log.Errorf(" >>> write-back plan [%s] operation [%d] failed: %s", plan.ID, i, runErr.Error.Message)
+			result.Status = models.WriteBackStatusFailed
+			result.Error = runErr.Error.Message
+			op.Error = runErr.Error.Message
+			switch {
+			case runErr.Error.Status == http.StatusGatewayTimeout:
+				result.Status = models.WriteBackStatusUnknown
+				op.Status = models.WriteBackStatusUnknown
+			// an operation failed to undo is still done, and one failed to verify is still of unknown outcome
+			case !undo && op.Status != models.WriteBackStatusUnknown:
+				op.Status = models.WriteBackStatusFailed
+			}
+		} else {
+			op.Status = result.Status
+			op.Error = ""
+		}
+		if operator.TrackResults != nil {
+			result.Tracks = operator.TrackResults(op, undo, runErr)
+		}
+		execution.Results = append(execution.Results, result)
+		execution.FinishedAt = time.Now()
+		plan.Status = writeBackPlanStatus(plan)
+		if !wbs.db.SaveWriteBackPlan(plan) {
+			log.Errorf(" >>> failed to save write-back plan [%s] after operation [%d]", plan.ID, i)
+		}
+		if runErr != nil {
+			break
+		}
+	}
+
+	log.Debugf(" > user [%s] write-back plan [%s] run (undo: %t), status [%s]", username, plan.ID, undo, plan.Status)
+	return plan, runErr
+}
+
+func (wbs *WriteBackService) start(id string) bool {
+	wbs.mutex.Lock()
+	defer wbs.mutex.Unlock()
+	if wbs.running[id] {
+		return false
+	}
+	wbs.running[id] = true
+	return true
+}
+
+func (wbs *WriteBackService) finish(id string) {
+	wbs.mutex.Lock()
+	defer wbs.mutex.Unlock()
+	delete(wbs.running, id)
+}
+
+// writeBackPlanStatus sums up the statuses of the plan operations
+func writeBackPlanStatus(plan *models.WriteBackPlan) string {
+	counts := make(map[string]int)
+	for _, op := range plan.Operations {
+		counts[op.Status]++
+	}
+	switch {
+	case counts[models.WriteBackStatusUndone] > 0 && counts[models.WriteBackStatusDone] == 0:
+		return models.WriteBackStatusUndone
+	case counts[models.WriteBackStatusUndone] > 0:
+		return models.WriteBackStatusPartiallyUndone
+	case counts[models.WriteBackStatusDone] > 0 && counts[models.WriteBackStatusDone] == len(plan.Operations):
+		return models.WriteBackStatusExecuted
+	case counts[models.WriteBackStatusDone] > 0:
+		return models.WriteBackStatusPartiallyExecuted
+	case counts[models.WriteBackStatusFailed] > 0 || counts[models.WriteBackStatusUnknown] > 0:
+		return models.WriteBackStatusFailed
+	}
+	return models.WriteBackStatusPlanned
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/2beens/spotilizer/db"
+	"github.com/2beens/spotilizer/models"
+)
+
+// writeBackTestAccount is changed by the test operators: "append" operations append their name to the account, and
+// fail while their name is in failing. Operations named in timingOut time out after they are applied, once.
+type writeBackTestAccount struct {
+	items     []string
+	failing   map[string]bool
+	timingOut map[string]bool
+}
+
+func (a *writeBackTestAccount) timeout(name string) *models.SpAPIError {
+	if !a.timingOut[name] {
+		return nil
+	}
+	delete(a.timingOut, name)
+	return &models.SpAPIError{Error: models.SpError{Status: 504, Message: "timeout occurred"}}
+}
+
+func (a *writeBackTestAccount) operators() map[string]WriteBackOperator {
+	return map[string]WriteBackOperator{
+		"append": {
+			Execute: func(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+				if a.failing[op.Name] {
+					return &models.SpAPIError{Error: models.SpError{Status: 502, Message: "failed " + op.Name}}
+				}
+				a.items = append(a.items, op.Name)
+				return a.timeout(op.Name)
+			},
+			Undo: func(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) *models.SpAPIError {
+				if a.items[len(a.items)-1] != op.Name {
+					return &models.SpAPIError{Error: models.SpError{Status: 409, Message: "undo out of order"}}
+				}
+				a.items = a.items[:len(a.items)-1]
+				return a.timeout(op.Name)
+			},
+			Verify: func(accessToken string, plan *models.WriteBackPlan, op *models.WriteBackOperation) (bool, *models.SpAPIError) {
+				return len(a.items) > 0 && a.items[len(a.items)-1] == op.Name, nil
+			},
+		},
+	}
+}
+
+func newWriteBackTestPlan(names ...string) *models.WriteBackPlan {
+	plan := &models.WriteBackPlan{Kind: "test"}
+	for _, name := range names {
+		plan.Operations = append(plan.Operations, models.WriteBackOperation{Type: "append", Name: name})
+	}
+	return plan
+}
+
+func TestWriteBackCreatePlan(t *testing.T) {
+	account := &writeBackTestAccount{}
+	wbs := NewWriteBackService(db.NewSpotifyDBTest(), account.operators())
+
+	plan := newWriteBackTestPlan("a", "b")
+	if !assert.Nil(t, wbs.CreatePlan("user", plan)) {
+		t.FailNow()
+	}
+	assert.NotEmpty(t, plan.ID)
+	assert.Equal(t, models.WriteBackStatusPlanned, plan.Status)
+
+	stored := wbs.GetPlan("user", plan.ID)
+	if assert.NotNil(t, stored) {
+		assert.Equal(t, models.WriteBackStatusPending, stored.Operations[1].Status)
+	}
+	assert.Nil(t, wbs.GetPlan("other-user", plan.ID), "plans are visible to their users only")
+	assert.Equal(t, 1, len(wbs.GetAllPlans("user")))
+	assert.Empty(t, account.items, "nothing must be changed before the plan is confirmed")
+
+	assert.NotNil(t, wbs.CreatePlan("user", &models.WriteBackPlan{Operations: []models.WriteBackOperation{{Type: "unknown"}}}))
+}
+
+func TestWriteBackExecuteResumeUndo(t *testing.T) {
+	account := &writeBackTestAccount{failing: map[string]bool{"c": true}}
+	wbs := NewWriteBackService(db.NewSpotifyDBTest(), account.operators())
+	plan := newWriteBackTestPlan("a", "b", "c", "d")
+	if !assert.Nil(t, wbs.CreatePlan("user", plan)) {
+		t.FailNow()
+	}
+
+	plan, apiErr := wbs.Execute("token", "user", plan.ID)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, 502, apiErr.Error.Status)
+	}
+	assert.Equal(t, []string{"a", "b"}, account.items)
+	assert.Equal(t, models.WriteBackStatusPartiallyExecuted, plan.Status)
+	assert.Equal(t, []models.WriteBackResult{
+		{Operation: 0, Status: models.WriteBackStatusDone},
+		{Operation: 1, Status: models.WriteBackStatusDone},
+		{Operation: 2, Status: models.WriteBackStatusFailed, Error: "failed c"},
+	}, plan.Executions[0].Results)
+	if stored := wbs.GetPlan("user", plan.ID); assert.NotNil(t, stored) {
+		assert.Equal(t, plan.Status, stored.Status)
+		assert.Equal(t, plan.Executions[0].Results, stored.Executions[0].Results, "execution record must be stored")
+	}
+
+	account.failing = nil
+	plan, apiErr = wbs.Execute("token", "user", plan.ID)
+	assert.Nil(t, apiErr)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, account.items)
+	assert.Equal(t, models.WriteBackStatusExecuted, plan.Status)
+	assert.Equal(t, 2, len(plan.Executions))
+	assert.Equal(t, 2, plan.Executions[1].Results[0].Operation, "resumed execution must start with the failed operation")
+	assert.Empty(t, plan.Operations[2].Error)
+
+	_, apiErr = wbs.Execute("token", "user", plan.ID)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, "Nothing left to execute", apiErr.Error.Message)
+	}
+
+	plan, apiErr = wbs.Undo("token", "user", plan.ID)
+	assert.Nil(t, apiErr)
+	assert.Empty(t, account.items)
+	assert.Equal(t, models.WriteBackStatusUndone, plan.Status)
+	assert.True(t, plan.Executions[2].Undo)
+	assert.Equal(t, 3, plan.Executions[2].Results[0].Operation, "undo must start with the last operation")
+
+	_, apiErr = wbs.Undo("token", "user", plan.ID)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, "Nothing to undo", apiErr.Error.Message)
+	}
+}
+
+func TestWriteBackUndoPartiallyExecuted(t *testing.T) {
+	account := &writeBackTestAccount{failing: map[string]bool{"b": true}}
+	wbs := NewWriteBackService(db.NewSpotifyDBTest(), account.operators())
+	plan := newWriteBackTestPlan("a", "b", "c")
+	if !assert.Nil(t, wbs.CreatePlan("user", plan)) {
+		t.FailNow()
+	}
+
+	plan, _ = wbs.Execute("token", "user", plan.ID)
+	// someone else changes the account meanwhile, so the undo fails
+	account.items = append(account.items, "x")
+	plan, apiErr := wbs.Undo("token", "user", plan.ID)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, 409, apiErr.Error.Status)
+	}
+	assert.Equal(t, models.WriteBackStatusPartiallyExecuted, plan.Status)
+	assert.Equal(t, models.WriteBackStatusDone, plan.Operations[0].Status, "operation failed to undo is still done")
+
+	account.items = account.items[:1]
+	plan, apiErr = wbs.Undo("token", "user", plan.ID)
+	assert.Nil(t, apiErr)
+	assert.Empty(t, account.items)
+	assert.Equal(t, models.WriteBackStatusUndone, plan.Status)
+}
+
+func TestWriteBackResumeTimedOut(t *testing.T) {
+	account := &writeBackTestAccount{timingOut: map[string]bool{"b": true}}
+	wbs := NewWriteBackService(db.NewSpotifyDBTest(), account.operators())
+	plan := newWriteBackTestPlan("a", "b", "c")
+	if !assert.Nil(t, wbs.CreatePlan("user", plan)) {
+		t.FailNow()
+	}
+
+	plan, apiErr := wbs.Execute("token", "user", plan.ID)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, 504, apiErr.Error.Status)
+	}
+	assert.Equal(t, models.WriteBackStatusUnknown, plan.Operations[1].Status)
+	assert.Equal(t, models.WriteBackResult{Operation: 1, Status: models.WriteBackStatusUnknown, Error: "timeout occurred"}, plan.Executions[0].Results[1])
+	assert.Equal(t, models.WriteBackStatusPartiallyExecuted, plan.Status)
+
+	// the timed out operation is applied, so resuming does not apply it again
+	plan, apiErr = wbs.Execute("token", "user", plan.ID)
+	assert.Nil(t, apiErr)
+	assert.Equal(t, []string{"a", "b", "c"}, account.items)
+	assert.Equal(t, []models.WriteBackResult{
+		{Operation: 1, Status: models.WriteBackStatusDone, Verified: true},
+		{Operation: 2, Status: models.WriteBackStatusDone},
+	}, plan.Executions[1].Results)
+
+	// undoing times out after the operation is undone, so undoing again does not undo it twice
+	account.timingOut = map[string]bool{"c": true}
+	plan, apiErr = wbs.Undo("token", "user", plan.ID)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, 504, apiErr.Error.Status)
+	}
+	assert.Equal(t, models.WriteBackStatusUnknown, plan.Operations[2].Status)
+	plan, apiErr = wbs.Undo("token", "user", plan.ID)
+	assert.Nil(t, apiErr)
+	assert.Empty(t, account.items)
+	assert.True(t, plan.Executions[3].Results[0].Verified)
+	assert.Equal(t, models.WriteBackStatusUndone, plan.Status)
+}
+
+func TestWriteBackUnknownPlan(t *testing.T) {
+	wbs := NewWriteBackService(db.NewSpotifyDBTest(), nil)
+	plan, apiErr := wbs.Execute("token", "user", "unknown")
+	assert.Nil(t, plan)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, 404, apiErr.Error.Status)
+	}
+}
@@ -63,7 +63,8 @@ func GetUsernameByRequestCookieID(r *http.Request) (username string, found bool)
 	return
 }
 
-func ReadSpotifyAuthData() (clientID string, clientSecret string, err error) {
+// ReadSpotifyAuthData reads Spotify app credentials from env. Client secret is not needed for PKCE login flow.
+func ReadSpotifyAuthData(secretRequired bool) (clientID string, clientSecret string, err error) {
 	clientID = os.Getenv("SPOTIFY_CLIENT_ID")
 	clientSecret = os.Getenv("SPOTIFY_CLIENT_SECRET")
 	log.Debug(" > client ID: " + clientID)
@@ -71,7 +72,7 @@ func ReadSpotifyAuthData() (clientID string, clientSecret string, err error) {
 	if clientID == "" {
 		return "", "", errors.New(" >>> error, client ID missing. set it using env [SPOTIFY_CLIENT_ID]")
 	}
-	if clientSecret == "" {
+	if clientSecret == "" && secretRequired {
 		return "", "", errors.New(" >>> error, client secret missing. set it using env [SPOTIFY_CLIENT_SECRET]")
 	}
 	return